@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -16,6 +17,7 @@ import (
 const (
 	AuditProviderUAPINSFW  = "uapis_nsfw"
 	AuditProviderTencentCI = "tencent_ci"
+	AuditProviderWebhook   = "webhook"
 )
 
 var ErrAuditProfileInUse = errors.New("audit profile in use")
@@ -150,11 +152,99 @@ func normalizeAuditProfileConfigs(provider string, configs map[string]interface{
 			"biz_type":        strings.TrimSpace(firstConfigString(configs, "biz_type", "bizType")),
 			"max_concurrency": maxConcurrency,
 		}, nil
+	case AuditProviderWebhook:
+		return normalizeWebhookAuditConfigs(configs, maxConcurrency)
 	default:
 		return nil, fmt.Errorf("不支持的审核服务提供商: %s", normalizedProvider)
 	}
 }
 
+// normalizeWebhookAuditConfigs 校验通用 Webhook 审核配置。
+// 响应字段使用点号路径（如 result.suggestion），决策值映射为逗号分隔的列表。
+func normalizeWebhookAuditConfigs(configs map[string]interface{}, maxConcurrency int) (map[string]interface{}, error) {
+	endpoint := strings.TrimSpace(firstConfigString(configs, "url", "endpoint"))
+	parsed, err := url.Parse(endpoint)
+	if endpoint == "" || err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("Webhook 审核配置需要填写有效的 http(s) 地址")
+	}
+	mode := strings.ToLower(strings.TrimSpace(firstConfigString(configs, "mode")))
+	if mode == "" {
+		mode = "multipart"
+	}
+	if mode != "multipart" && mode != "url" {
+		return nil, fmt.Errorf("Webhook 审核发送方式仅支持 multipart 或 url")
+	}
+	signatureHeader := strings.TrimSpace(firstConfigString(configs, "signature_header", "signatureHeader"))
+	if signatureHeader == "" {
+		signatureHeader = "X-Skyimage-Signature"
+	}
+	timeout := auditIntFromAny(configs["timeout_seconds"])
+	if timeout <= 0 {
+		timeout = auditIntFromAny(configs["timeoutSeconds"])
+	}
+	if timeout <= 0 {
+		timeout = 30
+	}
+	if timeout > 120 {
+		timeout = 120
+	}
+	decisionField := strings.TrimSpace(firstConfigString(configs, "decision_field", "decisionField"))
+	scoreField := strings.TrimSpace(firstConfigString(configs, "score_field", "scoreField"))
+	if decisionField == "" && scoreField == "" {
+		return nil, fmt.Errorf("Webhook 审核配置至少需要填写决策字段或分数字段")
+	}
+	// 阈值统一按 0-100 的百分制填写与保存，审核时再换算为 0-1 的分数
+	reviewThreshold := auditFloatFromAny(firstConfigValue(configs, "review_threshold", "reviewThreshold"))
+	blockThreshold := auditFloatFromAny(firstConfigValue(configs, "block_threshold", "blockThreshold"))
+	if reviewThreshold < 0 || reviewThreshold > 100 || blockThreshold < 0 || blockThreshold > 100 {
+		return nil, fmt.Errorf("Webhook 审核分数阈值需在 0-100 之间")
+	}
+	if reviewThreshold > 0 && blockThreshold > 0 && reviewThreshold > blockThreshold {
+		return nil, fmt.Errorf("Webhook 审核的复审阈值不能高于拦截阈值")
+	}
+	return map[string]interface{}{
+		"url":              endpoint,
+		"mode":             mode,
+		"secret":           strings.TrimSpace(firstConfigString(configs, "secret")),
+		"signature_header": signatureHeader,
+		"timeout_seconds":  timeout,
+		"decision_field":   decisionField,
+		"score_field":      scoreField,
+		"labels_field":     strings.TrimSpace(firstConfigString(configs, "labels_field", "labelsField")),
+		"message_field":    strings.TrimSpace(firstConfigString(configs, "message_field", "messageField")),
+		"pass_values":      normalizeConfigValueList(firstConfigValue(configs, "pass_values", "passValues"), "pass"),
+		"review_values":    normalizeConfigValueList(firstConfigValue(configs, "review_values", "reviewValues"), "review"),
+		"block_values":     normalizeConfigValueList(firstConfigValue(configs, "block_values", "blockValues"), "block"),
+		"review_threshold": reviewThreshold,
+		"block_threshold":  blockThreshold,
+		"max_concurrency":  maxConcurrency,
+	}, nil
+}
+
+func normalizeConfigValueList(value interface{}, fallback string) string {
+	var parts []string
+	switch v := value.(type) {
+	case string:
+		parts = strings.Split(v, ",")
+	case []interface{}:
+		for _, item := range v {
+			if text, ok := item.(string); ok {
+				parts = append(parts, text)
+			}
+		}
+	}
+	items := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if trimmed := strings.ToLower(strings.TrimSpace(part)); trimmed != "" {
+			items = append(items, trimmed)
+		}
+	}
+	if len(items) == 0 {
+		return fallback
+	}
+	return strings.Join(items, ",")
+}
+
 func (s *Service) findStrategiesUsingAuditProfile(ctx context.Context, profileID uint) ([]data.Strategy, error) {
 	var strategies []data.Strategy
 	if err := s.db.WithContext(ctx).Order("id ASC").Find(&strategies).Error; err != nil {
@@ -212,3 +302,30 @@ func auditIntFromAny(value interface{}) int {
 		return 0
 	}
 }
+
+func firstConfigValue(configs map[string]interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		if v, ok := configs[key]; ok && v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func auditFloatFromAny(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case string:
+		if parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return parsed
+		}
+		return 0
+	default:
+		return 0
+	}
+}
@@ -144,3 +144,106 @@ func TestCreateTencentCIProfile_RequiresCredentials(t *testing.T) {
 		t.Fatalf("expected error to mention SecretID, got %q", err.Error())
 	}
 }
+
+func TestCreateWebhookProfile_NormalizesConfigs(t *testing.T) {
+	db := setupAdminTestDB(t)
+	service := New(db)
+
+	profile, err := service.CreateAuditProfile(context.Background(), AuditProfilePayload{
+		Name:     "自建审核",
+		Provider: AuditProviderWebhook,
+		Configs: map[string]interface{}{
+			"url":            "https://audit.example.com/check",
+			"secret":         "s3cret",
+			"decision_field": "result.suggestion",
+			"block_values":   []interface{}{"Block", " deny "},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateAuditProfile failed: %v", err)
+	}
+
+	var configs map[string]interface{}
+	if err := json.Unmarshal(profile.Configs, &configs); err != nil {
+		t.Fatalf("failed to decode configs: %v", err)
+	}
+	if got := configs["mode"].(string); got != "multipart" {
+		t.Fatalf("expected mode to default to multipart, got %q", got)
+	}
+	if got := configs["signature_header"].(string); got != "X-Skyimage-Signature" {
+		t.Fatalf("expected default signature header, got %q", got)
+	}
+	if got := configs["block_values"].(string); got != "block,deny" {
+		t.Fatalf("expected normalized block values, got %q", got)
+	}
+	if got := configs["pass_values"].(string); got != "pass" {
+		t.Fatalf("expected default pass values, got %q", got)
+	}
+}
+
+func TestUpdateWebhookProfile_KeepsPercentThresholdsAcrossRoundTrips(t *testing.T) {
+	db := setupAdminTestDB(t)
+	service := New(db)
+	ctx := context.Background()
+
+	profile, err := service.CreateAuditProfile(ctx, AuditProfilePayload{
+		Name:     "自建审核",
+		Provider: AuditProviderWebhook,
+		Configs: map[string]interface{}{
+			"url":              "https://audit.example.com/check",
+			"score_field":      "nsfw",
+			"review_threshold": "1",
+			"block_threshold":  90,
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateAuditProfile failed: %v", err)
+	}
+	// 管理端读取配置后原样提交，阈值不能被重复换算
+	for i := 0; i < 2; i++ {
+		stored, err := service.FindAuditProfileByID(ctx, profile.ID)
+		if err != nil {
+			t.Fatalf("FindAuditProfileByID failed: %v", err)
+		}
+		var configs map[string]interface{}
+		if err := json.Unmarshal(stored.Configs, &configs); err != nil {
+			t.Fatalf("failed to decode configs: %v", err)
+		}
+		if configs["review_threshold"].(float64) != 1 || configs["block_threshold"].(float64) != 90 {
+			t.Fatalf("round trip %d: expected thresholds 1/90, got %v/%v", i, configs["review_threshold"], configs["block_threshold"])
+		}
+		if _, err := service.UpdateAuditProfile(ctx, profile.ID, AuditProfilePayload{
+			Name:     stored.Name,
+			Provider: stored.Provider,
+			Configs:  configs,
+		}); err != nil {
+			t.Fatalf("UpdateAuditProfile failed: %v", err)
+		}
+	}
+}
+
+func TestCreateWebhookProfile_ValidatesConfigs(t *testing.T) {
+	db := setupAdminTestDB(t)
+	service := New(db)
+
+	cases := map[string]map[string]interface{}{
+		"missing url":     {"decision_field": "decision"},
+		"invalid scheme":  {"url": "ftp://audit.example.com", "decision_field": "decision"},
+		"missing mapping": {"url": "https://audit.example.com"},
+		"invalid mode":    {"url": "https://audit.example.com", "decision_field": "decision", "mode": "base64"},
+		"threshold range": {"url": "https://audit.example.com", "score_field": "nsfw", "block_threshold": 150},
+		"threshold order": {"url": "https://audit.example.com", "score_field": "nsfw", "review_threshold": 80, "block_threshold": 60},
+	}
+	for name, configs := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := service.CreateAuditProfile(context.Background(), AuditProfilePayload{
+				Name:     "自建审核",
+				Provider: AuditProviderWebhook,
+				Configs:  configs,
+			})
+			if err == nil {
+				t.Fatal("expected invalid webhook config to be rejected")
+			}
+		})
+	}
+}
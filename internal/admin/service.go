@@ -443,6 +443,17 @@ func validateGroupConfigs(configs map[string]interface{}) error {
 		}
 	}
 
+	// Validate invite_quota
+	if raw, ok := configs["invite_quota"]; ok {
+		quota, err := asPositiveInt(raw)
+		if err != nil {
+			return fmt.Errorf("invite_quota 必须是数字")
+		}
+		if quota < 0 {
+			return fmt.Errorf("invite_quota 必须大于等于 0")
+		}
+	}
+
 	return nil
 }
 
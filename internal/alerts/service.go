@@ -0,0 +1,438 @@
+// Package alerts 把需要管理员关注的事件推送到即时通讯机器人（Telegram、钉钉、企业微信、Bark）
+// 或通用 JSON 地址。与 webhooks 不同，这里的推送只尽力投递一次，不落库也不重试。
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"skyimage/internal/webhooks"
+)
+
+const (
+	EventTicketCreated = "ticket.created"
+	EventTicketReplied = "ticket.replied"
+	EventOrderPaid     = "order.paid"
+	EventAuditBlocked  = "audit.blocked"
+	EventStorageError  = "storage.error"
+
+	ChannelTelegram = "telegram"
+	ChannelDingTalk = "dingtalk"
+	ChannelWeCom    = "wecom"
+	ChannelBark     = "bark"
+	ChannelJSON     = "json"
+
+	// Redacted 是读取配置时密钥字段的占位值，保存时传回该值表示保持不变
+	Redacted = "***"
+
+	defaultTelegramAPI = "https://api.telegram.org"
+	defaultBarkServer  = "https://api.day.app"
+
+	requestTimeout  = 10 * time.Second
+	throttleWindow  = 5 * time.Minute
+	maxResponseBody = 1024
+	maxTextLength   = 2000
+)
+
+var (
+	ErrUnknownChannel = errors.New("unknown alert channel")
+	ErrIncomplete     = errors.New("alert channel is not fully configured")
+)
+
+// AllEvents 返回可以选择推送的事件。
+func AllEvents() []string {
+	return []string{
+		EventTicketCreated,
+		EventTicketReplied,
+		EventOrderPaid,
+		EventAuditBlocked,
+		EventStorageError,
+	}
+}
+
+// ChannelTypes 返回支持的推送渠道。
+func ChannelTypes() []string {
+	return []string{ChannelTelegram, ChannelDingTalk, ChannelWeCom, ChannelBark, ChannelJSON}
+}
+
+var eventTitles = map[string]string{
+	EventTicketCreated: "新工单",
+	EventTicketReplied: "工单回复",
+	EventOrderPaid:     "订单支付",
+	EventAuditBlocked:  "图片审核拦截",
+	EventStorageError:  "存储错误",
+}
+
+// Message 是一条待推送的提醒。Title 为空时使用事件的默认标题；
+// URL 以 / 开头时按站点的控制台地址（site.console_url）补全，未配置控制台地址时省略链接。
+type Message struct {
+	Event string    `json:"event"`
+	Title string    `json:"title"`
+	Text  string    `json:"text"`
+	URL   string    `json:"url,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+type SettingsReader interface {
+	GetSettings(ctx context.Context) (map[string]string, error)
+}
+
+type Service struct {
+	mu       sync.Mutex
+	settings SettingsReader
+	client   *http.Client
+	lastSent map[string]time.Time
+}
+
+// New 创建提醒服务。推送地址由超级管理员配置，机器人或 Bark 服务也可能部署在内网，因此不限制目标地址。
+func New(settings SettingsReader) *Service {
+	return &Service{
+		settings: settings,
+		client:   &http.Client{Timeout: requestTimeout},
+		lastSent: make(map[string]time.Time),
+	}
+}
+
+func (s *Service) SetSettings(settings SettingsReader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = settings
+}
+
+func (s *Service) reader() SettingsReader {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settings
+}
+
+// Notify 在后台把提醒推送到订阅了该事件的全部渠道，不阻塞调用方；失败只记录日志。
+// 存储错误按标题节流，同一错误 5 分钟内只推送一次。
+func (s *Service) Notify(event string, msg Message) {
+	if s == nil {
+		return
+	}
+	msg.Event = event
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	if event == EventStorageError && !s.allow(event+"|"+msg.Title, msg.Time) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*requestTimeout)
+		defer cancel()
+		for channel, err := range s.deliver(ctx, msg) {
+			log.Printf("[alerts] send %s via %s failed: %v", event, channel, err)
+		}
+	}()
+}
+
+func (s *Service) allow(key string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.lastSent[key]; ok && now.Sub(last) < throttleWindow {
+		return false
+	}
+	for k, last := range s.lastSent {
+		if now.Sub(last) >= throttleWindow {
+			delete(s.lastSent, k)
+		}
+	}
+	s.lastSent[key] = now
+	return true
+}
+
+// deliver 同步推送到订阅了 msg.Event 的已启用渠道，返回各渠道的错误。
+func (s *Service) deliver(ctx context.Context, msg Message) map[string]error {
+	reader := s.reader()
+	if reader == nil {
+		return nil
+	}
+	values, err := reader.GetSettings(ctx)
+	if err != nil {
+		return map[string]error{"settings": err}
+	}
+	settings := ParseSettings(values)
+	msg = decorate(msg, values)
+	errs := map[string]error{}
+	for _, channel := range settings.Channels {
+		if !channel.Enabled || !channel.Subscribes(msg.Event) {
+			continue
+		}
+		if err := s.send(ctx, channel, msg); err != nil {
+			errs[channel.Type] = err
+		}
+	}
+	return errs
+}
+
+// Test 使用给定（可能尚未保存的）配置发送一条测试消息。
+func (s *Service) Test(ctx context.Context, channel ChannelConfig) error {
+	var values map[string]string
+	if reader := s.reader(); reader != nil {
+		values, _ = reader.GetSettings(ctx)
+	}
+	msg := decorate(Message{
+		Event: "test",
+		Title: "测试消息",
+		Text:  "如果你收到这条消息，说明提醒渠道配置正确。",
+		URL:   "/",
+		Time:  time.Now(),
+	}, values)
+	return s.send(ctx, channel, msg)
+}
+
+// decorate 补全默认标题、站点名前缀与控制台链接。
+func decorate(msg Message, settings map[string]string) Message {
+	if strings.TrimSpace(msg.Title) == "" {
+		msg.Title = eventTitles[msg.Event]
+	}
+	if siteTitle := strings.TrimSpace(settings["site.title"]); siteTitle != "" {
+		msg.Title = "[" + siteTitle + "] " + msg.Title
+	}
+	if strings.HasPrefix(msg.URL, "/") {
+		if base := strings.TrimRight(strings.TrimSpace(settings["site.console_url"]), "/"); base != "" {
+			msg.URL = base + msg.URL
+		} else {
+			msg.URL = ""
+		}
+	}
+	if runes := []rune(msg.Text); len(runes) > maxTextLength {
+		msg.Text = string(runes[:maxTextLength]) + "…"
+	}
+	return msg
+}
+
+func (s *Service) send(ctx context.Context, channel ChannelConfig, msg Message) error {
+	switch channel.Type {
+	case ChannelTelegram:
+		return s.sendTelegram(ctx, channel, msg)
+	case ChannelDingTalk:
+		return s.sendDingTalk(ctx, channel, msg)
+	case ChannelWeCom:
+		return s.sendWeCom(ctx, channel, msg)
+	case ChannelBark:
+		return s.sendBark(ctx, channel, msg)
+	case ChannelJSON:
+		return s.sendJSON(ctx, channel, msg)
+	default:
+		return ErrUnknownChannel
+	}
+}
+
+func plainText(msg Message) string {
+	var b strings.Builder
+	b.WriteString(msg.Title)
+	if msg.Text != "" {
+		b.WriteString("\n\n")
+		b.WriteString(msg.Text)
+	}
+	if msg.URL != "" {
+		b.WriteString("\n")
+		b.WriteString(msg.URL)
+	}
+	return b.String()
+}
+
+func markdownLink(msg Message) string {
+	if msg.URL == "" {
+		return ""
+	}
+	return "\n\n[查看详情](" + msg.URL + ")"
+}
+
+func (s *Service) sendTelegram(ctx context.Context, channel ChannelConfig, msg Message) error {
+	if channel.BotToken == "" || channel.ChatID == "" {
+		return ErrIncomplete
+	}
+	base := strings.TrimRight(firstNonEmpty(channel.Server, defaultTelegramAPI), "/")
+	endpoint := base + "/bot" + channel.BotToken + "/sendMessage"
+	var resp struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := s.postJSON(ctx, endpoint, nil, map[string]interface{}{
+		"chat_id":                  channel.ChatID,
+		"text":                     plainText(msg),
+		"disable_web_page_preview": true,
+	}, &resp); err != nil {
+		return err
+	}
+	if !resp.OK {
+		return fmt.Errorf("telegram: %s", resp.Description)
+	}
+	return nil
+}
+
+func (s *Service) sendDingTalk(ctx context.Context, channel ChannelConfig, msg Message) error {
+	if channel.WebhookURL == "" {
+		return ErrIncomplete
+	}
+	endpoint := channel.WebhookURL
+	if channel.Secret != "" {
+		signed, err := DingTalkSignedURL(endpoint, channel.Secret, msg.Time)
+		if err != nil {
+			return err
+		}
+		endpoint = signed
+	}
+	var resp robotResponse
+	if err := s.postJSON(ctx, endpoint, nil, map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": msg.Title,
+			"text":  "### " + msg.Title + "\n\n" + msg.Text + markdownLink(msg),
+		},
+	}, &resp); err != nil {
+		return err
+	}
+	return resp.err("dingtalk")
+}
+
+func (s *Service) sendWeCom(ctx context.Context, channel ChannelConfig, msg Message) error {
+	if channel.WebhookURL == "" {
+		return ErrIncomplete
+	}
+	var resp robotResponse
+	if err := s.postJSON(ctx, channel.WebhookURL, nil, map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"content": "**" + msg.Title + "**\n" + msg.Text + markdownLink(msg),
+		},
+	}, &resp); err != nil {
+		return err
+	}
+	return resp.err("wecom")
+}
+
+func (s *Service) sendBark(ctx context.Context, channel ChannelConfig, msg Message) error {
+	if channel.Key == "" {
+		return ErrIncomplete
+	}
+	base := strings.TrimRight(firstNonEmpty(channel.Server, defaultBarkServer), "/")
+	payload := map[string]interface{}{
+		"device_key": channel.Key,
+		"title":      msg.Title,
+		"body":       msg.Text,
+		"group":      "skyimage",
+	}
+	if msg.URL != "" {
+		payload["url"] = msg.URL
+	}
+	var resp struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := s.postJSON(ctx, base+"/push", nil, payload, &resp); err != nil {
+		return err
+	}
+	if resp.Code != http.StatusOK {
+		return fmt.Errorf("bark: %s", resp.Message)
+	}
+	return nil
+}
+
+// sendJSON 推送原始消息，配置了密钥时按 Webhook 相同的方式签名。
+func (s *Service) sendJSON(ctx context.Context, channel ChannelConfig, msg Message) error {
+	if channel.WebhookURL == "" {
+		return ErrIncomplete
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{webhooks.HeaderEvent: msg.Event}
+	if channel.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		headers[webhooks.HeaderTimestamp] = timestamp
+		headers[webhooks.HeaderSignature] = webhooks.Sign(channel.Secret, timestamp, body)
+	}
+	return s.post(ctx, channel.WebhookURL, headers, body, nil)
+}
+
+// robotResponse 是钉钉与企业微信机器人共用的响应格式，HTTP 200 时仍可能返回错误码。
+type robotResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (r robotResponse) err(name string) error {
+	if r.ErrCode != 0 {
+		return fmt.Errorf("%s: %d %s", name, r.ErrCode, r.ErrMsg)
+	}
+	return nil
+}
+
+// DingTalkSignedURL 按钉钉自定义机器人的加签规则追加 timestamp 与 sign 参数。
+func DingTalkSignedURL(webhookURL, secret string, now time.Time) (string, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "", err
+	}
+	timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	query := u.Query()
+	query.Set("timestamp", timestamp)
+	query.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func (s *Service) postJSON(ctx context.Context, endpoint string, headers map[string]string, payload, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.post(ctx, endpoint, headers, body, out)
+}
+
+func (s *Service) post(ctx context.Context, endpoint string, headers map[string]string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", "Skyimage-Alerts/1.0")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	if out != nil && len(bytes.TrimSpace(raw)) > 0 {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return fmt.Errorf("unexpected response: %s", strings.TrimSpace(string(raw)))
+		}
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
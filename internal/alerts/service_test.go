@@ -0,0 +1,200 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"skyimage/internal/webhooks"
+)
+
+type staticSettings map[string]string
+
+func (s staticSettings) GetSettings(context.Context) (map[string]string, error) {
+	return s, nil
+}
+
+type capturedRequest struct {
+	Path  string
+	Query string
+	Body  map[string]interface{}
+	Raw   []byte
+	Head  http.Header
+}
+
+// standIn 模拟各家机器人接口：记录请求并返回对应的成功响应。
+func standIn(t *testing.T) (*httptest.Server, func() []capturedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var got []capturedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		req := capturedRequest{Path: r.URL.Path, Query: r.URL.RawQuery, Raw: raw, Head: r.Header.Clone()}
+		_ = json.Unmarshal(raw, &req.Body)
+		mu.Lock()
+		got = append(got, req)
+		mu.Unlock()
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/bot"):
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		case r.URL.Path == "/push":
+			_, _ = w.Write([]byte(`{"code":200,"message":"success"}`))
+		case r.URL.Path == "/wecom-fail":
+			_, _ = w.Write([]byte(`{"errcode":93000,"errmsg":"invalid webhook url"}`))
+		case r.URL.Path == "/json":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []capturedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]capturedRequest(nil), got...)
+	}
+}
+
+func TestDeliverSendsToSubscribedChannels(t *testing.T) {
+	server, requests := standIn(t)
+	values := Settings{Channels: []ChannelConfig{
+		{Type: ChannelTelegram, Enabled: true, Events: []string{EventTicketCreated}, BotToken: "123:abc", ChatID: "42", Server: server.URL},
+		{Type: ChannelDingTalk, Enabled: true, Events: []string{EventTicketCreated}, WebhookURL: server.URL + "/robot/send?access_token=t", Secret: "SEC"},
+		{Type: ChannelWeCom, Enabled: true, Events: []string{EventTicketCreated}, WebhookURL: server.URL + "/wecom"},
+		{Type: ChannelBark, Enabled: true, Events: []string{EventTicketCreated, EventOrderPaid}, Server: server.URL, Key: "device"},
+		{Type: ChannelJSON, Enabled: false, Events: []string{EventTicketCreated}, WebhookURL: server.URL + "/json"},
+	}}.Values()
+	values["site.title"] = "Sky"
+	values["site.console_url"] = "https://img.example.com/"
+	svc := New(staticSettings(values))
+
+	errs := svc.deliver(context.Background(), Message{
+		Event: EventTicketCreated,
+		Text:  "T-1 无法上传",
+		URL:   "/dashboard/admin/tickets/1",
+		Time:  time.UnixMilli(1700000000000),
+	})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	got := requests()
+	if len(got) != 4 {
+		t.Fatalf("expected 4 requests (json channel disabled), got %d", len(got))
+	}
+	byPath := map[string]capturedRequest{}
+	for _, req := range got {
+		byPath[req.Path] = req
+	}
+
+	telegram := byPath["/bot123:abc/sendMessage"]
+	if telegram.Body["chat_id"] != "42" || !strings.Contains(telegram.Body["text"].(string), "[Sky] 新工单") ||
+		!strings.Contains(telegram.Body["text"].(string), "https://img.example.com/dashboard/admin/tickets/1") {
+		t.Fatalf("unexpected telegram request: %+v", telegram.Body)
+	}
+
+	dingtalk := byPath["/robot/send"]
+	signed, err := DingTalkSignedURL(server.URL+"/robot/send?access_token=t", "SEC", time.UnixMilli(1700000000000))
+	if err != nil || !strings.HasSuffix(signed, "?"+dingtalk.Query) {
+		t.Fatalf("dingtalk request should be signed: %s vs %s", dingtalk.Query, signed)
+	}
+	if !strings.Contains(dingtalk.Query, "timestamp=1700000000000") || !strings.Contains(dingtalk.Query, "sign=") {
+		t.Fatalf("dingtalk query is missing signature: %s", dingtalk.Query)
+	}
+	if dingtalk.Body["msgtype"] != "markdown" {
+		t.Fatalf("unexpected dingtalk body: %+v", dingtalk.Body)
+	}
+
+	if wecom := byPath["/wecom"]; wecom.Body["msgtype"] != "markdown" {
+		t.Fatalf("unexpected wecom body: %+v", wecom.Body)
+	}
+	if bark := byPath["/push"]; bark.Body["device_key"] != "device" || bark.Body["title"] != "[Sky] 新工单" || bark.Body["body"] != "T-1 无法上传" {
+		t.Fatalf("unexpected bark body: %+v", bark.Body)
+	}
+
+	// 只有 Bark 订阅了订单事件
+	_ = svc.deliver(context.Background(), Message{Event: EventOrderPaid, Text: "paid", Time: time.Now()})
+	if got := requests(); len(got) != 5 || got[4].Path != "/push" {
+		t.Fatalf("order.paid should only reach bark, got %d requests", len(got))
+	}
+}
+
+func TestChannelErrorsAndJSONSignature(t *testing.T) {
+	server, requests := standIn(t)
+	svc := New(staticSettings{})
+
+	err := svc.Test(context.Background(), ChannelConfig{Type: ChannelWeCom, WebhookURL: server.URL + "/wecom-fail"})
+	if err == nil || !strings.Contains(err.Error(), "93000") {
+		t.Fatalf("wecom errcode should surface as an error, got %v", err)
+	}
+	if err := svc.Test(context.Background(), ChannelConfig{Type: ChannelTelegram}); err != ErrIncomplete {
+		t.Fatalf("expected ErrIncomplete, got %v", err)
+	}
+
+	if err := svc.Test(context.Background(), ChannelConfig{Type: ChannelJSON, WebhookURL: server.URL + "/json", Secret: "s3cret"}); err != nil {
+		t.Fatalf("json test failed: %v", err)
+	}
+	got := requests()
+	last := got[len(got)-1]
+	timestamp := last.Head.Get(webhooks.HeaderTimestamp)
+	if last.Head.Get(webhooks.HeaderSignature) != webhooks.Sign("s3cret", timestamp, last.Raw) {
+		t.Fatalf("json channel signature mismatch")
+	}
+	if last.Body["event"] != "test" || last.Body["title"] != "测试消息" {
+		t.Fatalf("unexpected json body: %s", last.Raw)
+	}
+	// 未配置控制台地址时不附带相对链接
+	if _, ok := last.Body["url"]; ok {
+		t.Fatalf("relative url should be dropped without a console url: %s", last.Raw)
+	}
+}
+
+func TestStorageErrorsAreThrottled(t *testing.T) {
+	svc := New(nil)
+	now := time.Now()
+	key := EventStorageError + "|存储错误：本地（local）"
+	if !svc.allow(key, now) {
+		t.Fatalf("first alert should pass")
+	}
+	if svc.allow(key, now.Add(time.Minute)) {
+		t.Fatalf("repeated alert within the window should be throttled")
+	}
+	if !svc.allow(EventStorageError+"|other", now.Add(time.Minute)) {
+		t.Fatalf("different errors should not share a throttle")
+	}
+	if !svc.allow(key, now.Add(throttleWindow+time.Second)) {
+		t.Fatalf("alert should pass again after the window")
+	}
+}
+
+func TestSettingsRoundTripAndSecrets(t *testing.T) {
+	stored := ParseSettings(Settings{Channels: []ChannelConfig{
+		{Type: ChannelDingTalk, Enabled: true, Events: []string{EventAuditBlocked, "bogus", EventAuditBlocked}, WebhookURL: " https://oapi.dingtalk.com/robot/send?access_token=t ", Secret: "SEC"},
+		{Type: "sms", Enabled: true},
+	}}.Values())
+	if len(stored.Channels) != len(ChannelTypes()) {
+		t.Fatalf("expected every channel type, got %d", len(stored.Channels))
+	}
+	dingtalk, _ := stored.Channel(ChannelDingTalk)
+	if !dingtalk.Enabled || len(dingtalk.Events) != 1 || dingtalk.WebhookURL != "https://oapi.dingtalk.com/robot/send?access_token=t" {
+		t.Fatalf("unexpected dingtalk settings: %+v", dingtalk)
+	}
+
+	redacted := dingtalk.Redacted()
+	if redacted.WebhookURL != Redacted || redacted.Secret != Redacted || redacted.BotToken != "" {
+		t.Fatalf("unexpected redaction: %+v", redacted)
+	}
+	kept := redacted.KeepSecrets(dingtalk)
+	if kept.WebhookURL != dingtalk.WebhookURL || kept.Secret != "SEC" {
+		t.Fatalf("redacted placeholders should keep stored secrets: %+v", kept)
+	}
+	redacted.Secret = "NEW"
+	if changed := redacted.KeepSecrets(dingtalk); changed.Secret != "NEW" {
+		t.Fatalf("new secret should replace the stored one: %+v", changed)
+	}
+}
@@ -0,0 +1,169 @@
+package alerts
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ChannelConfig 是单个推送渠道的配置，保存在 configs 表的 alerts.<type>.* 键中。
+// 不同渠道只使用其中部分字段：
+//   - telegram: BotToken、ChatID，Server 为可选的 Bot API 地址
+//   - dingtalk: WebhookURL，Secret 为可选的加签密钥
+//   - wecom: WebhookURL
+//   - bark: Key（设备 Key），Server 为可选的自建服务地址
+//   - json: WebhookURL，Secret 为可选的签名密钥
+type ChannelConfig struct {
+	Type       string   `json:"type"`
+	Enabled    bool     `json:"enabled"`
+	Events     []string `json:"events"`
+	WebhookURL string   `json:"webhookUrl"`
+	Secret     string   `json:"secret"`
+	BotToken   string   `json:"botToken"`
+	ChatID     string   `json:"chatId"`
+	Server     string   `json:"server"`
+	Key        string   `json:"key"`
+}
+
+// Settings 是全部推送渠道的配置，顺序与 ChannelTypes 一致。
+type Settings struct {
+	Channels []ChannelConfig `json:"channels"`
+}
+
+func settingKey(channel, field string) string {
+	return "alerts." + channel + "." + field
+}
+
+// ParseSettings 从 configs 键值中读取全部渠道配置。
+func ParseSettings(values map[string]string) Settings {
+	out := Settings{Channels: make([]ChannelConfig, 0, len(ChannelTypes()))}
+	for _, channel := range ChannelTypes() {
+		get := func(field string) string {
+			return strings.TrimSpace(values[settingKey(channel, field)])
+		}
+		out.Channels = append(out.Channels, ChannelConfig{
+			Type:       channel,
+			Enabled:    get("enabled") == "true",
+			Events:     splitEvents(get("events")),
+			WebhookURL: get("webhook_url"),
+			Secret:     get("secret"),
+			BotToken:   get("bot_token"),
+			ChatID:     get("chat_id"),
+			Server:     get("server"),
+			Key:        get("key"),
+		})
+	}
+	return out
+}
+
+// Values 转换为 configs 表中的键值，未知渠道被忽略。
+func (s Settings) Values() map[string]string {
+	values := map[string]string{}
+	for _, channel := range s.Channels {
+		if !isChannelType(channel.Type) {
+			continue
+		}
+		channel = channel.Normalize()
+		set := func(field, value string) {
+			values[settingKey(channel.Type, field)] = value
+		}
+		set("enabled", strconv.FormatBool(channel.Enabled))
+		set("events", strings.Join(channel.Events, ","))
+		set("webhook_url", channel.WebhookURL)
+		set("secret", channel.Secret)
+		set("bot_token", channel.BotToken)
+		set("chat_id", channel.ChatID)
+		set("server", channel.Server)
+		set("key", channel.Key)
+	}
+	return values
+}
+
+// Channel 返回指定类型的渠道配置。
+func (s Settings) Channel(channelType string) (ChannelConfig, bool) {
+	for _, channel := range s.Channels {
+		if channel.Type == channelType {
+			return channel, true
+		}
+	}
+	return ChannelConfig{}, false
+}
+
+// Normalize 去除首尾空白并过滤未知事件。
+func (c ChannelConfig) Normalize() ChannelConfig {
+	c.Type = strings.ToLower(strings.TrimSpace(c.Type))
+	c.Events = splitEvents(strings.Join(c.Events, ","))
+	c.WebhookURL = strings.TrimSpace(c.WebhookURL)
+	c.Secret = strings.TrimSpace(c.Secret)
+	c.BotToken = strings.TrimSpace(c.BotToken)
+	c.ChatID = strings.TrimSpace(c.ChatID)
+	c.Server = strings.TrimSpace(c.Server)
+	c.Key = strings.TrimSpace(c.Key)
+	return c
+}
+
+// Subscribes 判断渠道是否推送该事件。
+func (c ChannelConfig) Subscribes(event string) bool {
+	for _, item := range c.Events {
+		if item == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted 隐藏密钥字段；钉钉、企业微信与通用 JSON 的地址本身带有访问凭据，同样隐藏。
+func (c ChannelConfig) Redacted() ChannelConfig {
+	c.WebhookURL = redact(c.WebhookURL)
+	c.Secret = redact(c.Secret)
+	c.BotToken = redact(c.BotToken)
+	c.Key = redact(c.Key)
+	return c
+}
+
+// KeepSecrets 把传回占位值或留空的密钥字段恢复为已保存的值。
+func (c ChannelConfig) KeepSecrets(stored ChannelConfig) ChannelConfig {
+	keep := func(value, previous string) string {
+		if value = strings.TrimSpace(value); value == "" || value == Redacted {
+			return previous
+		}
+		return value
+	}
+	c.WebhookURL = keep(c.WebhookURL, stored.WebhookURL)
+	c.Secret = keep(c.Secret, stored.Secret)
+	c.BotToken = keep(c.BotToken, stored.BotToken)
+	c.Key = keep(c.Key, stored.Key)
+	return c
+}
+
+func redact(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return ""
+	}
+	return Redacted
+}
+
+func isChannelType(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, channel := range ChannelTypes() {
+		if channel == value {
+			return true
+		}
+	}
+	return false
+}
+
+func splitEvents(raw string) []string {
+	known := map[string]bool{}
+	for _, event := range AllEvents() {
+		known[event] = true
+	}
+	out := []string{}
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if known[item] {
+			known[item] = false
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,9 +14,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"skyimage/internal/auditlog"
 	"skyimage/internal/captcha"
 	"skyimage/internal/data"
 	"skyimage/internal/middleware"
+	"skyimage/internal/s3gateway"
 	"skyimage/internal/redeem"
 	"skyimage/internal/users"
 )
@@ -24,26 +27,63 @@ const apiTokenExpiryLayout = "2006-01-02 15:04"
 
 func (s *Server) registerAccountRoutes(r *gin.RouterGroup) {
 	account := r.Group("/account")
-	account.Use(s.authMiddleware())
+	account.Use(s.scopedAuthMiddleware(accountTokenScope))
 
 	// 只读接口不需要 CSRF
 	account.GET("/profile", s.handleAccountProfile)
 	account.GET("/api-tokens", s.handleListApiTokens)
 	account.GET("/notifications", s.handleAccountNotifications)
+	account.GET("/2fa", s.handleTwoFactorStatus)
+	account.GET("/sessions", s.handleAccountSessions)
+	account.GET("/login-history", s.handleAccountLoginHistory)
+	account.GET("/invites", s.handleAccountInvites)
+	account.GET("/webhooks", s.handleAccountWebhooks)
+	account.GET("/webhooks/:id/deliveries", s.handleAccountWebhookDeliveries)
 
 	// 写操作需要 CSRF
 	accountWithCSRF := account.Group("")
 	accountWithCSRF.Use(middleware.RequireCSRF())
 	accountWithCSRF.PUT("/profile", s.handleAccountUpdateProfile)
-	accountWithCSRF.DELETE("/profile", s.handleAccountDelete)
-	accountWithCSRF.POST("/api-token", s.handleGenerateApiToken)
-	accountWithCSRF.PATCH("/api-token/:id", s.handleUpdateApiToken)
-	accountWithCSRF.DELETE("/api-token/:id", s.handleDeleteApiToken)
-	accountWithCSRF.DELETE("/api-token", s.handleDeleteApiTokens)
 	accountWithCSRF.PATCH("/notifications/:id/read", s.handleAccountNotificationRead)
 	accountWithCSRF.POST("/notifications/read-all", s.handleAccountNotificationsReadAll)
 	accountWithCSRF.DELETE("/notifications", s.handleAccountNotificationsClear)
-	accountWithCSRF.POST("/redeem", s.handleAccountRedeem)
+	accountWithCSRF.POST("/invites", s.handleAccountCreateInvite)
+	accountWithCSRF.DELETE("/invites/:id", s.handleAccountDeleteInvite)
+
+	// 凭据、Token、兑换、会话与 Webhook 管理在模拟登录期间禁止
+	sensitive := accountWithCSRF.Group("", middleware.BlockImpersonation())
+	sensitive.DELETE("/profile", s.handleAccountDelete)
+	sensitive.POST("/api-token", s.handleGenerateApiToken)
+	sensitive.PATCH("/api-token/:id", s.handleUpdateApiToken)
+	sensitive.DELETE("/api-token/:id", s.handleDeleteApiToken)
+	sensitive.DELETE("/api-token", s.handleDeleteApiTokens)
+	sensitive.POST("/api-token/client-config", s.handleGenerateClientConfig)
+	sensitive.POST("/redeem", s.handleAccountRedeem)
+	sensitive.POST("/2fa/setup", s.handleTwoFactorSetup)
+	sensitive.POST("/2fa/confirm", s.handleTwoFactorConfirm)
+	sensitive.POST("/2fa/disable", s.handleTwoFactorDisable)
+	sensitive.POST("/2fa/recovery-codes", s.handleTwoFactorRecoveryCodes)
+	sensitive.DELETE("/sessions/:id", s.handleAccountRevokeSession)
+	sensitive.DELETE("/sessions", s.handleAccountRevokeOtherSessions)
+	sensitive.POST("/webhooks", s.handleAccountCreateWebhook)
+	sensitive.PUT("/webhooks/:id", s.handleAccountUpdateWebhook)
+	sensitive.DELETE("/webhooks/:id", s.handleAccountDeleteWebhook)
+	sensitive.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", s.handleAccountRedeliverWebhook)
+}
+
+// accountTokenScope 账户接口按读写区分权限，Token 管理需要单独的 tokens:manage 权限。
+func accountTokenScope(c *gin.Context) string {
+	if strings.Contains(c.FullPath(), "/api-token") {
+		return data.ApiTokenScopeTokens
+	}
+	// 两步验证、会话管理与注销账户仅允许浏览器会话或完全权限的 Token
+	if strings.Contains(c.FullPath(), "/2fa") || strings.Contains(c.FullPath(), "/sessions") {
+		return ""
+	}
+	if c.Request.Method == http.MethodDelete && strings.HasSuffix(c.FullPath(), "/profile") {
+		return ""
+	}
+	return middleware.ScopeByMethod(data.ApiTokenScopeAccountRead, data.ApiTokenScopeAccountEdit)(c)
 }
 
 type accountNotificationDTO struct {
@@ -101,6 +141,16 @@ func (s *Server) handleAccountUpdateProfile(c *gin.Context) {
 		return
 	}
 
+	if _, impersonating := middleware.CurrentImpersonation(c); impersonating && strings.TrimSpace(input.Password) != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "模拟登录期间禁止修改密码", "impersonating": true})
+		return
+	}
+	// 受限 Token 只有 account:write 时也能修改资料，但不能修改密码，否则泄露的 Token 即可接管账户
+	if token, viaToken := middleware.CurrentAPIToken(c); viaToken && !token.FullAccess() && strings.TrimSpace(input.Password) != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "受限的 API Token 无权修改密码"})
+		return
+	}
+
 	// 演示站模式：禁止修改名称和密码
 	s.mu.RLock()
 	demoMode := s.cfg.DemoMode
@@ -122,6 +172,10 @@ func (s *Server) handleAccountUpdateProfile(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// 修改密码后注销其他设备上的会话
+	if strings.TrimSpace(input.Password) != "" {
+		s.revokeUserSessions(c, user.ID, currentSessionID(c))
+	}
 	c.JSON(http.StatusOK, gin.H{"data": updated})
 }
 
@@ -135,9 +189,8 @@ func (s *Server) handleAccountDelete(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if sessionID, err := c.Cookie("skyimage_session"); err == nil && sessionID != "" {
-		s.session.Delete(sessionID)
-	}
+	s.revokeUserSessions(c, user.ID, "")
+	s.clearSessionCookie(c)
 	c.JSON(http.StatusOK, gin.H{"message": "account deleted"})
 }
 
@@ -245,6 +298,7 @@ func (s *Server) handleGenerateApiToken(c *gin.Context) {
 
 	var req struct {
 		ExpiresAt string `json:"expiresAt"`
+		apiTokenRestrictionPayload
 	}
 	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
@@ -256,28 +310,183 @@ func (s *Server) handleGenerateApiToken(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	restrictions, err := s.normalizeApiTokenRestrictions(c, user, req.apiTokenRestrictionPayload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	tokenStr, err := data.GenerateAPIToken()
+	apiToken, tokenStr, err := s.createApiToken(user, restrictions, expiry)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"token": tokenStr,
+		"id":    apiToken.ID,
+		// S3 兼容网关凭据，Secret 只在创建时返回
+		"s3": gin.H{
+			"accessKeyId":     s3gateway.AccessKeyID(apiToken.ID),
+			"secretAccessKey": s.s3.SecretAccessKey(apiToken.Token),
+		},
+	}})
+}
+
+// createApiToken 生成并保存新 Token，返回记录与仅此一次可见的明文。
+func (s *Server) createApiToken(user data.User, restrictions apiTokenRestrictions, expiry time.Time) (data.ApiToken, string, error) {
+	tokenStr, err := data.GenerateAPIToken()
+	if err != nil {
+		return data.ApiToken{}, "", fmt.Errorf("Failed to generate token")
+	}
+
 	s.mu.RLock()
 	db := s.db
 	s.mu.RUnlock()
 
 	apiToken := data.ApiToken{
-		UserID:    user.ID,
-		Token:     data.HashAPIToken(tokenStr),
-		ExpiresAt: data.NormalizeApiTokenExpiry(expiry),
+		UserID:       user.ID,
+		Name:         restrictions.Name,
+		Token:        data.HashAPIToken(tokenStr),
+		Scopes:       restrictions.Scopes,
+		StrategyIDs:  restrictions.StrategyIDs,
+		AllowedCIDRs: restrictions.AllowedCIDRs,
+		ExpiresAt:    data.NormalizeApiTokenExpiry(expiry),
 	}
 	if err := db.Create(&apiToken).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
-		return
+		return data.ApiToken{}, "", fmt.Errorf("Failed to create token")
 	}
+	return apiToken, tokenStr, nil
+}
 
-	c.JSON(http.StatusOK, gin.H{"data": gin.H{"token": tokenStr}})
+// apiTokenRestrictionPayload 是创建/更新 Token 时可选的名称与权限限制。
+type apiTokenRestrictionPayload struct {
+	Name        *string   `json:"name"`
+	Scopes      *[]string `json:"scopes"`
+	StrategyIDs *[]uint   `json:"strategyIds"`
+	AllowedIPs  *[]string `json:"allowedIps"`
+}
+
+type apiTokenRestrictions struct {
+	Name         string
+	Scopes       string
+	StrategyIDs  string
+	AllowedCIDRs string
+}
+
+// normalizeApiTokenRestrictions 校验并序列化 Token 限制。通过 Token 调用时，新 Token 不能比当前 Token
+// 更宽：未指定的权限、储存策略与来源 IP 沿用当前 Token 的限制，超出范围的请求会被拒绝。
+func (s *Server) normalizeApiTokenRestrictions(c *gin.Context, user data.User, payload apiTokenRestrictionPayload) (apiTokenRestrictions, error) {
+	var out apiTokenRestrictions
+	if payload.Name != nil {
+		out.Name = strings.TrimSpace(*payload.Name)
+		if len([]rune(out.Name)) > 64 {
+			return out, fmt.Errorf("Token 名称不能超过 64 个字符")
+		}
+	}
+	current, fromToken := middleware.CurrentAPIToken(c)
+	var scopes []string
+	if payload.Scopes != nil {
+		scopes = *payload.Scopes
+	} else if fromToken {
+		scopes = current.ScopeList()
+	}
+	normalizedScopes, err := data.NormalizeApiTokenScopes(scopes)
+	if err != nil {
+		return out, err
+	}
+	// 受限 Token 只能签发权限不超过自身的新 Token
+	if fromToken && !current.FullAccess() {
+		for _, scope := range normalizedScopes {
+			if scope == data.ApiTokenScopeAll || !current.HasScope(scope) {
+				return out, fmt.Errorf("不能授予超出当前 Token 的权限: %s", scope)
+			}
+		}
+	}
+	out.Scopes = data.JoinApiTokenList(normalizedScopes)
+
+	var strategyIDs []uint
+	if payload.StrategyIDs != nil {
+		strategyIDs = *payload.StrategyIDs
+	}
+	if fromToken {
+		if limited := current.StrategyIDList(); len(limited) > 0 {
+			if len(strategyIDs) == 0 {
+				strategyIDs = limited
+			}
+			for _, id := range strategyIDs {
+				if !containsUint(limited, id) {
+					return out, fmt.Errorf("不能使用当前 Token 未授权的储存策略: %d", id)
+				}
+			}
+		}
+	}
+	if len(strategyIDs) > 0 {
+		available, err := s.files.ListStrategiesForUser(c.Request.Context(), user)
+		if err != nil {
+			return out, err
+		}
+		allowed := make(map[uint]struct{}, len(available))
+		for _, item := range available {
+			allowed[item.ID] = struct{}{}
+		}
+		for _, id := range strategyIDs {
+			if _, ok := allowed[id]; !ok {
+				return out, fmt.Errorf("储存策略 %d 不可用", id)
+			}
+		}
+		out.StrategyIDs = data.JoinApiTokenStrategyIDs(strategyIDs)
+	}
+
+	var cidrs []string
+	if payload.AllowedIPs != nil {
+		if cidrs, err = data.NormalizeApiTokenCIDRs(*payload.AllowedIPs); err != nil {
+			return out, err
+		}
+	}
+	if fromToken {
+		if limited := current.CIDRList(); len(limited) > 0 {
+			if len(cidrs) == 0 {
+				cidrs = limited
+			}
+			for _, cidr := range cidrs {
+				if !cidrWithinAny(cidr, limited) {
+					return out, fmt.Errorf("来源 IP 范围超出当前 Token 的限制: %s", cidr)
+				}
+			}
+		}
+	}
+	out.AllowedCIDRs = data.JoinApiTokenList(cidrs)
+	return out, nil
+}
+
+func containsUint(items []uint, value uint) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// cidrWithinAny 判断 cidr 是否完整落在 ranges 中的某一个网段内。
+func cidrWithinAny(cidr string, ranges []string) bool {
+	_, inner, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	innerOnes, innerBits := inner.Mask.Size()
+	for _, item := range ranges {
+		_, outer, err := net.ParseCIDR(item)
+		if err != nil {
+			continue
+		}
+		outerOnes, outerBits := outer.Mask.Size()
+		if innerBits == outerBits && outerOnes <= innerOnes && outer.Contains(inner.IP) {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *Server) handleListApiTokens(c *gin.Context) {
@@ -298,20 +507,30 @@ func (s *Server) handleListApiTokens(c *gin.Context) {
 	}
 
 	type tokenResp struct {
-		ID         uint       `json:"id"`
-		Token      string     `json:"tokenMasked"`
-		CreatedAt  time.Time  `json:"createdAt"`
-		ExpiresAt  time.Time  `json:"expiresAt"`
-		LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+		ID          uint       `json:"id"`
+		Name        string     `json:"name"`
+		Token       string     `json:"tokenMasked"`
+		Scopes      []string   `json:"scopes"`
+		StrategyIDs []uint     `json:"strategyIds"`
+		AllowedIPs  []string   `json:"allowedIps"`
+		CreatedAt   time.Time  `json:"createdAt"`
+		ExpiresAt   time.Time  `json:"expiresAt"`
+		LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+		S3AccessKey string     `json:"s3AccessKeyId"`
 	}
 	items := make([]tokenResp, 0, len(tokens))
 	for _, token := range tokens {
 		items = append(items, tokenResp{
-			ID:         token.ID,
-			Token:      maskStoredToken(token.Token),
-			CreatedAt:  token.CreatedAt,
-			ExpiresAt:  token.ExpiresAt,
-			LastUsedAt: token.LastUsedAt,
+			ID:          token.ID,
+			Name:        token.Name,
+			Token:       maskStoredToken(token.Token),
+			Scopes:      token.ScopeList(),
+			StrategyIDs: token.StrategyIDList(),
+			AllowedIPs:  token.CIDRList(),
+			CreatedAt:   token.CreatedAt,
+			ExpiresAt:   token.ExpiresAt,
+			LastUsedAt:  token.LastUsedAt,
+			S3AccessKey: s3gateway.AccessKeyID(token.ID),
 		})
 	}
 	c.JSON(http.StatusOK, gin.H{"data": items})
@@ -377,18 +596,45 @@ func (s *Server) handleUpdateApiToken(c *gin.Context) {
 	}
 
 	var req struct {
-		ExpiresAt string `json:"expiresAt"`
+		ExpiresAt *string `json:"expiresAt"`
+		apiTokenRestrictionPayload
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	expiry, err := parseApiTokenExpiry(req.ExpiresAt)
+	updates := map[string]interface{}{}
+	if req.ExpiresAt != nil {
+		expiry, err := parseApiTokenExpiry(*req.ExpiresAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["expires_at"] = data.NormalizeApiTokenExpiry(expiry)
+	}
+	restrictions, err := s.normalizeApiTokenRestrictions(c, user, req.apiTokenRestrictionPayload)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// 仅更新请求中出现的字段，兼容只修改过期时间的旧前端
+	if req.Name != nil {
+		updates["name"] = restrictions.Name
+	}
+	if req.Scopes != nil {
+		updates["scopes"] = restrictions.Scopes
+	}
+	if req.StrategyIDs != nil {
+		updates["strategy_ids"] = restrictions.StrategyIDs
+	}
+	if req.AllowedIPs != nil {
+		updates["allowed_cidrs"] = restrictions.AllowedCIDRs
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
 
 	s.mu.RLock()
 	db := s.db
@@ -396,7 +642,7 @@ func (s *Server) handleUpdateApiToken(c *gin.Context) {
 
 	result := db.Model(&data.ApiToken{}).
 		Where("id = ? AND user_id = ?", id, user.ID).
-		Update("expires_at", data.NormalizeApiTokenExpiry(expiry))
+		Updates(updates)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update token"})
 		return
@@ -501,6 +747,10 @@ func (s *Server) handleAccountRedeem(c *gin.Context) {
 	if hydrated, err := s.users.FindByID(c.Request.Context(), result.User.ID); err == nil {
 		result.User = hydrated
 	}
+	auditTarget(c, "redeem.use", "users", auditlog.TargetID(user.ID))
+	auditChange(c, auditUserSnapshot(user), auditUserSnapshot(result.User))
+	auditChanges(c, nil, map[string]string{"redeemCode": result.Code.Code})
+	s.writeAudit(c, user.ID, user.Email, http.StatusOK)
 
 	c.JSON(http.StatusOK, gin.H{
 		"data": gin.H{
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/alerts"
+)
+
+// ---------------------------------------------------------------------------
+// Alert Channels (GET/PUT /admin/system/alerts, POST /admin/system/alerts/test)
+// ---------------------------------------------------------------------------
+
+type alertSettingsResponse struct {
+	Channels []alerts.ChannelConfig `json:"channels"`
+	Events   []string               `json:"events"`
+}
+
+func (s *Server) storedAlertSettings(c *gin.Context) (alerts.Settings, bool) {
+	settings, err := s.admin.GetSettings(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return alerts.Settings{}, false
+	}
+	return alerts.ParseSettings(settings), true
+}
+
+func (s *Server) writeAlertSettings(c *gin.Context, settings alerts.Settings) {
+	channels := make([]alerts.ChannelConfig, 0, len(settings.Channels))
+	for _, channel := range settings.Channels {
+		channels = append(channels, channel.Redacted())
+	}
+	c.JSON(http.StatusOK, gin.H{"data": alertSettingsResponse{Channels: channels, Events: alerts.AllEvents()}})
+}
+
+func (s *Server) handleAdminAlertSettings(c *gin.Context) {
+	if !requireSuperAdmin(c) {
+		return
+	}
+	stored, ok := s.storedAlertSettings(c)
+	if !ok {
+		return
+	}
+	s.writeAlertSettings(c, stored)
+}
+
+func (s *Server) handleAdminUpdateAlertSettings(c *gin.Context) {
+	if !requireSuperAdmin(c) {
+		return
+	}
+	var payload alerts.Settings
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	stored, ok := s.storedAlertSettings(c)
+	if !ok {
+		return
+	}
+	channels := make([]alerts.ChannelConfig, 0, len(payload.Channels))
+	for _, channel := range payload.Channels {
+		channel = channel.Normalize()
+		previous, known := stored.Channel(channel.Type)
+		if !known {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的提醒渠道: " + channel.Type})
+			return
+		}
+		channel = channel.KeepSecrets(previous)
+		if msg := validateAlertChannel(channel); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		channels = append(channels, channel)
+	}
+	if err := s.updateSettings(c, alerts.Settings{Channels: channels}.Values()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	updated, ok := s.storedAlertSettings(c)
+	if !ok {
+		return
+	}
+	s.writeAlertSettings(c, updated)
+}
+
+func (s *Server) handleAdminTestAlert(c *gin.Context) {
+	if !requireSuperAdmin(c) {
+		return
+	}
+	var payload alerts.ChannelConfig
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写完整的提醒渠道配置"})
+		return
+	}
+	stored, ok := s.storedAlertSettings(c)
+	if !ok {
+		return
+	}
+	payload = payload.Normalize()
+	previous, known := stored.Channel(payload.Type)
+	if !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的提醒渠道: " + payload.Type})
+		return
+	}
+	// 表单中未修改的密钥字段为占位值，测试时使用已保存的值
+	payload = payload.KeepSecrets(previous)
+	// 测试时无论是否启用都要求必需字段完整
+	payload.Enabled = true
+	if msg := validateAlertChannel(payload); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := s.alerts.Test(c.Request.Context(), payload); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"data": gin.H{
+				"success": false,
+				"message": "发送测试消息失败: " + err.Error(),
+			},
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"success": true,
+			"message": "测试消息发送成功",
+		},
+	})
+}
+
+// validateAlertChannel 校验地址格式，启用的渠道还必须填写必需字段。
+func validateAlertChannel(channel alerts.ChannelConfig) string {
+	for _, raw := range []string{channel.WebhookURL, channel.Server} {
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "推送地址必须是有效的 http(s) 地址"
+		}
+	}
+	if !channel.Enabled {
+		return ""
+	}
+	var missing []string
+	switch channel.Type {
+	case alerts.ChannelTelegram:
+		if channel.BotToken == "" {
+			missing = append(missing, "Bot Token")
+		}
+		if channel.ChatID == "" {
+			missing = append(missing, "Chat ID")
+		}
+	case alerts.ChannelBark:
+		if channel.Key == "" {
+			missing = append(missing, "设备 Key")
+		}
+	default:
+		if channel.WebhookURL == "" {
+			missing = append(missing, "Webhook 地址")
+		}
+	}
+	if len(missing) > 0 {
+		return "请填写 " + strings.Join(missing, "、")
+	}
+	return ""
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/auditlog"
+	"skyimage/internal/data"
+	"skyimage/internal/middleware"
+)
+
+const auditContextKey = "admin_audit"
+
+// auditRecord 是处理函数为本次请求补充的审计信息。
+type auditRecord struct {
+	action     string
+	targetType string
+	targetID   string
+	changes    map[string]auditlog.Change
+}
+
+func currentAuditRecord(c *gin.Context) *auditRecord {
+	if value, ok := c.Get(auditContextKey); ok {
+		if record, ok := value.(*auditRecord); ok {
+			return record
+		}
+	}
+	record := &auditRecord{}
+	c.Set(auditContextKey, record)
+	return record
+}
+
+// auditTarget 覆盖本次请求默认推断出的动作与目标。
+func auditTarget(c *gin.Context, action, targetType, targetID string) {
+	record := currentAuditRecord(c)
+	record.action = action
+	record.targetType = targetType
+	record.targetID = targetID
+}
+
+// auditChange 记录 before/after 之间脱敏后的字段差异，可多次调用合并。
+func auditChange(c *gin.Context, before, after interface{}) {
+	beforeValues, afterValues := auditlog.Flatten(before), auditlog.Flatten(after)
+	// 时间戳每次更新都会变化，不计入差异
+	delete(beforeValues, "updatedAt")
+	delete(afterValues, "updatedAt")
+	auditChanges(c, beforeValues, afterValues)
+}
+
+func auditChanges(c *gin.Context, before, after map[string]string) {
+	changes := redactAuditChanges(auditlog.Diff(before, after))
+	if len(changes) == 0 {
+		return
+	}
+	record := currentAuditRecord(c)
+	if record.changes == nil {
+		record.changes = make(map[string]auditlog.Change, len(changes))
+	}
+	for key, change := range changes {
+		record.changes[key] = change
+	}
+}
+
+// auditAdminMutations 在后台写操作成功后写入审计日志。
+func (s *Server) auditAdminMutations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		c.Next()
+		status := c.Writer.Status()
+		if status >= http.StatusBadRequest || s.auditLog == nil {
+			return
+		}
+		actor, ok := middleware.CurrentUser(c)
+		if !ok {
+			return
+		}
+		s.writeAudit(c, actor.ID, actor.Email, status)
+	}
+}
+
+// writeAudit 把本次请求登记的审计信息写入日志。后台写操作由 auditAdminMutations
+// 统一调用；后台之外的敏感操作（用户兑换、支付回调）在处理函数中显式调用，
+// 系统行为的 actorID 为 0，actorEmail 标明来源（如 system/alipay）。
+func (s *Server) writeAudit(c *gin.Context, actorID uint, actorEmail string, status int) {
+	if s.auditLog == nil {
+		return
+	}
+	record := currentAuditRecord(c)
+	action, targetType := defaultAuditAction(c.Request.Method, c.FullPath())
+	if record.action != "" {
+		action = record.action
+	}
+	if record.targetType != "" {
+		targetType = record.targetType
+	}
+	targetID := record.targetID
+	if targetID == "" {
+		targetID = c.Param("id")
+	}
+	ctx := c.Request.Context()
+	entry := auditlog.Entry{
+		ActorID:    actorID,
+		ActorEmail: actorEmail,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path,
+		Status:     status,
+		IP:         getClientIP(c, s.isCDNEnabled(ctx)),
+		UserAgent:  c.Request.UserAgent(),
+		Changes:    record.changes,
+	}
+	if err := s.auditLog.Record(ctx, entry); err != nil {
+		log.Printf("[审计] 写入审计日志失败: %v", err)
+	}
+}
+
+// defaultAuditAction 由路由推断动作名，例如 PATCH /admin/users/:id/status -> users.status.update。
+// 带子路径的 POST 视为动作本身（如 images.batch.delete），不再追加动词。
+func defaultAuditAction(method, fullPath string) (string, string) {
+	path := fullPath
+	if idx := strings.Index(path, "/admin/"); idx >= 0 {
+		path = path[idx+len("/admin/"):]
+	}
+	var parts []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			continue
+		}
+		parts = append(parts, segment)
+	}
+	if len(parts) == 0 {
+		return strings.ToLower(method), ""
+	}
+	targetType := parts[0]
+	if method == http.MethodPost && len(parts) > 1 {
+		return strings.Join(parts, "."), targetType
+	}
+	verb := "update"
+	switch method {
+	case http.MethodPost:
+		verb = "create"
+	case http.MethodDelete:
+		verb = "delete"
+	}
+	return strings.Join(append(parts, verb), "."), targetType
+}
+
+// redactAuditChanges 对 diff 中的敏感字段脱敏：已知配置项复用 redactSettings，
+// 其它字段（如存储策略凭据）按名称判断。
+func redactAuditChanges(changes map[string]auditlog.Change) map[string]auditlog.Change {
+	if len(changes) == 0 {
+		return changes
+	}
+	before := make(map[string]string, len(changes))
+	after := make(map[string]string, len(changes))
+	for key, change := range changes {
+		before[key] = change.Before
+		after[key] = change.After
+	}
+	before = redactAuditValues(before)
+	after = redactAuditValues(after)
+	out := make(map[string]auditlog.Change, len(changes))
+	for key := range changes {
+		out[key] = auditlog.Change{Before: before[key], After: after[key]}
+	}
+	return out
+}
+
+func redactAuditValues(values map[string]string) map[string]string {
+	redacted := redactSettings(values)
+	for key, value := range values {
+		if value == "" {
+			redacted[key] = ""
+			continue
+		}
+		if isSensitiveAuditKey(key) {
+			redacted[key] = "***"
+		}
+	}
+	return redacted
+}
+
+func isSensitiveAuditKey(key string) bool {
+	key = strings.ToLower(key)
+	if idx := strings.LastIndex(key, "."); idx >= 0 {
+		if key[idx+1:] == "key" {
+			return true
+		}
+	}
+	for _, marker := range []string{"password", "secret", "private_key", "api_key", "access_key", "token", "signature", "webhook_url"} {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateSettings 保存系统配置并把变更的配置项写入审计记录。
+func (s *Server) updateSettings(c *gin.Context, values map[string]string) error {
+	ctx := c.Request.Context()
+	previous, err := s.admin.GetSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.admin.UpdateSettings(ctx, values); err != nil {
+		return err
+	}
+	before := make(map[string]string, len(values))
+	for key := range values {
+		before[key] = previous[key]
+	}
+	auditTarget(c, "", "settings", "")
+	auditChanges(c, before, values)
+	return nil
+}
+
+func (s *Server) handleAdminListAuditLogs(c *gin.Context) {
+	limit, offset := parsePagination(c, 50, 200)
+	filter := auditlog.Filter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("targetType"),
+		TargetID:   c.Query("targetId"),
+		Limit:      limit,
+		Offset:     offset,
+	}
+	if raw := strings.TrimSpace(c.Query("actorId")); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid actorId"})
+			return
+		}
+		filter.ActorID = uint(id)
+	}
+	for _, item := range []struct {
+		name   string
+		target **time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		raw := strings.TrimSpace(c.Query(item.name))
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + item.name})
+			return
+		}
+		*item.target = &parsed
+	}
+	items, total, err := s.auditLog.List(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"items": items, "total": total}})
+}
+
+// auditUserSnapshot 是写入审计 diff 的用户字段（不含密码等敏感信息）。
+func auditUserSnapshot(user data.User) gin.H {
+	if user.ID == 0 {
+		return nil
+	}
+	return gin.H{
+		"email":         user.Email,
+		"name":          user.Name,
+		"status":        user.Status,
+		"isAdmin":       user.IsAdmin,
+		"adminRoleId":   user.AdminRoleID,
+		"groupId":       user.GroupID,
+		"capacityBonus": user.CapacityBonus,
+	}
+}
+
+// auditStrategySnapshot 包含策略配置，凭据字段由 redactAuditChanges 脱敏。
+func auditStrategySnapshot(strategy data.Strategy) gin.H {
+	if strategy.ID == 0 {
+		return nil
+	}
+	return gin.H{
+		"name":    strategy.Name,
+		"key":     strategy.Key,
+		"intro":   strategy.Intro,
+		"configs": strategy.Configs,
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"skyimage/internal/admin"
+	"skyimage/internal/auditlog"
+	"skyimage/internal/captcha"
+	"skyimage/internal/data"
+	"skyimage/internal/redeem"
+	"skyimage/internal/shop"
+	"skyimage/internal/users"
+)
+
+func TestDefaultAuditAction(t *testing.T) {
+	cases := []struct {
+		method, path, action, target string
+	}{
+		{"PATCH", "/api/admin/users/:id/status", "users.status.update", "users"},
+		{"POST", "/api/admin/users", "users.create", "users"},
+		{"DELETE", "/api/admin/strategies/:id", "strategies.delete", "strategies"},
+		{"POST", "/api/admin/images/batch/delete", "images.batch.delete", "images"},
+		{"PUT", "/api/admin/system/site", "system.site.update", "system"},
+	}
+	for _, tc := range cases {
+		action, target := defaultAuditAction(tc.method, tc.path)
+		if action != tc.action || target != tc.target {
+			t.Fatalf("defaultAuditAction(%s %s) = %q, %q; want %q, %q", tc.method, tc.path, action, target, tc.action, tc.target)
+		}
+	}
+}
+
+func TestRedactAuditChanges(t *testing.T) {
+	changes := redactAuditChanges(map[string]auditlog.Change{
+		"mail.smtp.password":         {Before: "old", After: "new"},
+		"configs.secret_key":         {Before: "", After: "AKIA"},
+		"pay.epay.key":               {Before: "k1", After: "k2"},
+		"configs.bucket":             {Before: "a", After: "b"},
+		"captcha.cap.secret_key":     {Before: "x", After: ""},
+		"alerts.wecom.webhook_url":   {Before: "", After: "https://qyapi.weixin.qq.com/x?key=1"},
+		"features.registration_mode": {Before: "open", After: "closed"},
+	})
+	expect := map[string]auditlog.Change{
+		"mail.smtp.password":         {Before: "***", After: "***"},
+		"configs.secret_key":         {Before: "", After: "***"},
+		"pay.epay.key":               {Before: "***", After: "***"},
+		"configs.bucket":             {Before: "a", After: "b"},
+		"captcha.cap.secret_key":     {Before: "***", After: ""},
+		"alerts.wecom.webhook_url":   {Before: "", After: "***"},
+		"features.registration_mode": {Before: "open", After: "closed"},
+	}
+	for key, want := range expect {
+		if got := changes[key]; got != want {
+			t.Fatalf("%s: got %+v, want %+v", key, got, want)
+		}
+	}
+}
+
+func newAuditTestServer(t *testing.T) (*Server, *gorm.DB) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&data.User{}, &data.Group{}, &data.ConfigEntry{}, &data.AdminAuditLog{},
+		&data.FileAsset{}, &data.RedeemCode{}, &data.RedeemCodeUsage{}, &data.ShopProduct{}, &data.ShopOrder{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	adminSvc := admin.New(db)
+	return &Server{
+		db:       db,
+		admin:    adminSvc,
+		users:    users.New(db),
+		captcha:  captcha.New(adminSvc),
+		redeem:   redeem.New(db),
+		shop:     shop.New(db, adminSvc),
+		auditLog: auditlog.New(db, adminSvc),
+	}, db
+}
+
+func TestAccountRedeem_WritesAuditLog(t *testing.T) {
+	server, db := newAuditTestServer(t)
+	user := data.User{ID: 1000000000000001, Name: "member", Email: "member@example.com", PasswordHash: "x", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	code := data.RedeemCode{Code: "BONUS-1", RewardType: redeem.RewardTypeCapacity, CapacityDelta: 1024, Enabled: true, CreatedBy: user.ID}
+	if err := db.Create(&code).Error; err != nil {
+		t.Fatalf("create code: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/account/redeem", bytes.NewBufferString(`{"code":"BONUS-1"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("currentUser", user)
+	server.handleAccountRedeem(c)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var entry data.AdminAuditLog
+	if err := db.Where("action = ?", "redeem.use").First(&entry).Error; err != nil {
+		t.Fatalf("expected redeem audit entry: %v", err)
+	}
+	if entry.ActorID != user.ID || entry.TargetID != auditlog.TargetID(user.ID) {
+		t.Fatalf("unexpected actor/target: %+v", entry)
+	}
+	if !bytes.Contains([]byte(entry.Changes), []byte("BONUS-1")) || !bytes.Contains([]byte(entry.Changes), []byte("capacityBonus")) {
+		t.Fatalf("expected code and capacity change in audit entry, got %s", entry.Changes)
+	}
+}
+
+func TestPayNotify_WritesAuditLogOnce(t *testing.T) {
+	server, db := newAuditTestServer(t)
+	setConfig(t, db, "pay.epay.key", "notify-key")
+	group := data.Group{Name: "vip"}
+	if err := db.Create(&group).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	user := data.User{ID: 1000000000000002, Name: "buyer", Email: "buyer@example.com", PasswordHash: "x", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	order := data.ShopOrder{OrderNo: "SO-1", UserID: user.ID, ProductID: 1, ProductName: "VIP", PriceCents: 1000,
+		DurationDays: 30, GroupID: group.ID, Status: data.OrderStatusPending, Provider: "epay"}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	params := url.Values{
+		"out_trade_no": {"SO-1"},
+		"trade_no":     {"T-1"},
+		"trade_status": {"TRADE_SUCCESS"},
+		"money":        {"10.00"},
+	}
+	sum := md5.Sum([]byte("money=10.00&out_trade_no=SO-1&trade_no=T-1&trade_status=TRADE_SUCCESSnotify-key"))
+	params.Set("sign", hex.EncodeToString(sum[:]))
+
+	router := gin.New()
+	router.GET("/api/pay/notify/:provider", server.handlePayNotify)
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/pay/notify/epay?"+params.Encode(), nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("notify %d: expected 200, got %d: %s", i, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	var entries []data.AdminAuditLog
+	if err := db.Where("action = ?", "orders.paid").Find(&entries).Error; err != nil {
+		t.Fatalf("list audit entries: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected exactly one audit entry for the paid order, got %d", len(entries))
+	}
+	if entries[0].ActorID != 0 || entries[0].ActorEmail != "system/epay" || entries[0].TargetID != "SO-1" {
+		t.Fatalf("unexpected audit entry: %+v", entries[0])
+	}
+}
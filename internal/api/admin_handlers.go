@@ -9,8 +9,10 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
 	"skyimage/internal/admin"
+	"skyimage/internal/auditlog"
 	"skyimage/internal/captcha"
 	"skyimage/internal/data"
 	"skyimage/internal/files"
@@ -25,67 +27,122 @@ const defaultConsoleURL = "http://localhost:8080"
 
 func (s *Server) registerAdminRoutes(r *gin.RouterGroup) {
 	adminGroup := r.Group("/admin")
-	adminGroup.Use(s.authMiddleware(), middleware.RequireAdmin(), middleware.RequireCSRF())
+	adminGroup.Use(
+		s.scopedAuthMiddleware(middleware.ScopeByMethod(data.ApiTokenScopeAdminRead, data.ApiTokenScopeAdminWrite)),
+		middleware.RequireAdmin(),
+		middleware.BlockImpersonation(),
+		s.requireAdminTwoFactor(),
+		middleware.RequireCSRF(),
+		s.auditAdminMutations(),
+	)
+	// 概览对所有后台成员开放，其余路由按角色权限划分
 	adminGroup.GET("/metrics", s.handleAdminMetrics)
 	adminGroup.GET("/trends", s.handleAdminTrends)
-	adminGroup.GET("/settings", s.handleAdminSettings)
-	adminGroup.PUT("/settings", s.handleAdminUpdateSettings)
-	adminGroup.GET("/users", s.handleAdminUsers)
-	adminGroup.GET("/users/:id", s.handleAdminGetUser)
-	adminGroup.POST("/users", s.handleAdminCreateUser)
-	adminGroup.DELETE("/users/:id", s.handleAdminDeleteUser)
-	adminGroup.PATCH("/users/:id/status", s.handleAdminUpdateStatus)
-	adminGroup.POST("/users/:id/admin", s.handleAdminToggleAdmin)
-	adminGroup.PATCH("/users/:id/group", s.handleAdminAssignUserGroup)
-	adminGroup.PATCH("/users/:id/capacity-bonus", s.handleAdminAdjustCapacityBonus)
-
-	adminGroup.GET("/groups", s.handleAdminListGroups)
-	adminGroup.POST("/groups", s.handleAdminCreateGroup)
-	adminGroup.PUT("/groups/:id", s.handleAdminUpdateGroup)
-	adminGroup.DELETE("/groups/:id", s.handleAdminDeleteGroup)
-
-	adminGroup.GET("/redeem-codes", s.handleAdminListRedeemCodes)
-	adminGroup.POST("/redeem-codes", s.handleAdminCreateRedeemCode)
-	adminGroup.PUT("/redeem-codes/:id", s.handleAdminUpdateRedeemCode)
-	adminGroup.DELETE("/redeem-codes/:id", s.handleAdminDeleteRedeemCode)
-	adminGroup.GET("/redeem-codes/:id/usages", s.handleAdminListRedeemCodeUsages)
-
-	adminGroup.GET("/strategies", s.handleAdminListStrategies)
-	adminGroup.POST("/strategies", s.handleAdminCreateStrategy)
-	adminGroup.PUT("/strategies/:id", s.handleAdminUpdateStrategy)
-	adminGroup.DELETE("/strategies/:id", s.handleAdminDeleteStrategy)
-	adminGroup.GET("/audits", s.handleAdminListAuditProfiles)
-	adminGroup.POST("/audits", s.handleAdminCreateAuditProfile)
-	adminGroup.PUT("/audits/:id", s.handleAdminUpdateAuditProfile)
-	adminGroup.DELETE("/audits/:id", s.handleAdminDeleteAuditProfile)
-
-	adminGroup.GET("/images", s.handleAdminImages)
-	adminGroup.DELETE("/images/:id", s.handleAdminDeleteImage)
-	adminGroup.PATCH("/images/:id/visibility", s.handleAdminUpdateImageVisibility)
-	adminGroup.PATCH("/images/:id/audit-status", s.handleAdminUpdateImageAuditStatus)
-	adminGroup.PATCH("/images/batch/visibility", s.handleAdminBatchUpdateImageVisibility)
-	adminGroup.POST("/images/batch/delete", s.handleAdminBatchDeleteImages)
-
-	adminGroup.GET("/system/site", s.handleAdminSiteSettings)
-	adminGroup.PUT("/system/site", s.handleAdminUpdateSiteSettings)
-	adminGroup.GET("/system/general", s.handleAdminGeneralSettings)
-	adminGroup.PUT("/system/general", s.handleAdminUpdateGeneralSettings)
-	adminGroup.GET("/system/tickets", s.handleAdminTicketSettings)
-	adminGroup.PUT("/system/tickets", s.handleAdminUpdateTicketSettings)
-	adminGroup.GET("/system/email", s.handleAdminEmailSettings)
-	adminGroup.PUT("/system/email", s.handleAdminUpdateEmailSettings)
-	adminGroup.POST("/system/email/test", s.handleAdminTestSMTP)
-	adminGroup.GET("/system/captcha", s.handleAdminCaptchaSettings)
-	adminGroup.PUT("/system/captcha", s.handleAdminUpdateCaptchaSettings)
-	adminGroup.POST("/system/captcha/test-turnstile", s.handleAdminTestTurnstile)
-	adminGroup.POST("/system/captcha/test", s.handleAdminTestCaptcha)
-	adminGroup.GET("/system/oauth", s.handleAdminOAuthSettings)
-	adminGroup.GET("/system/database", s.handleAdminDatabaseConfig)
-	adminGroup.POST("/system/database/test", s.handleAdminDatabaseTest)
-	adminGroup.POST("/system/database/migrate", s.handleAdminDatabaseMigrate)
-	adminGroup.PUT("/system/oauth", s.handleAdminUpdateOAuthSettings)
-	s.registerAdminShopRoutes(adminGroup)
-	s.registerAdminTicketRoutes(adminGroup)
+
+	system := adminGroup.Group("", middleware.RequirePermission(data.AdminPermSystem))
+	system.GET("/settings", s.handleAdminSettings)
+	system.PUT("/settings", s.handleAdminUpdateSettings)
+	system.GET("/audit-logs", s.handleAdminListAuditLogs)
+	system.GET("/webhooks", s.handleAdminWebhooks)
+	system.POST("/webhooks", s.handleAdminCreateWebhook)
+	system.PUT("/webhooks/:id", s.handleAdminUpdateWebhook)
+	system.DELETE("/webhooks/:id", s.handleAdminDeleteWebhook)
+	system.GET("/webhooks/:id/deliveries", s.handleAdminWebhookDeliveries)
+	system.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", s.handleAdminRedeliverWebhook)
+
+	usersGroup := adminGroup.Group("", middleware.RequirePermission(data.AdminPermUsers))
+	usersGroup.GET("/users", s.handleAdminUsers)
+	usersGroup.GET("/users/:id", s.handleAdminGetUser)
+	usersGroup.POST("/users", s.handleAdminCreateUser)
+	usersGroup.DELETE("/users/:id", s.handleAdminDeleteUser)
+	usersGroup.PATCH("/users/:id/status", s.handleAdminUpdateStatus)
+	usersGroup.PATCH("/users/:id/group", s.handleAdminAssignUserGroup)
+	usersGroup.PATCH("/users/:id/capacity-bonus", s.handleAdminAdjustCapacityBonus)
+	usersGroup.DELETE("/users/:id/2fa", s.handleAdminResetTwoFactor)
+	usersGroup.DELETE("/users/:id/login-lock", s.handleAdminUnlockLogin)
+	usersGroup.POST("/users/:id/impersonate", s.handleAdminStartImpersonation)
+	usersGroup.DELETE("/users/:id/impersonate", s.handleAdminEndImpersonations)
+
+	rolesGroup := adminGroup.Group("", middleware.RequirePermission(data.AdminPermRoles))
+	rolesGroup.POST("/users/:id/admin", s.handleAdminToggleAdmin)
+	rolesGroup.PUT("/users/:id/role", s.handleAdminAssignRole)
+	rolesGroup.GET("/roles", s.handleAdminListRoles)
+	rolesGroup.POST("/roles", s.handleAdminCreateRole)
+	rolesGroup.PUT("/roles/:id", s.handleAdminUpdateRole)
+	rolesGroup.DELETE("/roles/:id", s.handleAdminDeleteRole)
+
+	groups := adminGroup.Group("", middleware.RequirePermission(data.AdminPermGroups))
+	groups.GET("/groups", s.handleAdminListGroups)
+	groups.POST("/groups", s.handleAdminCreateGroup)
+	groups.PUT("/groups/:id", s.handleAdminUpdateGroup)
+	groups.DELETE("/groups/:id", s.handleAdminDeleteGroup)
+
+	redeemGroup := adminGroup.Group("", middleware.RequirePermission(data.AdminPermRedeem))
+	redeemGroup.GET("/redeem-codes", s.handleAdminListRedeemCodes)
+	redeemGroup.POST("/redeem-codes", s.handleAdminCreateRedeemCode)
+	redeemGroup.PUT("/redeem-codes/:id", s.handleAdminUpdateRedeemCode)
+	redeemGroup.DELETE("/redeem-codes/:id", s.handleAdminDeleteRedeemCode)
+	redeemGroup.GET("/redeem-codes/:id/usages", s.handleAdminListRedeemCodeUsages)
+	redeemGroup.GET("/invite-codes", s.handleAdminListInviteCodes)
+	redeemGroup.POST("/invite-codes", s.handleAdminCreateInviteCode)
+	redeemGroup.PUT("/invite-codes/:id", s.handleAdminUpdateInviteCode)
+	redeemGroup.DELETE("/invite-codes/:id", s.handleAdminDeleteInviteCode)
+	redeemGroup.GET("/invite-codes/:id/usages", s.handleAdminListInviteCodeUsages)
+	redeemGroup.GET("/invite-settings", s.handleAdminInviteSettings)
+	redeemGroup.PUT("/invite-settings", s.handleAdminUpdateInviteSettings)
+
+	strategies := adminGroup.Group("", middleware.RequirePermission(data.AdminPermStrategies))
+	strategies.GET("/strategies", s.handleAdminListStrategies)
+	strategies.POST("/strategies", s.handleAdminCreateStrategy)
+	strategies.PUT("/strategies/:id", s.handleAdminUpdateStrategy)
+	strategies.DELETE("/strategies/:id", s.handleAdminDeleteStrategy)
+	system.GET("/audits", s.handleAdminListAuditProfiles)
+	system.POST("/audits", s.handleAdminCreateAuditProfile)
+	system.PUT("/audits/:id", s.handleAdminUpdateAuditProfile)
+	system.DELETE("/audits/:id", s.handleAdminDeleteAuditProfile)
+
+	moderation := adminGroup.Group("", middleware.RequirePermission(data.AdminPermModeration))
+	moderation.GET("/images", s.handleAdminImages)
+	moderation.DELETE("/images/:id", s.handleAdminDeleteImage)
+	moderation.PATCH("/images/:id/visibility", s.handleAdminUpdateImageVisibility)
+	moderation.PATCH("/images/:id/audit-status", s.handleAdminUpdateImageAuditStatus)
+	moderation.PATCH("/images/batch/visibility", s.handleAdminBatchUpdateImageVisibility)
+	moderation.POST("/images/batch/delete", s.handleAdminBatchDeleteImages)
+	moderation.GET("/moderation", s.handleAdminModerationQueue)
+	moderation.POST("/moderation/batch", s.handleAdminModerationBatch)
+	moderation.GET("/hash-blocklist", s.handleAdminListHashBlocks)
+	moderation.POST("/hash-blocklist", s.handleAdminCreateHashBlocks)
+	moderation.DELETE("/hash-blocklist/:id", s.handleAdminDeleteHashBlock)
+	moderation.GET("/images/placeholders/backfill", s.handleAdminPlaceholderBackfillStatus)
+	moderation.POST("/images/placeholders/backfill", s.handleAdminStartPlaceholderBackfill)
+
+	system.GET("/system/site", s.handleAdminSiteSettings)
+	system.PUT("/system/site", s.handleAdminUpdateSiteSettings)
+	system.GET("/system/general", s.handleAdminGeneralSettings)
+	system.PUT("/system/general", s.handleAdminUpdateGeneralSettings)
+	system.GET("/system/email", s.handleAdminEmailSettings)
+	system.PUT("/system/email", s.handleAdminUpdateEmailSettings)
+	system.POST("/system/email/test", s.handleAdminTestSMTP)
+	system.GET("/system/captcha", s.handleAdminCaptchaSettings)
+	system.PUT("/system/captcha", s.handleAdminUpdateCaptchaSettings)
+	system.POST("/system/captcha/test-turnstile", s.handleAdminTestTurnstile)
+	system.POST("/system/captcha/test", s.handleAdminTestCaptcha)
+	system.GET("/system/oauth", s.handleAdminOAuthSettings)
+	system.GET("/system/database", s.handleAdminDatabaseConfig)
+	system.POST("/system/database/test", s.handleAdminDatabaseTest)
+	system.POST("/system/database/migrate", s.handleAdminDatabaseMigrate)
+	system.PUT("/system/oauth", s.handleAdminUpdateOAuthSettings)
+	system.GET("/system/s3", s.handleAdminS3Settings)
+	system.PUT("/system/s3", s.handleAdminUpdateS3Settings)
+	system.GET("/system/alerts", s.handleAdminAlertSettings)
+	system.PUT("/system/alerts", s.handleAdminUpdateAlertSettings)
+	system.POST("/system/alerts/test", s.handleAdminTestAlert)
+
+	tickets := adminGroup.Group("", middleware.RequirePermission(data.AdminPermTickets))
+	tickets.GET("/system/tickets", s.handleAdminTicketSettings)
+	tickets.PUT("/system/tickets", s.handleAdminUpdateTicketSettings)
+	s.registerAdminShopRoutes(adminGroup.Group("", middleware.RequirePermission(data.AdminPermShop)))
+	s.registerAdminTicketRoutes(tickets)
 }
 
 func requireSuperAdmin(c *gin.Context) bool {
@@ -216,10 +273,16 @@ func (s *Server) handleAdminUpdateStatus(c *gin.Context) {
 		}
 	}
 
+	previous, _ := s.users.FindByID(c.Request.Context(), id)
 	if err := s.users.UpdateStatus(c.Request.Context(), actor, id, payload.Status); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(userMutationStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
+	auditChange(c, gin.H{"status": previous.Status}, gin.H{"status": payload.Status})
+	// 禁用账户时立即注销其全部会话
+	if payload.Status == 0 {
+		s.revokeUserSessions(c, id, "")
+	}
 	c.JSON(http.StatusOK, gin.H{"data": "updated"})
 }
 
@@ -242,29 +305,44 @@ func (s *Server) handleAdminToggleAdmin(c *gin.Context) {
 		return
 	}
 
-	// 演示站模式：禁止修改演示账户角色
+	if s.isDemoProtectedUser(c, id) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "演示站禁止修改此账户角色"})
+		return
+	}
+
+	previous, _ := s.users.FindByID(c.Request.Context(), id)
+	if err := s.users.ToggleAdmin(c.Request.Context(), actor, id, payload.Admin); err != nil {
+		c.JSON(userMutationStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	auditChange(c, gin.H{"isAdmin": previous.IsAdmin, "adminRoleId": previous.AdminRoleID}, gin.H{"isAdmin": payload.Admin})
+	c.JSON(http.StatusOK, gin.H{"data": "updated"})
+}
+
+// userMutationStatus 将越权修改管理员的错误映射为 403，其余错误使用 fallback。
+func userMutationStatus(err error, fallback int) int {
+	if errors.Is(err, users.ErrFullAdminRequired) || errors.Is(err, users.ErrFullAdminTarget) || errors.Is(err, users.ErrSuperAdminImmutable) {
+		return http.StatusForbidden
+	}
+	return fallback
+}
+
+// isDemoProtectedUser 判断演示站模式下目标账户是否为受保护的演示账户。
+func (s *Server) isDemoProtectedUser(c *gin.Context, id uint) bool {
 	s.mu.RLock()
 	demoMode := s.cfg.DemoMode
 	adminEmail := strings.ToLower(strings.TrimSpace(s.cfg.AdminEmail))
 	demoUserEmail := strings.ToLower(strings.TrimSpace(s.cfg.DemoUserEmail))
 	s.mu.RUnlock()
-
-	if demoMode {
-		target, findErr := s.users.FindByID(c.Request.Context(), id)
-		if findErr == nil {
-			targetEmail := strings.ToLower(strings.TrimSpace(target.Email))
-			if targetEmail == adminEmail || targetEmail == demoUserEmail {
-				c.JSON(http.StatusForbidden, gin.H{"error": "演示站禁止修改此账户角色"})
-				return
-			}
-		}
+	if !demoMode {
+		return false
 	}
-
-	if err := s.users.ToggleAdmin(c.Request.Context(), actor, id, payload.Admin); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	target, err := s.users.FindByID(c.Request.Context(), id)
+	if err != nil {
+		return false
 	}
-	c.JSON(http.StatusOK, gin.H{"data": "updated"})
+	targetEmail := strings.ToLower(strings.TrimSpace(target.Email))
+	return targetEmail == adminEmail || targetEmail == demoUserEmail
 }
 
 func (s *Server) handleAdminAssignUserGroup(c *gin.Context) {
@@ -306,7 +384,7 @@ func (s *Server) handleAdminAssignUserGroup(c *gin.Context) {
 
 	user, err := s.users.AssignGroup(c.Request.Context(), actor, id, payload.GroupID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(userMutationStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"data": user})
@@ -346,6 +424,7 @@ func (s *Server) handleAdminAdjustCapacityBonus(c *gin.Context) {
 		return
 	}
 
+	previous, _ := s.users.FindByID(c.Request.Context(), id)
 	var user data.User
 	if payload.DeltaBytes != nil {
 		user, err = s.users.AdjustCapacityBonus(c.Request.Context(), actor, id, *payload.DeltaBytes)
@@ -353,9 +432,10 @@ func (s *Server) handleAdminAdjustCapacityBonus(c *gin.Context) {
 		user, err = s.users.SetCapacityBonus(c.Request.Context(), actor, id, *payload.BonusBytes)
 	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(userMutationStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
 		return
 	}
+	auditChange(c, gin.H{"capacityBonus": previous.CapacityBonus}, gin.H{"capacityBonus": user.CapacityBonus})
 	c.JSON(http.StatusOK, gin.H{"data": user})
 }
 
@@ -372,9 +452,15 @@ func (s *Server) handleAdminCreateUser(c *gin.Context) {
 	}
 	user, err := s.users.CreateUser(c.Request.Context(), actor, payload)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		status := http.StatusBadRequest
+		if errors.Is(err, users.ErrFullAdminRequired) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	auditTarget(c, "", "", auditlog.TargetID(user.ID))
+	auditChange(c, nil, auditUserSnapshot(user))
 	c.JSON(http.StatusOK, gin.H{"data": user})
 }
 
@@ -408,10 +494,12 @@ func (s *Server) handleAdminDeleteUser(c *gin.Context) {
 		}
 	}
 
+	previous, _ := s.users.FindByID(c.Request.Context(), id)
 	if err := s.users.DeleteUser(c.Request.Context(), actor, id); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(userMutationStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
 		return
 	}
+	auditChange(c, auditUserSnapshot(previous), nil)
 	c.JSON(http.StatusOK, gin.H{"data": "deleted"})
 }
 
@@ -521,6 +609,8 @@ func (s *Server) handleAdminCreateStrategy(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	auditTarget(c, "", "", auditlog.TargetID(item.ID))
+	auditChange(c, nil, auditStrategySnapshot(item))
 	c.JSON(http.StatusOK, gin.H{"data": item})
 }
 
@@ -558,6 +648,7 @@ func (s *Server) handleAdminUpdateStrategy(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	auditChange(c, auditStrategySnapshot(existing), auditStrategySnapshot(item))
 	c.JSON(http.StatusOK, gin.H{"data": item})
 }
 
@@ -576,10 +667,12 @@ func (s *Server) handleAdminDeleteStrategy(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
+	previous, _ := s.admin.FindStrategyByID(c.Request.Context(), uint(id))
 	if err := s.admin.DeleteStrategy(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	auditChange(c, auditStrategySnapshot(previous), nil)
 	c.JSON(http.StatusOK, gin.H{"data": "deleted"})
 }
 
@@ -677,10 +770,12 @@ func (s *Server) handleAdminDeleteImage(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	previous, _ := s.files.FindByID(c.Request.Context(), uint(id))
 	if err := s.files.DeleteByAdmin(c.Request.Context(), uint(id), payload.Reason); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	auditChange(c, gin.H{"name": previous.OriginalName, "path": previous.Path, "userId": auditlog.TargetID(previous.UserID)}, gin.H{"reason": payload.Reason})
 	c.JSON(http.StatusOK, gin.H{"data": "deleted"})
 }
 
@@ -724,12 +819,12 @@ func (s *Server) handleAdminUpdateImageAuditStatus(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	file, err := s.files.UpdateAuditStatusByAdmin(c.Request.Context(), uint(id), payload.Status)
+	viewer, _ := middleware.CurrentUser(c)
+	file, err := s.files.UpdateAuditStatusByReviewer(c.Request.Context(), viewer.ID, uint(id), payload.Status)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	viewer, _ := middleware.CurrentUser(c)
 	dto, err := s.files.ToDTOForViewer(c.Request.Context(), file, &viewer)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -769,9 +864,156 @@ func (s *Server) handleAdminBatchDeleteImages(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	auditChange(c, gin.H{"ids": payload.IDs}, gin.H{"deleted": deleted, "reason": payload.Reason})
 	c.JSON(http.StatusOK, gin.H{"data": gin.H{"deleted": deleted}})
 }
 
+func (s *Server) handleAdminModerationQueue(c *gin.Context) {
+	limit, offset := parsePagination(c, 50, 100)
+	minScore, _ := strconv.ParseFloat(strings.TrimSpace(c.Query("minScore")), 64)
+	maxScore, _ := strconv.ParseFloat(strings.TrimSpace(c.Query("maxScore")), 64)
+	items, total, err := s.files.ListModerationQueue(c.Request.Context(), files.ModerationQuery{
+		Status:   c.Query("status"),
+		Decision: c.Query("decision"),
+		Provider: c.Query("provider"),
+		Label:    c.Query("label"),
+		MinScore: minScore,
+		MaxScore: maxScore,
+		Sort:     c.Query("sort"),
+		Limit:    limit,
+		Offset:   offset,
+	})
+	if err != nil {
+		c.JSON(statusCodeFromError(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	viewer, _ := middleware.CurrentUser(c)
+	dtos := make([]files.FileDTO, 0, len(items))
+	for _, file := range items {
+		dto, err := s.files.ToDTOForViewer(c.Request.Context(), file, &viewer)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		dtos = append(dtos, dto)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"items": dtos, "total": total}})
+}
+
+func (s *Server) handleAdminModerationBatch(c *gin.Context) {
+	var payload struct {
+		IDs       []uint `json:"ids"`
+		Action    string `json:"action"`
+		Reason    string `json:"reason"`
+		BlockHash bool   `json:"blockHash"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(payload.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要处理的图片"})
+		return
+	}
+	action, err := files.NormalizeModerationAction(payload.Action)
+	if err != nil {
+		c.JSON(statusCodeFromError(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+	viewer, _ := middleware.CurrentUser(c)
+	// 屏蔽需在删除前完成，否则无法再读取原图生成指纹
+	if payload.BlockHash && action != files.ModerationActionApprove {
+		if _, err := s.files.BlockFileHashes(c.Request.Context(), viewer.ID, payload.IDs, payload.Reason); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	result, err := s.files.ModerateBatch(c.Request.Context(), viewer.ID, payload.IDs, action, payload.Reason)
+	if err != nil {
+		c.JSON(statusCodeFromError(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+func (s *Server) handleAdminListHashBlocks(c *gin.Context) {
+	limit, offset := parsePagination(c, 50, 100)
+	items, total, err := s.files.ListHashBlocks(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"items": items, "total": total}})
+}
+
+func (s *Server) handleAdminCreateHashBlocks(c *gin.Context) {
+	var payload struct {
+		FileIDs []uint `json:"fileIds"`
+		Reason  string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(payload.FileIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要屏蔽的图片"})
+		return
+	}
+	viewer, _ := middleware.CurrentUser(c)
+	items, err := s.files.BlockFileHashes(c.Request.Context(), viewer.ID, payload.FileIDs, payload.Reason)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "图片不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": items})
+}
+
+func (s *Server) handleAdminDeleteHashBlock(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := s.files.DeleteHashBlock(c.Request.Context(), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "屏蔽记录不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": "deleted"})
+}
+
+func (s *Server) handleAdminPlaceholderBackfillStatus(c *gin.Context) {
+	status, err := s.files.PlaceholderBackfillStatus(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": status})
+}
+
+func (s *Server) handleAdminStartPlaceholderBackfill(c *gin.Context) {
+	if !requireSuperAdmin(c) {
+		return
+	}
+	if !s.files.StartPlaceholderBackfill() {
+		c.JSON(http.StatusConflict, gin.H{"error": "补算任务正在运行"})
+		return
+	}
+	status, err := s.files.PlaceholderBackfillStatus(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"data": status})
+}
+
 func (s *Server) handleAdminSettings(c *gin.Context) {
 	if !requireSuperAdmin(c) {
 		return
@@ -793,7 +1035,7 @@ func (s *Server) handleAdminUpdateSettings(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := s.admin.UpdateSettings(c.Request.Context(), payload); err != nil {
+	if err := s.updateSettings(c, payload); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -859,7 +1101,7 @@ func (s *Server) handleAdminTestTurnstile(c *gin.Context) {
 	}
 	signature := captcha.GenerateSignature(payload.SiteKey, secretKey)
 	now := time.Now().UTC().Format(time.RFC3339)
-	if err := s.admin.UpdateSettings(c.Request.Context(), map[string]string{
+	if err := s.updateSettings(c, map[string]string{
 		"turnstile.last_verified_signature": signature,
 		"turnstile.last_verified_at":        now,
 	}); err != nil {
@@ -1052,7 +1294,7 @@ func (s *Server) handleAdminTestCaptcha(c *gin.Context) {
 		settingsUpdate["captcha.cap.last_verified_at"] = now
 	}
 
-	if err := s.admin.UpdateSettings(c.Request.Context(), settingsUpdate); err != nil {
+	if err := s.updateSettings(c, settingsUpdate); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -1102,6 +1344,8 @@ func (s *Server) handleAdminCreateRedeemCode(c *gin.Context) {
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	auditTarget(c, "", "", auditlog.TargetID(item.ID))
+	auditChange(c, nil, item)
 	c.JSON(http.StatusOK, gin.H{"data": item})
 }
 
@@ -1130,6 +1374,7 @@ func (s *Server) handleAdminUpdateRedeemCode(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	previous, _ := s.redeem.Get(c.Request.Context(), uint(id))
 	item, err := s.redeem.Update(c.Request.Context(), actor, uint(id), payload)
 	if err != nil {
 		status := http.StatusBadRequest
@@ -1141,6 +1386,7 @@ func (s *Server) handleAdminUpdateRedeemCode(c *gin.Context) {
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	auditChange(c, previous, item)
 	c.JSON(http.StatusOK, gin.H{"data": item})
 }
 
@@ -1164,6 +1410,7 @@ func (s *Server) handleAdminDeleteRedeemCode(c *gin.Context) {
 		return
 	}
 
+	previous, _ := s.redeem.Get(c.Request.Context(), uint(id))
 	if err := s.redeem.Delete(c.Request.Context(), actor, uint(id)); err != nil {
 		status := http.StatusBadRequest
 		if errors.Is(err, redeem.ErrCodeNotFound) {
@@ -1174,6 +1421,7 @@ func (s *Server) handleAdminDeleteRedeemCode(c *gin.Context) {
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	auditChange(c, previous, nil)
 	c.JSON(http.StatusOK, gin.H{"data": "deleted"})
 }
 
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/data"
+	"skyimage/internal/loginguard"
+)
+
+func TestAdminModerationBatch_ValidatesActionBeforeBlockingHashes(t *testing.T) {
+	client := newLskyContractServer(t)
+	db := client.server.db
+	file := data.FileAsset{UserID: 1000000000000001, Key: "suspect", Name: "suspect.png", Path: "/tmp/suspect.png", Size: 5,
+		MimeType: "image/png", PerceptualHash: "ff00ff00ff00ff00", AuditStatus: "pending"}
+	if err := db.Create(&file).Error; err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/admin/moderation/batch",
+		bytes.NewBufferString(`{"ids":[`+strconv.FormatUint(uint64(file.ID), 10)+`],"action":"ban","blockHash":true}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	client.server.handleAdminModerationBatch(c)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown action, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var count int64
+	if err := db.Model(&data.ImageHashBlock{}).Count(&count).Error; err != nil {
+		t.Fatalf("failed to count hash blocks: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("expected no hash block for a rejected request, got %d", count)
+	}
+}
+
+func TestAdminUnlockLogin_ScopedAdminCannotUnlockFullAdmin(t *testing.T) {
+	server, db := newAuthTestServer(t)
+	if err := db.AutoMigrate(&data.LoginFailure{}, &data.LoginHistory{}); err != nil {
+		t.Fatalf("failed to migrate login guard tables: %v", err)
+	}
+	server.loginGuard = loginguard.New(db)
+	target := data.User{ID: 1000000000000002, Name: "admin", Email: "admin@example.com", PasswordHash: "x", Status: 1, IsAdmin: true}
+	if err := db.Create(&target).Error; err != nil {
+		t.Fatalf("failed to create admin: %v", err)
+	}
+	key := loginguard.AccountKey(target.Email)
+	if err := server.loginGuard.Reserve(context.Background(), key); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	unlock := func(actor data.User) int {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+		c.Params = gin.Params{{Key: "id", Value: strconv.FormatUint(uint64(target.ID), 10)}}
+		c.Set("currentUser", actor)
+		server.handleAdminUnlockLogin(c)
+		return recorder.Code
+	}
+
+	roleID := uint(7)
+	scoped := data.User{ID: 1000000000000003, IsAdmin: true, AdminRoleID: &roleID, Permissions: []string{data.AdminPermUsers}}
+	if code := unlock(scoped); code != http.StatusForbidden {
+		t.Fatalf("expected scoped admin to be rejected, got %d", code)
+	}
+	var count int64
+	db.Model(&data.LoginFailure{}).Where("failure_key = ?", key).Count(&count)
+	if count != 1 {
+		t.Fatalf("failure counter must survive a rejected unlock")
+	}
+	if code := unlock(data.User{ID: 1000000000000004, IsAdmin: true}); code != http.StatusOK {
+		t.Fatalf("expected full admin to unlock, got %d", code)
+	}
+}
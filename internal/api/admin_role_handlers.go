@@ -0,0 +1,133 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+	"skyimage/internal/middleware"
+	"skyimage/internal/roles"
+)
+
+func roleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, roles.ErrNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, roles.ErrNameTaken), errors.Is(err, roles.ErrRoleInUse):
+		return http.StatusConflict
+	case errors.Is(err, roles.ErrSelfAssign), errors.Is(err, roles.ErrSuperAdminRole), errors.Is(err, roles.ErrBuiltIn),
+		errors.Is(err, roles.ErrOwnRole), errors.Is(err, roles.ErrEscalation):
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func parseRoleID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (s *Server) handleAdminListRoles(c *gin.Context) {
+	items, err := s.roles.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"items":       items,
+		"permissions": data.AllAdminPermissions(),
+	}})
+}
+
+func (s *Server) handleAdminCreateRole(c *gin.Context) {
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing user"})
+		return
+	}
+	var input roles.Input
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role, err := s.roles.Create(c.Request.Context(), actor, input)
+	if err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": roles.RoleDTO{AdminRole: role, Permissions: role.PermissionList()}})
+}
+
+func (s *Server) handleAdminUpdateRole(c *gin.Context) {
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing user"})
+		return
+	}
+	id, ok := parseRoleID(c)
+	if !ok {
+		return
+	}
+	var input roles.Input
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role, err := s.roles.Update(c.Request.Context(), actor, id, input)
+	if err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": roles.RoleDTO{AdminRole: role, Permissions: role.PermissionList()}})
+}
+
+func (s *Server) handleAdminDeleteRole(c *gin.Context) {
+	id, ok := parseRoleID(c)
+	if !ok {
+		return
+	}
+	if err := s.roles.Delete(c.Request.Context(), id); err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": "deleted"})
+}
+
+// handleAdminAssignRole 为用户分配后台角色；roleId 为空时撤销其后台权限。
+func (s *Server) handleAdminAssignRole(c *gin.Context) {
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing user"})
+		return
+	}
+	id, err := parseRouteUserID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var payload struct {
+		RoleID *uint `json:"roleId"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if s.isDemoProtectedUser(c, id) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "演示站禁止修改此账户角色"})
+		return
+	}
+	if err := s.roles.Assign(c.Request.Context(), actor, id, payload.RoleID); err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": "updated"})
+}
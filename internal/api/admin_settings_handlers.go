@@ -8,9 +8,12 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"skyimage/internal/auditlog"
 	"skyimage/internal/captcha"
+	"skyimage/internal/files"
 	"skyimage/internal/notifications"
 	"skyimage/internal/tickets"
+	"skyimage/internal/twofactor"
 )
 
 func parseUintSetting(raw string) uint {
@@ -25,6 +28,10 @@ func parseUintSetting(raw string) uint {
 	return uint(value)
 }
 
+func boolPtr(value bool) *bool {
+	return &value
+}
+
 // ---------------------------------------------------------------------------
 // Site Settings (GET/PUT /admin/system/site)
 // ---------------------------------------------------------------------------
@@ -49,8 +56,11 @@ type siteSettingsPayload struct {
 	EnableHome            bool   `json:"enableHome"`
 	EnableApi             bool   `json:"enableApi"`
 	EnablePasskey         bool   `json:"enablePasskey"`
+	EnableGalleryFeed     *bool  `json:"enableGalleryFeed"`
+	EnableUserFeeds       *bool  `json:"enableUserFeeds"`
+	EnableSitemap         *bool  `json:"enableSitemap"`
 	AllowRegistration     bool   `json:"allowRegistration"` // legacy, derived from registrationMode
-	RegistrationMode      string `json:"registrationMode"`  // open | oauth_only | closed
+	RegistrationMode      string `json:"registrationMode"`  // open | oauth_only | invite | closed
 	AccountDisabledNotice string `json:"accountDisabledNotice"`
 }
 
@@ -102,6 +112,9 @@ func (s *Server) handleAdminSiteSettings(c *gin.Context) {
 		EnableHome:            settings["features.home"] != "false",
 		EnableApi:             settings["features.api"] != "false",
 		EnablePasskey:         settings["features.passkeys_enabled"] != "false",
+		EnableGalleryFeed:     boolPtr(settings[settingGalleryFeed] != "false"),
+		EnableUserFeeds:       boolPtr(settings[settingUserFeeds] != "false"),
+		EnableSitemap:         boolPtr(settings[settingSitemap] != "false"),
 		AllowRegistration:     regMode != "closed",
 		RegistrationMode:      regMode,
 		AccountDisabledNotice: disabledNotice,
@@ -134,7 +147,7 @@ func (s *Server) handleAdminUpdateSiteSettings(c *gin.Context) {
 
 	regMode := strings.ToLower(strings.TrimSpace(payload.RegistrationMode))
 	switch regMode {
-	case "open", "oauth_only", "closed":
+	case "open", "oauth_only", "invite", "closed":
 	default:
 		// Backward compatible: allowRegistration bool only
 		if payload.AllowRegistration {
@@ -167,12 +180,22 @@ func (s *Server) handleAdminUpdateSiteSettings(c *gin.Context) {
 		"features.passkeys_enabled":   strconv.FormatBool(payload.EnablePasskey),
 		"account.disabled_notice":     notice,
 	}
+	// 订阅源与站点地图开关未提交时保持原值
+	for key, value := range map[string]*bool{
+		settingGalleryFeed: payload.EnableGalleryFeed,
+		settingUserFeeds:   payload.EnableUserFeeds,
+		settingSitemap:     payload.EnableSitemap,
+	} {
+		if value != nil {
+			values[key] = strconv.FormatBool(*value)
+		}
+	}
 
 	oldSettings, _ := s.admin.GetSettings(c.Request.Context())
 	oldConsole := strings.TrimSpace(oldSettings["site.console_url"])
 	newConsole := strings.TrimSpace(payload.ConsoleURL)
 
-	if err := s.admin.UpdateSettings(c.Request.Context(), values); err != nil {
+	if err := s.updateSettings(c, values); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -198,6 +221,9 @@ type generalSettingsPayload struct {
 	AdminImageDeleteDefaultReason string `json:"adminImageDeleteDefaultReason"`
 	SystemAutoDeleteDefaultReason string `json:"systemAutoDeleteDefaultReason"`
 	EnableCDN                     bool   `json:"enableCDN"`
+	HashBlockDistance             *int   `json:"hashBlockDistance,omitempty"`
+	RequireAdminTwoFactor         *bool  `json:"requireAdminTwoFactor,omitempty"`
+	AuditRetentionDays            *int   `json:"auditRetentionDays,omitempty"` // 0 = keep forever
 }
 
 func (s *Server) handleAdminGeneralSettings(c *gin.Context) {
@@ -217,6 +243,12 @@ func (s *Server) handleAdminGeneralSettings(c *gin.Context) {
 		SystemAutoDeleteDefaultReason: notifications.NormalizeSystemAutoDeleteReason(settings[notifications.ConfigSystemAutoDeleteReason]),
 		EnableCDN:                     settings["mail.cdn.enabled"] == "true",
 	}
+	hashBlockDistance := files.NormalizeHashBlockDistance(settings[files.ConfigHashBlockDistance])
+	payload.HashBlockDistance = &hashBlockDistance
+	requireAdminTwoFactor := settings[twofactor.ConfigKeyRequireAdmin] == "true"
+	payload.RequireAdminTwoFactor = &requireAdminTwoFactor
+	auditRetentionDays := auditlog.NormalizeRetentionDays(settings[auditlog.ConfigRetentionDays])
+	payload.AuditRetentionDays = &auditRetentionDays
 	c.JSON(http.StatusOK, gin.H{"data": payload})
 }
 
@@ -240,8 +272,17 @@ func (s *Server) handleAdminUpdateGeneralSettings(c *gin.Context) {
 		notifications.ConfigSystemAutoDeleteReason: systemAutoDeleteReason,
 		"mail.cdn.enabled":                         strconv.FormatBool(payload.EnableCDN),
 	}
+	if payload.HashBlockDistance != nil {
+		values[files.ConfigHashBlockDistance] = strconv.Itoa(files.NormalizeHashBlockDistanceValue(*payload.HashBlockDistance))
+	}
+	if payload.RequireAdminTwoFactor != nil {
+		values[twofactor.ConfigKeyRequireAdmin] = strconv.FormatBool(*payload.RequireAdminTwoFactor)
+	}
+	if payload.AuditRetentionDays != nil {
+		values[auditlog.ConfigRetentionDays] = strconv.Itoa(auditlog.NormalizeRetentionDaysValue(*payload.AuditRetentionDays))
+	}
 
-	if err := s.admin.UpdateSettings(c.Request.Context(), values); err != nil {
+	if err := s.updateSettings(c, values); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -316,7 +357,7 @@ func (s *Server) handleAdminUpdateTicketSettings(c *gin.Context) {
 		tickets.ConfigEmailNotifyMode:      mode,
 		tickets.ConfigEmailNotifyAdminIDs:  strings.Join(ids, ","),
 	}
-	if err := s.admin.UpdateSettings(c.Request.Context(), values); err != nil {
+	if err := s.updateSettings(c, values); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -459,7 +500,7 @@ func (s *Server) handleAdminUpdateEmailSettings(c *gin.Context) {
 		"mail.forgot_password.turnstile_reset":     strconv.FormatBool(payload.EnableForgotPasswordTurnstileReset),
 	}
 
-	if err := s.admin.UpdateSettings(c.Request.Context(), values); err != nil {
+	if err := s.updateSettings(c, values); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -679,7 +720,7 @@ func (s *Server) handleAdminUpdateCaptchaSettings(c *gin.Context) {
 		values["captcha.cap.last_verified_at"] = ""
 	}
 
-	if err := s.admin.UpdateSettings(c.Request.Context(), values); err != nil {
+	if err := s.updateSettings(c, values); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -830,7 +871,7 @@ func (s *Server) handleAdminUpdateOAuthSettings(c *gin.Context) {
 		"oauth.custom.userinfo_url":   strings.TrimRight(strings.TrimSpace(payload.Custom.UserInfoURL), "?&"),
 		"oauth.custom.scopes":         firstNonEmptyTrim(payload.Custom.Scopes, "openid profile email"),
 	}
-	if err := s.admin.UpdateSettings(c.Request.Context(), values); err != nil {
+	if err := s.updateSettings(c, values); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
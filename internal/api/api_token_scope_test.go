@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/data"
+	"skyimage/internal/middleware"
+)
+
+func TestScopedAuthMiddleware_EnforcesTokenScopesAndIPs(t *testing.T) {
+	server, db := newAuthTestServer(t)
+	if err := db.AutoMigrate(&data.ApiToken{}); err != nil {
+		t.Fatalf("failed to migrate api tokens: %v", err)
+	}
+	user := data.User{ID: 1000000000000001, Name: "ci", Email: "ci@example.com", PasswordHash: "hashed", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	createToken := func(raw, scopes, cidrs string) {
+		token := data.ApiToken{
+			UserID:       user.ID,
+			Token:        data.HashAPIToken(raw),
+			Scopes:       scopes,
+			AllowedCIDRs: cidrs,
+			ExpiresAt:    time.Now().Add(time.Hour),
+		}
+		if err := db.Create(&token).Error; err != nil {
+			t.Fatalf("failed to create token: %v", err)
+		}
+	}
+	createToken("sk_upload", data.ApiTokenScopeFilesUpload, "")
+	createToken("sk_full", "", "")
+	createToken("sk_office", data.ApiTokenScopeFilesUpload, "10.0.0.0/8")
+
+	engine := gin.New()
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"data": "ok"}) }
+	engine.POST("/upload", server.scopedAuthMiddleware(middleware.Scope(data.ApiTokenScopeFilesUpload)), ok)
+	engine.DELETE("/files", server.scopedAuthMiddleware(middleware.Scope(data.ApiTokenScopeFilesDelete)), ok)
+	engine.GET("/shop", server.authMiddleware(), ok)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"scoped upload", http.MethodPost, "/upload", "sk_upload", http.StatusOK},
+		{"scoped delete denied", http.MethodDelete, "/files", "sk_upload", http.StatusForbidden},
+		{"unscoped route denied", http.MethodGet, "/shop", "sk_upload", http.StatusForbidden},
+		{"full token", http.MethodGet, "/shop", "sk_full", http.StatusOK},
+		{"ip restricted", http.MethodPost, "/upload", "sk_office", http.StatusForbidden},
+		{"invalid token", http.MethodPost, "/upload", "sk_missing", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			req.RemoteAddr = "203.0.113.7:1234"
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, req)
+			if recorder.Code != tc.want {
+				t.Fatalf("expected %d, got %d: %s", tc.want, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestNormalizeApiTokenRestrictions_TokenCannotMintWiderToken(t *testing.T) {
+	client := newLskyContractServer(t)
+	server := client.server
+	var strategy data.Strategy
+	if err := server.db.First(&strategy).Error; err != nil {
+		t.Fatalf("load strategy: %v", err)
+	}
+	user, err := server.users.FindByID(context.Background(), 1000000000000001)
+	if err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	caller := data.ApiToken{
+		Scopes:       data.ApiTokenScopeFilesUpload + "," + data.ApiTokenScopeTokens,
+		StrategyIDs:  data.JoinApiTokenStrategyIDs([]uint{strategy.ID}),
+		AllowedCIDRs: "10.0.0.0/8",
+	}
+	normalize := func(payload apiTokenRestrictionPayload) (apiTokenRestrictions, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+		c.Set("currentApiToken", caller)
+		return server.normalizeApiTokenRestrictions(c, user, payload)
+	}
+
+	// 未指定的限制沿用调用方 Token，而不是变成不受限
+	got, err := normalize(apiTokenRestrictionPayload{})
+	if err != nil {
+		t.Fatalf("normalize defaults: %v", err)
+	}
+	if got.Scopes != caller.Scopes || got.StrategyIDs != caller.StrategyIDs || got.AllowedCIDRs != caller.AllowedCIDRs {
+		t.Fatalf("expected caller restrictions to be inherited, got %+v", got)
+	}
+	empty := []uint{}
+	noIPs := []string{}
+	if got, err := normalize(apiTokenRestrictionPayload{StrategyIDs: &empty, AllowedIPs: &noIPs}); err != nil || got.StrategyIDs == "" || got.AllowedCIDRs == "" {
+		t.Fatalf("clearing restrictions must keep the caller's limits, got %+v (%v)", got, err)
+	}
+
+	narrower := []string{"10.1.2.3"}
+	if got, err := normalize(apiTokenRestrictionPayload{AllowedIPs: &narrower}); err != nil || got.AllowedCIDRs != "10.1.2.3/32" {
+		t.Fatalf("narrower range should be accepted, got %+v (%v)", got, err)
+	}
+	for name, payload := range map[string]apiTokenRestrictionPayload{
+		"full scopes":     {Scopes: &[]string{"*"}},
+		"extra scope":     {Scopes: &[]string{data.ApiTokenScopeFilesDelete}},
+		"other strategy":  {StrategyIDs: &[]uint{strategy.ID + 1}},
+		"wider ip range":  {AllowedIPs: &[]string{"0.0.0.0/0"}},
+		"outside ip":      {AllowedIPs: &[]string{"192.168.1.1"}},
+		"overlapping net": {AllowedIPs: &[]string{"10.0.0.0/7"}},
+	} {
+		if _, err := normalize(payload); err == nil {
+			t.Fatalf("%s: expected restricted token to be rejected", name)
+		}
+	}
+}
+
+func TestAccountUpdateProfile_ScopedTokenCannotChangePassword(t *testing.T) {
+	server, db := newAuthTestServer(t)
+	user := data.User{ID: 1000000000000001, Name: "ci", Email: "ci@example.com", PasswordHash: "hashed", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	update := func(token *data.ApiToken, body string) int {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/account/profile", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("currentUser", user)
+		if token != nil {
+			c.Set("currentApiToken", *token)
+		}
+		server.handleAccountUpdateProfile(c)
+		return recorder.Code
+	}
+
+	scoped := data.ApiToken{Scopes: data.ApiTokenScopeAccountEdit}
+	if code := update(&scoped, `{"password":"Takeover123"}`); code != http.StatusForbidden {
+		t.Fatalf("expected scoped token password change to be rejected, got %d", code)
+	}
+	var stored data.User
+	if err := db.First(&stored, user.ID).Error; err != nil || stored.PasswordHash != "hashed" {
+		t.Fatalf("password must be unchanged, got %q (%v)", stored.PasswordHash, err)
+	}
+	if code := update(&scoped, `{"name":"renamed"}`); code != http.StatusOK {
+		t.Fatalf("scoped token should still edit the profile, got %d", code)
+	}
+	full := data.ApiToken{Scopes: data.ApiTokenScopeAll}
+	if code := update(&full, `{"password":"Changed1234"}`); code != http.StatusOK {
+		t.Fatalf("full access token should change the password, got %d", code)
+	}
+}
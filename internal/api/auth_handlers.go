@@ -16,10 +16,12 @@ import (
 
 	"skyimage/internal/captcha"
 	"skyimage/internal/data"
+	"skyimage/internal/loginguard"
 	"skyimage/internal/middleware"
 	"skyimage/internal/oauth"
 	"skyimage/internal/session"
 	"skyimage/internal/users"
+	"skyimage/internal/verification"
 )
 
 const defaultConsoleBaseURL = "http://localhost:8080"
@@ -62,12 +64,14 @@ const registrationVerificationMessage = "验证码已发送，请查收邮件"
 func (s *Server) registerAuthRoutes(r *gin.RouterGroup) {
 	auth := r.Group("/auth")
 	auth.POST("/login", s.handleLogin)
+	auth.POST("/login/2fa", s.handleLoginTwoFactor)
 	auth.POST("/register", s.handleRegister)
 	auth.POST("/send-verification-code", s.handleSendVerificationCode)
 	auth.POST("/forgot-password", s.handleForgotPassword)
 	auth.POST("/reset-password", s.handleResetPassword)
 	auth.GET("/reset-password-status", s.handleResetPasswordStatus)
 	auth.POST("/logout", s.authMiddleware(), middleware.RequireCSRF(), s.handleLogout)
+	auth.POST("/impersonate/stop", middleware.RequireCSRF(), s.handleStopImpersonation)
 	auth.GET("/needs-setup", s.handleNeedsSetup)
 	auth.GET("/registration-status", s.handleRegistrationStatus)
 	auth.GET("/captcha-config", s.handleCaptchaConfig)
@@ -149,11 +153,11 @@ func (s *Server) handleSendVerificationCode(c *gin.Context) {
 	}
 	clientIP := getClientIP(c, settings["mail.cdn.enabled"] == "true")
 	emailKey := strings.ToLower(strings.TrimSpace(input.Email))
-	if ok, retry := s.authLimiter.Allow("verify:ip:"+clientIP, 10, time.Minute); !ok {
+	if ok, retry := allowRequest(c, s.authLimiter, "verify:ip:"+clientIP, 10, time.Minute); !ok {
 		c.JSON(http.StatusTooManyRequests, gin.H{"error": "请求过于频繁，请稍后再试", "retryAfterSeconds": int(retry.Seconds()) + 1})
 		return
 	}
-	if ok, retry := s.authLimiter.Allow("verify:email:"+emailKey, 3, time.Minute); !ok {
+	if ok, retry := allowRequest(c, s.authLimiter, "verify:email:"+emailKey, 3, time.Minute); !ok {
 		c.JSON(http.StatusTooManyRequests, gin.H{"error": "该邮箱请求过于频繁，请稍后再试", "retryAfterSeconds": int(retry.Seconds()) + 1})
 		return
 	}
@@ -189,7 +193,16 @@ func (s *Server) handleSendVerificationCode(c *gin.Context) {
 
 	// 生成验证码
 	code := s.verification.GenerateCode()
-	s.verification.StoreCode(emailKey, code)
+	if err := s.verification.StoreCode(c.Request.Context(), emailKey, code); err != nil {
+		var throttled *verification.ThrottleError
+		if errors.As(err, &throttled) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": throttled.Error(), "retryAfterSeconds": int(throttled.RetryAfter.Seconds()) + 1})
+			return
+		}
+		log.Printf("[验证码] 保存验证码失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误"})
+		return
+	}
 
 	// 发送验证码邮件
 	go func() {
@@ -241,6 +254,10 @@ func (s *Server) handleRegister(c *gin.Context) {
 		return
 	}
 	normalizedEmail := strings.ToLower(strings.TrimSpace(input.Email))
+	if regMode == oauth.RegModeInvite && strings.TrimSpace(input.InviteCode) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入邀请码", "inviteRequired": true})
+		return
+	}
 
 	// 如果启用了邮件验证，验证邮箱验证码
 	if emailVerifyEnabled {
@@ -248,7 +265,7 @@ func (s *Server) handleRegister(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "请输入邮箱验证码"})
 			return
 		}
-		valid, err := s.verification.VerifyCode(normalizedEmail, input.VerificationCode)
+		valid, err := s.verification.VerifyCode(c.Request.Context(), normalizedEmail, input.VerificationCode)
 		if err != nil || !valid {
 			errMsg := "验证码错误"
 			if err != nil {
@@ -282,6 +299,10 @@ func (s *Server) handleRegister(c *gin.Context) {
 
 	user, err := s.users.Register(c.Request.Context(), input.RegisterInput)
 	if err != nil {
+		if isInviteError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": localizeInviteError(err)})
+			return
+		}
 		statusCode, message := registerErrorResponse(err)
 		if statusCode >= http.StatusInternalServerError {
 			log.Printf("[注册] 创建用户失败: %v", err)
@@ -290,14 +311,11 @@ func (s *Server) handleRegister(c *gin.Context) {
 		return
 	}
 
-	sessionID, err := s.session.Create(user.ID)
-	if err != nil {
+	if err := s.startSession(c, user.ID, session.MethodRegister, getClientIP(c, settings["mail.cdn.enabled"] == "true"), false); err != nil {
 		log.Printf("[注册] 创建会话失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
 		return
 	}
-	s.writeSessionCookie(c, sessionID)
-	s.writeCSRFCookie(c)
 
 	// 发送注册成功邮件（异步，不阻塞响应）
 	go func() {
@@ -319,6 +337,7 @@ func (s *Server) handleLogin(c *gin.Context) {
 		CaptchaToken    string            `json:"captchaToken"`
 		CaptchaData     map[string]string `json:"captchaData"`
 		CaptchaProvider string            `json:"captchaProvider"`
+		RememberMe      bool              `json:"rememberMe"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -326,12 +345,12 @@ func (s *Server) handleLogin(c *gin.Context) {
 	}
 	clientIP := getClientIP(c, s.isCDNEnabled(c.Request.Context()))
 	emailKey := strings.ToLower(strings.TrimSpace(input.Email))
-	if ok, retry := s.authLimiter.Allow("login:ip:"+clientIP, 20, time.Minute); !ok {
+	if ok, retry := allowRequest(c, s.authLimiter, "login:ip:"+clientIP, 20, time.Minute); !ok {
 		c.JSON(http.StatusTooManyRequests, gin.H{"error": "登录请求过于频繁，请稍后再试", "retryAfterSeconds": int(retry.Seconds()) + 1})
 		return
 	}
 	if emailKey != "" {
-		if ok, retry := s.authLimiter.Allow("login:email:"+emailKey, 10, time.Minute); !ok {
+		if ok, retry := allowRequest(c, s.authLimiter, "login:email:"+emailKey, 10, time.Minute); !ok {
 			c.JSON(http.StatusTooManyRequests, gin.H{"error": "账号尝试次数过多，请稍后再试", "retryAfterSeconds": int(retry.Seconds()) + 1})
 			return
 		}
@@ -355,18 +374,72 @@ func (s *Server) handleLogin(c *gin.Context) {
 		}
 	}
 
+	// 按邮箱与 IP 限制失败次数，防止分布式撞库绕过按 IP 的限流；
+	// 不存在的邮箱同样计数并返回相同的响应，避免借锁定状态探测账户
+	attempt := loginAttempt(c, clientIP, session.MethodPassword)
+	guardKeys := []string{loginguard.AccountKey(input.Email), loginguard.IPKey(clientIP)}
+	target, lookupErr := s.users.FindByEmail(c.Request.Context(), input.Email)
+	if err := s.loginGuard.Reserve(c.Request.Context(), guardKeys...); err != nil {
+		if lookupErr == nil {
+			s.loginGuard.RecordBlocked(c.Request.Context(), target.ID, attempt)
+		}
+		if !respondLoginLocked(c, err) {
+			log.Printf("[登录] 记录失败次数失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误"})
+		}
+		return
+	}
+
 	user, err := s.users.Login(c.Request.Context(), input.LoginInput)
 	if err != nil {
+		if lookupErr == nil && errors.Is(err, users.ErrInvalidCredentials) {
+			if recordErr := s.loginGuard.RecordFailure(c.Request.Context(), target.ID, attempt); recordErr != nil {
+				log.Printf("[登录] 记录登录历史失败: %v", recordErr)
+			}
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
-	sessionID, err := s.session.Create(user.ID)
+	if err := s.loginGuard.Reset(c.Request.Context(), guardKeys...); err != nil {
+		log.Printf("[登录] 清除失败次数失败: %v", err)
+	}
+	// 已启用两步验证：暂不创建会话，返回挑战 ID 等待第二步
+	if s.respondTwoFactorChallenge(c, user, session.MethodPassword) {
+		return
+	}
+	s.completeLogin(c, user, clientIP, input.RememberMe, session.MethodPassword)
+}
+
+// twoFactorChallengeFor 在用户启用了两步验证时创建登录挑战并返回其 ID，未启用时返回空字符串。
+// 密码、OAuth 与未经用户验证的 Passkey 登录都必须经过该挑战才能创建会话。
+func (s *Server) twoFactorChallengeFor(c *gin.Context, user data.User, method string) (string, error) {
+	if !s.twoFactor.Enabled(c.Request.Context(), user.ID) {
+		return "", nil
+	}
+	return s.twoFactor.CreateChallenge(c.Request.Context(), user.ID, method)
+}
+
+// respondTwoFactorChallenge 需要第二步验证时返回挑战 ID 并返回 true，调用方应停止创建会话。
+func (s *Server) respondTwoFactorChallenge(c *gin.Context, user data.User, method string) bool {
+	challenge, err := s.twoFactorChallengeFor(c, user, method)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create 2fa challenge"})
+		return true
+	}
+	if challenge == "" {
+		return false
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"twoFactorRequired": true, "challenge": challenge}})
+	return true
+}
+
+// completeLogin 创建会话、写入 Cookie 并发送登录提醒。
+func (s *Server) completeLogin(c *gin.Context, user data.User, clientIP string, rememberMe bool, method string) {
+	if err := s.startSession(c, user.ID, method, clientIP, rememberMe); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
 		return
 	}
-	s.writeSessionCookie(c, sessionID)
-	s.writeCSRFCookie(c)
+	s.recordLoginSuccess(c, user, loginAttempt(c, clientIP, method))
 
 	// 发送登录提醒邮件（异步，不阻塞响应）
 	go func() {
@@ -380,7 +453,11 @@ func (s *Server) handleLogin(c *gin.Context) {
 		}
 	}()
 
-	c.JSON(http.StatusOK, gin.H{"data": gin.H{"user": user}})
+	resp := gin.H{"user": user}
+	if s.twoFactor.Required(c.Request.Context(), user) && !s.twoFactor.Enabled(c.Request.Context(), user.ID) {
+		resp["twoFactorSetupRequired"] = true
+	}
+	c.JSON(http.StatusOK, gin.H{"data": resp})
 }
 
 func (s *Server) handleLogout(c *gin.Context) {
@@ -391,35 +468,32 @@ func (s *Server) handleLogout(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": gin.H{"message": "logged out"}})
 }
 
-func (s *Server) writeSessionCookie(c *gin.Context, sessionID string) {
-	// Lax (not Strict): OAuth IdP redirects back with a top-level GET navigation.
-	// Strict would omit the session cookie on that callback and break account binding.
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     session.CookieName,
-		Value:    sessionID,
-		Path:     "/",
-		MaxAge:   int(s.session.TTL().Seconds()),
-		HttpOnly: true,
-		Secure:   isSecureRequest(c),
-		SameSite: http.SameSiteLaxMode,
+// startSession 创建带设备信息的会话并写入会话与 CSRF Cookie。
+func (s *Server) startSession(c *gin.Context, userID uint, method, clientIP string, rememberMe bool) error {
+	sessionID, err := s.session.CreateWithMetadata(userID, session.Metadata{
+		IP:         clientIP,
+		UserAgent:  c.Request.UserAgent(),
+		Method:     method,
+		RememberMe: rememberMe,
 	})
+	if err != nil {
+		return err
+	}
+	s.writeSessionCookie(c, sessionID, s.session.LifetimeFor(rememberMe))
+	s.writeCSRFCookie(c, s.session.LifetimeFor(rememberMe))
+	return nil
+}
+
+func (s *Server) writeSessionCookie(c *gin.Context, sessionID string, lifetime time.Duration) {
+	middleware.WriteSessionCookie(c, sessionID, lifetime)
 }
 
-func (s *Server) writeCSRFCookie(c *gin.Context) {
+func (s *Server) writeCSRFCookie(c *gin.Context, lifetime time.Duration) {
 	token := make([]byte, 32)
 	if _, err := rand.Read(token); err != nil {
 		return
 	}
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     middleware.CSRFCookieName,
-		Value:    hex.EncodeToString(token),
-		Path:     "/",
-		MaxAge:   int(s.session.TTL().Seconds()),
-		HttpOnly: false,
-		Secure:   isSecureRequest(c),
-		// Lax so CSRF cookie is still present after OAuth top-level return navigation.
-		SameSite: http.SameSiteLaxMode,
-	})
+	middleware.WriteCSRFCookie(c, hex.EncodeToString(token), lifetime)
 }
 
 func (s *Server) clearSessionCookie(c *gin.Context) {
@@ -444,10 +518,7 @@ func (s *Server) clearSessionCookie(c *gin.Context) {
 }
 
 func isSecureRequest(c *gin.Context) bool {
-	if c.Request.TLS != nil {
-		return true
-	}
-	return strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+	return middleware.IsSecureRequest(c)
 }
 
 func (s *Server) handleMe(c *gin.Context) {
@@ -457,9 +528,9 @@ func (s *Server) handleMe(c *gin.Context) {
 		return
 	}
 	if _, err := c.Cookie(middleware.CSRFCookieName); err != nil {
-		s.writeCSRFCookie(c)
+		s.writeCSRFCookie(c, s.session.TTL())
 	}
-	c.JSON(http.StatusOK, gin.H{"data": user})
+	c.JSON(http.StatusOK, gin.H{"data": meResponse{User: user, Impersonation: s.currentImpersonationInfo(c)}})
 }
 
 func (s *Server) handleNeedsSetup(c *gin.Context) {
@@ -483,8 +554,8 @@ func (s *Server) handleRegistrationStatus(c *gin.Context) {
 		mode = oauth.RegModeClosed
 	}
 
-	passwordAllowed := mode == oauth.RegModeOpen
-	oauthAllowed := mode == oauth.RegModeOpen || mode == oauth.RegModeOAuthOnly
+	passwordAllowed := mode == oauth.RegModeOpen || mode == oauth.RegModeInvite
+	oauthAllowed := passwordAllowed || mode == oauth.RegModeOAuthOnly
 
 	forgotEnabled := false
 	if err == nil {
@@ -495,6 +566,7 @@ func (s *Server) handleRegistrationStatus(c *gin.Context) {
 		"mode":                  mode,
 		"passwordAllowed":       passwordAllowed,
 		"oauthAllowed":          oauthAllowed,
+		"inviteRequired":        mode == oauth.RegModeInvite,
 		"emailVerifyEnabled":    emailVerifyEnabled,
 		"forgotPasswordEnabled": forgotEnabled,
 		"passkeyEnabled":        settings["features.passkeys_enabled"] != "false",
@@ -534,11 +606,11 @@ func (s *Server) handleForgotPassword(c *gin.Context) {
 	}
 	clientIP := getClientIP(c, s.isCDNEnabled(c.Request.Context()))
 	emailKey := strings.ToLower(strings.TrimSpace(input.Email))
-	if ok, retry := s.authLimiter.Allow("forgot:ip:"+clientIP, 10, time.Minute); !ok {
+	if ok, retry := allowRequest(c, s.authLimiter, "forgot:ip:"+clientIP, 10, time.Minute); !ok {
 		c.JSON(http.StatusTooManyRequests, gin.H{"error": "请求过于频繁，请稍后再试", "retryAfterSeconds": int(retry.Seconds()) + 1})
 		return
 	}
-	if ok, retry := s.authLimiter.Allow("forgot:email:"+emailKey, 3, time.Minute); !ok {
+	if ok, retry := allowRequest(c, s.authLimiter, "forgot:email:"+emailKey, 3, time.Minute); !ok {
 		c.JSON(http.StatusTooManyRequests, gin.H{"error": "该邮箱请求过于频繁，请稍后再试", "retryAfterSeconds": int(retry.Seconds()) + 1})
 		return
 	}
@@ -574,7 +646,15 @@ func (s *Server) handleForgotPassword(c *gin.Context) {
 	token := hex.EncodeToString(tokenBytes)
 	code := s.verification.GenerateCode()
 	normalizedEmail := strings.ToLower(strings.TrimSpace(user.Email))
-	s.verification.StorePasswordReset(normalizedEmail, token, code)
+	if err := s.verification.StorePasswordReset(c.Request.Context(), normalizedEmail, token, code); err != nil {
+		var throttled *verification.ThrottleError
+		if !errors.As(err, &throttled) {
+			log.Printf("[重置密码] 保存重置请求失败: %v", err)
+		}
+		// 不区分邮箱是否存在，统一返回相同提示
+		c.JSON(http.StatusOK, gin.H{"data": gin.H{"message": "如果邮箱存在，重置邮件已发送"}})
+		return
+	}
 	resetLink := buildPasswordResetLink(settings["site.console_url"], token)
 
 	go func(email string, verifyCode string, link string) {
@@ -629,7 +709,7 @@ func (s *Server) handleResetPassword(c *gin.Context) {
 		}
 	}
 
-	email, verifyErr := s.verification.VerifyPasswordReset(strings.TrimSpace(input.Token), strings.TrimSpace(input.Code))
+	email, verifyErr := s.verification.VerifyPasswordReset(c.Request.Context(), strings.TrimSpace(input.Token), strings.TrimSpace(input.Code))
 	if verifyErr != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": verifyErr.Error()})
 		return
@@ -643,6 +723,10 @@ func (s *Server) handleResetPassword(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// 密码已重置：注销该账户的全部会话
+	if user, err := s.users.FindByEmail(c.Request.Context(), email); err == nil {
+		s.revokeUserSessions(c, user.ID, "")
+	}
 
 	c.JSON(http.StatusOK, gin.H{"data": gin.H{"message": "密码重置成功"}})
 }
@@ -690,7 +774,7 @@ func (s *Server) handleResetPasswordStatus(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{"data": gin.H{
-		"valid":          s.verification.IsPasswordResetTokenValid(token),
+		"valid":          s.verification.IsPasswordResetTokenValid(c.Request.Context(), token),
 		"captchaEnabled": captchaConfig.Enabled,
 		"captchaConfig":  captchaConfig,
 	}})
@@ -2,9 +2,14 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -17,7 +22,12 @@ import (
 	"skyimage/internal/captcha"
 	"skyimage/internal/config"
 	"skyimage/internal/data"
+	"skyimage/internal/invites"
+	"skyimage/internal/loginguard"
+	mailservice "skyimage/internal/mail"
+	"skyimage/internal/middleware"
 	"skyimage/internal/session"
+	"skyimage/internal/twofactor"
 	"skyimage/internal/users"
 	"skyimage/internal/verification"
 )
@@ -31,7 +41,7 @@ func newAuthTestServer(t *testing.T) (*Server, *gorm.DB) {
 		t.Fatalf("failed to open test database: %v", err)
 	}
 
-	if err := db.AutoMigrate(&data.User{}, &data.Group{}, &data.ConfigEntry{}, &data.SessionEntry{}); err != nil {
+	if err := db.AutoMigrate(&data.User{}, &data.Group{}, &data.ConfigEntry{}, &data.SessionEntry{}, &data.VerificationCode{}); err != nil {
 		t.Fatalf("failed to migrate test database: %v", err)
 	}
 
@@ -42,7 +52,7 @@ func newAuthTestServer(t *testing.T) (*Server, *gorm.DB) {
 		cfg:          config.Config{AllowRegistration: true},
 		admin:        adminSvc,
 		users:        users.New(db),
-		verification: verification.New(),
+		verification: verification.New(db, []byte("test-secret")),
 		captcha:      captcha.New(adminSvc),
 		authLimiter:  newRequestLimiter(),
 		session:      session.NewManager(db, 24*time.Hour),
@@ -128,3 +138,284 @@ func TestHandleRegister_HidesDuplicateEmailDetails(t *testing.T) {
 		t.Fatalf("expected generic registration failure message, got %s", recorder.Body.String())
 	}
 }
+
+func TestHandleRegister_InviteModeRequiresValidCode(t *testing.T) {
+	server, db := newAuthTestServer(t)
+	if err := db.AutoMigrate(&data.InviteCode{}, &data.InviteCodeUsage{}); err != nil {
+		t.Fatalf("failed to migrate invite tables: %v", err)
+	}
+	server.invites = invites.New(db, server.admin)
+	server.users.SetInvites(server.invites)
+	setConfig(t, db, "features.registration_mode", "invite")
+
+	recorder := performJSONRequest(t, server.handleRegister, map[string]string{
+		"name":     "New User",
+		"email":    "new@example.com",
+		"password": "Password1",
+	})
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "inviteRequired") {
+		t.Fatalf("expected invite required, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = performJSONRequest(t, server.handleRegister, map[string]string{
+		"name":       "New User",
+		"email":      "new@example.com",
+		"password":   "Password1",
+		"inviteCode": "NOPE",
+	})
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "邀请码无效") {
+		t.Fatalf("expected invalid invite, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var count int64
+	db.Model(&data.User{}).Where("email = ?", "new@example.com").Count(&count)
+	if count != 0 {
+		t.Fatalf("user must not be created when the invite is rejected")
+	}
+}
+
+func TestTwoFactorChallenge_RequiredForOAuthAndKeepsMethod(t *testing.T) {
+	server, db := newAuthTestServer(t)
+	if err := db.AutoMigrate(&data.UserTOTP{}, &data.UserRecoveryCode{}, &data.TwoFactorChallenge{}, &data.LoginHistory{}, &data.LoginFailure{}); err != nil {
+		t.Fatalf("failed to migrate 2fa tables: %v", err)
+	}
+	server.twoFactor = twofactor.New(db, server.admin)
+	server.loginGuard = loginguard.New(db)
+	server.mail = mailservice.New(server.admin)
+
+	user := data.User{ID: 1000000000000001, Name: "2fa", Email: "2fa@example.com", PasswordHash: "hashed", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if challenge, err := server.twoFactorChallengeFor(ctx, user, session.MethodOAuth); err != nil || challenge != "" {
+		t.Fatalf("users without 2fa should not get a challenge, got %q (%v)", challenge, err)
+	}
+
+	recovery := sha256.Sum256([]byte("abcde12345"))
+	if err := db.Create(&data.UserTOTP{UserID: user.ID, Secret: "JBSWY3DPEHPK3PXP", Enabled: true}).Error; err != nil {
+		t.Fatalf("failed to enable totp: %v", err)
+	}
+	if err := db.Create(&data.UserRecoveryCode{UserID: user.ID, CodeHash: hex.EncodeToString(recovery[:])}).Error; err != nil {
+		t.Fatalf("failed to create recovery code: %v", err)
+	}
+	challenge, err := server.twoFactorChallengeFor(ctx, user, session.MethodOAuth)
+	if err != nil || challenge == "" {
+		t.Fatalf("OAuth login of a 2fa user must be challenged, got %q (%v)", challenge, err)
+	}
+
+	recorder := performJSONRequest(t, server.handleLoginTwoFactor, map[string]string{"challenge": challenge, "code": "abcde-12345"})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 2fa completion to succeed, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var entry data.SessionEntry
+	if err := db.Where("user_id = ?", user.ID).First(&entry).Error; err != nil {
+		t.Fatalf("expected a session after the second factor: %v", err)
+	}
+	if want := session.WithTwoFactor(session.MethodOAuth); entry.Method != want {
+		t.Fatalf("session should record the first-factor method with 2fa, want %q got %q", want, entry.Method)
+	}
+	var history data.LoginHistory
+	if err := db.Where("user_id = ? AND success = ?", user.ID, true).First(&history).Error; err != nil {
+		t.Fatalf("expected a login history entry: %v", err)
+	}
+	if history.Method != entry.Method {
+		t.Fatalf("login history should match the session method, got %q", history.Method)
+	}
+}
+
+func TestHandleLogin_ThrottlesUnknownEmailLikeKnownEmail(t *testing.T) {
+	server, db := newAuthTestServer(t)
+	if err := db.AutoMigrate(&data.LoginHistory{}, &data.LoginFailure{}); err != nil {
+		t.Fatalf("failed to migrate login guard tables: %v", err)
+	}
+	server.loginGuard = loginguard.New(db)
+	createAuthTestUser(t, db, "known@example.com")
+
+	login := func(email, remoteAddr string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"email": email, "password": "wrong-password"})
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		ctx.Request.Header.Set("Content-Type", "application/json")
+		ctx.Request.RemoteAddr = remoteAddr
+		server.handleLogin(ctx)
+		return recorder
+	}
+
+	var bodies []string
+	for i, email := range []string{"known@example.com", "missing@example.com"} {
+		// 每次尝试换一个 IP，只让邮箱维度的计数生效
+		for j := 0; j < 3; j++ {
+			addr := fmt.Sprintf("198.51.100.%d:1234", i*10+j+1)
+			if recorder := login(email, addr); recorder.Code != http.StatusUnauthorized {
+				t.Fatalf("%s attempt %d: expected 401, got %d: %s", email, j+1, recorder.Code, recorder.Body.String())
+			}
+		}
+		recorder := login(email, fmt.Sprintf("198.51.100.%d:1234", i*10+9))
+		if recorder.Code != http.StatusTooManyRequests {
+			t.Fatalf("%s: expected progressive delay, got %d: %s", email, recorder.Code, recorder.Body.String())
+		}
+		var payload map[string]any
+		_ = json.Unmarshal(recorder.Body.Bytes(), &payload)
+		delete(payload, "retryAfterSeconds")
+		normalized, _ := json.Marshal(payload)
+		bodies = append(bodies, string(normalized))
+	}
+	if bodies[0] != bodies[1] {
+		t.Fatalf("known and unknown emails must get the same response, got %s vs %s", bodies[0], bodies[1])
+	}
+
+	// 同一 IP 换邮箱撞库同样会被延迟
+	for j := 0; j < 3; j++ {
+		login(fmt.Sprintf("spray%d@example.com", j), "203.0.113.50:1234")
+	}
+	if recorder := login("spray9@example.com", "203.0.113.50:1234"); recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected IP key to throttle password spraying, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestSessionAuth_RefreshesCookieMaxAgeOnSlidingExpiry(t *testing.T) {
+	server, db := newAuthTestServer(t)
+	user := data.User{ID: 1000000000000001, Name: "slider", Email: "slider@example.com", PasswordHash: "hashed", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	sessionID, err := server.session.CreateWithMetadata(user.ID, session.Metadata{RememberMe: true})
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if err := db.Model(&data.SessionEntry{}).Where("id = ?", sessionID).
+		Update("last_seen_at", time.Now().UTC().Add(-10*time.Minute)).Error; err != nil {
+		t.Fatalf("failed to age session: %v", err)
+	}
+
+	router := gin.New()
+	router.GET("/me", middleware.Auth(server.users, server.session), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(&http.Cookie{Name: session.CookieName, Value: sessionID})
+	req.AddCookie(&http.Cookie{Name: middleware.CSRFCookieName, Value: "csrf-token"})
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected authenticated request, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range recorder.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	want := int(session.RememberTTL.Seconds())
+	if cookie := cookies[session.CookieName]; cookie == nil || cookie.Value != sessionID || cookie.MaxAge != want {
+		t.Fatalf("expected session cookie refreshed with MaxAge %d, got %+v", want, cookie)
+	}
+	if cookie := cookies[middleware.CSRFCookieName]; cookie == nil || cookie.Value != "csrf-token" || cookie.MaxAge != want {
+		t.Fatalf("expected csrf cookie refreshed with the same token, got %+v", cookie)
+	}
+}
+
+func newTwoFactorTestServer(t *testing.T) (*Server, *gorm.DB, data.User) {
+	t.Helper()
+	server, db := newAuthTestServer(t)
+	if err := db.AutoMigrate(&data.UserTOTP{}, &data.UserRecoveryCode{}, &data.TwoFactorChallenge{}, &data.LoginHistory{}, &data.LoginFailure{}); err != nil {
+		t.Fatalf("failed to migrate 2fa tables: %v", err)
+	}
+	server.twoFactor = twofactor.New(db, server.admin)
+	server.loginGuard = loginguard.New(db)
+	server.mail = mailservice.New(server.admin)
+	user := data.User{ID: 1000000000000001, Name: "2fa", Email: "2fa@example.com", PasswordHash: "hashed", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := db.Create(&data.UserTOTP{UserID: user.ID, Secret: "JBSWY3DPEHPK3PXP", Enabled: true}).Error; err != nil {
+		t.Fatalf("failed to enable totp: %v", err)
+	}
+	return server, db, user
+}
+
+func performAsUser(handler func(*gin.Context), user data.User, payload any, params ...gin.Param) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.RemoteAddr = "127.0.0.1:12345"
+	c.Params = params
+	c.Set("currentUser", user)
+	handler(c)
+	return recorder
+}
+
+func TestLoginTwoFactor_CountsFailuresPerUserAcrossChallenges(t *testing.T) {
+	server, _, user := newTwoFactorTestServer(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		challenge, err := server.twoFactor.CreateChallenge(ctx, user.ID, session.MethodPassword)
+		if err != nil {
+			t.Fatalf("create challenge: %v", err)
+		}
+		recorder := performJSONRequest(t, server.handleLoginTwoFactor, map[string]string{"challenge": challenge, "code": "000000"})
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d: %s", i+1, recorder.Code, recorder.Body.String())
+		}
+	}
+	challenge, err := server.twoFactor.CreateChallenge(ctx, user.ID, session.MethodPassword)
+	if err != nil {
+		t.Fatalf("create challenge: %v", err)
+	}
+	recorder := performJSONRequest(t, server.handleLoginTwoFactor, map[string]string{"challenge": challenge, "code": "000000"})
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected a fresh challenge to be throttled per user, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestTwoFactorDisableAndRecoveryCodes_AreThrottled(t *testing.T) {
+	server, _, user := newTwoFactorTestServer(t)
+
+	for i := 0; i < 3; i++ {
+		handler := server.handleTwoFactorDisable
+		if i%2 == 1 {
+			handler = server.handleTwoFactorRecoveryCodes
+		}
+		if recorder := performAsUser(handler, user, map[string]string{"code": "000000"}); recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d: %s", i+1, recorder.Code, recorder.Body.String())
+		}
+	}
+	if recorder := performAsUser(server.handleTwoFactorDisable, user, map[string]string{"code": "000000"}); recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected disable to be throttled, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := performAsUser(server.handleTwoFactorRecoveryCodes, user, map[string]string{"code": "000000"}); recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected recovery code regeneration to be throttled, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestAdminResetTwoFactor_ProtectsSuperAndFullAdmins(t *testing.T) {
+	server, db, regular := newTwoFactorTestServer(t)
+	superAdmin := data.User{ID: 1000000000000002, Name: "root", Email: "root@example.com", PasswordHash: "x", Status: 1, IsAdmin: true, IsSuperAdmin: true}
+	fullAdmin := data.User{ID: 1000000000000003, Name: "admin", Email: "admin@example.com", PasswordHash: "x", Status: 1, IsAdmin: true}
+	for _, user := range []*data.User{&superAdmin, &fullAdmin} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatalf("failed to create admin: %v", err)
+		}
+	}
+	roleID := uint(7)
+	scoped := data.User{ID: 1000000000000004, IsAdmin: true, AdminRoleID: &roleID, Permissions: []string{data.AdminPermUsers}}
+
+	reset := func(actor, target data.User) int {
+		param := gin.Param{Key: "id", Value: strconv.FormatUint(uint64(target.ID), 10)}
+		return performAsUser(server.handleAdminResetTwoFactor, actor, nil, param).Code
+	}
+	if code := reset(fullAdmin, superAdmin); code != http.StatusForbidden {
+		t.Fatalf("super admin 2fa must not be reset, got %d", code)
+	}
+	if code := reset(scoped, fullAdmin); code != http.StatusForbidden {
+		t.Fatalf("scoped admin must not reset a full admin, got %d", code)
+	}
+	if code := reset(scoped, regular); code != http.StatusOK {
+		t.Fatalf("scoped admin should reset a regular user, got %d", code)
+	}
+	if server.twoFactor.Enabled(context.Background(), regular.ID) {
+		t.Fatalf("expected regular user's 2fa to be reset")
+	}
+}
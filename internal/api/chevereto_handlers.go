@@ -0,0 +1,206 @@
+package api
+
+import (
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/data"
+	"skyimage/internal/files"
+	"skyimage/internal/middleware"
+)
+
+// cheveretoMaxSourceSize base64 与远程地址来源的大小上限，实际还受角色组限制。
+const cheveretoMaxSourceSize int64 = 64 << 20
+
+// Chevereto 错误码，客户端通常只展示 message
+const (
+	cheveretoCodeInvalidKey    = 100
+	cheveretoCodeInvalidSource = 310
+	cheveretoCodeUploadFailed  = 320
+	cheveretoCodeInvalidAlbum  = 330
+)
+
+func (s *Server) registerCheveretoRoutes(apiGroup *gin.RouterGroup) {
+	// 兼容 Chevereto API v1：/api/1/upload?key=<API Token>&source=<文件|base64|URL>
+	auth := s.cheveretoAuthMiddleware()
+	apiGroup.POST("/1/upload", auth, s.handleCheveretoUpload)
+	apiGroup.GET("/1/upload", auth, s.handleCheveretoUpload)
+}
+
+func (s *Server) cheveretoAuthMiddleware() gin.HandlerFunc {
+	extract := func(c *gin.Context) string {
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			return key
+		}
+		if key := c.Query("key"); key != "" {
+			return key
+		}
+		return c.PostForm("key")
+	}
+	deny := func(c *gin.Context, status int, message string) {
+		writeCheveretoError(c, status, cheveretoCodeInvalidKey, message)
+	}
+	return func(c *gin.Context) {
+		s.mu.RLock()
+		userService := s.users
+		s.mu.RUnlock()
+		middleware.KeyTokenAuth(userService, extract, middleware.Scope(data.ApiTokenScopeFilesUpload), deny)(c)
+	}
+}
+
+func (s *Server) handleCheveretoUpload(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	ctx := c.Request.Context()
+
+	var albumID uint
+	if raw := strings.TrimSpace(c.DefaultPostForm("album_id", c.Query("album_id"))); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			writeCheveretoError(c, http.StatusBadRequest, cheveretoCodeInvalidAlbum, "Invalid album ID")
+			return
+		}
+		albumID = uint(id)
+	}
+
+	header, cleanup, err := cheveretoSource(c)
+	if err != nil {
+		writeCheveretoError(c, statusCodeFromError(err, http.StatusBadRequest), cheveretoCodeInvalidSource, err.Error())
+		return
+	}
+	defer cleanup()
+
+	asset, err := s.files.Upload(ctx, user, header, files.UploadOptions{
+		Visibility:         s.defaultUploadVisibility(user),
+		AlbumID:            albumID,
+		AllowedStrategyIDs: middleware.TokenStrategyIDs(c),
+	})
+	if err != nil {
+		writeRateLimitHeaders(c, err)
+		if errors.Is(err, files.ErrAlbumNotFound) {
+			writeCheveretoError(c, http.StatusNotFound, cheveretoCodeInvalidAlbum, "Album not found")
+			return
+		}
+		writeCheveretoError(c, statusCodeFromError(err, http.StatusBadRequest), cheveretoCodeUploadFailed, err.Error())
+		return
+	}
+
+	imageURL := strings.TrimSpace(asset.PublicURL)
+	if imageURL == "" {
+		if resolved, err := s.files.PublicURL(ctx, asset); err == nil {
+			imageURL = resolved
+		}
+	}
+	switch strings.ToLower(c.DefaultPostForm("format", c.Query("format"))) {
+	case "txt":
+		c.String(http.StatusOK, imageURL)
+		return
+	case "redirect":
+		c.Redirect(http.StatusFound, imageURL)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status_code": http.StatusOK,
+		"success":     gin.H{"message": "image uploaded", "code": http.StatusOK},
+		"image":       cheveretoImage(asset, imageURL),
+		"status_txt":  "OK",
+	})
+}
+
+// cheveretoSource 读取 source 参数：表单文件、远程地址或 base64 内容。
+func cheveretoSource(c *gin.Context) (*multipart.FileHeader, func(), error) {
+	if header, err := c.FormFile("source"); err == nil {
+		return header, func() {}, nil
+	}
+	value := strings.TrimSpace(c.DefaultPostForm("source", c.Query("source")))
+	if value == "" {
+		return nil, func() {}, &files.StatusError{StatusCode: http.StatusBadRequest, Message: "Empty upload source"}
+	}
+	lower := strings.ToLower(value)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		return files.FetchRemoteSource(c.Request.Context(), value, cheveretoMaxSourceSize)
+	}
+	filename := strings.TrimSpace(c.DefaultPostForm("title", c.Query("title")))
+	if filename == "" {
+		filename = "image"
+	}
+	return files.DecodeBase64Source(filename, value, cheveretoMaxSourceSize)
+}
+
+func cheveretoImage(asset data.FileAsset, imageURL string) gin.H {
+	thumbURL := strings.TrimSpace(asset.ThumbnailPublicURL)
+	if thumbURL == "" {
+		thumbURL = imageURL
+	}
+	ratio := 0.0
+	if asset.Height > 0 {
+		ratio = float64(asset.Width) / float64(asset.Height)
+	}
+	base := strings.TrimSuffix(asset.Name, path.Ext(asset.Name))
+	sizeFormatted := formatBytesCN(float64(asset.Size))
+	return gin.H{
+		"id_encoded":        asset.Key,
+		"name":              base,
+		"filename":          asset.Name,
+		"original_filename": asset.OriginalName,
+		"title":             strings.TrimSuffix(asset.OriginalName, path.Ext(asset.OriginalName)),
+		"description":       nil,
+		"extension":         asset.Extension,
+		"mime":              asset.MimeType,
+		"size":              asset.Size,
+		"size_formatted":    sizeFormatted,
+		"width":             asset.Width,
+		"height":            asset.Height,
+		"ratio":             ratio,
+		"md5":               asset.ChecksumMD5,
+		"nsfw":              "0",
+		"views":             "0",
+		"date":              asset.CreatedAt.Format("2006-01-02 15:04:05"),
+		"date_gmt":          asset.CreatedAt.UTC().Format("2006-01-02 15:04:05"),
+		"how_long_ago":      formatHumanDate(asset.CreatedAt),
+		"url":               imageURL,
+		"url_viewer":        imageURL,
+		"display_url":       imageURL,
+		"image": gin.H{
+			"filename":  asset.Name,
+			"name":      base,
+			"mime":      asset.MimeType,
+			"extension": asset.Extension,
+			"url":       imageURL,
+			"size":      asset.Size,
+		},
+		"thumb": gin.H{
+			"filename":  asset.Name,
+			"name":      base,
+			"mime":      asset.MimeType,
+			"extension": asset.Extension,
+			"url":       thumbURL,
+		},
+		"medium": gin.H{
+			"filename":  asset.Name,
+			"name":      base,
+			"mime":      asset.MimeType,
+			"extension": asset.Extension,
+			"url":       thumbURL,
+		},
+		"delete_url": nil,
+		"timestamp":  asset.CreatedAt.Unix(),
+	}
+}
+
+func writeCheveretoError(c *gin.Context, status, code int, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"status_code": status,
+		"error": gin.H{
+			"message": message,
+			"code":    code,
+			"context": "Exception",
+		},
+		"status_txt": http.StatusText(status),
+	})
+}
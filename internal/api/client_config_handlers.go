@@ -0,0 +1,361 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/data"
+	"skyimage/internal/middleware"
+)
+
+// 客户端配置统一使用 Lsky 兼容的 /api/v1/upload，该接口支持 Bearer Token 且无需 CSRF。
+const (
+	clientUploadPath        = "/api/v1/upload"
+	clientURLJSONPath       = "data.links.url"
+	clientThumbnailJSONPath = "data.links.thumbnail_url"
+	clientErrorJSONPath     = "message"
+)
+
+var clientConfigKinds = []string{"sharex", "picgo", "upic", "flameshot"}
+
+var clientConfigNames = map[string]string{
+	"sharex":    "ShareX",
+	"picgo":     "PicGo",
+	"upic":      "uPic",
+	"flameshot": "Flameshot",
+}
+
+type clientConfigFile struct {
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+}
+
+// clientUploadTarget 是生成客户端配置所需的上传参数。
+type clientUploadTarget struct {
+	UploadURL  string
+	Token      string
+	StrategyID uint
+	Permission string
+}
+
+// fields 返回随文件一起提交的表单字段。
+func (t clientUploadTarget) fields() map[string]string {
+	return map[string]string{
+		"strategy_id": strconv.FormatUint(uint64(t.StrategyID), 10),
+		"permission":  t.Permission,
+	}
+}
+
+// handleGenerateClientConfig 签发仅可上传到指定策略的 Token，并生成可直接导入的客户端配置。
+func (s *Server) handleGenerateClientConfig(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	s.mu.RLock()
+	demoMode := s.cfg.DemoMode
+	s.mu.RUnlock()
+	if demoMode {
+		c.JSON(http.StatusForbidden, gin.H{"error": "演示站禁止创建 API Token"})
+		return
+	}
+
+	var req struct {
+		Client     string `json:"client"`
+		StrategyID uint   `json:"strategyId"`
+		Visibility string `json:"visibility"`
+		ExpiresAt  string `json:"expiresAt"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	kinds := clientConfigKinds
+	client := strings.ToLower(strings.TrimSpace(req.Client))
+	if client != "" && client != "all" {
+		if _, ok := clientConfigNames[client]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的客户端类型"})
+			return
+		}
+		kinds = []string{client}
+	}
+
+	visibility := strings.ToLower(strings.TrimSpace(req.Visibility))
+	switch visibility {
+	case "":
+		visibility = s.defaultUploadVisibility(user)
+	case "public", "private":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "可见性只能为 public 或 private"})
+		return
+	}
+
+	strategies, err := s.files.ListStrategiesForUser(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var strategy *data.Strategy
+	for i := range strategies {
+		if req.StrategyID == 0 || strategies[i].ID == req.StrategyID {
+			strategy = &strategies[i]
+			break
+		}
+	}
+	if strategy == nil {
+		if req.StrategyID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "当前账户没有可用的储存策略"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("储存策略 %d 不可用", req.StrategyID)})
+		}
+		return
+	}
+
+	expiry, err := parseApiTokenExpiry(req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := "客户端配置"
+	if len(kinds) == 1 {
+		name = clientConfigNames[kinds[0]]
+	}
+	name += " · " + strategy.Name
+	if runes := []rune(name); len(runes) > 64 {
+		name = string(runes[:64])
+	}
+	restrictions, err := s.normalizeApiTokenRestrictions(c, user, apiTokenRestrictionPayload{
+		Name:        &name,
+		Scopes:      &[]string{data.ApiTokenScopeFilesUpload},
+		StrategyIDs: &[]uint{strategy.ID},
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	apiToken, tokenStr, err := s.createApiToken(user, restrictions, expiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	baseURL := s.publicBaseURL(c)
+	siteName := "SkyImage"
+	if settings, err := s.admin.GetSettings(c.Request.Context()); err == nil {
+		if title := strings.TrimSpace(settings["site.title"]); title != "" {
+			siteName = title
+		}
+	}
+	target := clientUploadTarget{
+		UploadURL:  baseURL + clientUploadPath,
+		Token:      tokenStr,
+		StrategyID: strategy.ID,
+		Permission: "0",
+	}
+	if visibility == "public" {
+		target.Permission = "1"
+	}
+
+	configs := make(gin.H, len(kinds))
+	for _, kind := range kinds {
+		file, err := buildClientConfig(kind, siteName, target)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		configs[kind] = file
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"token":      tokenStr,
+		"id":         apiToken.ID,
+		"baseUrl":    baseURL,
+		"uploadUrl":  target.UploadURL,
+		"strategy":   gin.H{"id": strategy.ID, "name": strategy.Name},
+		"visibility": visibility,
+		"jsonPaths": gin.H{
+			"url":       clientURLJSONPath,
+			"thumbnail": clientThumbnailJSONPath,
+			"error":     clientErrorJSONPath,
+		},
+		"configs": configs,
+	}})
+}
+
+func buildClientConfig(kind, siteName string, target clientUploadTarget) (clientConfigFile, error) {
+	slug := clientConfigSlug(siteName)
+	switch kind {
+	case "sharex":
+		return marshalClientConfig(slug+".sxcu", shareXConfig(siteName, target))
+	case "picgo":
+		return marshalClientConfig(slug+"-picgo.json", picGoConfig(target))
+	case "upic":
+		return upicConfig(slug+"-upic.json", siteName, target)
+	case "flameshot":
+		return clientConfigFile{Filename: slug + "-upload.sh", Content: flameshotScript(siteName, target)}, nil
+	default:
+		return clientConfigFile{}, fmt.Errorf("不支持的客户端类型")
+	}
+}
+
+// shareXConfig 生成 ShareX 自定义上传器（.sxcu），响应解析使用 {json:...} 语法。
+func shareXConfig(siteName string, target clientUploadTarget) gin.H {
+	return gin.H{
+		"Version":         "15.0.0",
+		"Name":            siteName,
+		"DestinationType": "ImageUploader, FileUploader",
+		"RequestMethod":   "POST",
+		"RequestURL":      target.UploadURL,
+		"Headers": gin.H{
+			"Authorization": "Bearer " + target.Token,
+			"Accept":        "application/json",
+		},
+		"Body":         "MultipartFormData",
+		"Arguments":    target.fields(),
+		"FileFormName": "file",
+		"URL":          "{json:" + clientURLJSONPath + "}",
+		"ThumbnailURL": "{json:" + clientThumbnailJSONPath + "}",
+		"ErrorMessage": "{json:" + clientErrorJSONPath + "}",
+	}
+}
+
+// picGoConfig 生成 picgo-plugin-web-uploader 的配置片段，PicGo 与 PicList 均可导入。
+// 插件要求 customHeader/customBody 为 JSON 字符串。
+func picGoConfig(target clientUploadTarget) gin.H {
+	header, _ := json.Marshal(map[string]string{
+		"Authorization": "Bearer " + target.Token,
+		"Accept":        "application/json",
+	})
+	body, _ := json.Marshal(target.fields())
+	uploader := gin.H{
+		"url":          target.UploadURL,
+		"paramName":    "file",
+		"jsonPath":     clientURLJSONPath,
+		"customHeader": string(header),
+		"customBody":   string(body),
+	}
+	return gin.H{
+		"picBed": gin.H{
+			"uploader":     "web-uploader",
+			"current":      "web-uploader",
+			"web-uploader": uploader,
+		},
+		"picgoPlugins": gin.H{"picgo-plugin-web-uploader": true},
+	}
+}
+
+// upicConfig 生成 uPic 的自定义图床导出文件，data 字段本身是 JSON 字符串。
+func upicConfig(filename, siteName string, target clientUploadTarget) (clientConfigFile, error) {
+	type keyValue struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	headers, _ := json.Marshal([]keyValue{
+		{Key: "Authorization", Value: "Bearer " + target.Token},
+		{Key: "Accept", Value: "application/json"},
+	})
+	fields := target.fields()
+	bodys, _ := json.Marshal([]keyValue{
+		{Key: "strategy_id", Value: fields["strategy_id"]},
+		{Key: "permission", Value: fields["permission"]},
+	})
+	resultPath, _ := json.Marshal(strings.Split(clientURLJSONPath, "."))
+	hostData, err := json.Marshal(map[string]string{
+		"url":         target.UploadURL,
+		"method":      "POST",
+		"field":       "file",
+		"headers":     string(headers),
+		"bodys":       string(bodys),
+		"resultPath":  string(resultPath),
+		"saveKeyPath": "",
+		"domain":      "",
+	})
+	if err != nil {
+		return clientConfigFile{}, err
+	}
+	return marshalClientConfig(filename, []gin.H{{
+		"name": siteName,
+		"type": "custom",
+		"data": string(hostData),
+	}})
+}
+
+// flameshotScript 生成 curl 上传脚本：可上传参数中的文件，或读取标准输入（flameshot gui -r | script）。
+func flameshotScript(siteName string, target clientUploadTarget) string {
+	fields := target.fields()
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# %s 上传脚本，依赖 curl 与 jq。\n", siteName)
+	b.WriteString("# 用法：flameshot gui -r | ./upload.sh，或 ./upload.sh image.png\n")
+	b.WriteString("set -eu\n\n")
+	fmt.Fprintf(&b, "UPLOAD_URL=%s\n", shellQuote(target.UploadURL))
+	fmt.Fprintf(&b, "TOKEN=%s\n\n", shellQuote(target.Token))
+	b.WriteString("if [ $# -gt 0 ]; then\n")
+	b.WriteString("  file=\"$1\"\n")
+	b.WriteString("  name=$(basename \"$1\")\n")
+	b.WriteString("else\n")
+	b.WriteString("  name=screenshot.png\n")
+	b.WriteString("  file=$(mktemp \"${TMPDIR:-/tmp}/skyimage.XXXXXX\")\n")
+	b.WriteString("  trap 'rm -f \"$file\"' EXIT\n")
+	b.WriteString("  cat > \"$file\"\n")
+	b.WriteString("fi\n\n")
+	b.WriteString("response=$(curl -sS -H \"Authorization: Bearer $TOKEN\" -H \"Accept: application/json\" \\\n")
+	b.WriteString("  -F \"file=@$file;filename=$name\" \\\n")
+	fmt.Fprintf(&b, "  -F strategy_id=%s -F permission=%s \\\n", fields["strategy_id"], fields["permission"])
+	b.WriteString("  \"$UPLOAD_URL\")\n")
+	fmt.Fprintf(&b, "url=$(printf '%%s' \"$response\" | jq -r '.%s // empty')\n", clientURLJSONPath)
+	b.WriteString("if [ -z \"$url\" ]; then\n")
+	fmt.Fprintf(&b, "  printf '%%s\\n' \"$(printf '%%s' \"$response\" | jq -r '.%s // \"上传失败\"')\" >&2\n", clientErrorJSONPath)
+	b.WriteString("  exit 1\n")
+	b.WriteString("fi\n\n")
+	b.WriteString("if command -v wl-copy >/dev/null 2>&1; then\n")
+	b.WriteString("  printf '%s' \"$url\" | wl-copy\n")
+	b.WriteString("elif command -v xclip >/dev/null 2>&1; then\n")
+	b.WriteString("  printf '%s' \"$url\" | xclip -selection clipboard\n")
+	b.WriteString("elif command -v pbcopy >/dev/null 2>&1; then\n")
+	b.WriteString("  printf '%s' \"$url\" | pbcopy\n")
+	b.WriteString("fi\n")
+	b.WriteString("printf '%s\\n' \"$url\"\n")
+	return b.String()
+}
+
+func marshalClientConfig(filename string, value interface{}) (clientConfigFile, error) {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return clientConfigFile{}, err
+	}
+	return clientConfigFile{Filename: filename, Content: string(content)}, nil
+}
+
+// clientConfigSlug 把站点名称转换为文件名，非 ASCII 名称回退为 skyimage。
+func clientConfigSlug(siteName string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(siteName) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '_':
+			if b.Len() > 0 {
+				b.WriteByte('-')
+			}
+		}
+	}
+	slug := strings.Trim(b.String(), "-")
+	if slug == "" {
+		return "skyimage"
+	}
+	return slug
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
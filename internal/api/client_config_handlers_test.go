@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"skyimage/internal/data"
+	"skyimage/internal/middleware"
+)
+
+func TestClientConfig_IssuesScopedTokenAndWorkingConfigs(t *testing.T) {
+	client := newLskyContractServer(t)
+	server := client.server
+	client.engine.POST("/api/account/api-token/client-config", server.scopedAuthMiddleware(middleware.Scope(data.ApiTokenScopeTokens)), server.handleGenerateClientConfig)
+
+	if recorder := client.do(http.MethodPost, "/api/account/api-token/client-config", "application/json", []byte(`{"client":"unknown"}`)); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unknown client should be rejected, got %d", recorder.Code)
+	}
+	if recorder := client.do(http.MethodPost, "/api/account/api-token/client-config", "application/json", []byte(`{"strategyId":999}`)); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unavailable strategy should be rejected, got %d", recorder.Code)
+	}
+
+	recorder := client.do(http.MethodPost, "/api/account/api-token/client-config", "application/json", []byte(`{"visibility":"private"}`))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Token     string                      `json:"token"`
+			UploadURL string                      `json:"uploadUrl"`
+			Configs   map[string]clientConfigFile `json:"configs"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	for _, kind := range clientConfigKinds {
+		if resp.Data.Configs[kind].Content == "" || !strings.Contains(resp.Data.Configs[kind].Content, resp.Data.Token) {
+			t.Fatalf("%s config should embed the issued token: %+v", kind, resp.Data.Configs[kind])
+		}
+	}
+
+	var sharex struct {
+		RequestURL   string            `json:"RequestURL"`
+		Headers      map[string]string `json:"Headers"`
+		Arguments    map[string]string `json:"Arguments"`
+		FileFormName string            `json:"FileFormName"`
+		URL          string            `json:"URL"`
+	}
+	if err := json.Unmarshal([]byte(resp.Data.Configs["sharex"].Content), &sharex); err != nil {
+		t.Fatalf("invalid sxcu: %v", err)
+	}
+	if sharex.RequestURL != resp.Data.UploadURL || !strings.HasSuffix(sharex.RequestURL, clientUploadPath) || sharex.FileFormName != "file" {
+		t.Fatalf("unexpected sxcu request: %+v", sharex)
+	}
+	if sharex.Arguments["permission"] != "0" || sharex.Arguments["strategy_id"] == "" {
+		t.Fatalf("sxcu should carry strategy and visibility: %v", sharex.Arguments)
+	}
+
+	// 按 sxcu 的参数上传，并用其中的 JSON 路径取出链接
+	client.token = resp.Data.Token
+	body, contentType := lskyUploadBody(t, sharex.Arguments)
+	uploaded := client.do(http.MethodPost, clientUploadPath, contentType, body)
+	if uploaded.Code != http.StatusOK {
+		t.Fatalf("upload with generated config failed: %d %s", uploaded.Code, uploaded.Body.String())
+	}
+	var payload interface{}
+	_ = json.Unmarshal(uploaded.Body.Bytes(), &payload)
+	path := strings.TrimSuffix(strings.TrimPrefix(sharex.URL, "{json:"), "}")
+	for _, key := range strings.Split(path, ".") {
+		object, _ := payload.(map[string]interface{})
+		payload = object[key]
+	}
+	if link := fmt.Sprint(payload); !strings.HasPrefix(link, "https://img.example.com/") {
+		t.Fatalf("json path %s resolved to %q", path, link)
+	}
+
+	// 签发的 Token 只能上传
+	if recorder := client.do(http.MethodGet, "/api/v1/images", "", nil); recorder.Code != http.StatusForbidden {
+		t.Fatalf("generated token should be upload-only, got %d", recorder.Code)
+	}
+}
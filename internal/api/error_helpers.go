@@ -4,7 +4,10 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/gin-gonic/gin"
+
 	"skyimage/internal/files"
+	"skyimage/internal/ratelimit"
 )
 
 func statusCodeFromError(err error, fallback int) int {
@@ -15,8 +18,20 @@ func statusCodeFromError(err error, fallback int) int {
 	if errors.As(err, &statusErr) && statusErr.StatusCode > 0 {
 		return statusErr.StatusCode
 	}
+	var limitErr *ratelimit.ExceededError
+	if errors.As(err, &limitErr) {
+		return http.StatusTooManyRequests
+	}
 	if fallback > 0 {
 		return fallback
 	}
 	return http.StatusInternalServerError
 }
+
+// writeRateLimitHeaders 在错误来自限流时写入 Retry-After / RateLimit-* 响应头。
+func writeRateLimitHeaders(c *gin.Context, err error) {
+	var limitErr *ratelimit.ExceededError
+	if errors.As(err, &limitErr) {
+		ratelimit.SetHeaders(c.Writer.Header(), limitErr.Result)
+	}
+}
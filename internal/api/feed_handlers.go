@@ -0,0 +1,447 @@
+package api
+
+import (
+	"encoding/xml"
+	"errors"
+	stdhtml "html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+	"skyimage/internal/files"
+	"skyimage/internal/users"
+)
+
+// 订阅源只输出最近的图片，阅读器按 guid/id 去重
+const feedItemLimit = 50
+
+const (
+	settingGalleryFeed = "features.gallery_feed"
+	settingUserFeeds   = "features.user_feeds"
+	settingSitemap     = "features.sitemap"
+)
+
+const mediaRSSNamespace = "http://search.yahoo.com/mrss/"
+
+func (s *Server) registerFeedRoutes() {
+	s.engine.GET("/feed.atom", s.handleGalleryFeed("atom"))
+	s.engine.GET("/feed.rss", s.handleGalleryFeed("rss"))
+	s.engine.GET("/u/:id/feed.atom", s.handleUserFeed("atom"))
+	s.engine.GET("/u/:id/feed.rss", s.handleUserFeed("rss"))
+}
+
+// feedChannel 是 Atom 与 RSS 共用的中间结构。
+type feedChannel struct {
+	Title       string
+	Description string
+	SiteURL     string
+	SelfURL     string
+	Author      string
+	Updated     time.Time
+	Items       []feedItem
+}
+
+type feedItem struct {
+	Title     string
+	Link      string
+	ImageURL  string
+	MimeType  string
+	Size      int64
+	Width     int
+	Height    int
+	Author    string
+	Published time.Time
+}
+
+func (s *Server) handleGalleryFeed(format string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		settings, err := s.admin.GetSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// 关闭图片广场时站点订阅源一并关闭
+		if settings["features.gallery"] == "false" || settings[settingGalleryFeed] == "false" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		items, err := s.files.ListPublic(ctx, feedItemLimit, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		base := s.publicBaseURL(c)
+		siteName := feedSiteName(settings)
+		channel := feedChannel{
+			Title:       siteName + " 图片广场",
+			Description: strings.TrimSpace(settings["site.description"]),
+			SiteURL:     base + "/",
+			SelfURL:     base + "/feed." + format,
+			Author:      siteName,
+		}
+		if err := s.fillFeedItems(c, &channel, items, base); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		writeFeed(c, format, channel)
+	}
+}
+
+func (s *Server) handleUserFeed(format string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		settings, err := s.admin.GetSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if settings[settingUserFeeds] == "false" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		userID, err := data.ParseUserID(c.Param("id"))
+		if err != nil || userID == 0 {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		user, err := s.users.FindByID(ctx, userID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.Status(http.StatusNotFound)
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// 与公开主页一致：未开启公开主页的用户没有订阅源
+		if user.Status == 0 || !users.PublicProfileEnabled(user) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		items, err := s.files.ListPublicByUser(ctx, user.ID, feedItemLimit, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for i := range items {
+			items[i].User = user
+		}
+		base := s.publicBaseURL(c)
+		profileURL := base + "/u/" + strconv.FormatUint(uint64(user.ID), 10)
+		channel := feedChannel{
+			Title:       user.Name + " - " + feedSiteName(settings),
+			Description: user.Name + " 的公开图片",
+			SiteURL:     profileURL,
+			SelfURL:     profileURL + "/feed." + format,
+			Author:      user.Name,
+		}
+		if err := s.fillFeedItems(c, &channel, items, base); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		writeFeed(c, format, channel)
+	}
+}
+
+// feedDiscoveryLinks 返回注入 index.html 的订阅源自动发现链接，公开主页额外包含该用户的订阅源。
+func (s *Server) feedDiscoveryLinks(c *gin.Context, settings map[string]string) string {
+	var b strings.Builder
+	siteName := stdhtml.EscapeString(feedSiteName(settings))
+	if settings["features.gallery"] != "false" && settings[settingGalleryFeed] != "false" {
+		b.WriteString(`<link rel="alternate" type="application/atom+xml" title="` + siteName + `" href="/feed.atom" />`)
+		b.WriteString(`<link rel="alternate" type="application/rss+xml" title="` + siteName + `" href="/feed.rss" />`)
+	}
+	if settings[settingUserFeeds] == "false" {
+		return b.String()
+	}
+	segment, rest := splitFirstSegment(c.Request.URL.Path)
+	if segment != "u" || rest == "" || strings.Contains(rest, "/") {
+		return b.String()
+	}
+	userID, err := data.ParseUserID(rest)
+	if err != nil || userID == 0 {
+		return b.String()
+	}
+	user, err := s.users.FindByID(c.Request.Context(), userID)
+	if err != nil || user.Status == 0 || !users.PublicProfileEnabled(user) {
+		return b.String()
+	}
+	prefix := "/u/" + strconv.FormatUint(uint64(user.ID), 10)
+	title := stdhtml.EscapeString(user.Name)
+	b.WriteString(`<link rel="alternate" type="application/atom+xml" title="` + title + `" href="` + prefix + `/feed.atom" />`)
+	b.WriteString(`<link rel="alternate" type="application/rss+xml" title="` + title + `" href="` + prefix + `/feed.rss" />`)
+	return b.String()
+}
+
+func feedSiteName(settings map[string]string) string {
+	if title := strings.TrimSpace(settings["site.title"]); title != "" {
+		return title
+	}
+	return "SkyImage"
+}
+
+func (s *Server) fillFeedItems(c *gin.Context, channel *feedChannel, items []data.FileAsset, base string) error {
+	channel.Items = make([]feedItem, 0, len(items))
+	for _, file := range items {
+		imageURL, err := s.files.PublicURL(c.Request.Context(), file)
+		if err != nil {
+			return err
+		}
+		item := feedItem{
+			Title:     shareTitle(files.FileDTO{Name: file.Name, OriginalName: file.OriginalName}),
+			Link:      base + sharePathPrefix + url.PathEscape(file.Key),
+			ImageURL:  absoluteShareURL(base, imageURL),
+			MimeType:  file.MimeType,
+			Size:      file.Size,
+			Width:     file.Width,
+			Height:    file.Height,
+			Published: file.CreatedAt,
+		}
+		// 作者只在其开启公开主页时展示
+		if users.PublicProfileEnabled(file.User) {
+			item.Author = file.User.Name
+		}
+		channel.Items = append(channel.Items, item)
+		if file.CreatedAt.After(channel.Updated) {
+			channel.Updated = file.CreatedAt
+		}
+	}
+	if channel.Updated.IsZero() {
+		channel.Updated = time.Now()
+	}
+	return nil
+}
+
+func writeFeed(c *gin.Context, format string, channel feedChannel) {
+	var (
+		doc         interface{}
+		contentType string
+	)
+	if format == "rss" {
+		doc = buildRSSFeed(channel)
+		contentType = "application/rss+xml; charset=utf-8"
+	} else {
+		doc = buildAtomFeed(channel)
+		contentType = "application/atom+xml; charset=utf-8"
+	}
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=600")
+	c.Data(http.StatusOK, contentType, append([]byte(xml.Header), body...))
+}
+
+// feedItemHTML 生成条目正文，阅读器中直接显示图片。
+func feedItemHTML(item feedItem) string {
+	var b strings.Builder
+	b.WriteString(`<p><a href="`)
+	xml.EscapeText(&b, []byte(item.Link))
+	b.WriteString(`"><img src="`)
+	xml.EscapeText(&b, []byte(item.ImageURL))
+	b.WriteString(`" alt="`)
+	xml.EscapeText(&b, []byte(item.Title))
+	b.WriteString(`"`)
+	if item.Width > 0 && item.Height > 0 {
+		b.WriteString(` width="` + strconv.Itoa(item.Width) + `" height="` + strconv.Itoa(item.Height) + `"`)
+	}
+	b.WriteString(` /></a></p>`)
+	return b.String()
+}
+
+// Media RSS 元素，Atom 与 RSS 共用。
+type mediaContent struct {
+	URL      string          `xml:"url,attr"`
+	Type     string          `xml:"type,attr,omitempty"`
+	Medium   string          `xml:"medium,attr"`
+	FileSize int64           `xml:"fileSize,attr,omitempty"`
+	Width    int             `xml:"width,attr,omitempty"`
+	Height   int             `xml:"height,attr,omitempty"`
+	Title    string          `xml:"media:title,omitempty"`
+	Thumb    *mediaThumbnail `xml:"media:thumbnail,omitempty"`
+}
+
+type mediaThumbnail struct {
+	URL    string `xml:"url,attr"`
+	Width  int    `xml:"width,attr,omitempty"`
+	Height int    `xml:"height,attr,omitempty"`
+}
+
+func newMediaContent(item feedItem) *mediaContent {
+	return &mediaContent{
+		URL:      item.ImageURL,
+		Type:     item.MimeType,
+		Medium:   "image",
+		FileSize: item.Size,
+		Width:    item.Width,
+		Height:   item.Height,
+		Title:    item.Title,
+		Thumb:    &mediaThumbnail{URL: item.ImageURL, Width: item.Width, Height: item.Height},
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Atom 1.0 (RFC 4287)
+// ---------------------------------------------------------------------------
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	XMLNS    string      `xml:"xmlns,attr"`
+	Media    string      `xml:"xmlns:media,attr"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string        `xml:"id"`
+	Title     string        `xml:"title"`
+	Updated   string        `xml:"updated"`
+	Published string        `xml:"published"`
+	Author    *atomAuthor   `xml:"author,omitempty"`
+	Links     []atomLink    `xml:"link"`
+	Content   atomContent   `xml:"content"`
+	Media     *mediaContent `xml:"media:content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func buildAtomFeed(channel feedChannel) atomFeed {
+	feed := atomFeed{
+		XMLNS:    "http://www.w3.org/2005/Atom",
+		Media:    mediaRSSNamespace,
+		ID:       channel.SelfURL,
+		Title:    channel.Title,
+		Subtitle: channel.Description,
+		Updated:  channel.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: channel.SelfURL},
+			{Rel: "alternate", Type: "text/html", Href: channel.SiteURL},
+		},
+		Entries: make([]atomEntry, 0, len(channel.Items)),
+	}
+	for _, item := range channel.Items {
+		published := item.Published.UTC().Format(time.RFC3339)
+		entry := atomEntry{
+			ID:        item.Link,
+			Title:     item.Title,
+			Updated:   published,
+			Published: published,
+			Links: []atomLink{
+				{Rel: "alternate", Type: "text/html", Href: item.Link},
+				{Rel: "enclosure", Type: item.MimeType, Href: item.ImageURL, Length: item.Size},
+			},
+			Content: atomContent{Type: "html", Body: feedItemHTML(item)},
+			Media:   newMediaContent(item),
+		}
+		// Atom 要求条目或订阅源提供作者，未公开主页的用户以订阅源作者代替
+		author := item.Author
+		if author == "" {
+			author = channel.Author
+		}
+		entry.Author = &atomAuthor{Name: author}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+// ---------------------------------------------------------------------------
+// RSS 2.0
+// ---------------------------------------------------------------------------
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Media   string     `xml:"xmlns:media,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	SelfLink      atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Author      string        `xml:"media:credit,omitempty"`
+	Description string        `xml:"description"`
+	Enclosure   rssEnclosure  `xml:"enclosure"`
+	Media       *mediaContent `xml:"media:content"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+func buildRSSFeed(channel feedChannel) rssFeed {
+	description := channel.Description
+	if description == "" {
+		description = channel.Title
+	}
+	feed := rssFeed{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Media:   mediaRSSNamespace,
+		Channel: rssChannel{
+			Title:         channel.Title,
+			Link:          channel.SiteURL,
+			Description:   description,
+			SelfLink:      atomLink{Rel: "self", Type: "application/rss+xml", Href: channel.SelfURL},
+			LastBuildDate: channel.Updated.UTC().Format(time.RFC1123Z),
+			Items:         make([]rssItem, 0, len(channel.Items)),
+		},
+	}
+	for _, item := range channel.Items {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{IsPermaLink: true, Value: item.Link},
+			PubDate:     item.Published.UTC().Format(time.RFC1123Z),
+			Author:      item.Author,
+			Description: feedItemHTML(item),
+			Enclosure:   rssEnclosure{URL: item.ImageURL, Length: item.Size, Type: item.MimeType},
+			Media:       newMediaContent(item),
+		})
+	}
+	return feed
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gorm.io/datatypes"
+
+	"skyimage/internal/data"
+)
+
+func TestFeedsSitemapAndRobots(t *testing.T) {
+	client := newLskyContractServer(t)
+	server := client.server
+	server.registerFeedRoutes()
+	client.engine.GET("/sitemap.xml", server.handleSitemap)
+	client.engine.GET("/robots.txt", server.robotsHandler)
+
+	body, contentType := lskyUploadBody(t, map[string]string{"permission": "1"})
+	uploaded := client.do(http.MethodPost, "/api/v1/upload", contentType, body)
+	var resp map[string]interface{}
+	if err := json.Unmarshal(uploaded.Body.Bytes(), &resp); err != nil || uploaded.Code != http.StatusOK {
+		t.Fatalf("upload failed: %d %s", uploaded.Code, uploaded.Body.String())
+	}
+	key := fmt.Sprint(dataField(t, resp, "key"))
+	client.token = ""
+	const userPath = "/u/1000000000000001"
+
+	get := func(path string, status int) string {
+		t.Helper()
+		recorder := client.do(http.MethodGet, path, "", nil)
+		if recorder.Code != status {
+			t.Fatalf("GET %s: expected %d, got %d: %s", path, status, recorder.Code, recorder.Body.String())
+		}
+		if status == http.StatusOK && !strings.HasSuffix(path, ".txt") {
+			var doc struct{}
+			if err := xml.Unmarshal(recorder.Body.Bytes(), &doc); err != nil {
+				t.Fatalf("GET %s returned invalid xml: %v", path, err)
+			}
+		}
+		return recorder.Body.String()
+	}
+
+	atom := get("/feed.atom", http.StatusOK)
+	for _, want := range []string{
+		`<link rel="enclosure" type="image/png" href="https://img.example.com/`,
+		`<media:content url="https://img.example.com/`,
+		`medium="image"`,
+		`<id>http://example.com/i/` + key + `</id>`,
+	} {
+		if !strings.Contains(atom, want) {
+			t.Fatalf("atom feed is missing %q:\n%s", want, atom)
+		}
+	}
+	rss := get("/feed.rss", http.StatusOK)
+	for _, want := range []string{`<enclosure url="https://img.example.com/`, `<guid isPermaLink="true">http://example.com/i/` + key + `</guid>`} {
+		if !strings.Contains(rss, want) {
+			t.Fatalf("rss feed is missing %q:\n%s", want, rss)
+		}
+	}
+
+	// 未开启公开主页时没有个人订阅源，站点地图也不收录主页
+	get(userPath+"/feed.atom", http.StatusNotFound)
+	if sitemap := get("/sitemap.xml", http.StatusOK); strings.Contains(sitemap, userPath) || !strings.Contains(sitemap, "/i/"+key) {
+		t.Fatalf("unexpected sitemap:\n%s", sitemap)
+	}
+
+	if err := server.db.Model(&data.User{}).Where("id = ?", 1000000000000001).
+		Update("configs", datatypes.JSON([]byte(`{"public_profile":true}`))).Error; err != nil {
+		t.Fatalf("failed to enable public profile: %v", err)
+	}
+	if feed := get(userPath+"/feed.rss", http.StatusOK); !strings.Contains(feed, "<media:credit>lsky</media:credit>") {
+		t.Fatalf("user feed should credit the owner:\n%s", feed)
+	}
+	if sitemap := get("/sitemap.xml", http.StatusOK); !strings.Contains(sitemap, "<loc>http://example.com"+userPath+"</loc>") {
+		t.Fatalf("sitemap should list the public profile:\n%s", sitemap)
+	}
+	if robots := get("/robots.txt", http.StatusOK); !strings.Contains(robots, "Sitemap: http://example.com/sitemap.xml") {
+		t.Fatalf("robots.txt should advertise the sitemap:\n%s", robots)
+	}
+
+	if err := server.admin.UpdateSettings(context.Background(), map[string]string{
+		settingGalleryFeed: "false",
+		settingUserFeeds:   "false",
+		settingSitemap:     "false",
+	}); err != nil {
+		t.Fatalf("failed to update settings: %v", err)
+	}
+	get("/feed.atom", http.StatusNotFound)
+	get(userPath+"/feed.atom", http.StatusNotFound)
+	get("/sitemap.xml", http.StatusNotFound)
+	if robots := get("/robots.txt", http.StatusOK); strings.Contains(robots, "Sitemap:") {
+		t.Fatalf("robots.txt should not advertise a disabled sitemap:\n%s", robots)
+	}
+}
@@ -1,11 +1,14 @@
 package api
 
 import (
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
+	"skyimage/internal/data"
 	"skyimage/internal/files"
 	"skyimage/internal/middleware"
 	"skyimage/internal/users"
@@ -13,18 +16,36 @@ import (
 
 func (s *Server) registerFileRoutes(r *gin.RouterGroup) {
 	fileGroup := r.Group("/files")
-	fileGroup.Use(s.authMiddleware(), middleware.RequireCSRF())
+	fileGroup.Use(s.scopedAuthMiddleware(fileTokenScope), middleware.RequireCSRF())
 	fileGroup.GET("", s.handleListFiles)
 	fileGroup.GET("/trends", s.handleUserFileTrends)
 	fileGroup.GET("/strategies", s.handleListAvailableStrategies)
+	fileGroup.GET("/duplicates", s.handleFileDuplicates)
+	fileGroup.POST("/similar", s.handleSimilarByProbe)
 	fileGroup.POST("", s.handleUploadFile)
 	fileGroup.GET("/:id", s.handleGetFile)
 	fileGroup.DELETE("/:id", s.handleDeleteFile)
+	fileGroup.GET("/:id/similar", s.handleSimilarFiles)
 	fileGroup.PATCH("/:id/visibility", s.handleUpdateFileVisibility)
 	fileGroup.PATCH("/batch/visibility", s.handleBatchUpdateFileVisibility)
 	fileGroup.POST("/batch/delete", s.handleBatchDeleteFiles)
 }
 
+// fileTokenScope 将 /files 下的路由映射到 API Token 权限。
+func fileTokenScope(c *gin.Context) string {
+	path := c.FullPath()
+	switch {
+	case c.Request.Method == http.MethodGet || strings.HasSuffix(path, "/similar"):
+		return data.ApiTokenScopeFilesRead
+	case c.Request.Method == http.MethodDelete || strings.HasSuffix(path, "/batch/delete"):
+		return data.ApiTokenScopeFilesDelete
+	case c.Request.Method == http.MethodPost && strings.HasSuffix(path, "/files"):
+		return data.ApiTokenScopeFilesUpload
+	default:
+		return data.ApiTokenScopeFilesWrite
+	}
+}
+
 func (s *Server) handleListFiles(c *gin.Context) {
 	user, ok := middleware.CurrentUser(c)
 	if !ok {
@@ -102,10 +123,12 @@ func (s *Server) handleUploadFile(c *gin.Context) {
 		}
 	}
 	record, err := s.files.Upload(c.Request.Context(), user, file, files.UploadOptions{
-		Visibility: visibility,
-		StrategyID: strategyID,
+		Visibility:         visibility,
+		StrategyID:         strategyID,
+		AllowedStrategyIDs: middleware.TokenStrategyIDs(c),
 	})
 	if err != nil {
+		writeRateLimitHeaders(c, err)
 		c.JSON(statusCodeFromError(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
@@ -133,7 +156,7 @@ func (s *Server) handleGetFile(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-	if file.UserID != user.ID && !user.IsAdmin {
+	if file.UserID != user.ID && !user.HasAdminPermission(data.AdminPermModeration) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 		return
 	}
@@ -265,3 +288,46 @@ func (s *Server) handleListAvailableStrategies(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"data": resp})
 }
+
+// serveStoredFile 输出图片内容，支持 Range/条件请求；未开启代理的对象存储重定向到图片地址。
+func (s *Server) serveStoredFile(c *gin.Context, file data.FileAsset) error {
+	ctx := c.Request.Context()
+	header := c.Writer.Header()
+	mimeType := strings.TrimSpace(file.MimeType)
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	header.Set("Content-Type", mimeType)
+	if file.ChecksumMD5 != "" {
+		header.Set("ETag", `"`+file.ChecksumMD5+`"`)
+	}
+	header.Set("Last-Modified", file.CreatedAt.UTC().Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("X-Content-Type-Options", "nosniff")
+
+	obj, err := s.files.OpenStoredObject(ctx, file.StrategyID, file.Path, file.RelativePath, file.StorageProvider)
+	if err != nil {
+		if target, urlErr := s.files.PublicURL(ctx, file); urlErr == nil && target != "" {
+			header.Del("Content-Type")
+			c.Redirect(http.StatusTemporaryRedirect, target)
+			return nil
+		}
+		return err
+	}
+	defer obj.Body.Close()
+	if seeker, ok := obj.Body.(io.ReadSeeker); ok {
+		// 处理 Range、If-None-Match 与 HEAD
+		http.ServeContent(c.Writer, c.Request, "", file.CreatedAt, seeker)
+		return nil
+	}
+	size := obj.ContentLength
+	if size <= 0 {
+		size = file.Size
+	}
+	header.Set("Content-Length", strconv.FormatInt(size, 10))
+	c.Status(http.StatusOK)
+	if c.Request.Method != http.MethodHead {
+		_, _ = io.Copy(c.Writer, obj.Body)
+	}
+	return nil
+}
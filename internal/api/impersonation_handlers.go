@@ -0,0 +1,187 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"skyimage/internal/auditlog"
+	"skyimage/internal/data"
+	"skyimage/internal/middleware"
+	"skyimage/internal/session"
+)
+
+// impersonatorCookieName 在模拟登录期间保存管理员自己的会话，结束模拟时恢复。
+const impersonatorCookieName = "skyimage_impersonator"
+
+// impersonationInfo 随 /auth/me 返回，前端据此显示模拟登录提示。
+type impersonationInfo struct {
+	ImpersonatorID    uint      `json:"impersonatorId,string"`
+	ImpersonatorName  string    `json:"impersonatorName"`
+	ImpersonatorEmail string    `json:"impersonatorEmail"`
+	ExpiresAt         time.Time `json:"expiresAt"`
+}
+
+type meResponse struct {
+	data.User
+	Impersonation *impersonationInfo `json:"impersonation,omitempty"`
+}
+
+func (s *Server) currentImpersonationInfo(c *gin.Context) *impersonationInfo {
+	info, ok := middleware.CurrentImpersonation(c)
+	if !ok {
+		return nil
+	}
+	out := &impersonationInfo{ImpersonatorID: info.ImpersonatorID, ExpiresAt: info.ExpiresAt}
+	if admin, err := s.users.FindByID(c.Request.Context(), info.ImpersonatorID); err == nil {
+		out.ImpersonatorName = admin.Name
+		out.ImpersonatorEmail = admin.Email
+	}
+	return out
+}
+
+// handleAdminStartImpersonation 以目标用户身份创建限时会话，管理员原会话保存在单独的 Cookie 中。
+func (s *Server) handleAdminStartImpersonation(c *gin.Context) {
+	if !requireSuperAdmin(c) {
+		return
+	}
+	actor, _ := middleware.CurrentUser(c)
+	adminSessionID := currentSessionID(c)
+	if adminSessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请在浏览器登录后发起模拟登录"})
+		return
+	}
+	id, err := parseRouteUserID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if id == actor.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能模拟登录自己的账户"})
+		return
+	}
+	target, err := s.users.FindByID(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if target.IsSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能模拟登录超级管理员"})
+		return
+	}
+	if target.Status == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该账户已被禁用"})
+		return
+	}
+
+	clientIP := getClientIP(c, s.isCDNEnabled(c.Request.Context()))
+	sessionID, expiresAt, err := s.session.CreateImpersonation(actor.ID, target.ID, session.Metadata{
+		IP:        clientIP,
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
+		return
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     impersonatorCookieName,
+		Value:    adminSessionID,
+		Path:     "/",
+		MaxAge:   int(session.RememberTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   isSecureRequest(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+	s.writeSessionCookie(c, sessionID, session.ImpersonationTTL)
+	auditChange(c, nil, gin.H{"email": target.Email, "expiresAt": expiresAt})
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"user": target, "expiresAt": expiresAt}})
+}
+
+// handleStopImpersonation 结束模拟登录并恢复管理员会话；模拟会话已过期时也可调用。
+func (s *Server) handleStopImpersonation(c *gin.Context) {
+	ctx := c.Request.Context()
+	if sessionID, err := c.Cookie(session.CookieName); err == nil && sessionID != "" {
+		if resolved, ok := s.session.ResolveSession(sessionID); ok {
+			if resolved.ImpersonatorID == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "当前不是模拟登录会话"})
+				return
+			}
+			s.session.Delete(sessionID)
+			s.recordImpersonationEnd(c, resolved)
+		}
+	}
+
+	restored := false
+	if adminSessionID, err := c.Cookie(impersonatorCookieName); err == nil && adminSessionID != "" {
+		if resolved, ok := s.session.ResolveSession(adminSessionID); ok && resolved.ImpersonatorID == 0 {
+			if admin, err := s.users.FindByID(ctx, resolved.UserID); err == nil && admin.IsSuperAdmin && admin.Status == 1 {
+				s.writeSessionCookie(c, adminSessionID, resolved.Lifetime)
+				restored = true
+			}
+		}
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     impersonatorCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+	if !restored {
+		s.clearSessionCookie(c)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"restored": restored}})
+}
+
+// handleAdminEndImpersonations 注销目标用户上的全部模拟登录会话。
+func (s *Server) handleAdminEndImpersonations(c *gin.Context) {
+	if !requireSuperAdmin(c) {
+		return
+	}
+	id, err := parseRouteUserID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	revoked, err := s.session.EndImpersonations(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"revoked": revoked}})
+}
+
+// recordImpersonationEnd 结束模拟不经过后台路由，需要单独写入审计日志。
+func (s *Server) recordImpersonationEnd(c *gin.Context, resolved session.Resolved) {
+	if s.auditLog == nil {
+		return
+	}
+	ctx := c.Request.Context()
+	entry := auditlog.Entry{
+		ActorID:    resolved.ImpersonatorID,
+		Action:     "users.impersonate.end",
+		TargetType: "users",
+		TargetID:   auditlog.TargetID(resolved.UserID),
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path,
+		Status:     http.StatusOK,
+		IP:         getClientIP(c, s.isCDNEnabled(ctx)),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if admin, err := s.users.FindByID(ctx, resolved.ImpersonatorID); err == nil {
+		entry.ActorEmail = admin.Email
+	}
+	if err := s.auditLog.Record(ctx, entry); err != nil {
+		log.Printf("[审计] 写入审计日志失败: %v", err)
+	}
+}
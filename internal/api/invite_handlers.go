@@ -0,0 +1,267 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/auditlog"
+	"skyimage/internal/invites"
+	"skyimage/internal/middleware"
+)
+
+func (s *Server) handleAccountInvites(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	quota, err := s.invites.Quota(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	items, _, err := s.invites.List(c.Request.Context(), invites.Filter{InviterID: user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	settings := s.invites.Settings(c.Request.Context())
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"items":         items,
+		"quota":         quota,
+		"inviterReward": settings.InviterRewardBytes,
+		"inviteeReward": settings.InviteeRewardBytes,
+	}})
+}
+
+func (s *Server) handleAccountCreateInvite(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var payload struct {
+		Note string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	item, err := s.invites.CreateForUser(c.Request.Context(), user, payload.Note)
+	if err != nil {
+		c.JSON(inviteErrorStatus(err), gin.H{"error": localizeInviteError(err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": item})
+}
+
+func (s *Server) handleAccountDeleteInvite(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := s.invites.DeleteOwn(c.Request.Context(), user.ID, uint(id)); err != nil {
+		c.JSON(inviteErrorStatus(err), gin.H{"error": localizeInviteError(err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": "deleted"})
+}
+
+func (s *Server) handleAdminListInviteCodes(c *gin.Context) {
+	limit, offset := parsePagination(c, 50, 200)
+	filter := invites.Filter{Limit: limit, Offset: offset}
+	if raw := c.Query("inviterId"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid inviterId"})
+			return
+		}
+		filter.InviterID = uint(id)
+	}
+	items, total, err := s.invites.List(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"items": items, "total": total}})
+}
+
+func (s *Server) handleAdminCreateInviteCode(c *gin.Context) {
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing user"})
+		return
+	}
+	s.mu.RLock()
+	demoMode := s.cfg.DemoMode
+	s.mu.RUnlock()
+	if demoMode {
+		c.JSON(http.StatusForbidden, gin.H{"error": "演示站禁止创建邀请码"})
+		return
+	}
+	var payload invites.CreateInput
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	item, err := s.invites.Create(c.Request.Context(), actor, payload)
+	if err != nil {
+		c.JSON(inviteErrorStatus(err), gin.H{"error": localizeInviteError(err)})
+		return
+	}
+	auditTarget(c, "", "", auditlog.TargetID(item.ID))
+	auditChange(c, nil, item)
+	c.JSON(http.StatusOK, gin.H{"data": item})
+}
+
+func (s *Server) handleAdminUpdateInviteCode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	s.mu.RLock()
+	demoMode := s.cfg.DemoMode
+	s.mu.RUnlock()
+	if demoMode {
+		c.JSON(http.StatusForbidden, gin.H{"error": "演示站禁止修改邀请码"})
+		return
+	}
+	var payload invites.UpdateInput
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	previous, _ := s.invites.Get(c.Request.Context(), uint(id))
+	item, err := s.invites.Update(c.Request.Context(), uint(id), payload)
+	if err != nil {
+		c.JSON(inviteErrorStatus(err), gin.H{"error": localizeInviteError(err)})
+		return
+	}
+	auditChange(c, previous, item)
+	c.JSON(http.StatusOK, gin.H{"data": item})
+}
+
+func (s *Server) handleAdminDeleteInviteCode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	s.mu.RLock()
+	demoMode := s.cfg.DemoMode
+	s.mu.RUnlock()
+	if demoMode {
+		c.JSON(http.StatusForbidden, gin.H{"error": "演示站禁止删除邀请码"})
+		return
+	}
+	previous, _ := s.invites.Get(c.Request.Context(), uint(id))
+	if err := s.invites.Delete(c.Request.Context(), uint(id)); err != nil {
+		c.JSON(inviteErrorStatus(err), gin.H{"error": localizeInviteError(err)})
+		return
+	}
+	auditChange(c, previous, nil)
+	c.JSON(http.StatusOK, gin.H{"data": "deleted"})
+}
+
+func (s *Server) handleAdminListInviteCodeUsages(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	items, err := s.invites.ListUsages(c.Request.Context(), uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": items})
+}
+
+func (s *Server) handleAdminInviteSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": s.invites.Settings(c.Request.Context())})
+}
+
+func (s *Server) handleAdminUpdateInviteSettings(c *gin.Context) {
+	var payload invites.Settings
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.updateSettings(c, payload.Values()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": s.invites.Settings(c.Request.Context())})
+}
+
+func inviteErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, invites.ErrCodeNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, invites.ErrQuotaExceeded),
+		errors.Is(err, invites.ErrCodeUsed):
+		return http.StatusForbidden
+	case errors.Is(err, invites.ErrCodeExists):
+		return http.StatusConflict
+	case isInviteError(err):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func isInviteError(err error) bool {
+	for _, target := range []error{
+		invites.ErrCodeNotFound,
+		invites.ErrInvalidCode,
+		invites.ErrCodeDisabled,
+		invites.ErrCodeExpired,
+		invites.ErrCodeExhausted,
+		invites.ErrCodeExists,
+		invites.ErrCodeUsed,
+		invites.ErrQuotaExceeded,
+		invites.ErrAlreadyInvited,
+		invites.ErrSelfInvite,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func localizeInviteError(err error) string {
+	switch {
+	case errors.Is(err, invites.ErrCodeNotFound), errors.Is(err, invites.ErrInvalidCode):
+		return "邀请码无效"
+	case errors.Is(err, invites.ErrCodeDisabled):
+		return "邀请码已停用"
+	case errors.Is(err, invites.ErrCodeExpired):
+		return "邀请码已过期"
+	case errors.Is(err, invites.ErrCodeExhausted):
+		return "邀请码已达使用上限"
+	case errors.Is(err, invites.ErrCodeExists):
+		return "邀请码已存在"
+	case errors.Is(err, invites.ErrCodeUsed):
+		return "邀请码已被使用，无法删除"
+	case errors.Is(err, invites.ErrQuotaExceeded):
+		return "邀请码配额已用完"
+	case errors.Is(err, invites.ErrAlreadyInvited):
+		return "该账户已使用过邀请码"
+	case errors.Is(err, invites.ErrSelfInvite):
+		return "不能使用自己的邀请码"
+	default:
+		return err.Error()
+	}
+}
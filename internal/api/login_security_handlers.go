@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/data"
+	"skyimage/internal/loginguard"
+	"skyimage/internal/middleware"
+	"skyimage/internal/notifications"
+	"skyimage/internal/ratelimit"
+	"skyimage/internal/users"
+)
+
+func loginAttempt(c *gin.Context, clientIP, method string) loginguard.Attempt {
+	return loginguard.Attempt{IP: clientIP, UserAgent: c.Request.UserAgent(), Method: method}
+}
+
+// respondLoginLocked 在账户被锁定或处于渐进延迟时返回 429。
+func respondLoginLocked(c *gin.Context, err error) bool {
+	var locked *loginguard.LockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	secs := ratelimit.Seconds(locked.RetryAfter)
+	c.Header("Retry-After", strconv.Itoa(secs))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": locked.Error(), "retryAfterSeconds": secs, "locked": locked.Locked})
+	return true
+}
+
+// recordLoginSuccess 写入登录历史；来自新 IP 或设备时发送站内提醒。
+func (s *Server) recordLoginSuccess(c *gin.Context, user data.User, attempt loginguard.Attempt) {
+	newDevice, err := s.loginGuard.RecordSuccess(c.Request.Context(), user.ID, attempt)
+	if err != nil {
+		log.Printf("[登录] 记录登录历史失败: %v", err)
+		return
+	}
+	if !newDevice || s.notifications == nil {
+		return
+	}
+	go func() {
+		meta := notifications.LoginNoticeMetadata{IP: attempt.IP, UserAgent: attempt.UserAgent, Method: attempt.Method}
+		if err := s.notifications.NotifyNewLogin(context.Background(), user.ID, meta); err != nil {
+			log.Printf("[登录] 新设备登录提醒失败: %v", err)
+		}
+	}()
+}
+
+func (s *Server) handleAccountLoginHistory(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	limit, offset := parsePagination(c, 20, 100)
+	items, total, err := s.loginGuard.History(c.Request.Context(), user.ID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"items": items, "total": total}})
+}
+
+// handleAdminUnlockLogin 清除账户邮箱的登录失败计数与临时锁定。
+func (s *Server) handleAdminUnlockLogin(c *gin.Context) {
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing user"})
+		return
+	}
+	id, err := parseRouteUserID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	user, err := s.users.FindByID(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if err := users.GuardFullAdminTarget(actor, user); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.loginGuard.Unlock(c.Request.Context(), user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": "unlocked"})
+}
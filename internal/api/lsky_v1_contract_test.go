@@ -0,0 +1,339 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"skyimage/internal/admin"
+	"skyimage/internal/config"
+	"skyimage/internal/data"
+	"skyimage/internal/files"
+	"skyimage/internal/loginguard"
+	"skyimage/internal/users"
+)
+
+// testdata/lsky 下的样例按 Lsky Pro 2.x（API v1）的响应结构整理，逐字段比较取值，允许我们返回额外字段。
+// 与实例相关的值用占位写法：
+//   - "<string>"、"<number>"、"<bool>"：只校验类型；"<date>"：Lsky 的 "2006-01-02 15:04:05" 格式
+//   - "{name}"：整个值等于测试过程中记录的变量（如上传后得到的 key、pathname）
+//   - "~..."：实际字符串包含展开变量后的内容（用于 HTML/Markdown 等只关心链接的字段）
+// 其余字符串、数字、布尔与 null 必须完全相等，数组长度也必须一致。
+
+const lskyTestPNG = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mP8/x8AAwMCAO+jk6cAAAAASUVORK5CYII="
+
+type lskyTestClient struct {
+	t      *testing.T
+	server *Server
+	engine *gin.Engine
+	token  string
+	vars   map[string]interface{}
+}
+
+func newLskyContractServer(t *testing.T) *lskyTestClient {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(data.AllModels()...); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	group := data.Group{Name: "默认组", IsDefault: true, Configs: datatypes.JSON([]byte(`{"max_file_size":5242880,"upload_rate_minute":20,"upload_rate_hour":100}`))}
+	if err := db.Create(&group).Error; err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	user := data.User{ID: 1000000000000001, Name: "lsky", Email: "lsky@example.com", PasswordHash: "hashed", Status: 1, GroupID: &group.ID, Configs: datatypes.JSON([]byte(`{}`))}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	strategyConfig, _ := json.Marshal(map[string]interface{}{
+		"driver":        "local",
+		"root":          t.TempDir(),
+		"url":           "https://img.example.com",
+		"path_template": "{year}/{month}/{day}/{uuid}",
+	})
+	strategy := data.Strategy{Name: "本地", Configs: datatypes.JSON(strategyConfig)}
+	if err := db.Create(&strategy).Error; err != nil {
+		t.Fatalf("failed to create strategy: %v", err)
+	}
+	if err := db.Create(&data.GroupStrategy{GroupID: group.ID, StrategyID: strategy.ID}).Error; err != nil {
+		t.Fatalf("failed to link strategy: %v", err)
+	}
+	token := data.ApiToken{UserID: user.ID, Token: data.HashAPIToken("sk_lsky"), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.Create(&token).Error; err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	server := &Server{
+		db:          db,
+		admin:       admin.New(db),
+		users:       users.New(db),
+		files:       files.New(db, config.Config{}),
+		loginGuard:  loginguard.New(db),
+		authLimiter: newRequestLimiter(),
+		engine:      gin.New(),
+	}
+	server.registerLskyV1Routes(server.engine.Group("/api"))
+	return &lskyTestClient{t: t, server: server, engine: server.engine, token: "sk_lsky", vars: map[string]interface{}{
+		"group_id":    float64(group.ID),
+		"strategy_id": float64(strategy.ID),
+	}}
+}
+
+func (c *lskyTestClient) do(method, path, contentType string, body []byte) *httptest.ResponseRecorder {
+	c.t.Helper()
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	recorder := httptest.NewRecorder()
+	c.engine.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func (c *lskyTestClient) expect(recorder *httptest.ResponseRecorder, status int, fixture string) map[string]interface{} {
+	c.t.Helper()
+	if recorder.Code != status {
+		c.t.Fatalf("expected %d, got %d: %s", status, recorder.Code, recorder.Body.String())
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+		c.t.Fatalf("invalid json response: %v", err)
+	}
+	raw, err := os.ReadFile(filepath.Join("testdata", "lsky", fixture+".json"))
+	if err != nil {
+		c.t.Fatalf("failed to read fixture: %v", err)
+	}
+	var want interface{}
+	if err := json.Unmarshal(raw, &want); err != nil {
+		c.t.Fatalf("invalid fixture %s: %v", fixture, err)
+	}
+	for _, problem := range compareLskyContract("$", want, got, c.vars) {
+		c.t.Errorf("%s: %s", fixture, problem)
+	}
+	return got
+}
+
+var lskyDatePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}$`)
+
+// compareLskyContract 逐字段比较 got 与样例 want，占位写法见文件开头的说明。
+func compareLskyContract(path string, want, got interface{}, vars map[string]interface{}) []string {
+	switch expected := want.(type) {
+	case map[string]interface{}:
+		actual, ok := got.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, got %T", path, got)}
+		}
+		var problems []string
+		for key, value := range expected {
+			field, exists := actual[key]
+			if !exists {
+				problems = append(problems, path+"."+key+": missing")
+				continue
+			}
+			problems = append(problems, compareLskyContract(path+"."+key, value, field, vars)...)
+		}
+		return problems
+	case []interface{}:
+		actual, ok := got.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected array, got %T", path, got)}
+		}
+		if len(expected) != len(actual) {
+			return []string{fmt.Sprintf("%s: expected %d items, got %d", path, len(expected), len(actual))}
+		}
+		var problems []string
+		for i := range expected {
+			problems = append(problems, compareLskyContract(fmt.Sprintf("%s[%d]", path, i), expected[i], actual[i], vars)...)
+		}
+		return problems
+	case string:
+		return compareLskyString(path, expected, got, vars)
+	default:
+		if !reflect.DeepEqual(want, got) {
+			return []string{fmt.Sprintf("%s: expected %v, got %v", path, want, got)}
+		}
+		return nil
+	}
+}
+
+func compareLskyString(path, want string, got interface{}, vars map[string]interface{}) []string {
+	typeMismatch := func(kind string) []string {
+		return []string{fmt.Sprintf("%s: expected %s, got %T (%v)", path, kind, got, got)}
+	}
+	switch want {
+	case "<string>":
+		if _, ok := got.(string); !ok {
+			return typeMismatch("string")
+		}
+		return nil
+	case "<number>":
+		if _, ok := got.(float64); !ok {
+			return typeMismatch("number")
+		}
+		return nil
+	case "<bool>":
+		if _, ok := got.(bool); !ok {
+			return typeMismatch("bool")
+		}
+		return nil
+	case "<date>":
+		if value, ok := got.(string); !ok || !lskyDatePattern.MatchString(value) {
+			return typeMismatch("date")
+		}
+		return nil
+	}
+	if strings.HasPrefix(want, "{") && strings.HasSuffix(want, "}") && strings.Count(want, "{") == 1 {
+		if value, ok := vars[want[1:len(want)-1]]; ok {
+			if !reflect.DeepEqual(value, got) {
+				return []string{fmt.Sprintf("%s: expected %v, got %v", path, value, got)}
+			}
+			return nil
+		}
+	}
+	actual, ok := got.(string)
+	if !ok {
+		return typeMismatch("string")
+	}
+	contains := strings.HasPrefix(want, "~")
+	want = strings.TrimPrefix(want, "~")
+	for name, value := range vars {
+		want = strings.ReplaceAll(want, "{"+name+"}", fmt.Sprint(value))
+	}
+	if contains && !strings.Contains(actual, want) {
+		return []string{fmt.Sprintf("%s: expected %q to contain %q", path, actual, want)}
+	}
+	if !contains && actual != want {
+		return []string{fmt.Sprintf("%s: expected %q, got %q", path, want, actual)}
+	}
+	return nil
+}
+
+func lskyUploadBody(t *testing.T, fields map[string]string) ([]byte, string) {
+	t.Helper()
+	content, _ := base64.StdEncoding.DecodeString(lskyTestPNG)
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "example.png")
+	if err != nil {
+		t.Fatalf("failed to create form file: %v", err)
+	}
+	_, _ = part.Write(content)
+	for key, value := range fields {
+		_ = writer.WriteField(key, value)
+	}
+	_ = writer.Close()
+	return body.Bytes(), writer.FormDataContentType()
+}
+
+func dataField(t *testing.T, body map[string]interface{}, key string) interface{} {
+	t.Helper()
+	payload, ok := body["data"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("response has no data object: %v", body)
+	}
+	return payload[key]
+}
+
+func TestLskyV1Contract(t *testing.T) {
+	client := newLskyContractServer(t)
+
+	profile := client.do(http.MethodGet, "/api/v1/profile", "", nil)
+	client.expect(profile, http.StatusOK, "profile")
+	if profile.Header().Get("X-RateLimit-Limit") != "60" || profile.Header().Get("X-RateLimit-Remaining") != "59" {
+		t.Fatalf("unexpected rate limit headers: %v", profile.Header())
+	}
+
+	group := client.expect(client.do(http.MethodGet, "/api/v1/group", "", nil), http.StatusOK, "group")
+	if dataField(t, group, "name") != "默认组" {
+		t.Fatalf("expected the user's group, got %v", group)
+	}
+	client.expect(client.do(http.MethodGet, "/api/v1/strategies", "", nil), http.StatusOK, "strategies")
+
+	album := client.expect(client.do(http.MethodPost, "/api/v1/albums", "application/json", []byte(`{"name":"旅行"}`)), http.StatusOK, "album")
+	client.vars["album_id"] = dataField(t, album, "id")
+	albumID := fmt.Sprint(client.vars["album_id"])
+
+	body, contentType := lskyUploadBody(t, map[string]string{"album_id": albumID, "permission": "0"})
+	uploadRecorder := client.do(http.MethodPost, "/api/v1/upload", contentType, body)
+	var uploaded map[string]interface{}
+	if err := json.Unmarshal(uploadRecorder.Body.Bytes(), &uploaded); err != nil {
+		t.Fatalf("invalid upload response: %v", err)
+	}
+	for _, field := range []string{"key", "name", "pathname"} {
+		client.vars[field] = dataField(t, uploaded, field)
+	}
+	client.expect(uploadRecorder, http.StatusOK, "upload")
+	key := fmt.Sprint(client.vars["key"])
+	if !strings.HasSuffix(fmt.Sprint(client.vars["pathname"]), fmt.Sprint(client.vars["name"])) {
+		t.Fatalf("expected pathname to end with the stored name, got %v", client.vars)
+	}
+
+	images := client.expect(client.do(http.MethodGet, "/api/v1/images?album_id="+albumID+"&permission=private&keyword=example", "", nil), http.StatusOK, "images")
+	if dataField(t, images, "total") != float64(1) {
+		t.Fatalf("expected the uploaded image to match the filters, got %v", images)
+	}
+	// keyword 中的 % 与 _ 按字面匹配，不能当作通配符
+	for _, query := range []string{"permission=public", "album_id=999", "keyword=missing", "keyword=%25", "keyword=_"} {
+		client.expect(client.do(http.MethodGet, "/api/v1/images?"+query, "", nil), http.StatusOK, "images_empty")
+	}
+
+	client.expect(client.do(http.MethodGet, "/api/v1/images/"+key, "", nil), http.StatusOK, "image")
+	albums := client.expect(client.do(http.MethodGet, "/api/v1/albums", "", nil), http.StatusOK, "albums")
+	if list := dataField(t, albums, "data").([]interface{}); len(list) != 1 || list[0].(map[string]interface{})["image_num"] != float64(1) {
+		t.Fatalf("expected the album to count the upload, got %v", albums)
+	}
+
+	client.expect(client.do(http.MethodDelete, "/api/v1/images/"+key, "", nil), http.StatusOK, "empty")
+	if recorder := client.do(http.MethodGet, "/api/v1/images/"+key, "", nil); recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected deleted image to be gone, got %d", recorder.Code)
+	}
+	client.expect(client.do(http.MethodDelete, "/api/v1/albums/"+albumID, "", nil), http.StatusOK, "empty")
+}
+
+func TestLskyV1Throttle(t *testing.T) {
+	client := newLskyContractServer(t)
+	client.token = ""
+
+	var recorder *httptest.ResponseRecorder
+	for i := 0; i < lskyRateLimitPerMinute; i++ {
+		recorder = client.do(http.MethodGet, "/api/v1/strategies", "", nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("request %d should pass, got %d", i+1, recorder.Code)
+		}
+	}
+	if recorder.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("expected no remaining requests, got %q", recorder.Header().Get("X-RateLimit-Remaining"))
+	}
+
+	recorder = client.do(http.MethodGet, "/api/v1/strategies", "", nil)
+	client.expect(recorder, http.StatusTooManyRequests, "throttled")
+	if recorder.Header().Get("Retry-After") == "" || recorder.Header().Get("X-RateLimit-Reset") == "" {
+		t.Fatalf("expected retry headers, got %v", recorder.Header())
+	}
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("expected json error body")
+	}
+}
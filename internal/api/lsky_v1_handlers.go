@@ -2,7 +2,10 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -15,7 +18,11 @@ import (
 	"skyimage/internal/captcha"
 	"skyimage/internal/data"
 	"skyimage/internal/files"
+	"skyimage/internal/loginguard"
 	"skyimage/internal/middleware"
+	"skyimage/internal/ratelimit"
+	"skyimage/internal/session"
+	"skyimage/internal/twofactor"
 	"skyimage/internal/users"
 )
 
@@ -25,11 +32,18 @@ type LskyV1Handler struct {
 	admin       *admin.Service
 	userService *users.Service
 	fileService *files.Service
-	authLimiter *requestLimiter
+	authLimiter *ratelimit.Limiter
 	captcha     *captcha.Service
+	twoFactor   *twofactor.Service
+	loginGuard  *loginguard.Service
+	// demoMode 返回是否为演示站，演示站上传强制私有
+	demoMode func() bool
 }
 
-func NewLskyV1Handler(db *gorm.DB, adminSvc *admin.Service, userService *users.Service, fileService *files.Service, authLimiter *requestLimiter, captchaSvc *captcha.Service) *LskyV1Handler {
+// lskyRateLimitPerMinute 与 Lsky Pro（Laravel throttle:api）一致：每个用户或 IP 每分钟 60 次
+const lskyRateLimitPerMinute = 60
+
+func NewLskyV1Handler(db *gorm.DB, adminSvc *admin.Service, userService *users.Service, fileService *files.Service, authLimiter *ratelimit.Limiter, captchaSvc *captcha.Service, twoFactorSvc *twofactor.Service, loginGuard *loginguard.Service) *LskyV1Handler {
 	return &LskyV1Handler{
 		db:          db,
 		admin:       adminSvc,
@@ -37,6 +51,8 @@ func NewLskyV1Handler(db *gorm.DB, adminSvc *admin.Service, userService *users.S
 		fileService: fileService,
 		authLimiter: authLimiter,
 		captcha:     captchaSvc,
+		twoFactor:   twoFactorSvc,
+		loginGuard:  loginGuard,
 	}
 }
 
@@ -49,12 +65,40 @@ func (h *LskyV1Handler) isCDNEnabled(ctx context.Context) bool {
 	return settings["mail.cdn.enabled"] == "true"
 }
 
+// Throttle 按用户（未登录时按 IP）限制请求频率，并写入 Lsky 客户端读取的 X-RateLimit-* 响应头。
+// 需放在认证中间件之后。
+func (h *LskyV1Handler) Throttle(c *gin.Context) {
+	if h.authLimiter == nil {
+		c.Next()
+		return
+	}
+	key := "lsky:ip:" + getClientIP(c, h.isCDNEnabled(c.Request.Context()))
+	if user, ok := middleware.CurrentUser(c); ok {
+		key = fmt.Sprintf("lsky:user:%d", user.ID)
+	}
+	result := h.authLimiter.Take(c.Request.Context(), key, lskyRateLimitPerMinute, time.Minute)
+	ratelimit.SetHeaders(c.Writer.Header(), result)
+	c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(max(result.Remaining, 0)))
+	if !result.Allowed {
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(result.Reset).Unix(), 10))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"status":  false,
+			"message": "Too Many Attempts.",
+			"data":    gin.H{},
+		})
+		return
+	}
+	c.Next()
+}
+
 // 生成 Token
 func (h *LskyV1Handler) CreateToken(c *gin.Context) {
 	var req struct {
 		Email          string `json:"email" binding:"required"`
 		Password       string `json:"password" binding:"required"`
 		TurnstileToken string `json:"turnstileToken"`
+		TwoFactorCode  string `json:"two_factor_code"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -69,7 +113,7 @@ func (h *LskyV1Handler) CreateToken(c *gin.Context) {
 	clientIP := getClientIP(c, h.isCDNEnabled(c.Request.Context()))
 	emailKey := strings.ToLower(strings.TrimSpace(req.Email))
 	if h.authLimiter != nil {
-		if ok, retry := h.authLimiter.Allow("v1token:ip:"+clientIP, 20, time.Minute); !ok {
+		if ok, retry := allowRequest(c, h.authLimiter, "v1token:ip:"+clientIP, 20, time.Minute); !ok {
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"status":  false,
 				"message": fmt.Sprintf("Too many requests, retry in %d seconds", int(retry.Seconds())+1),
@@ -78,7 +122,7 @@ func (h *LskyV1Handler) CreateToken(c *gin.Context) {
 			return
 		}
 		if emailKey != "" {
-			if ok, retry := h.authLimiter.Allow("v1token:email:"+emailKey, 10, time.Minute); !ok {
+			if ok, retry := allowRequest(c, h.authLimiter, "v1token:email:"+emailKey, 10, time.Minute); !ok {
 				c.JSON(http.StatusTooManyRequests, gin.H{
 					"status":  false,
 					"message": fmt.Sprintf("Too many attempts for this account, retry in %d seconds", int(retry.Seconds())+1),
@@ -134,12 +178,41 @@ func (h *LskyV1Handler) CreateToken(c *gin.Context) {
 		}
 	}
 
+	// 按邮箱与 IP 限制失败次数，与网页登录共用计数
+	attempt := loginguard.Attempt{IP: clientIP, UserAgent: c.Request.UserAgent(), Method: "api"}
+	guardKeys := []string{loginguard.AccountKey(req.Email), loginguard.IPKey(clientIP)}
+	target, lookupErr := h.userService.FindByEmail(c.Request.Context(), req.Email)
+	if err := h.loginGuard.Reserve(c.Request.Context(), guardKeys...); err != nil {
+		if lookupErr == nil {
+			h.loginGuard.RecordBlocked(c.Request.Context(), target.ID, attempt)
+		}
+		var locked *loginguard.LockedError
+		if !errors.As(err, &locked) {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  false,
+				"message": "Internal server error",
+				"data":    gin.H{},
+			})
+			return
+		}
+		c.Header("Retry-After", strconv.Itoa(ratelimit.Seconds(locked.RetryAfter)))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"status":  false,
+			"message": fmt.Sprintf("Too many failed attempts, retry in %d seconds", ratelimit.Seconds(locked.RetryAfter)),
+			"data":    gin.H{},
+		})
+		return
+	}
+
 	// 验证用户
 	user, err := h.userService.Login(c.Request.Context(), users.LoginInput{
 		Email:    req.Email,
 		Password: req.Password,
 	})
 	if err != nil {
+		if lookupErr == nil && errors.Is(err, users.ErrInvalidCredentials) {
+			_ = h.loginGuard.RecordFailure(c.Request.Context(), target.ID, attempt)
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"status":  false,
 			"message": "Invalid credentials",
@@ -147,6 +220,57 @@ func (h *LskyV1Handler) CreateToken(c *gin.Context) {
 		})
 		return
 	}
+	if err := h.loginGuard.Reset(c.Request.Context(), guardKeys...); err != nil {
+		log.Printf("[lsky] 清除失败次数失败: %v", err)
+	}
+
+	// 已启用两步验证的账户需要在同一请求中提供验证码（或恢复码）
+	if h.twoFactor != nil && h.twoFactor.Enabled(c.Request.Context(), user.ID) {
+		code := strings.TrimSpace(req.TwoFactorCode)
+		if code == "" {
+			code = strings.TrimSpace(c.GetHeader("X-2FA-Code"))
+		}
+		if code == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  false,
+				"message": "Two-factor code required",
+				"data":    gin.H{"two_factor_required": true},
+			})
+			return
+		}
+		// 与网页登录共用按用户累计的两步验证失败次数
+		twoFactorKey := loginguard.TwoFactorKey(user.ID)
+		if err := h.loginGuard.Reserve(c.Request.Context(), twoFactorKey); err != nil {
+			var locked *loginguard.LockedError
+			if !errors.As(err, &locked) {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"status":  false,
+					"message": "Failed to check login attempts",
+					"data":    gin.H{},
+				})
+				return
+			}
+			c.Header("Retry-After", strconv.Itoa(ratelimit.Seconds(locked.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"status":  false,
+				"message": fmt.Sprintf("Too many failed attempts, retry in %d seconds", ratelimit.Seconds(locked.RetryAfter)),
+				"data":    gin.H{"two_factor_required": true},
+			})
+			return
+		}
+		if err := h.twoFactor.Verify(c.Request.Context(), user.ID, code); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  false,
+				"message": "Invalid two-factor code",
+				"data":    gin.H{"two_factor_required": true},
+			})
+			return
+		}
+		if err := h.loginGuard.Reset(c.Request.Context(), twoFactorKey); err != nil {
+			log.Printf("[lsky] 清除两步验证失败次数失败: %v", err)
+		}
+		attempt.Method = session.WithTwoFactor(attempt.Method)
+	}
 
 	tokenStr, err := data.GenerateAPIToken()
 	if err != nil {
@@ -160,6 +284,7 @@ func (h *LskyV1Handler) CreateToken(c *gin.Context) {
 
 	apiToken := data.ApiToken{
 		UserID:    user.ID,
+		Name:      "Lsky API",
 		Token:     data.HashAPIToken(tokenStr),
 		ExpiresAt: data.NewNeverExpireTime(),
 	}
@@ -171,9 +296,9 @@ func (h *LskyV1Handler) CreateToken(c *gin.Context) {
 		})
 		return
 	}
-
-	c.Header("X-RateLimit-Limit", "60")
-	c.Header("X-RateLimit-Remaining", "59")
+	if _, err := h.loginGuard.RecordSuccess(c.Request.Context(), user.ID, attempt); err != nil {
+		log.Printf("[lsky] 记录登录历史失败: %v", err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  true,
@@ -205,9 +330,6 @@ func (h *LskyV1Handler) DeleteTokens(c *gin.Context) {
 		return
 	}
 
-	c.Header("X-RateLimit-Limit", "60")
-	c.Header("X-RateLimit-Remaining", "59")
-
 	c.JSON(http.StatusOK, gin.H{
 		"status":  true,
 		"message": "Tokens deleted successfully",
@@ -227,9 +349,6 @@ func (h *LskyV1Handler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	c.Header("X-RateLimit-Limit", "60")
-	c.Header("X-RateLimit-Remaining", "59")
-
 	c.JSON(http.StatusOK, gin.H{
 		"status":  true,
 		"message": "Success",
@@ -254,7 +373,7 @@ func (h *LskyV1Handler) GetStrategies(c *gin.Context) {
 	var strategies []data.Strategy
 	query := h.db.Model(&data.Strategy{})
 	if keyword != "" {
-		query = query.Where("name LIKE ?", "%"+keyword+"%")
+		query = query.Where("name LIKE ? ESCAPE '!'", "%"+data.EscapeLike(keyword)+"%")
 	}
 
 	if err := query.Find(&strategies).Error; err != nil {
@@ -266,7 +385,7 @@ func (h *LskyV1Handler) GetStrategies(c *gin.Context) {
 		return
 	}
 
-	var result []gin.H
+	result := make([]gin.H, 0, len(strategies))
 	for _, s := range strategies {
 		result = append(result, gin.H{
 			"id":   s.ID,
@@ -274,9 +393,6 @@ func (h *LskyV1Handler) GetStrategies(c *gin.Context) {
 		})
 	}
 
-	c.Header("X-RateLimit-Limit", "60")
-	c.Header("X-RateLimit-Remaining", "59")
-
 	c.JSON(http.StatusOK, gin.H{
 		"status":  true,
 		"message": "Success",
@@ -325,15 +441,49 @@ func (h *LskyV1Handler) UploadImage(c *gin.Context) {
 		user.Group = guestGroup
 	}
 
-	// 兼容 Lsky v2：上传可见性遵循用户个人设置中的默认上传可见性。
+	var albumID uint
+	if raw := strings.TrimSpace(c.PostForm("album_id")); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || !authenticated {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  false,
+				"message": "Invalid album ID",
+				"data":    gin.H{},
+			})
+			return
+		}
+		albumID = uint(id)
+	}
+
+	// 兼容 Lsky v2：permission 为 1 公开、0 私有，未指定时遵循用户个人设置中的默认上传可见性。
 	visibility := users.DefaultVisibility(user)
+	switch c.PostForm("permission") {
+	case "1":
+		visibility = "public"
+	case "0":
+		visibility = "private"
+	}
+	if h.demoMode != nil && h.demoMode() {
+		visibility = "private"
+	}
 
 	// 使用文件服务上传
 	asset, err := h.fileService.Upload(c.Request.Context(), user, file, files.UploadOptions{
-		StrategyID: strategyID,
-		Visibility: visibility,
+		StrategyID:         strategyID,
+		Visibility:         visibility,
+		AlbumID:            albumID,
+		AllowedStrategyIDs: middleware.TokenStrategyIDs(c),
 	})
 	if err != nil {
+		if errors.Is(err, files.ErrAlbumNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  false,
+				"message": "Album not found",
+				"data":    gin.H{},
+			})
+			return
+		}
+		writeRateLimitHeaders(c, err)
 		c.JSON(statusCodeFromError(err, http.StatusInternalServerError), gin.H{
 			"status":  false,
 			"message": err.Error(),
@@ -360,22 +510,23 @@ func (h *LskyV1Handler) UploadImage(c *gin.Context) {
 	}
 	embeds := files.BuildImageEmbedCodes(asset.Name, imageURL)
 
-	c.Header("X-RateLimit-Limit", "60")
-	c.Header("X-RateLimit-Remaining", "59")
-
 	c.JSON(http.StatusOK, gin.H{
 		"status":  true,
 		"message": "Upload successful",
 		"data": gin.H{
-			"key":         asset.Key,
-			"name":        asset.Name,
-			"pathname":    asset.RelativePath,
-			"origin_name": asset.OriginalName,
-			"size":        float64(asset.Size) / 1024,
-			"mimetype":    asset.MimeType,
-			"extension":   asset.Extension,
-			"md5":         asset.ChecksumMD5,
-			"sha1":        asset.ChecksumSHA1,
+			"key":             asset.Key,
+			"name":            asset.Name,
+			"pathname":        asset.RelativePath,
+			"origin_name":     asset.OriginalName,
+			"size":            float64(asset.Size) / 1024,
+			"mimetype":        asset.MimeType,
+			"extension":       asset.Extension,
+			"md5":             asset.ChecksumMD5,
+			"sha1":            asset.ChecksumSHA1,
+			"width":           asset.Width,
+			"height":          asset.Height,
+			"blurhash":        asset.BlurHash,
+			"dominant_colors": files.ParseDominantColors(asset.DominantColors),
 			"links": gin.H{
 				"url":                imageURL,
 				"html":               embeds.HTML,
@@ -419,7 +570,21 @@ func (h *LskyV1Handler) GetImages(c *gin.Context) {
 	}
 
 	if keyword != "" {
-		query = query.Where("name LIKE ? OR original_name LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+		pattern := "%" + data.EscapeLike(keyword) + "%"
+		query = query.Where("(name LIKE ? ESCAPE '!' OR original_name LIKE ? ESCAPE '!')", pattern, pattern)
+	}
+
+	if raw := strings.TrimSpace(c.Query("album_id")); raw != "" {
+		albumID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  false,
+				"message": "Invalid album ID",
+				"data":    gin.H{},
+			})
+			return
+		}
+		query = query.Where("album_id = ?", albumID)
 	}
 
 	switch order {
@@ -448,43 +613,13 @@ func (h *LskyV1Handler) GetImages(c *gin.Context) {
 	}
 
 	viewer, _ := middleware.CurrentUser(c)
-	var result []gin.H
+	result := make([]gin.H, 0, len(images))
 	for _, img := range images {
-		imageURL := h.resolveAssetPublicURL(c, img)
-		thumbnailURL := imageURL
-		if files.CanAccessThumbnail(img, &viewer) {
-			if raw := strings.TrimSpace(img.ThumbnailPublicURL); raw != "" {
-				thumbnailURL = raw
-			}
-		}
-		embeds := files.BuildImageEmbedCodes(img.Name, imageURL)
-		result = append(result, gin.H{
-			"key":         img.Key,
-			"name":        img.Name,
-			"origin_name": img.OriginalName,
-			"pathname":    img.RelativePath,
-			"size":        float64(img.Size) / 1024,
-			"width":       img.Width,
-			"height":      img.Height,
-			"md5":         img.ChecksumMD5,
-			"sha1":        img.ChecksumSHA1,
-			"human_date":  formatHumanDate(img.CreatedAt),
-			"date":        img.CreatedAt.Format("2006-01-02 15:04:05"),
-			"links": gin.H{
-				"url":                imageURL,
-				"html":               embeds.HTML,
-				"bbcode":             fmt.Sprintf(`[img]%s[/img]`, imageURL),
-				"markdown":           embeds.Markdown,
-				"markdown_with_link": embeds.MarkdownWithLink,
-				"thumbnail_url":      thumbnailURL,
-			},
-		})
+		result = append(result, h.imageItem(c, img, &viewer))
 	}
 
-	lastPage := int((total + int64(perPage) - 1) / int64(perPage))
-
-	c.Header("X-RateLimit-Limit", "60")
-	c.Header("X-RateLimit-Remaining", "59")
+	// 与 Laravel 分页器一致：没有数据时 last_page 仍为 1
+	lastPage := max(int((total+int64(perPage)-1)/int64(perPage)), 1)
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  true,
@@ -499,6 +634,35 @@ func (h *LskyV1Handler) GetImages(c *gin.Context) {
 	})
 }
 
+// 图片详情
+func (h *LskyV1Handler) GetImage(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  false,
+			"message": "Unauthorized",
+			"data":    gin.H{},
+		})
+		return
+	}
+
+	var asset data.FileAsset
+	if err := h.db.Where("key = ? AND user_id = ?", c.Param("key"), user.ID).First(&asset).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  false,
+			"message": "Image not found",
+			"data":    gin.H{},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  true,
+		"message": "Success",
+		"data":    h.imageItem(c, asset, &user),
+	})
+}
+
 // 删除图片
 func (h *LskyV1Handler) DeleteImage(c *gin.Context) {
 	user, ok := middleware.CurrentUser(c)
@@ -531,7 +695,7 @@ func (h *LskyV1Handler) DeleteImage(c *gin.Context) {
 		return
 	}
 
-	if err := h.fileService.Delete(c.Request.Context(), asset.ID, user.ID); err != nil {
+	if err := h.fileService.Delete(c.Request.Context(), user.ID, asset.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  false,
 			"message": err.Error(),
@@ -540,9 +704,6 @@ func (h *LskyV1Handler) DeleteImage(c *gin.Context) {
 		return
 	}
 
-	c.Header("X-RateLimit-Limit", "60")
-	c.Header("X-RateLimit-Remaining", "59")
-
 	c.JSON(http.StatusOK, gin.H{
 		"status":  true,
 		"message": "Image deleted successfully",
@@ -574,7 +735,7 @@ func (h *LskyV1Handler) GetAlbums(c *gin.Context) {
 	query := h.db.Model(&data.Album{}).Where("user_id = ?", user.ID)
 
 	if keyword != "" {
-		query = query.Where("name LIKE ?", "%"+keyword+"%")
+		query = query.Where("name LIKE ? ESCAPE '!'", "%"+data.EscapeLike(keyword)+"%")
 	}
 
 	switch order {
@@ -602,7 +763,7 @@ func (h *LskyV1Handler) GetAlbums(c *gin.Context) {
 		return
 	}
 
-	var result []gin.H
+	result := make([]gin.H, 0, len(albums))
 	for _, album := range albums {
 		result = append(result, gin.H{
 			"id":        album.ID,
@@ -612,10 +773,8 @@ func (h *LskyV1Handler) GetAlbums(c *gin.Context) {
 		})
 	}
 
-	lastPage := int((total + int64(perPage) - 1) / int64(perPage))
-
-	c.Header("X-RateLimit-Limit", "60")
-	c.Header("X-RateLimit-Remaining", "59")
+	// 与 Laravel 分页器一致：没有数据时 last_page 仍为 1
+	lastPage := max(int((total+int64(perPage)-1)/int64(perPage)), 1)
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  true,
@@ -630,6 +789,61 @@ func (h *LskyV1Handler) GetAlbums(c *gin.Context) {
 	})
 }
 
+// 创建相册
+func (h *LskyV1Handler) CreateAlbum(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  false,
+			"message": "Unauthorized",
+			"data":    gin.H{},
+		})
+		return
+	}
+
+	var req struct {
+		Name  string `json:"name" form:"name"`
+		Intro string `json:"intro" form:"intro"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  false,
+			"message": "Invalid request parameters",
+			"data":    gin.H{},
+		})
+		return
+	}
+
+	album, err := h.fileService.CreateAlbum(c.Request.Context(), user.ID, req.Name, req.Intro)
+	if err != nil {
+		if errors.Is(err, files.ErrInvalidAlbumName) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  false,
+				"message": "Invalid album name",
+				"data":    gin.H{},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  false,
+			"message": "Failed to create album",
+			"data":    gin.H{},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  true,
+		"message": "Album created successfully",
+		"data": gin.H{
+			"id":        album.ID,
+			"name":      album.Name,
+			"intro":     album.Intro,
+			"image_num": album.ImageNum,
+		},
+	})
+}
+
 // 删除相册
 func (h *LskyV1Handler) DeleteAlbum(c *gin.Context) {
 	user, ok := middleware.CurrentUser(c)
@@ -653,35 +867,125 @@ func (h *LskyV1Handler) DeleteAlbum(c *gin.Context) {
 		return
 	}
 
-	var album data.Album
-	if err := h.db.Where("id = ? AND user_id = ?", id, user.ID).First(&album).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+	// 相册中的图片保留，仅移出相册
+	if err := h.fileService.DeleteAlbum(c.Request.Context(), user.ID, uint(id)); err != nil {
+		if errors.Is(err, files.ErrAlbumNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  false,
+				"message": "Album not found",
+				"data":    gin.H{},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  false,
-			"message": "Album not found",
+			"message": "Failed to delete album",
 			"data":    gin.H{},
 		})
 		return
 	}
 
-	if err := h.db.Delete(&album).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	c.JSON(http.StatusOK, gin.H{
+		"status":  true,
+		"message": "Album deleted successfully",
+		"data":    gin.H{},
+	})
+}
+
+// 角色组信息：已登录返回所属角色组，未登录返回游客组
+func (h *LskyV1Handler) GetGroup(c *gin.Context) {
+	query := h.db.Model(&data.Group{})
+	if user, ok := middleware.CurrentUser(c); ok && user.GroupID != nil {
+		query = query.Where("id = ?", *user.GroupID)
+	} else if ok {
+		query = query.Where("is_default = ?", true)
+	} else {
+		query = query.Where("is_guest = ?", true)
+	}
+
+	var group data.Group
+	if err := query.First(&group).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
 			"status":  false,
-			"message": "Failed to delete album",
+			"message": "Group not found",
 			"data":    gin.H{},
 		})
 		return
 	}
 
-	c.Header("X-RateLimit-Limit", "60")
-	c.Header("X-RateLimit-Remaining", "59")
+	var configs map[string]interface{}
+	_ = json.Unmarshal(group.Configs, &configs)
+	maxFileSize := float64(0)
+	if v, ok := configs["max_file_size"].(float64); ok {
+		maxFileSize = v / 1024
+	}
+	intConfig := func(key string) int {
+		if v, ok := configs[key].(float64); ok {
+			return int(v)
+		}
+		return 0
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  true,
-		"message": "Album deleted successfully",
-		"data":    gin.H{},
+		"message": "Success",
+		"data": gin.H{
+			"id":         group.ID,
+			"name":       group.Name,
+			"is_default": group.IsDefault,
+			"is_guest":   group.IsGuest,
+			"configs": gin.H{
+				"maximum_file_size":      maxFileSize,
+				"limit_per_minute":       intConfig("upload_rate_minute"),
+				"limit_per_hour":         intConfig("upload_rate_hour"),
+				"accepted_file_suffixes": lskyAcceptedSuffixes,
+			},
+		},
 	})
 }
 
+// lskyAcceptedSuffixes 与上传校验支持的图片格式一致
+var lskyAcceptedSuffixes = []string{"jpeg", "jpg", "png", "gif", "tif", "tiff", "bmp", "ico", "webp", "avif"}
+
+// imageItem 构建 Lsky 图片对象，列表与详情共用。
+func (h *LskyV1Handler) imageItem(c *gin.Context, img data.FileAsset, viewer *data.User) gin.H {
+	imageURL := h.resolveAssetPublicURL(c, img)
+	thumbnailURL := imageURL
+	if files.CanAccessThumbnail(img, viewer) {
+		if raw := strings.TrimSpace(img.ThumbnailPublicURL); raw != "" {
+			thumbnailURL = raw
+		}
+	}
+	embeds := files.BuildImageEmbedCodes(img.Name, imageURL)
+	return gin.H{
+		"key":             img.Key,
+		"name":            img.Name,
+		"origin_name":     img.OriginalName,
+		"pathname":        img.RelativePath,
+		"size":            float64(img.Size) / 1024,
+		"mimetype":        img.MimeType,
+		"extension":       img.Extension,
+		"width":           img.Width,
+		"height":          img.Height,
+		"md5":             img.ChecksumMD5,
+		"sha1":            img.ChecksumSHA1,
+		"album_id":        img.AlbumID,
+		"public":          img.Visibility == "public",
+		"blurhash":        img.BlurHash,
+		"dominant_colors": files.ParseDominantColors(img.DominantColors),
+		"human_date":      formatHumanDate(img.CreatedAt),
+		"date":            img.CreatedAt.Format("2006-01-02 15:04:05"),
+		"links": gin.H{
+			"url":                imageURL,
+			"html":               embeds.HTML,
+			"bbcode":             fmt.Sprintf(`[img]%s[/img]`, imageURL),
+			"markdown":           embeds.Markdown,
+			"markdown_with_link": embeds.MarkdownWithLink,
+			"thumbnail_url":      thumbnailURL,
+		},
+	}
+}
+
 // 辅助函数
 func getBaseURL(c *gin.Context) string {
 	scheme := "http"
@@ -2,6 +2,9 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/data"
+	"skyimage/internal/middleware"
 )
 
 func (s *Server) registerLskyV1Routes(apiGroup *gin.RouterGroup) {
@@ -12,27 +15,39 @@ func (s *Server) registerLskyV1Routes(apiGroup *gin.RouterGroup) {
 	fileService := s.files
 	authLimiter := s.authLimiter
 	captchaSvc := s.captcha
+	twoFactorSvc := s.twoFactor
+	loginGuard := s.loginGuard
 	s.mu.RUnlock()
 
-	handler := NewLskyV1Handler(db, adminSvc, userService, fileService, authLimiter, captchaSvc)
+	handler := NewLskyV1Handler(db, adminSvc, userService, fileService, authLimiter, captchaSvc, twoFactorSvc, loginGuard)
+	handler.demoMode = func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.cfg.DemoMode
+	}
+	// 限流在认证之后执行，已登录请求按用户计数
+	throttle := handler.Throttle
 
 	v1 := apiGroup.Group("/v1")
 	{
 		// 授权相关
-		v1.POST("/tokens", handler.CreateToken)
-		v1.DELETE("/tokens", s.authMiddleware(), handler.DeleteTokens)
-		v1.GET("/profile", s.authMiddleware(), handler.GetProfile)
+		v1.POST("/tokens", throttle, handler.CreateToken)
+		v1.DELETE("/tokens", s.scopedAuthMiddleware(middleware.Scope(data.ApiTokenScopeTokens)), throttle, handler.DeleteTokens)
+		v1.GET("/profile", s.scopedAuthMiddleware(middleware.Scope(data.ApiTokenScopeAccountRead)), throttle, handler.GetProfile)
+		v1.GET("/group", s.optionalAuthMiddleware(), throttle, handler.GetGroup)
 
 		// 策略相关
-		v1.GET("/strategies", handler.GetStrategies)
+		v1.GET("/strategies", throttle, handler.GetStrategies)
 
 		// 图片相关
-		v1.POST("/upload", s.authMiddleware(), handler.UploadImage)
-		v1.GET("/images", s.authMiddleware(), handler.GetImages)
-		v1.DELETE("/images/:key", s.authMiddleware(), handler.DeleteImage)
+		v1.POST("/upload", s.scopedAuthMiddleware(middleware.Scope(data.ApiTokenScopeFilesUpload)), throttle, handler.UploadImage)
+		v1.GET("/images", s.scopedAuthMiddleware(middleware.Scope(data.ApiTokenScopeFilesRead)), throttle, handler.GetImages)
+		v1.GET("/images/:key", s.scopedAuthMiddleware(middleware.Scope(data.ApiTokenScopeFilesRead)), throttle, handler.GetImage)
+		v1.DELETE("/images/:key", s.scopedAuthMiddleware(middleware.Scope(data.ApiTokenScopeFilesDelete)), throttle, handler.DeleteImage)
 
 		// 相册相关
-		v1.GET("/albums", s.authMiddleware(), handler.GetAlbums)
-		v1.DELETE("/albums/:id", s.authMiddleware(), handler.DeleteAlbum)
+		v1.GET("/albums", s.scopedAuthMiddleware(middleware.Scope(data.ApiTokenScopeAlbumsRead)), throttle, handler.GetAlbums)
+		v1.POST("/albums", s.scopedAuthMiddleware(middleware.Scope(data.ApiTokenScopeAlbumsWrite)), throttle, handler.CreateAlbum)
+		v1.DELETE("/albums/:id", s.scopedAuthMiddleware(middleware.Scope(data.ApiTokenScopeAlbumsWrite)), throttle, handler.DeleteAlbum)
 	}
 }
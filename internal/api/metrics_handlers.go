@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/config"
+	"skyimage/internal/metrics"
+)
+
+const metricsPath = "/metrics"
+
+// metricsEnabled 判断是否提供 Prometheus 指标；设置了独立监听地址即视为开启。
+func metricsEnabled(cfg config.Config) bool {
+	return cfg.MetricsEnabled || strings.TrimSpace(cfg.MetricsAddr) != ""
+}
+
+// registerMetricsRoutes 未配置独立监听地址时在主端口提供 /metrics。
+func (s *Server) registerMetricsRoutes() {
+	metrics.ActiveSessions.SetFunc(s.countActiveSessions)
+	if !metricsEnabled(s.cfg) || strings.TrimSpace(s.cfg.MetricsAddr) != "" {
+		return
+	}
+	s.engine.GET(metricsPath, gin.WrapF(s.serveMetrics))
+}
+
+// newMetricsServer 返回独立监听地址上的指标服务，未配置时返回 nil。
+func (s *Server) newMetricsServer() *http.Server {
+	addr := strings.TrimSpace(s.cfg.MetricsAddr)
+	if addr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(metricsPath, s.serveMetrics)
+	return &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+}
+
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.RLock()
+	token := s.cfg.MetricsToken
+	s.mu.RUnlock()
+	if token != "" {
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(provided)), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := metrics.Default.WriteTo(w); err != nil {
+		log.Printf("[metrics] write response failed: %v", err)
+	}
+}
+
+// countActiveSessions 在抓取时统计未过期的会话数，数据库不可用时不输出该指标。
+func (s *Server) countActiveSessions() (float64, bool) {
+	s.mu.RLock()
+	manager := s.session
+	s.mu.RUnlock()
+	if manager == nil {
+		return 0, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	count, err := manager.CountActive(ctx)
+	if err != nil {
+		return 0, false
+	}
+	return float64(count), true
+}
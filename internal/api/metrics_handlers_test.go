@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/config"
+	"skyimage/internal/middleware"
+	"skyimage/internal/session"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	client := newLskyContractServer(t)
+	server := client.server
+	server.cfg = config.Config{MetricsEnabled: true, MetricsToken: "scrape-token"}
+	server.session = session.NewManager(server.db, time.Hour)
+	// 重新构建引擎，使请求统计中间件作用于全部路由
+	server.engine = gin.New()
+	server.engine.Use(middleware.Metrics(), gin.Recovery())
+	server.registerLskyV1Routes(server.engine.Group("/api"))
+	server.registerMetricsRoutes()
+	client.engine = server.engine
+
+	body, contentType := lskyUploadBody(t, map[string]string{"permission": "1"})
+	if recorder := client.do(http.MethodPost, "/api/v1/upload", contentType, body); recorder.Code != http.StatusOK {
+		t.Fatalf("upload failed: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if _, err := server.session.Create(1000000000000001); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	client.token = ""
+	if recorder := client.do(http.MethodGet, "/metrics", "", nil); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("metrics without token should be rejected, got %d", recorder.Code)
+	}
+	client.token = "wrong"
+	if recorder := client.do(http.MethodGet, "/metrics", "", nil); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("metrics with a wrong token should be rejected, got %d", recorder.Code)
+	}
+
+	client.token = "scrape-token"
+	recorder := client.do(http.MethodGet, "/metrics", "", nil)
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected metrics response: %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	text := recorder.Body.String()
+	for _, want := range []string{
+		`skyimage_http_requests_total{method="POST",route="/api/v1/upload",status="200"}`,
+		`skyimage_http_request_duration_seconds_bucket{method="POST",route="/api/v1/upload",le="+Inf"}`,
+		`skyimage_uploads_total{strategy="1",driver="local"}`,
+		`skyimage_upload_bytes_total{strategy="1",driver="local"}`,
+		`skyimage_storage_operation_duration_seconds_count{driver="local",operation="put"}`,
+		"skyimage_active_sessions 1\n",
+		"skyimage_audit_queue_depth 0\n",
+		`skyimage_build_info{version="`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("metrics output is missing %q:\n%s", want, text)
+		}
+	}
+
+	// 配置独立监听地址后主端口不再提供 /metrics
+	server.cfg.MetricsAddr = "127.0.0.1:0"
+	server.engine = gin.New()
+	server.registerMetricsRoutes()
+	if metricsSrv := server.newMetricsServer(); metricsSrv == nil || metricsSrv.Addr != "127.0.0.1:0" {
+		t.Fatalf("expected a dedicated metrics server")
+	}
+	if routes := server.engine.Routes(); len(routes) != 0 {
+		t.Fatalf("main engine should not expose /metrics when METRICS_ADDR is set: %+v", routes)
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	"skyimage/internal/middleware"
 	"skyimage/internal/oauth"
+	"skyimage/internal/session"
 	"skyimage/internal/users"
 )
 
@@ -25,8 +26,8 @@ func (s *Server) registerOAuthRoutes(r *gin.RouterGroup) {
 	protected := auth.Group("/")
 	protected.Use(s.authMiddleware())
 	protected.GET("/oauth/bindings", s.handleOAuthListBindings)
-	protected.POST("/oauth/:provider/bind", middleware.RequireCSRF(), s.handleOAuthBindStart)
-	protected.DELETE("/oauth/:provider", middleware.RequireCSRF(), s.handleOAuthUnbind)
+	protected.POST("/oauth/:provider/bind", middleware.RequireCSRF(), middleware.BlockImpersonation(), s.handleOAuthBindStart)
+	protected.DELETE("/oauth/:provider", middleware.RequireCSRF(), middleware.BlockImpersonation(), s.handleOAuthUnbind)
 }
 
 func (s *Server) handleOAuthProviders(c *gin.Context) {
@@ -75,7 +76,19 @@ func (s *Server) startOAuthFlow(c *gin.Context, mode string, userID uint) {
 		return
 	}
 
-	state, codeVerifier, err := s.oauth.CreateState(c.Request.Context(), provider, mode, userID)
+	// 邀请码随 state 传递到回调，跳转前先校验以免授权后才失败
+	inviteCode := ""
+	if mode == oauth.ModeLogin {
+		inviteCode = strings.TrimSpace(c.Query("invite"))
+		if inviteCode != "" {
+			if _, err := s.invites.Check(c.Request.Context(), inviteCode); err != nil {
+				c.JSON(inviteErrorStatus(err), gin.H{"error": localizeInviteError(err)})
+				return
+			}
+		}
+	}
+
+	state, codeVerifier, err := s.oauth.CreateStateWithInvite(c.Request.Context(), provider, mode, userID, inviteCode)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create oauth state"})
 		return
@@ -168,11 +181,15 @@ func (s *Server) handleOAuthCallback(c *gin.Context) {
 	}
 
 	clientIP := getClientIP(c, s.isCDNEnabled(c.Request.Context()))
-	user, err := s.oauth.CompleteLogin(c.Request.Context(), identity, clientIP)
+	user, err := s.oauth.CompleteLogin(c.Request.Context(), identity, clientIP, pending.InviteCode)
 	if err != nil {
 		switch {
 		case errors.Is(err, oauth.ErrRegistrationClosed):
 			s.redirectOAuthResult(c, "/login", "oauth_error", "registration closed")
+		case errors.Is(err, oauth.ErrInviteRequired):
+			s.redirectOAuthResult(c, "/login", "oauth_error", "invite required")
+		case isInviteError(err):
+			s.redirectOAuthResult(c, "/login", "oauth_error", "invalid invite")
 		case errors.Is(err, oauth.ErrAccountDisabled):
 			s.redirectOAuthResult(c, "/login", "oauth_error", "account disabled")
 		default:
@@ -182,13 +199,21 @@ func (s *Server) handleOAuthCallback(c *gin.Context) {
 		return
 	}
 
-	sessionID, err := s.session.Create(user.ID)
+	// 启用了两步验证的账户需要在登录页完成第二步，OAuth 不能绕过
+	challenge, err := s.twoFactorChallengeFor(c, user, session.MethodOAuth)
 	if err != nil {
+		s.redirectOAuthResult(c, "/login", "oauth_error", "login failed")
+		return
+	}
+	if challenge != "" {
+		s.redirectOAuthResult(c, "/login", "two_factor_challenge", challenge)
+		return
+	}
+	if err := s.startSession(c, user.ID, session.MethodOAuth, clientIP, false); err != nil {
 		s.redirectOAuthResult(c, "/login", "oauth_error", "session failed")
 		return
 	}
-	s.writeSessionCookie(c, sessionID)
-	s.writeCSRFCookie(c)
+	s.recordLoginSuccess(c, user, loginAttempt(c, clientIP, session.MethodOAuth))
 
 	go func() {
 		userNotifyEnabled := users.LoginNotificationEnabled(user)
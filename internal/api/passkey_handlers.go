@@ -14,6 +14,7 @@ import (
 
 	"skyimage/internal/middleware"
 	"skyimage/internal/passkey"
+	"skyimage/internal/session"
 	"skyimage/internal/users"
 )
 
@@ -27,11 +28,11 @@ func (s *Server) registerPasskeyRoutes(r *gin.RouterGroup) {
 	// Authenticated ceremony + management endpoints (middleware applies to the
 	// routes registered after this point).
 	pk.Use(s.authMiddleware())
-	pk.POST("/register/begin", middleware.RequireCSRF(), s.handlePasskeyRegisterBegin)
-	pk.POST("/register/complete", middleware.RequireCSRF(), s.handlePasskeyRegisterComplete)
+	pk.POST("/register/begin", middleware.RequireCSRF(), middleware.BlockImpersonation(), s.handlePasskeyRegisterBegin)
+	pk.POST("/register/complete", middleware.RequireCSRF(), middleware.BlockImpersonation(), s.handlePasskeyRegisterComplete)
 	pk.GET("", s.handlePasskeyList)
-	pk.PATCH("/:id", middleware.RequireCSRF(), s.handlePasskeyRename)
-	pk.DELETE("/:id", middleware.RequireCSRF(), s.handlePasskeyDelete)
+	pk.PATCH("/:id", middleware.RequireCSRF(), middleware.BlockImpersonation(), s.handlePasskeyRename)
+	pk.DELETE("/:id", middleware.RequireCSRF(), middleware.BlockImpersonation(), s.handlePasskeyDelete)
 }
 
 // passkeySiteName resolves the display name for the Relying Party.
@@ -117,7 +118,7 @@ func (s *Server) handlePasskeyLoginBegin(c *gin.Context) {
 		return
 	}
 	clientIP := getClientIP(c, s.isCDNEnabled(c.Request.Context()))
-	if ok, retry := s.authLimiter.Allow("passkey:login:ip:"+clientIP, 30, time.Minute); !ok {
+	if ok, retry := allowRequest(c, s.authLimiter, "passkey:login:ip:"+clientIP, 30, time.Minute); !ok {
 		c.JSON(http.StatusTooManyRequests, gin.H{"error": "请求过于频繁，请稍后再试", "retryAfterSeconds": int(retry.Seconds()) + 1})
 		return
 	}
@@ -135,7 +136,7 @@ func (s *Server) handlePasskeyLoginComplete(c *gin.Context) {
 		return
 	}
 	clientIP := getClientIP(c, s.isCDNEnabled(c.Request.Context()))
-	if ok, retry := s.authLimiter.Allow("passkey:login:ip:"+clientIP, 30, time.Minute); !ok {
+	if ok, retry := allowRequest(c, s.authLimiter, "passkey:login:ip:"+clientIP, 30, time.Minute); !ok {
 		c.JSON(http.StatusTooManyRequests, gin.H{"error": "请求过于频繁，请稍后再试", "retryAfterSeconds": int(retry.Seconds()) + 1})
 		return
 	}
@@ -144,23 +145,26 @@ func (s *Server) handlePasskeyLoginComplete(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
 		return
 	}
-	user, _, err := s.passkeys.FinishLogin(c.Request.Context(), requestOrigin(c), s.passkeySiteName(c), raw)
+	result, err := s.passkeys.FinishLogin(c.Request.Context(), requestOrigin(c), s.passkeySiteName(c), raw)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
+	user := result.User
 	if user.Status == 0 {
 		c.JSON(http.StatusForbidden, gin.H{"error": "account disabled"})
 		return
 	}
-	sessionID, err := s.session.Create(user.ID)
-	if err != nil {
+	// 经过 PIN/生物识别验证的 Passkey 本身就是多因素登录；仅凭持有设备的断言仍需两步验证
+	if !result.UserVerified && s.respondTwoFactorChallenge(c, user, session.MethodPasskey) {
+		return
+	}
+	if err := s.startSession(c, user.ID, session.MethodPasskey, clientIP, false); err != nil {
 		log.Printf("[passkey] 创建会话失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
 		return
 	}
-	s.writeSessionCookie(c, sessionID)
-	s.writeCSRFCookie(c)
+	s.recordLoginSuccess(c, user, loginAttempt(c, clientIP, session.MethodPasskey))
 
 	go func() {
 		if s.mail == nil {
@@ -1,59 +1,55 @@
 package api
 
 import (
-	"sync"
+	"strings"
 	"time"
-)
 
-type requestLimiter struct {
-	mu      sync.Mutex
-	buckets map[string]*limitBucket
-}
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
-type limitBucket struct {
-	count   int
-	resetAt time.Time
-}
+	"skyimage/internal/config"
+	"skyimage/internal/ratelimit"
+)
 
-func newRequestLimiter() *requestLimiter {
-	return &requestLimiter{
-		buckets: make(map[string]*limitBucket),
-	}
+func newRequestLimiter() *ratelimit.Limiter {
+	return ratelimit.New(ratelimit.NewMemoryStore())
 }
 
-func (l *requestLimiter) Allow(key string, limit int, window time.Duration) (bool, time.Duration) {
-	if l == nil || limit <= 0 || window <= 0 || key == "" {
-		return true, 0
+// useDatabaseRateLimit 判断是否使用数据库共享限流计数。
+func useDatabaseRateLimit(cfg config.Config, db *gorm.DB) bool {
+	switch strings.ToLower(strings.TrimSpace(cfg.RateLimitStore)) {
+	case "memory":
+		return false
+	case "database", "db":
+		return db != nil
 	}
+	// 默认：SQLite 通常是单实例部署，使用内存；MySQL/PostgreSQL 可能多副本，使用数据库
+	return db != nil && db.Dialector.Name() != "sqlite"
+}
 
-	now := time.Now()
-	l.mu.Lock()
-	defer l.mu.Unlock()
-
-	for k, bucket := range l.buckets {
-		if now.After(bucket.resetAt) {
-			delete(l.buckets, k)
-		}
+// applyRateLimitStore 根据配置选择限流计数存储，调用方需持有 s.mu。
+func (s *Server) applyRateLimitStore(cfg config.Config, db *gorm.DB) {
+	if s.authLimiter == nil {
+		s.authLimiter = newRequestLimiter()
 	}
-
-	bucket, ok := l.buckets[key]
-	if !ok || now.After(bucket.resetAt) {
-		l.buckets[key] = &limitBucket{
-			count:   1,
-			resetAt: now.Add(window),
-		}
-		return true, 0
+	if !useDatabaseRateLimit(cfg, db) {
+		s.authLimiter.SetStore(ratelimit.NewMemoryStore())
+		return
 	}
-
-	if bucket.count >= limit {
-		return false, time.Until(bucket.resetAt)
+	if s.rateStore == nil {
+		s.rateStore = ratelimit.NewDBStore(db)
+	} else {
+		s.rateStore.SetDB(db)
 	}
-
-	bucket.count++
-	return true, 0
+	s.authLimiter.SetStore(s.rateStore)
 }
 
-// AllowInterval allows at most one action per key inside interval (cooldown).
-func (l *requestLimiter) AllowInterval(key string, interval time.Duration) (bool, time.Duration) {
-	return l.Allow(key, 1, interval)
+// allowRequest 对 key 计数一次并写入 RateLimit-* 响应头；超限时同时写入 Retry-After。
+func allowRequest(c *gin.Context, limiter *ratelimit.Limiter, key string, limit int, window time.Duration) (bool, time.Duration) {
+	if limiter == nil {
+		return true, 0
+	}
+	result := limiter.Take(c.Request.Context(), key, limit, window)
+	ratelimit.SetHeaders(c.Writer.Header(), result)
+	return result.Allowed, result.RetryAfter()
 }
@@ -0,0 +1,714 @@
+package api
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/data"
+	"skyimage/internal/files"
+	"skyimage/internal/s3gateway"
+	"skyimage/internal/users"
+)
+
+// s3Request 是一次已通过签名校验的 S3 请求。
+type s3Request struct {
+	sig        *s3gateway.Signature
+	token      data.ApiToken
+	user       data.User
+	bucket     string
+	strategyID uint
+	key        string
+}
+
+func (s *Server) registerS3Routes(apiGroup *gin.RouterGroup) {
+	// 仅支持 path-style：/api/s3/<bucket>/<key>
+	apiGroup.Any("/s3", s.handleS3)
+	apiGroup.Any("/s3/*path", s.handleS3)
+}
+
+func (s *Server) handleS3(c *gin.Context) {
+	s.mu.RLock()
+	gateway := s.s3
+	userService := s.users
+	db := s.db
+	s.mu.RUnlock()
+
+	ctx := c.Request.Context()
+	if gateway == nil || !gateway.Settings(ctx).Enabled {
+		writeS3Error(c, s3gateway.ErrServiceUnavailable)
+		return
+	}
+
+	var token data.ApiToken
+	sig, err := s3gateway.Verify(c.Request, time.Now(), func(accessKeyID string) (string, error) {
+		found, err := gateway.LookupToken(ctx, accessKeyID)
+		if err != nil {
+			return "", err
+		}
+		token = found
+		return gateway.SecretAccessKey(found.Token), nil
+	})
+	if err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	if !token.AllowsIP(c.ClientIP()) {
+		writeS3Error(c, s3gateway.ErrAccessDenied.WithMessage("Token not allowed from this address"))
+		return
+	}
+	user, err := userService.FindByID(ctx, token.UserID)
+	if err != nil || user.Status == 0 {
+		writeS3Error(c, s3gateway.ErrAccessDenied)
+		return
+	}
+	_ = db.Model(&data.ApiToken{}).Where("id = ?", token.ID).Update("last_used_at", time.Now()).Error
+
+	req := &s3Request{sig: sig, token: token, user: user}
+	req.bucket, req.key = splitS3Path(c.Param("path"))
+	if req.bucket == "" {
+		if c.Request.Method != http.MethodGet {
+			writeS3Error(c, s3gateway.ErrMethodNotAllowed)
+			return
+		}
+		s.handleS3ListBuckets(c, req)
+		return
+	}
+	strategyID, ok := s3gateway.ParseBucket(req.bucket)
+	if !ok {
+		writeS3Error(c, s3gateway.ErrNoSuchBucket)
+		return
+	}
+	allowed, err := s.s3Strategies(ctx, req)
+	if err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	if _, ok := allowed[strategyID]; !ok {
+		writeS3Error(c, s3gateway.ErrNoSuchBucket)
+		return
+	}
+	req.strategyID = strategyID
+
+	if req.key == "" {
+		s.handleS3Bucket(c, gateway, req)
+		return
+	}
+	if !s3gateway.ValidKey(req.key) {
+		writeS3Error(c, s3gateway.ErrInvalidArgument.WithMessage("Invalid object key"))
+		return
+	}
+	s.handleS3Object(c, gateway, req)
+}
+
+func (s *Server) handleS3Bucket(c *gin.Context, gateway *s3gateway.Service, req *s3Request) {
+	query := c.Request.URL.Query()
+	switch c.Request.Method {
+	case http.MethodHead:
+		if !requireS3Scope(c, req, data.ApiTokenScopeFilesRead) {
+			return
+		}
+		c.Status(http.StatusOK)
+	case http.MethodGet:
+		if !requireS3Scope(c, req, data.ApiTokenScopeFilesRead) {
+			return
+		}
+		switch {
+		case query.Has("location"):
+			writeS3XML(c, http.StatusOK, s3gateway.LocationConstraint{Xmlns: s3gateway.Namespace()})
+		case query.Has("uploads"), query.Has("versioning"), query.Has("acl"), query.Has("policy"):
+			writeS3Error(c, s3gateway.ErrNotImplemented)
+		default:
+			s.handleS3ListObjects(c, gateway, req)
+		}
+	case http.MethodPut:
+		// 存储桶由储存策略决定，不能创建；对已有存储桶返回与 S3 一致的错误，rclone 等工具会视为成功
+		writeS3Error(c, s3gateway.ErrBucketAlreadyOwnedByYou)
+	case http.MethodDelete:
+		writeS3Error(c, s3gateway.ErrAccessDenied)
+	case http.MethodPost:
+		writeS3Error(c, s3gateway.ErrNotImplemented)
+	default:
+		writeS3Error(c, s3gateway.ErrMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleS3Object(c *gin.Context, gateway *s3gateway.Service, req *s3Request) {
+	query := c.Request.URL.Query()
+	uploadID := query.Get("uploadId")
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead:
+		if uploadID != "" {
+			writeS3Error(c, s3gateway.ErrNotImplemented)
+			return
+		}
+		if !requireS3Scope(c, req, data.ApiTokenScopeFilesRead) {
+			return
+		}
+		s.handleS3GetObject(c, gateway, req)
+	case http.MethodPut:
+		if !requireS3Scope(c, req, data.ApiTokenScopeFilesUpload) {
+			return
+		}
+		switch {
+		case uploadID != "":
+			s.handleS3UploadPart(c, gateway, req, uploadID)
+		case c.GetHeader("X-Amz-Copy-Source") != "":
+			writeS3Error(c, s3gateway.ErrNotImplemented)
+		default:
+			s.handleS3PutObject(c, gateway, req)
+		}
+	case http.MethodPost:
+		if !requireS3Scope(c, req, data.ApiTokenScopeFilesUpload) {
+			return
+		}
+		switch {
+		case query.Has("uploads"):
+			s.handleS3CreateMultipart(c, gateway, req)
+		case uploadID != "":
+			s.handleS3CompleteMultipart(c, gateway, req, uploadID)
+		default:
+			writeS3Error(c, s3gateway.ErrMethodNotAllowed)
+		}
+	case http.MethodDelete:
+		if uploadID != "" {
+			if !requireS3Scope(c, req, data.ApiTokenScopeFilesUpload) {
+				return
+			}
+			s.handleS3AbortMultipart(c, gateway, req, uploadID)
+			return
+		}
+		if !requireS3Scope(c, req, data.ApiTokenScopeFilesDelete) {
+			return
+		}
+		s.handleS3DeleteObject(c, gateway, req)
+	default:
+		writeS3Error(c, s3gateway.ErrMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleS3ListBuckets(c *gin.Context, req *s3Request) {
+	strategies, err := s.files.ListStrategiesForUser(c.Request.Context(), req.user)
+	if err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	restricted := tokenStrategySet(req.token)
+	result := s3gateway.ListAllMyBucketsResult{
+		Xmlns: s3gateway.Namespace(),
+		Owner: s3Owner(req.user),
+	}
+	for _, strategy := range strategies {
+		if restricted != nil {
+			if _, ok := restricted[strategy.ID]; !ok {
+				continue
+			}
+		}
+		result.Buckets = append(result.Buckets, s3gateway.Bucket{
+			Name:         s3gateway.BucketName(strategy.ID),
+			CreationDate: s3gateway.FormatTime(strategy.CreatedAt),
+		})
+	}
+	writeS3XML(c, http.StatusOK, result)
+}
+
+func (s *Server) handleS3ListObjects(c *gin.Context, gateway *s3gateway.Service, req *s3Request) {
+	query := c.Request.URL.Query()
+	v2 := query.Get("list-type") == "2"
+	maxKeys := s3gateway.MaxListKeys
+	if raw := query.Get("max-keys"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			writeS3Error(c, s3gateway.ErrInvalidArgument.WithMessage("max-keys must be a non-negative integer"))
+			return
+		}
+		maxKeys = min(parsed, s3gateway.MaxListKeys)
+	}
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		writeS3Error(c, s3gateway.ErrInvalidArgument.WithMessage("Invalid Encoding Method specified in Request"))
+		return
+	}
+	encode := func(value string) string {
+		if encodingType == "url" {
+			return s3gateway.EncodeKey(value)
+		}
+		return value
+	}
+
+	input := s3gateway.ListInput{
+		Prefix:    query.Get("prefix"),
+		Delimiter: query.Get("delimiter"),
+		MaxKeys:   maxKeys,
+	}
+	continuation := query.Get("continuation-token")
+	switch {
+	case !v2:
+		input.After = query.Get("marker")
+	case continuation != "":
+		after, err := base64.RawURLEncoding.DecodeString(continuation)
+		if err != nil {
+			writeS3Error(c, s3gateway.ErrInvalidArgument.WithMessage("The continuation token provided is incorrect"))
+			return
+		}
+		input.After = string(after)
+	default:
+		input.After = query.Get("start-after")
+	}
+
+	result := s3gateway.ListBucketResult{
+		Xmlns:        s3gateway.Namespace(),
+		Name:         req.bucket,
+		Prefix:       encode(input.Prefix),
+		Delimiter:    encode(input.Delimiter),
+		EncodingType: encodingType,
+		MaxKeys:      maxKeys,
+	}
+	if maxKeys > 0 {
+		listed, err := gateway.ListObjects(c.Request.Context(), req.user.ID, req.strategyID, input)
+		if err != nil {
+			writeS3Error(c, err)
+			return
+		}
+		owner := s3Owner(req.user)
+		for _, object := range listed.Objects {
+			content := s3gateway.Content{
+				Key:          encode(object.Key),
+				LastModified: s3gateway.FormatTime(object.LastModified),
+				ETag:         s3gateway.QuoteETag(object.ETag),
+				Size:         object.Size,
+				StorageClass: "STANDARD",
+			}
+			if !v2 || query.Get("fetch-owner") == "true" {
+				content.Owner = &owner
+			}
+			result.Contents = append(result.Contents, content)
+		}
+		for _, prefix := range listed.CommonPrefixes {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3gateway.CommonPrefix{Prefix: encode(prefix)})
+		}
+		result.IsTruncated = listed.Truncated
+		if listed.Truncated {
+			if v2 {
+				result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(listed.NextAfter))
+			} else {
+				result.NextMarker = encode(listed.NextAfter)
+			}
+		}
+	}
+	if v2 {
+		count := len(result.Contents) + len(result.CommonPrefixes)
+		result.KeyCount = &count
+		result.ContinuationToken = continuation
+		if continuation == "" {
+			result.StartAfter = encode(input.After)
+		}
+	} else {
+		marker := encode(input.After)
+		result.Marker = &marker
+	}
+	writeS3XML(c, http.StatusOK, result)
+}
+
+func (s *Server) handleS3GetObject(c *gin.Context, gateway *s3gateway.Service, req *s3Request) {
+	ctx := c.Request.Context()
+	file, err := gateway.FindObject(ctx, req.user.ID, req.strategyID, req.key)
+	if err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	if err := s.serveStoredFile(c, file); err != nil {
+		writeS3Error(c, err)
+	}
+}
+
+func (s *Server) handleS3PutObject(c *gin.Context, gateway *s3gateway.Service, req *s3Request) {
+	tmp, err := os.CreateTemp("", "skyimage-s3-put-*")
+	if err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	_, md5hex, err := req.sig.CopyBody(tmp, c.Request, s3gateway.MaxObjectSize)
+	if err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	if err := checkContentMD5(c.GetHeader("Content-MD5"), md5hex); err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	if _, err := s.storeS3Object(c, gateway, req, tmp, c.GetHeader("Content-Type"), c.GetHeader("X-Amz-Acl")); err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	c.Header("ETag", s3gateway.QuoteETag(md5hex))
+	c.Status(http.StatusOK)
+}
+
+// storeS3Object 通过 files.Service.Upload 保存对象并绑定对象键，覆盖时删除旧图片。
+func (s *Server) storeS3Object(c *gin.Context, gateway *s3gateway.Service, req *s3Request, body io.Reader, contentType, acl string) (data.FileAsset, error) {
+	ctx := c.Request.Context()
+	if _, err := gateway.FindObject(ctx, req.user.ID, req.strategyID, req.key); err == nil {
+		if !req.token.HasScope(data.ApiTokenScopeFilesDelete) {
+			return data.FileAsset{}, s3gateway.ErrAccessDenied.WithMessage("Overwriting an object requires the files:delete scope")
+		}
+	} else if !errors.Is(err, s3gateway.ErrNoSuchKey) {
+		return data.FileAsset{}, err
+	}
+
+	header, cleanup, err := files.NewFileHeader(path.Base(req.key), contentType, body)
+	if err != nil {
+		return data.FileAsset{}, err
+	}
+	defer cleanup()
+	record, err := s.files.Upload(ctx, req.user, header, files.UploadOptions{
+		Visibility:         s.s3Visibility(req.user, acl),
+		StrategyID:         req.strategyID,
+		AllowedStrategyIDs: req.token.StrategyIDList(),
+	})
+	if err != nil {
+		writeRateLimitHeaders(c, err)
+		return data.FileAsset{}, s3UploadError(err)
+	}
+	previous, err := gateway.BindObject(ctx, req.user.ID, req.strategyID, req.key, record.ID)
+	if err != nil {
+		if delErr := s.files.Delete(context.WithoutCancel(ctx), req.user.ID, record.ID); delErr != nil {
+			log.Printf("[s3] rollback upload %d failed: %v", record.ID, delErr)
+		}
+		return data.FileAsset{}, err
+	}
+	if previous != 0 && previous != record.ID {
+		if err := s.files.Delete(context.WithoutCancel(ctx), req.user.ID, previous); err != nil {
+			log.Printf("[s3] delete replaced file %d failed: %v", previous, err)
+		}
+	}
+	return record, nil
+}
+
+func (s *Server) handleS3DeleteObject(c *gin.Context, gateway *s3gateway.Service, req *s3Request) {
+	ctx := c.Request.Context()
+	file, err := gateway.FindObject(ctx, req.user.ID, req.strategyID, req.key)
+	if err != nil {
+		// 删除不存在的对象与 S3 一致返回成功
+		if errors.Is(err, s3gateway.ErrNoSuchKey) {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		writeS3Error(c, err)
+		return
+	}
+	if err := s.files.Delete(ctx, req.user.ID, file.ID); err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	if err := gateway.UnbindFile(ctx, file.ID); err != nil {
+		log.Printf("[s3] unbind file %d failed: %v", file.ID, err)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleS3CreateMultipart(c *gin.Context, gateway *s3gateway.Service, req *s3Request) {
+	upload, err := gateway.CreateMultipart(c.Request.Context(), data.S3MultipartUpload{
+		UserID:      req.user.ID,
+		TokenID:     req.token.ID,
+		StrategyID:  req.strategyID,
+		ObjectKey:   req.key,
+		ContentType: truncateString(c.GetHeader("Content-Type"), 128),
+		Visibility:  truncateString(c.GetHeader("X-Amz-Acl"), 16),
+	})
+	if err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	writeS3XML(c, http.StatusOK, s3gateway.InitiateMultipartUploadResult{
+		Xmlns:    s3gateway.Namespace(),
+		Bucket:   req.bucket,
+		Key:      req.key,
+		UploadID: upload.UploadID,
+	})
+}
+
+func (s *Server) handleS3UploadPart(c *gin.Context, gateway *s3gateway.Service, req *s3Request, uploadID string) {
+	partNumber, err := strconv.Atoi(c.Query("partNumber"))
+	if err != nil {
+		writeS3Error(c, s3gateway.ErrInvalidArgument.WithMessage("Part number must be an integer between 1 and 10000"))
+		return
+	}
+	if c.GetHeader("X-Amz-Copy-Source") != "" {
+		writeS3Error(c, s3gateway.ErrNotImplemented)
+		return
+	}
+	upload, err := gateway.GetMultipart(c.Request.Context(), uploadID, req.user.ID, req.strategyID, req.key)
+	if err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	part, err := gateway.CreatePart(upload, partNumber)
+	if err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	_, md5hex, err := req.sig.CopyBody(part, c.Request, s3gateway.MaxObjectSize)
+	if closeErr := part.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = checkContentMD5(c.GetHeader("Content-MD5"), md5hex)
+	}
+	if err != nil {
+		_ = os.Remove(part.Name())
+		writeS3Error(c, err)
+		return
+	}
+	c.Header("ETag", s3gateway.QuoteETag(md5hex))
+	c.Status(http.StatusOK)
+}
+
+func (s *Server) handleS3CompleteMultipart(c *gin.Context, gateway *s3gateway.Service, req *s3Request, uploadID string) {
+	ctx := c.Request.Context()
+	upload, err := gateway.GetMultipart(ctx, uploadID, req.user.ID, req.strategyID, req.key)
+	if err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	var body strings.Builder
+	if _, _, err := req.sig.CopyBody(&body, c.Request, 1<<20); err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	var payload s3gateway.CompleteMultipartUpload
+	if err := xml.Unmarshal([]byte(body.String()), &payload); err != nil {
+		writeS3Error(c, s3gateway.ErrMalformedXML)
+		return
+	}
+	combined, _, err := gateway.OpenParts(upload, payload.Parts)
+	if err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	_, err = s.storeS3Object(c, gateway, req, combined, upload.ContentType, upload.Visibility)
+	_ = combined.Close()
+	if err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	if err := gateway.AbortMultipart(context.WithoutCancel(ctx), upload); err != nil {
+		log.Printf("[s3] cleanup multipart upload %s failed: %v", upload.UploadID, err)
+	}
+	writeS3XML(c, http.StatusOK, s3gateway.CompleteMultipartUploadResult{
+		Xmlns:    s3gateway.Namespace(),
+		Location: "/" + req.bucket + "/" + req.key,
+		Bucket:   req.bucket,
+		Key:      req.key,
+		ETag:     s3gateway.QuoteETag(multipartETag(payload.Parts)),
+	})
+}
+
+func (s *Server) handleS3AbortMultipart(c *gin.Context, gateway *s3gateway.Service, req *s3Request, uploadID string) {
+	upload, err := gateway.GetMultipart(c.Request.Context(), uploadID, req.user.ID, req.strategyID, req.key)
+	if err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	if err := gateway.AbortMultipart(c.Request.Context(), upload); err != nil {
+		writeS3Error(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleAdminS3Settings(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": s.s3.Settings(c.Request.Context())})
+}
+
+func (s *Server) handleAdminUpdateS3Settings(c *gin.Context) {
+	var payload s3gateway.Settings
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.updateSettings(c, payload.Values()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": s.s3.Settings(c.Request.Context())})
+}
+
+// s3Strategies 返回用户可用且 Token 未限制的储存策略。
+func (s *Server) s3Strategies(ctx context.Context, req *s3Request) (map[uint]struct{}, error) {
+	strategies, err := s.files.ListStrategiesForUser(ctx, req.user)
+	if err != nil {
+		return nil, err
+	}
+	restricted := tokenStrategySet(req.token)
+	out := make(map[uint]struct{}, len(strategies))
+	for _, strategy := range strategies {
+		if restricted != nil {
+			if _, ok := restricted[strategy.ID]; !ok {
+				continue
+			}
+		}
+		out[strategy.ID] = struct{}{}
+	}
+	return out, nil
+}
+
+// s3Visibility 按 x-amz-acl 决定可见性，未指定时使用用户默认值；演示站强制私有。
+func (s *Server) s3Visibility(user data.User, acl string) string {
+	s.mu.RLock()
+	demoMode := s.cfg.DemoMode
+	s.mu.RUnlock()
+	if demoMode {
+		return "private"
+	}
+	switch strings.ToLower(strings.TrimSpace(acl)) {
+	case "public-read", "public-read-write":
+		return "public"
+	case "private":
+		return "private"
+	default:
+		return users.DefaultVisibility(user)
+	}
+}
+
+// defaultUploadVisibility 返回不指定可见性时的上传可见性；演示站强制私有。
+func (s *Server) defaultUploadVisibility(user data.User) string {
+	s.mu.RLock()
+	demoMode := s.cfg.DemoMode
+	s.mu.RUnlock()
+	if demoMode {
+		return "private"
+	}
+	return users.DefaultVisibility(user)
+}
+
+func tokenStrategySet(token data.ApiToken) map[uint]struct{} {
+	ids := token.StrategyIDList()
+	if len(ids) == 0 {
+		return nil
+	}
+	out := make(map[uint]struct{}, len(ids))
+	for _, id := range ids {
+		out[id] = struct{}{}
+	}
+	return out
+}
+
+func requireS3Scope(c *gin.Context, req *s3Request, scope string) bool {
+	if req.token.HasScope(scope) {
+		return true
+	}
+	writeS3Error(c, s3gateway.ErrAccessDenied.WithMessage("Token is missing the "+scope+" scope"))
+	return false
+}
+
+func splitS3Path(raw string) (string, string) {
+	raw = strings.TrimPrefix(raw, "/")
+	bucket, key, _ := strings.Cut(raw, "/")
+	return bucket, key
+}
+
+func s3Owner(user data.User) s3gateway.Owner {
+	return s3gateway.Owner{ID: strconv.FormatUint(uint64(user.ID), 10), DisplayName: user.Name}
+}
+
+// s3UploadError 将上传错误转换为 S3 错误码，保留原始提示便于客户端展示。
+func s3UploadError(err error) error {
+	switch status := statusCodeFromError(err, http.StatusBadRequest); {
+	case status == http.StatusTooManyRequests:
+		return s3gateway.ErrSlowDown.WithMessage(err.Error())
+	case status == http.StatusForbidden:
+		return s3gateway.ErrAccessDenied.WithMessage(err.Error())
+	case status == http.StatusRequestEntityTooLarge:
+		return s3gateway.ErrEntityTooLarge.WithMessage(err.Error())
+	case status >= http.StatusInternalServerError:
+		return err
+	default:
+		return s3gateway.ErrInvalidArgument.WithMessage(err.Error())
+	}
+}
+
+func checkContentMD5(header, md5hex string) error {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil
+	}
+	expected, err := base64.StdEncoding.DecodeString(header)
+	if err != nil || len(expected) != md5.Size {
+		return s3gateway.ErrInvalidArgument.WithMessage("The Content-MD5 you specified is not valid")
+	}
+	if hex.EncodeToString(expected) != md5hex {
+		return s3gateway.ErrBadDigest
+	}
+	return nil
+}
+
+// multipartETag 按 S3 约定计算分片对象的 ETag：各分片 MD5 拼接后再取 MD5，附加分片数。
+func multipartETag(parts []s3gateway.CompletedPart) string {
+	sum := md5.New()
+	for _, part := range parts {
+		raw, err := hex.DecodeString(strings.Trim(part.ETag, "\" "))
+		if err == nil {
+			sum.Write(raw)
+		}
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum.Sum(nil)), len(parts))
+}
+
+func truncateString(value string, limit int) string {
+	value = strings.TrimSpace(value)
+	if len(value) > limit {
+		return value[:limit]
+	}
+	return value
+}
+
+func writeS3XML(c *gin.Context, status int, payload interface{}) {
+	c.Header("Content-Type", "application/xml")
+	c.Status(status)
+	if c.Request.Method == http.MethodHead {
+		return
+	}
+	_, _ = c.Writer.WriteString(xml.Header)
+	if err := xml.NewEncoder(c.Writer).Encode(payload); err != nil {
+		log.Printf("[s3] encode response failed: %v", err)
+	}
+}
+
+func writeS3Error(c *gin.Context, err error) {
+	var s3err *s3gateway.Error
+	if !errors.As(err, &s3err) {
+		log.Printf("[s3] %s %s failed: %v", c.Request.Method, c.Request.URL.Path, err)
+		s3err = s3gateway.ErrInternal
+	}
+	requestID := strings.ToUpper(strconv.FormatInt(time.Now().UnixNano(), 16))
+	c.Header("X-Amz-Request-Id", requestID)
+	writeS3XML(c, s3err.Status, s3gateway.ErrorResponse{
+		Code:      s3err.Code,
+		Message:   s3err.Message,
+		Resource:  c.Request.URL.Path,
+		RequestID: requestID,
+	})
+}
@@ -24,22 +24,32 @@ import (
 	"gorm.io/gorm"
 
 	"skyimage/internal/admin"
+	"skyimage/internal/alerts"
+	"skyimage/internal/auditlog"
 	"skyimage/internal/captcha"
 	"skyimage/internal/config"
 	"skyimage/internal/data"
+	"skyimage/internal/davfs"
 	"skyimage/internal/files"
 	"skyimage/internal/installer"
+	"skyimage/internal/invites"
+	"skyimage/internal/loginguard"
 	"skyimage/internal/mail"
 	"skyimage/internal/middleware"
 	"skyimage/internal/notifications"
 	"skyimage/internal/oauth"
 	"skyimage/internal/passkey"
+	"skyimage/internal/ratelimit"
 	"skyimage/internal/redeem"
+	"skyimage/internal/roles"
+	"skyimage/internal/s3gateway"
 	"skyimage/internal/session"
 	"skyimage/internal/shop"
 	"skyimage/internal/tickets"
+	"skyimage/internal/twofactor"
 	"skyimage/internal/users"
 	"skyimage/internal/verification"
+	"skyimage/internal/webhooks"
 )
 
 type Server struct {
@@ -53,6 +63,7 @@ type Server struct {
 	users         *users.Service
 	notifications *notifications.Service
 	redeem        *redeem.Service
+	invites       *invites.Service
 	shop          *shop.Service
 	tickets       *tickets.Service
 	mail          *mail.Service
@@ -60,8 +71,17 @@ type Server struct {
 	verification  *verification.Service
 	oauth         *oauth.Service
 	passkeys      *passkey.Service
+	twoFactor     *twofactor.Service
 	session       *session.Manager
-	authLimiter   *requestLimiter
+	loginGuard    *loginguard.Service
+	roles         *roles.Service
+	auditLog      *auditlog.Service
+	webhooks      *webhooks.Service
+	alerts        *alerts.Service
+	s3            *s3gateway.Service
+	davLocks      *davfs.Locks
+	authLimiter   *ratelimit.Limiter
+	rateStore     *ratelimit.DBStore
 	publicPaths   map[string]struct{}
 	stopShopExp   chan struct{}
 }
@@ -92,8 +112,12 @@ func NewServer(cfg config.Config, db *gorm.DB) *Server {
 		allowedOrigins = append(allowedOrigins, cfg.CORSAllowedOrigins...)
 	}
 
+	engine.Use(gin.Logger())
+	if metricsEnabled(cfg) {
+		// 放在 Recovery 之前，panic 恢复后的 500 也会被统计
+		engine.Use(middleware.Metrics())
+	}
 	engine.Use(
-		gin.Logger(),
 		gin.Recovery(),
 		middleware.CORS(allowedOrigins...),
 	)
@@ -103,6 +127,7 @@ func NewServer(cfg config.Config, db *gorm.DB) *Server {
 		engine:      engine,
 		authLimiter: newRequestLimiter(),
 		publicPaths: make(map[string]struct{}),
+		davLocks:    davfs.NewLocks(),
 	}
 	s.applyRuntimeConfig(cfg, db)
 	s.installer = installer.New(db, cfg, s.applyRuntimeConfig)
@@ -122,8 +147,23 @@ func (s *Server) applyRuntimeConfig(cfg config.Config, db *gorm.DB) {
 	s.db = db
 	adminService := admin.New(db)
 	s.admin = adminService
+	s.applyRateLimitStore(cfg, db)
+	if s.webhooks == nil {
+		s.webhooks = webhooks.New(db)
+	} else {
+		s.webhooks.SetDB(db)
+	}
+	if s.alerts == nil {
+		s.alerts = alerts.New(adminService)
+	} else {
+		s.alerts.SetSettings(adminService)
+	}
 	s.files = files.New(db, cfg)
+	s.files.SetLimiter(s.authLimiter)
+	s.files.SetWebhooks(s.webhooks)
+	s.files.SetAlerts(s.alerts)
 	s.users = users.New(db)
+	s.users.SetWebhooks(s.webhooks)
 	s.notifications = notifications.New(db)
 	s.redeem = redeem.New(db)
 	if s.shop == nil {
@@ -132,6 +172,8 @@ func (s *Server) applyRuntimeConfig(cfg config.Config, db *gorm.DB) {
 		s.shop.SetDB(db)
 		s.shop.SetAdmin(adminService)
 	}
+	s.shop.SetWebhooks(s.webhooks)
+	s.shop.SetAlerts(s.alerts)
 	s.mail = mail.New(adminService)
 	if s.tickets == nil {
 		s.tickets = tickets.New(db, s.files, s.notifications)
@@ -141,20 +183,63 @@ func (s *Server) applyRuntimeConfig(cfg config.Config, db *gorm.DB) {
 		s.tickets.SetNotifications(s.notifications)
 	}
 	s.tickets.SetMail(s.mail)
+	s.tickets.SetWebhooks(s.webhooks)
+	s.tickets.SetAlerts(s.alerts)
 	s.captcha = captcha.New(adminService)
-	s.verification = verification.New()
+	if s.verification == nil {
+		s.verification = verification.New(db, cfg.DeriveKey("verification-codes"))
+	} else {
+		s.verification.SetDB(db)
+	}
+	if s.invites == nil {
+		s.invites = invites.New(db, adminService)
+	} else {
+		s.invites.SetDB(db)
+		s.invites.SetSettings(adminService)
+	}
+	s.users.SetInvites(s.invites)
+	if s.s3 == nil {
+		s.s3 = s3gateway.New(db, adminService, cfg.DeriveKey("s3-gateway"))
+	} else {
+		s.s3.SetDB(db)
+		s.s3.SetSettings(adminService)
+	}
 	if s.oauth == nil {
 		s.oauth = oauth.New(db, adminService)
 	} else {
 		s.oauth.SetDB(db)
 		s.oauth.SetSettings(adminService)
 	}
+	s.oauth.SetInvites(s.invites)
+	s.oauth.SetWebhooks(s.webhooks)
 	if s.passkeys == nil {
 		s.passkeys = passkey.New(db, adminService, cfg.PublicBaseURL)
 	} else {
 		s.passkeys.SetDB(db)
 		s.passkeys.SetSettings(adminService)
 	}
+	if s.twoFactor == nil {
+		s.twoFactor = twofactor.New(db, adminService)
+	} else {
+		s.twoFactor.SetDB(db)
+		s.twoFactor.SetSettings(adminService)
+	}
+	if s.loginGuard == nil {
+		s.loginGuard = loginguard.New(db)
+	} else {
+		s.loginGuard.SetDB(db)
+	}
+	if s.roles == nil {
+		s.roles = roles.New(db)
+	} else {
+		s.roles.SetDB(db)
+	}
+	if s.auditLog == nil {
+		s.auditLog = auditlog.New(db, adminService)
+	} else {
+		s.auditLog.SetDB(db)
+		s.auditLog.SetSettings(adminService)
+	}
 	if s.session == nil {
 		s.session = session.NewManager(db, 24*time.Hour)
 	} else {
@@ -181,19 +266,37 @@ func (s *Server) Run(ctx context.Context) error {
 		Addr:    s.cfg.HTTPAddr,
 		Handler: s.engine,
 	}
-	errCh := make(chan error, 1)
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			errCh <- err
+	servers := []*http.Server{srv}
+	if metricsSrv := s.newMetricsServer(); metricsSrv != nil {
+		servers = append(servers, metricsSrv)
+		log.Printf("Prometheus 指标监听于 %s%s", metricsSrv.Addr, metricsPath)
+	}
+	errCh := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errCh <- err
+			}
+		}(server)
+	}
+
+	shutdown := func() error {
+		ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var firstErr error
+		for _, server := range servers {
+			if err := server.Shutdown(ctxShutdown); err != nil && firstErr == nil {
+				firstErr = err
+			}
 		}
-	}()
+		return firstErr
+	}
 
 	select {
 	case <-ctx.Done():
-		ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		return srv.Shutdown(ctxShutdown)
+		return shutdown()
 	case err := <-errCh:
+		_ = shutdown()
 		return err
 	}
 }
@@ -328,12 +431,16 @@ Disallow: /forgot-password
 Disallow: /reset-password
 Disallow: /installer
 `
+	if settings, err := s.admin.GetSettings(c.Request.Context()); err == nil && settings[settingSitemap] != "false" {
+		robotsTxt += "\nSitemap: " + s.publicBaseURL(c) + "/sitemap.xml\n"
+	}
 	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(robotsTxt))
 }
 
 func (s *Server) registerRoutes() {
 	apiGroup := s.engine.Group("/api")
 	apiGroup.GET("/health", s.healthHandler)
+	s.registerMetricsRoutes()
 	s.registerInstallerRoutes(apiGroup)
 	s.registerAuthRoutes(apiGroup)
 	s.registerOAuthRoutes(apiGroup)
@@ -345,9 +452,15 @@ func (s *Server) registerRoutes() {
 	s.registerFileRoutes(apiGroup)
 	s.registerSiteRoutes(apiGroup)
 	s.registerLskyV1Routes(apiGroup)
+	s.registerCheveretoRoutes(apiGroup)
+	s.registerS3Routes(apiGroup)
+	s.registerWebDAVRoutes()
+	s.registerShareRoutes(apiGroup)
+	s.registerFeedRoutes()
 	s.registerStaticAssets()
 	s.registerFrontend()
 	s.engine.GET("/robots.txt", s.robotsHandler)
+	s.engine.GET("/sitemap.xml", s.handleSitemap)
 }
 
 func (s *Server) registerFrontend() {
@@ -904,7 +1017,7 @@ func (s *Server) serveLocalFileByRelative(c *gin.Context, rel string) bool {
 			return true // 返回 true 表示已处理请求
 		}
 		// 检查是否是图片所有者或管理员
-		if file.UserID != user.ID && !user.IsAdmin {
+		if file.UserID != user.ID && !user.HasAdminPermission(data.AdminPermModeration) {
 			c.JSON(http.StatusForbidden, gin.H{
 				"error":   "无权访问此私有图片",
 				"message": "私有图片仅对上传者和管理员可见",
@@ -1305,6 +1418,10 @@ func (s *Server) serveIndexHTML(c *gin.Context, distPath string, statusCode int)
 		}
 	}
 
+	if links := s.feedDiscoveryLinks(c, settings); links != "" {
+		html = strings.Replace(html, "</head>", links+"</head>", 1)
+	}
+
 	c.Data(statusCode, "text/html; charset=utf-8", []byte(html))
 }
 
@@ -1334,12 +1451,17 @@ func sanitizeFaviconURL(raw string) string {
 }
 
 func (s *Server) authMiddleware() gin.HandlerFunc {
+	return s.scopedAuthMiddleware(nil)
+}
+
+// scopedAuthMiddleware 允许具备 policy 所需权限的受限 API Token 访问。
+func (s *Server) scopedAuthMiddleware(policy middleware.TokenScopePolicy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		s.mu.RLock()
 		userService := s.users
 		sessionManager := s.session
 		s.mu.RUnlock()
-		middleware.Auth(userService, sessionManager)(c)
+		middleware.AuthWithScope(userService, sessionManager, policy)(c)
 	}
 }
 
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/middleware"
+	"skyimage/internal/session"
+)
+
+// currentSessionID 返回本次请求使用的会话 Cookie；API Token 访问时为空。
+func currentSessionID(c *gin.Context) string {
+	if _, ok := middleware.CurrentAPIToken(c); ok {
+		return ""
+	}
+	sessionID, err := c.Cookie(session.CookieName)
+	if err != nil {
+		return ""
+	}
+	return sessionID
+}
+
+// revokeUserSessions 注销用户除 exceptID 之外的全部会话，失败只记录日志。
+func (s *Server) revokeUserSessions(c *gin.Context, userID uint, exceptID string) {
+	if _, err := s.session.RevokeAll(c.Request.Context(), userID, exceptID); err != nil {
+		log.Printf("[会话] 注销用户 %d 的会话失败: %v", userID, err)
+	}
+}
+
+func (s *Server) handleAccountSessions(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	items, err := s.session.List(c.Request.Context(), user.ID, currentSessionID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": items})
+}
+
+func (s *Server) handleAccountRevokeSession(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	publicID := c.Param("id")
+	if err := s.session.Revoke(c.Request.Context(), user.ID, publicID); err != nil {
+		if errors.Is(err, session.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if current := currentSessionID(c); current != "" && session.PublicID(current) == publicID {
+		s.clearSessionCookie(c)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"message": "会话已注销"}})
+}
+
+// handleAccountRevokeOtherSessions 注销除当前会话外的所有会话。
+func (s *Server) handleAccountRevokeOtherSessions(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	revoked, err := s.session.RevokeAll(c.Request.Context(), user.ID, currentSessionID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"revoked": revoked}})
+}
@@ -0,0 +1,319 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"skyimage/internal/files"
+)
+
+// sharePathPrefix 公开图片分享页 /i/<key>，供 Slack、Discord、微信等抓取 OpenGraph 信息。
+const sharePathPrefix = "/i/"
+
+var errShareNotFound = errors.New("image not found")
+
+func (s *Server) registerShareRoutes(apiGroup *gin.RouterGroup) {
+	s.engine.GET(sharePathPrefix+":key", s.handleSharePage)
+	s.engine.HEAD(sharePathPrefix+":key", s.handleSharePage)
+	apiGroup.GET("/oembed", s.handleOEmbed)
+}
+
+// publicBaseURL 返回站点对外地址，未配置控制台地址时回退到当前请求。
+func (s *Server) publicBaseURL(c *gin.Context) string {
+	if base := s.oauthPublicBase(c); base != "" {
+		return base
+	}
+	return getBaseURL(c)
+}
+
+// publicShareFile 按 key 查找公开图片，私有或不存在时统一返回 errShareNotFound。
+func (s *Server) publicShareFile(ctx context.Context, key string) (files.FileDTO, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return files.FileDTO{}, errShareNotFound
+	}
+	file, err := s.files.FindByKey(ctx, key)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return files.FileDTO{}, errShareNotFound
+		}
+		return files.FileDTO{}, err
+	}
+	if file.Visibility != "public" {
+		return files.FileDTO{}, errShareNotFound
+	}
+	dto, err := s.files.ToDTOForViewer(ctx, file, nil)
+	if err != nil {
+		return files.FileDTO{}, err
+	}
+	// 与公开画廊一致：不暴露邮箱与审核信息，未公开主页时不暴露用户 ID
+	dto.Audit = nil
+	dto.OwnerEmail = ""
+	if !dto.OwnerPublicProfile {
+		dto.OwnerID = 0
+		dto.OwnerName = ""
+	}
+	return dto, nil
+}
+
+func shareTitle(dto files.FileDTO) string {
+	if name := strings.TrimSpace(dto.OriginalName); name != "" {
+		return name
+	}
+	return dto.Name
+}
+
+type sharePageView struct {
+	SiteName    string
+	Title       string
+	Description string
+	PageURL     string
+	ImageURL    string
+	MimeType    string
+	IsImage     bool
+	Width       int
+	Height      int
+	OwnerName   string
+	OwnerURL    string
+	OEmbedJSON  string
+	OEmbedXML   string
+	Favicon     template.URL
+}
+
+var sharePageTemplate = template.Must(template.New("share").Parse(`<!doctype html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8" />
+<meta name="viewport" content="width=device-width, initial-scale=1" />
+<title>{{.Title}} - {{.SiteName}}</title>
+<meta name="description" content="{{.Description}}" />
+<link rel="canonical" href="{{.PageURL}}" />
+{{- if .Favicon}}
+<link rel="icon" href="{{.Favicon}}" />
+{{- end}}
+<link rel="alternate" type="application/json+oembed" href="{{.OEmbedJSON}}" title="{{.Title}}" />
+<link rel="alternate" type="text/xml+oembed" href="{{.OEmbedXML}}" title="{{.Title}}" />
+<meta property="og:site_name" content="{{.SiteName}}" />
+<meta property="og:type" content="website" />
+<meta property="og:title" content="{{.Title}}" />
+<meta property="og:description" content="{{.Description}}" />
+<meta property="og:url" content="{{.PageURL}}" />
+{{- if .IsImage}}
+<meta property="og:image" content="{{.ImageURL}}" />
+<meta property="og:image:type" content="{{.MimeType}}" />
+<meta property="og:image:alt" content="{{.Title}}" />
+{{- if and .Width .Height}}
+<meta property="og:image:width" content="{{.Width}}" />
+<meta property="og:image:height" content="{{.Height}}" />
+{{- end}}
+<meta name="twitter:card" content="summary_large_image" />
+<meta name="twitter:image" content="{{.ImageURL}}" />
+{{- else}}
+<meta name="twitter:card" content="summary" />
+{{- end}}
+<meta name="twitter:title" content="{{.Title}}" />
+<meta name="twitter:description" content="{{.Description}}" />
+<style>
+body{margin:0;min-height:100vh;display:flex;flex-direction:column;align-items:center;justify-content:center;background:#0f172a;color:#e2e8f0;font-family:system-ui,-apple-system,"PingFang SC","Microsoft YaHei",sans-serif}
+main{max-width:min(96vw,1200px);padding:24px;text-align:center}
+img{max-width:100%;max-height:80vh;border-radius:8px;box-shadow:0 10px 30px rgba(0,0,0,.4)}
+h1{font-size:16px;font-weight:500;margin:16px 0 4px;word-break:break-all}
+p{font-size:13px;color:#94a3b8;margin:4px 0}
+a{color:#38bdf8;text-decoration:none}
+</style>
+</head>
+<body>
+<main>
+{{- if .IsImage}}
+<a href="{{.ImageURL}}"><img src="{{.ImageURL}}" alt="{{.Title}}"{{if and .Width .Height}} width="{{.Width}}" height="{{.Height}}"{{end}} /></a>
+{{- end}}
+<h1>{{.Title}}</h1>
+<p>{{.Description}}</p>
+<p>{{if .OwnerURL}}<a href="{{.OwnerURL}}">{{.OwnerName}}</a> · {{end}}<a href="{{.ImageURL}}">查看原图</a> · <a href="/">{{.SiteName}}</a></p>
+</main>
+</body>
+</html>
+`))
+
+func (s *Server) handleSharePage(c *gin.Context) {
+	ctx := c.Request.Context()
+	dto, err := s.publicShareFile(ctx, c.Param("key"))
+	if err != nil {
+		// 单段路径也可能是公开路径为 i 的本地文件
+		if s.tryServeLocalFile(c) {
+			return
+		}
+		s.serveIndexHTML(c, filepath.Clean(s.cfg.FrontendDist), http.StatusNotFound)
+		return
+	}
+
+	settings, _ := s.admin.GetSettings(ctx)
+	siteName := strings.TrimSpace(settings["site.title"])
+	if siteName == "" {
+		siteName = "SkyImage"
+	}
+	base := s.publicBaseURL(c)
+	pageURL := base + sharePathPrefix + url.PathEscape(dto.Key)
+	view := sharePageView{
+		SiteName:    siteName,
+		Title:       shareTitle(dto),
+		Description: shareDescription(dto),
+		PageURL:     pageURL,
+		ImageURL:    absoluteShareURL(base, dto.DirectURL),
+		MimeType:    dto.MimeType,
+		IsImage:     strings.HasPrefix(dto.MimeType, "image/"),
+		Width:       dto.Width,
+		Height:      dto.Height,
+		OEmbedJSON:  base + "/api/oembed?" + url.Values{"url": {pageURL}, "format": {"json"}}.Encode(),
+		OEmbedXML:   base + "/api/oembed?" + url.Values{"url": {pageURL}, "format": {"xml"}}.Encode(),
+		// sanitizeFaviconURL 已限制为 http(s)、站内路径或 data:image
+		Favicon: template.URL(sanitizeFaviconURL(settings["site.logo"])),
+	}
+	if dto.OwnerID != 0 {
+		view.OwnerName = dto.OwnerName
+		view.OwnerURL = base + "/u/" + strconv.FormatUint(uint64(dto.OwnerID), 10)
+	}
+
+	var buf bytes.Buffer
+	if err := sharePageTemplate.Execute(&buf, view); err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+func shareDescription(dto files.FileDTO) string {
+	parts := make([]string, 0, 3)
+	if dto.Width > 0 && dto.Height > 0 {
+		parts = append(parts, strconv.Itoa(dto.Width)+" × "+strconv.Itoa(dto.Height))
+	}
+	if dto.Size > 0 {
+		parts = append(parts, formatBytesCN(float64(dto.Size)))
+	}
+	if !dto.CreatedAt.IsZero() {
+		parts = append(parts, dto.CreatedAt.Format("2006-01-02"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// shareKeyFromURL 从分享页地址中解析图片 key，只接受 /i/<key> 形式。
+func shareKeyFromURL(raw string) string {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return ""
+	}
+	key, ok := strings.CutPrefix(parsed.Path, sharePathPrefix)
+	if !ok || key == "" || strings.Contains(key, "/") {
+		return ""
+	}
+	return key
+}
+
+// handleOEmbed 实现 oEmbed 1.0 的 photo 类型，https://oembed.com/
+func (s *Server) handleOEmbed(c *gin.Context) {
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", "json")))
+	if format != "json" && format != "xml" {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "unsupported format"})
+		return
+	}
+	key := shareKeyFromURL(c.Query("url"))
+	if key == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		return
+	}
+	dto, err := s.publicShareFile(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, errShareNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, _ := s.admin.GetSettings(c.Request.Context())
+	siteName := strings.TrimSpace(settings["site.title"])
+	if siteName == "" {
+		siteName = "SkyImage"
+	}
+	base := s.publicBaseURL(c)
+	width, height := fitOEmbedSize(dto.Width, dto.Height, queryInt(c, "maxwidth"), queryInt(c, "maxheight"))
+	resp := oembedResponse{
+		Type:            "photo",
+		Version:         "1.0",
+		Title:           shareTitle(dto),
+		ProviderName:    siteName,
+		ProviderURL:     base + "/",
+		CacheAge:        3600,
+		URL:             absoluteShareURL(base, dto.DirectURL),
+		Width:           width,
+		Height:          height,
+		ThumbnailURL:    absoluteShareURL(base, dto.ThumbnailURL),
+		ThumbnailWidth:  width,
+		ThumbnailHeight: height,
+	}
+	if dto.OwnerID != 0 {
+		resp.AuthorName = dto.OwnerName
+		resp.AuthorURL = base + "/u/" + strconv.FormatUint(uint64(dto.OwnerID), 10)
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	if format == "xml" {
+		c.XML(http.StatusOK, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+type oembedResponse struct {
+	XMLName         xml.Name `json:"-" xml:"oembed"`
+	Type            string   `json:"type" xml:"type"`
+	Version         string   `json:"version" xml:"version"`
+	Title           string   `json:"title,omitempty" xml:"title,omitempty"`
+	AuthorName      string   `json:"author_name,omitempty" xml:"author_name,omitempty"`
+	AuthorURL       string   `json:"author_url,omitempty" xml:"author_url,omitempty"`
+	ProviderName    string   `json:"provider_name" xml:"provider_name"`
+	ProviderURL     string   `json:"provider_url" xml:"provider_url"`
+	CacheAge        int      `json:"cache_age" xml:"cache_age"`
+	URL             string   `json:"url" xml:"url"`
+	Width           int      `json:"width" xml:"width"`
+	Height          int      `json:"height" xml:"height"`
+	ThumbnailURL    string   `json:"thumbnail_url,omitempty" xml:"thumbnail_url,omitempty"`
+	ThumbnailWidth  int      `json:"thumbnail_width,omitempty" xml:"thumbnail_width,omitempty"`
+	ThumbnailHeight int      `json:"thumbnail_height,omitempty" xml:"thumbnail_height,omitempty"`
+}
+
+// absoluteShareURL 补全站内相对地址，OpenGraph 与 oEmbed 都要求绝对地址。
+func absoluteShareURL(base, value string) string {
+	if strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "//") {
+		return base + value
+	}
+	return value
+}
+
+// fitOEmbedSize 按 maxwidth/maxheight 等比缩小尺寸，0 表示不限制。
+func fitOEmbedSize(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return width, height
+	}
+	if maxWidth > 0 && width > maxWidth {
+		height = height * maxWidth / width
+		width = maxWidth
+	}
+	if maxHeight > 0 && height > maxHeight {
+		width = width * maxHeight / height
+		height = maxHeight
+	}
+	return max(width, 1), max(height, 1)
+}
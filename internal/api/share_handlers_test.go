@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSharePageAndOEmbed(t *testing.T) {
+	client := newLskyContractServer(t)
+	client.server.registerShareRoutes(client.engine.Group("/api"))
+
+	upload := func(permission string) string {
+		body, contentType := lskyUploadBody(t, map[string]string{"permission": permission})
+		recorder := client.do(http.MethodPost, "/api/v1/upload", contentType, body)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("upload failed: %d %s", recorder.Code, recorder.Body.String())
+		}
+		var resp map[string]interface{}
+		_ = json.Unmarshal(recorder.Body.Bytes(), &resp)
+		return fmt.Sprint(dataField(t, resp, "key"))
+	}
+	publicKey := upload("1")
+	privateKey := upload("0")
+	client.token = ""
+
+	page := client.do(http.MethodGet, "/i/"+publicKey, "", nil)
+	if page.Code != http.StatusOK || !strings.HasPrefix(page.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected share page, got %d %s", page.Code, page.Header().Get("Content-Type"))
+	}
+	html := page.Body.String()
+	for _, want := range []string{
+		`<meta property="og:image" content="https://img.example.com/`,
+		`<meta property="og:image:width" content="1" />`,
+		`<meta property="og:url" content="http://example.com/i/` + publicKey + `" />`,
+		`<meta name="twitter:card" content="summary_large_image" />`,
+		`type="application/json+oembed" href="http://example.com/api/oembed?format=json&amp;url=http%3A%2F%2Fexample.com%2Fi%2F` + publicKey + `"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Fatalf("share page is missing %q:\n%s", want, html)
+		}
+	}
+	if recorder := client.do(http.MethodGet, "/i/"+privateKey, "", nil); recorder.Code != http.StatusNotFound {
+		t.Fatalf("private image should not have a share page, got %d", recorder.Code)
+	}
+
+	oembedURL := func(key, extra string) string {
+		return "/api/oembed?url=" + url.QueryEscape("http://example.com/i/"+key) + extra
+	}
+	recorder := client.do(http.MethodGet, oembedURL(publicKey, ""), "", nil)
+	var embed oembedResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &embed); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("oembed failed: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if embed.Type != "photo" || embed.Version != "1.0" || embed.Width != 1 || !strings.HasPrefix(embed.URL, "https://img.example.com/") {
+		t.Fatalf("unexpected oembed response: %+v", embed)
+	}
+	if recorder := client.do(http.MethodGet, oembedURL(publicKey, "&format=xml"), "", nil); recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "<oembed><type>photo</type>") {
+		t.Fatalf("unexpected xml oembed: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := client.do(http.MethodGet, oembedURL(publicKey, "&format=yaml"), "", nil); recorder.Code != http.StatusNotImplemented {
+		t.Fatalf("unsupported format should return 501, got %d", recorder.Code)
+	}
+	if recorder := client.do(http.MethodGet, oembedURL(privateKey, ""), "", nil); recorder.Code != http.StatusNotFound {
+		t.Fatalf("private image should not be embeddable, got %d", recorder.Code)
+	}
+
+	if w, h := fitOEmbedSize(1600, 900, 800, 0); w != 800 || h != 450 {
+		t.Fatalf("fitOEmbedSize = %dx%d", w, h)
+	}
+	if w, h := fitOEmbedSize(1600, 900, 0, 300); w != 533 || h != 300 {
+		t.Fatalf("fitOEmbedSize = %dx%d", w, h)
+	}
+}
@@ -9,6 +9,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"skyimage/internal/auditlog"
+	"skyimage/internal/data"
+	"skyimage/internal/metrics"
 	"skyimage/internal/middleware"
 	"skyimage/internal/payment"
 	"skyimage/internal/shop"
@@ -22,7 +25,7 @@ func (s *Server) registerShopRoutes(r *gin.RouterGroup) {
 	// Auth required
 	auth := r.Group("")
 	auth.Use(s.authMiddleware(), middleware.RequireCSRF())
-	auth.POST("/shop/orders", s.handleShopCreateOrder)
+	auth.POST("/shop/orders", middleware.BlockImpersonation(), s.handleShopCreateOrder)
 	auth.GET("/shop/orders", s.handleShopListOrders)
 	auth.GET("/shop/orders/:orderNo", s.handleShopGetOrder)
 	auth.GET("/shop/membership", s.handleShopMembership)
@@ -163,11 +166,17 @@ func (s *Server) handlePayNotify(c *gin.Context) {
 	providerName := payment.NormalizeProvider(c.Param("provider"))
 	prov, err := payment.Get(providerName)
 	if err != nil {
+		// 未知的提供方不作为标签值，避免任意路径制造大量时间序列
+		metrics.PaymentNotifies.Inc("unknown", "bad_provider")
 		c.String(http.StatusBadRequest, "bad provider")
 		return
 	}
+	record := func(result string) {
+		metrics.PaymentNotifies.Inc(providerName, result)
+	}
 	settingsMap, err := s.admin.GetSettings(c.Request.Context())
 	if err != nil {
+		record("error")
 		c.String(http.StatusInternalServerError, "error")
 		return
 	}
@@ -184,21 +193,42 @@ func (s *Server) handlePayNotify(c *gin.Context) {
 
 	result, err := prov.HandleNotify(c.Request, settings, expected)
 	if err != nil {
+		record("invalid")
 		c.String(http.StatusBadRequest, "fail")
 		return
 	}
 	// FulfillFromNotify re-loads the order and enforces amount == snapshot.
 	if result.Paid {
+		// 已支付订单的重复回调不再写审计日志
+		alreadyPaid := false
+		if order, err := s.shop.GetOrderByNo(c.Request.Context(), result.OrderNo); err == nil {
+			alreadyPaid = order.Status == data.OrderStatusPaid
+		}
 		if err := s.shop.FulfillFromNotify(c.Request.Context(), providerName, result); err != nil {
 			if errors.Is(err, shop.ErrAmountMismatch) {
+				record("amount_mismatch")
 				c.String(http.StatusBadRequest, "fail")
 				return
 			}
 			if !errors.Is(err, shop.ErrOrderNotPending) {
+				record("error")
 				c.String(http.StatusInternalServerError, "fail")
 				return
 			}
+			record("duplicate")
+		} else {
+			record("paid")
+			if !alreadyPaid {
+				auditTarget(c, "orders.paid", "orders", result.OrderNo)
+				auditChanges(c, map[string]string{"status": data.OrderStatusPending}, map[string]string{
+					"status":  data.OrderStatusPaid,
+					"tradeNo": result.TradeNo,
+				})
+				s.writeAudit(c, 0, "system/"+providerName, http.StatusOK)
+			}
 		}
+	} else {
+		record("unpaid")
 	}
 	if result.RespondOK != "" {
 		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(result.RespondOK))
@@ -262,6 +292,8 @@ func (s *Server) handleAdminCreateShopProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	auditTarget(c, "", "", auditlog.TargetID(item.ID))
+	auditChange(c, nil, item)
 	c.JSON(http.StatusOK, gin.H{"data": item})
 }
 
@@ -276,6 +308,7 @@ func (s *Server) handleAdminUpdateShopProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	previous, _ := s.shop.GetProduct(c.Request.Context(), uint(id))
 	item, err := s.shop.UpdateProduct(c.Request.Context(), uint(id), input)
 	if err != nil {
 		status := http.StatusBadRequest
@@ -285,6 +318,7 @@ func (s *Server) handleAdminUpdateShopProduct(c *gin.Context) {
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	auditChange(c, previous, item)
 	c.JSON(http.StatusOK, gin.H{"data": item})
 }
 
@@ -294,6 +328,7 @@ func (s *Server) handleAdminDeleteShopProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
+	previous, _ := s.shop.GetProduct(c.Request.Context(), uint(id))
 	if err := s.shop.DeleteProduct(c.Request.Context(), uint(id)); err != nil {
 		status := http.StatusBadRequest
 		if errors.Is(err, shop.ErrProductNotFound) {
@@ -302,6 +337,7 @@ func (s *Server) handleAdminDeleteShopProduct(c *gin.Context) {
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	auditChange(c, previous, nil)
 	c.JSON(http.StatusOK, gin.H{"data": true})
 }
 
@@ -431,7 +467,7 @@ func (s *Server) handleAdminUpdatePaymentSettings(c *gin.Context) {
 		"pay.stripe.secret_key":        keep(payload.Stripe.SecretKey, "pay.stripe.secret_key"),
 		"pay.stripe.webhook_secret":    keep(payload.Stripe.WebhookSecret, "pay.stripe.webhook_secret"),
 	}
-	if err := s.admin.UpdateSettings(c.Request.Context(), updates); err != nil {
+	if err := s.updateSettings(c, updates); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
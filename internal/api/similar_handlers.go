@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+	"skyimage/internal/files"
+	"skyimage/internal/middleware"
+)
+
+const maxSimilarProbeSize = 20 * 1024 * 1024
+
+type similarFileDTO struct {
+	File     files.FileDTO `json:"file"`
+	Distance int           `json:"distance"`
+}
+
+type duplicateClusterDTO struct {
+	Files         []similarFileDTO `json:"files"`
+	RedundantSize int64            `json:"redundantSize"`
+}
+
+// similarScope 默认只在当前用户的图片中查找，管理员可通过 scope=global 查找全站。
+func similarScope(c *gin.Context, user data.User) uint {
+	if c.Query("scope") == "global" && user.HasAdminPermission(data.AdminPermModeration) {
+		return 0
+	}
+	return user.ID
+}
+
+func queryInt(c *gin.Context, key string) int {
+	value, err := strconv.Atoi(c.Query(key))
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+func (s *Server) similarMatchesToDTO(c *gin.Context, matches []files.SimilarMatch, viewer *data.User) ([]similarFileDTO, error) {
+	items := make([]similarFileDTO, 0, len(matches))
+	for _, match := range matches {
+		dto, err := s.files.ToDTOForViewer(c.Request.Context(), match.File, viewer)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, similarFileDTO{File: dto, Distance: match.Distance})
+	}
+	return items, nil
+}
+
+func (s *Server) handleSimilarFiles(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	source, matches, err := s.files.FindSimilarByFile(c.Request.Context(), similarScope(c, user), uint(id), queryInt(c, "distance"), queryInt(c, "limit"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+			return
+		}
+		c.JSON(statusCodeFromError(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	sourceDTO, err := s.files.ToDTOForViewer(c.Request.Context(), source, &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	items, err := s.similarMatchesToDTO(c, matches, &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"source": sourceDTO, "items": items}})
+}
+
+func (s *Server) handleSimilarByProbe(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if header.Size > maxSimilarProbeSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "样本图片过大"})
+		return
+	}
+	src, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer src.Close()
+	payload, err := io.ReadAll(io.LimitReader(src, maxSimilarProbeSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	distance, _ := strconv.Atoi(c.PostForm("distance"))
+	if distance == 0 {
+		distance = queryInt(c, "distance")
+	}
+	matches, err := s.files.FindSimilarByImage(c.Request.Context(), similarScope(c, user), payload, http.DetectContentType(payload), distance, queryInt(c, "limit"))
+	if err != nil {
+		c.JSON(statusCodeFromError(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	items, err := s.similarMatchesToDTO(c, matches, &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"items": items}})
+}
+
+// handleFileDuplicates 返回当前用户图库中的近似重复分组，前端可配合 /files/batch/delete 批量清理。
+func (s *Server) handleFileDuplicates(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	clusters, err := s.files.FindDuplicateClusters(c.Request.Context(), user.ID, queryInt(c, "distance"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var totalRedundant int64
+	items := make([]duplicateClusterDTO, 0, len(clusters))
+	for _, cluster := range clusters {
+		matches, err := s.similarMatchesToDTO(c, cluster.Files, &user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		totalRedundant += cluster.RedundantSize
+		items = append(items, duplicateClusterDTO{Files: matches, RedundantSize: cluster.RedundantSize})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"clusters": items, "redundantSize": totalRedundant}})
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/data"
+	"skyimage/internal/users"
+)
+
+// sitemapMaxURLs 单个 sitemap 文件的上限（sitemaps.org 协议规定 50,000 条）。
+const sitemapMaxURLs = 50000
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+}
+
+// handleSitemap 列出首页、公开主页与公开图片的分享页。
+// 关闭图片广场时只收录开启公开主页用户的图片，避免把仅用于外链的图片暴露给搜索引擎。
+func (s *Server) handleSitemap(c *gin.Context) {
+	ctx := c.Request.Context()
+	settings, err := s.admin.GetSettings(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if settings[settingSitemap] == "false" {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	s.mu.RLock()
+	db := s.db
+	s.mu.RUnlock()
+
+	base := s.publicBaseURL(c)
+	set := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	set.URLs = append(set.URLs, sitemapURL{Loc: base + "/", ChangeFreq: "daily"})
+
+	var candidates []data.User
+	if err := db.WithContext(ctx).
+		Select("id", "status", "configs", "updated_at").
+		Where("status = ?", 1).
+		Where("configs LIKE ?", "%public_profile%").
+		Order("id").
+		Find(&candidates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	profiles := make([]uint, 0, len(candidates))
+	for _, user := range candidates {
+		if !users.PublicProfileEnabled(user) {
+			continue
+		}
+		profiles = append(profiles, user.ID)
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:        base + "/u/" + strconv.FormatUint(uint64(user.ID), 10),
+			LastMod:    user.UpdatedAt.UTC().Format(time.RFC3339),
+			ChangeFreq: "weekly",
+		})
+	}
+
+	remaining := sitemapMaxURLs - len(set.URLs)
+	galleryEnabled := settings["features.gallery"] != "false"
+	if remaining > 0 && (galleryEnabled || len(profiles) > 0) {
+		var rows []struct {
+			Key       string
+			UpdatedAt time.Time
+		}
+		query := db.WithContext(ctx).
+			Model(&data.FileAsset{}).
+			Select("key", "updated_at").
+			Where("visibility = ?", "public")
+		if !galleryEnabled {
+			query = query.Where("user_id IN ?", profiles)
+		}
+		if err := query.Order("created_at DESC").Limit(remaining).Scan(&rows).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, row := range rows {
+			set.URLs = append(set.URLs, sitemapURL{
+				Loc:     base + sharePathPrefix + url.PathEscape(row.Key),
+				LastMod: row.UpdatedAt.UTC().Format(time.RFC3339),
+			})
+		}
+	}
+
+	body, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", append([]byte(xml.Header), body...))
+}
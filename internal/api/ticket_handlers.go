@@ -15,6 +15,7 @@ import (
 	"skyimage/internal/captcha"
 	"skyimage/internal/data"
 	"skyimage/internal/middleware"
+	"skyimage/internal/ratelimit"
 	"skyimage/internal/tickets"
 	"skyimage/internal/users"
 )
@@ -29,15 +30,11 @@ type ticketCaptchaPayload struct {
 
 func (s *Server) enforceTicketWriteRateLimit(c *gin.Context, userID uint, action string) bool {
 	key := fmt.Sprintf("ticket:%s:user:%d", action, userID)
-	ok, retry := s.authLimiter.AllowInterval(key, ticketWriteCooldown)
+	ok, retry := allowRequest(c, s.authLimiter, key, 1, ticketWriteCooldown)
 	if ok {
 		return true
 	}
-	secs := int(retry.Seconds() + 0.999)
-	if secs < 1 {
-		secs = 1
-	}
-	c.Header("Retry-After", strconv.Itoa(secs))
+	secs := ratelimit.Seconds(retry)
 	c.JSON(http.StatusTooManyRequests, gin.H{
 		"error":      "操作过于频繁，请稍后再试",
 		"retryAfter": secs,
@@ -401,12 +398,8 @@ func (s *Server) handleUploadMyTicketAttachment(c *gin.Context) {
 		return
 	}
 	// Soft limit for multi-file uploads after create/reply (5 files / 10s).
-	if ok, retry := s.authLimiter.Allow(fmt.Sprintf("ticket:attach:user:%d", user.ID), 5, ticketWriteCooldown); !ok {
-		secs := int(retry.Seconds() + 0.999)
-		if secs < 1 {
-			secs = 1
-		}
-		c.Header("Retry-After", strconv.Itoa(secs))
+	if ok, retry := allowRequest(c, s.authLimiter, fmt.Sprintf("ticket:attach:user:%d", user.ID), 5, ticketWriteCooldown); !ok {
+		secs := ratelimit.Seconds(retry)
 		c.JSON(http.StatusTooManyRequests, gin.H{"error": "操作过于频繁，请稍后再试", "retryAfter": secs})
 		return
 	}
@@ -521,12 +514,8 @@ func (s *Server) handleAdminUploadTicketAttachment(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing user"})
 		return
 	}
-	if ok, retry := s.authLimiter.Allow(fmt.Sprintf("ticket:admin-attach:user:%d", user.ID), 5, ticketWriteCooldown); !ok {
-		secs := int(retry.Seconds() + 0.999)
-		if secs < 1 {
-			secs = 1
-		}
-		c.Header("Retry-After", strconv.Itoa(secs))
+	if ok, retry := allowRequest(c, s.authLimiter, fmt.Sprintf("ticket:admin-attach:user:%d", user.ID), 5, ticketWriteCooldown); !ok {
+		secs := ratelimit.Seconds(retry)
 		c.JSON(http.StatusTooManyRequests, gin.H{"error": "操作过于频繁，请稍后再试", "retryAfter": secs})
 		return
 	}
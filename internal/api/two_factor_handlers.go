@@ -0,0 +1,248 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/loginguard"
+	"skyimage/internal/middleware"
+	"skyimage/internal/session"
+	"skyimage/internal/twofactor"
+	"skyimage/internal/users"
+)
+
+func twoFactorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, twofactor.ErrInvalidCode), errors.Is(err, twofactor.ErrInvalidChallenge):
+		return http.StatusUnauthorized
+	case errors.Is(err, twofactor.ErrNotEnabled), errors.Is(err, twofactor.ErrAlreadyEnabled), errors.Is(err, twofactor.ErrNoPendingSetup):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// handleLoginTwoFactor 完成密码、OAuth 或 Passkey 登录后的第二步验证。
+func (s *Server) handleLoginTwoFactor(c *gin.Context) {
+	var input struct {
+		Challenge  string `json:"challenge" binding:"required"`
+		Code       string `json:"code" binding:"required"`
+		RememberMe bool   `json:"rememberMe"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	clientIP := getClientIP(c, s.isCDNEnabled(c.Request.Context()))
+	if ok, retry := allowRequest(c, s.authLimiter, "login2fa:ip:"+clientIP, 20, time.Minute); !ok {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "验证请求过于频繁，请稍后再试", "retryAfterSeconds": int(retry.Seconds()) + 1})
+		return
+	}
+	// 单个挑战的尝试次数有上限，但知道密码后可以反复创建新挑战，因此再按用户累计失败次数
+	userID, err := s.twoFactor.ChallengeUserID(c.Request.Context(), input.Challenge)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !s.reserveTwoFactorAttempt(c, userID) {
+		return
+	}
+	challenge, err := s.twoFactor.CompleteChallenge(c.Request.Context(), input.Challenge, input.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	s.clearTwoFactorAttempts(c, userID)
+	user, err := s.users.FindByID(c.Request.Context(), challenge.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if user.Status == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account disabled"})
+		return
+	}
+	method := challenge.Method
+	if method == "" {
+		method = session.MethodPassword
+	}
+	s.completeLogin(c, user, clientIP, input.RememberMe, session.WithTwoFactor(method))
+}
+
+// reserveTwoFactorAttempt 在校验验证码之前为用户计入一次两步验证尝试；
+// 频率过高或处于锁定中时写入响应并返回 false。
+func (s *Server) reserveTwoFactorAttempt(c *gin.Context, userID uint) bool {
+	if ok, retry := allowRequest(c, s.authLimiter, "2fa:user:"+strconv.FormatUint(uint64(userID), 10), 10, time.Minute); !ok {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "验证请求过于频繁，请稍后再试", "retryAfterSeconds": int(retry.Seconds()) + 1})
+		return false
+	}
+	if err := s.loginGuard.Reserve(c.Request.Context(), loginguard.TwoFactorKey(userID)); err != nil {
+		if !respondLoginLocked(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误"})
+		}
+		return false
+	}
+	return true
+}
+
+// clearTwoFactorAttempts 在验证码校验通过后清除用户的两步验证失败计数。
+func (s *Server) clearTwoFactorAttempts(c *gin.Context, userID uint) {
+	if err := s.loginGuard.Reset(c.Request.Context(), loginguard.TwoFactorKey(userID)); err != nil {
+		log.Printf("[两步验证] 清除失败次数失败: %v", err)
+	}
+}
+
+func (s *Server) handleTwoFactorStatus(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	status, err := s.twoFactor.Status(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": status})
+}
+
+func (s *Server) handleTwoFactorSetup(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	issuer := s.passkeySiteName(c)
+	enrollment, err := s.twoFactor.BeginEnrollment(c.Request.Context(), user, issuer)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": enrollment})
+}
+
+type twoFactorCodePayload struct {
+	Code string `json:"code" binding:"required"`
+}
+
+func (s *Server) handleTwoFactorConfirm(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var payload twoFactorCodePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	codes, err := s.twoFactor.ConfirmEnrollment(c.Request.Context(), user.ID, payload.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"recoveryCodes": codes}})
+}
+
+func (s *Server) handleTwoFactorDisable(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if s.twoFactor.Required(c.Request.Context(), user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "站点要求管理员账户启用两步验证，无法关闭"})
+		return
+	}
+	var payload twoFactorCodePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.reserveTwoFactorAttempt(c, user.ID) {
+		return
+	}
+	if err := s.twoFactor.Disable(c.Request.Context(), user.ID, payload.Code); err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	s.clearTwoFactorAttempts(c, user.ID)
+	c.JSON(http.StatusOK, gin.H{"data": "disabled"})
+}
+
+func (s *Server) handleTwoFactorRecoveryCodes(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var payload twoFactorCodePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.reserveTwoFactorAttempt(c, user.ID) {
+		return
+	}
+	codes, err := s.twoFactor.RegenerateRecoveryCodes(c.Request.Context(), user.ID, payload.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	s.clearTwoFactorAttempts(c, user.ID)
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"recoveryCodes": codes}})
+}
+
+// handleAdminResetTwoFactor 清除用户的两步验证。超级管理员不可被重置，
+// 不受角色限制的管理员只能由同样不受限的管理员重置。
+func (s *Server) handleAdminResetTwoFactor(c *gin.Context) {
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing user"})
+		return
+	}
+	id, err := parseRouteUserID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	target, err := s.users.FindByID(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if target.IsSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": users.ErrSuperAdminImmutable.Error()})
+		return
+	}
+	if err := users.GuardFullAdminTarget(actor, target); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.twoFactor.Reset(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": "reset"})
+}
+
+// requireAdminTwoFactor 在站点开启强制策略时，阻止未启用两步验证的管理员访问后台接口。
+func (s *Server) requireAdminTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := middleware.CurrentUser(c)
+		if !ok {
+			c.Next()
+			return
+		}
+		if s.twoFactor.Required(c.Request.Context(), user) && !s.twoFactor.Enabled(c.Request.Context(), user.ID) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "管理员账户必须先启用两步验证", "twoFactorSetupRequired": true})
+			return
+		}
+		c.Next()
+	}
+}
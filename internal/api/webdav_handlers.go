@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/webdav"
+
+	"skyimage/internal/data"
+	"skyimage/internal/davfs"
+	"skyimage/internal/files"
+	"skyimage/internal/middleware"
+)
+
+const webdavPrefix = "/dav"
+
+var webdavMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete,
+	"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK",
+}
+
+func (s *Server) registerWebDAVRoutes() {
+	// gin 的 Any 不包含 WebDAV 扩展方法，逐个注册
+	for _, method := range webdavMethods {
+		s.engine.Handle(method, webdavPrefix, s.webdavAuthMiddleware(), s.handleWebDAV)
+		s.engine.Handle(method, webdavPrefix+"/*path", s.webdavAuthMiddleware(), s.handleWebDAV)
+	}
+}
+
+func (s *Server) webdavAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.mu.RLock()
+		userService := s.users
+		s.mu.RUnlock()
+		middleware.BasicTokenAuth(userService, "SkyImage WebDAV", webdavTokenScope)(c)
+	}
+}
+
+// webdavTokenScope 将 WebDAV 方法映射到 API Token 权限，涉及相册的操作在处理器中额外校验。
+func webdavTokenScope(c *gin.Context) string {
+	switch c.Request.Method {
+	case http.MethodPut:
+		return data.ApiTokenScopeFilesUpload
+	case http.MethodDelete:
+		return data.ApiTokenScopeFilesDelete
+	case "MKCOL":
+		return data.ApiTokenScopeAlbumsWrite
+	case "MOVE", "COPY", "PROPPATCH":
+		return data.ApiTokenScopeFilesWrite
+	default:
+		return data.ApiTokenScopeFilesRead
+	}
+}
+
+func (s *Server) handleWebDAV(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	token, _ := middleware.CurrentAPIToken(c)
+	s.mu.RLock()
+	db := s.db
+	fileService := s.files
+	s.mu.RUnlock()
+
+	ctx := c.Request.Context()
+	name := c.Param("path")
+	fs := davfs.New(db, fileService, user.ID, token.HasScope(data.ApiTokenScopeFilesDelete))
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead:
+		// 图片内容按存储驱动读取，目录交给 webdav 处理
+		if node, err := fs.Resolve(ctx, name); err == nil && node.IsFile() {
+			if err := s.serveStoredFile(c, node.File()); err != nil {
+				c.Status(http.StatusNotFound)
+			}
+			return
+		}
+	case http.MethodPut:
+		s.handleWebDAVPut(c, fs, user, token, name)
+		return
+	case "COPY":
+		// 复制会产生重复图片，暂不支持
+		c.Status(http.StatusNotImplemented)
+		return
+	case http.MethodDelete, "MOVE":
+		if node, err := fs.Resolve(ctx, name); err == nil && !node.IsFile() && !token.HasScope(data.ApiTokenScopeAlbumsWrite) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient token scope", "requiredScope": data.ApiTokenScopeAlbumsWrite})
+			return
+		}
+	}
+
+	handler := &webdav.Handler{
+		Prefix:     webdavPrefix,
+		FileSystem: fs,
+		LockSystem: s.davLocks.For(user.ID),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, os.ErrPermission) {
+				log.Printf("[webdav] %s %s failed: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	handler.ServeHTTP(c.Writer, c.Request)
+}
+
+// handleWebDAVPut 通过 files.Service.Upload 保存图片：上传到相册目录时放入该相册，
+// 上传到日期目录时不放入相册（图片按上传时间归档，可能出现在其他月份目录）。
+// 同名图片会被替换，需要 files:delete 权限。
+func (s *Server) handleWebDAVPut(c *gin.Context, fs *davfs.FileSystem, user data.User, token data.ApiToken, name string) {
+	ctx := c.Request.Context()
+	parent, base, err := fs.ResolveParent(ctx, name)
+	if err != nil {
+		c.Status(http.StatusConflict)
+		return
+	}
+	albumID, ok := parent.UploadTarget()
+	if !ok || strings.HasPrefix(base, ".") {
+		// 拒绝 .DS_Store、._ 资源分叉等系统文件
+		c.Status(http.StatusForbidden)
+		return
+	}
+	existing, err := fs.Resolve(ctx, name)
+	replacing := err == nil
+	if replacing {
+		if !existing.IsFile() {
+			c.Status(http.StatusMethodNotAllowed)
+			return
+		}
+		if !token.HasScope(data.ApiTokenScopeFilesDelete) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient token scope", "requiredScope": data.ApiTokenScopeFilesDelete})
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, davfs.MaxUploadSize)
+	header, cleanup, err := files.NewFileHeader(base, c.GetHeader("Content-Type"), body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "文件过大"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取上传内容失败"})
+		return
+	}
+	defer cleanup()
+
+	record, err := s.files.Upload(ctx, user, header, files.UploadOptions{
+		Visibility:         s.defaultUploadVisibility(user),
+		AlbumID:            albumID,
+		AllowedStrategyIDs: token.StrategyIDList(),
+	})
+	if err != nil {
+		writeRateLimitHeaders(c, err)
+		c.JSON(statusCodeFromError(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+	if replacing {
+		if err := s.files.Delete(context.WithoutCancel(ctx), user.ID, existing.File().ID); err != nil {
+			log.Printf("[webdav] delete replaced file %d failed: %v", existing.File().ID, err)
+		}
+	}
+	if record.ChecksumMD5 != "" {
+		c.Header("ETag", `"`+record.ChecksumMD5+`"`)
+	}
+	if replacing {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.Status(http.StatusCreated)
+}
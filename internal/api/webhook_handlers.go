@@ -0,0 +1,274 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/auditlog"
+	"skyimage/internal/middleware"
+	"skyimage/internal/webhooks"
+)
+
+// webhookResponse 在创建或轮换密钥时附带一次性返回的签名密钥。
+type webhookResponse struct {
+	Webhook interface{} `json:"webhook"`
+	Secret  string      `json:"secret,omitempty"`
+}
+
+func (s *Server) handleAccountWebhooks(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	s.listWebhooks(c, webhooks.ScopeUser, user.ID)
+}
+
+func (s *Server) handleAccountCreateWebhook(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	s.createWebhook(c, webhooks.ScopeUser, user.ID)
+}
+
+func (s *Server) handleAccountUpdateWebhook(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	s.updateWebhook(c, webhooks.ScopeUser, user.ID)
+}
+
+func (s *Server) handleAccountDeleteWebhook(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	s.deleteWebhook(c, webhooks.ScopeUser, user.ID)
+}
+
+func (s *Server) handleAccountWebhookDeliveries(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	s.listWebhookDeliveries(c, webhooks.ScopeUser, user.ID)
+}
+
+func (s *Server) handleAccountRedeliverWebhook(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	s.redeliverWebhook(c, webhooks.ScopeUser, user.ID)
+}
+
+func (s *Server) handleAdminWebhooks(c *gin.Context) {
+	s.listWebhooks(c, webhooks.ScopeAdmin, 0)
+}
+
+func (s *Server) handleAdminCreateWebhook(c *gin.Context) {
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing user"})
+		return
+	}
+	s.createWebhook(c, webhooks.ScopeAdmin, actor.ID)
+}
+
+func (s *Server) handleAdminUpdateWebhook(c *gin.Context) {
+	s.updateWebhook(c, webhooks.ScopeAdmin, 0)
+}
+
+func (s *Server) handleAdminDeleteWebhook(c *gin.Context) {
+	s.deleteWebhook(c, webhooks.ScopeAdmin, 0)
+}
+
+func (s *Server) handleAdminWebhookDeliveries(c *gin.Context) {
+	s.listWebhookDeliveries(c, webhooks.ScopeAdmin, 0)
+}
+
+func (s *Server) handleAdminRedeliverWebhook(c *gin.Context) {
+	s.redeliverWebhook(c, webhooks.ScopeAdmin, 0)
+}
+
+func (s *Server) listWebhooks(c *gin.Context, scope string, userID uint) {
+	items, err := s.webhooks.List(c.Request.Context(), scope, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	events := webhooks.UserEvents()
+	if scope == webhooks.ScopeAdmin {
+		events = webhooks.AllEvents()
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"items": items, "events": events}})
+}
+
+func (s *Server) createWebhook(c *gin.Context, scope string, userID uint) {
+	if s.webhookDemoBlocked(c) {
+		return
+	}
+	var payload webhooks.Input
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	item, secret, err := s.webhooks.Create(c.Request.Context(), scope, userID, payload)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": localizeWebhookError(err)})
+		return
+	}
+	if scope == webhooks.ScopeAdmin {
+		auditTarget(c, "", "", auditlog.TargetID(item.ID))
+		auditChange(c, nil, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": webhookResponse{Webhook: item, Secret: secret}})
+}
+
+func (s *Server) updateWebhook(c *gin.Context, scope string, userID uint) {
+	id, ok := parseWebhookID(c, "id")
+	if !ok {
+		return
+	}
+	if s.webhookDemoBlocked(c) {
+		return
+	}
+	var payload webhooks.Input
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	previous, _ := s.webhooks.Get(c.Request.Context(), scope, userID, id)
+	item, secret, err := s.webhooks.Update(c.Request.Context(), scope, userID, id, payload)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": localizeWebhookError(err)})
+		return
+	}
+	if scope == webhooks.ScopeAdmin {
+		auditChange(c, previous, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": webhookResponse{Webhook: item, Secret: secret}})
+}
+
+func (s *Server) deleteWebhook(c *gin.Context, scope string, userID uint) {
+	id, ok := parseWebhookID(c, "id")
+	if !ok {
+		return
+	}
+	previous, _ := s.webhooks.Get(c.Request.Context(), scope, userID, id)
+	if err := s.webhooks.Delete(c.Request.Context(), scope, userID, id); err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": localizeWebhookError(err)})
+		return
+	}
+	if scope == webhooks.ScopeAdmin {
+		auditChange(c, previous, nil)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": "deleted"})
+}
+
+func (s *Server) listWebhookDeliveries(c *gin.Context, scope string, userID uint) {
+	id, ok := parseWebhookID(c, "id")
+	if !ok {
+		return
+	}
+	if _, err := s.webhooks.Get(c.Request.Context(), scope, userID, id); err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": localizeWebhookError(err)})
+		return
+	}
+	limit, offset := parsePagination(c, 20, 100)
+	items, total, err := s.webhooks.ListDeliveries(c.Request.Context(), id, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if scope == webhooks.ScopeUser {
+		// 用户级推送不回显对端响应内容（包括修复前已记录的历史数据）
+		for i := range items {
+			items[i].ResponseBody = ""
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"items": items, "total": total}})
+}
+
+func (s *Server) redeliverWebhook(c *gin.Context, scope string, userID uint) {
+	id, ok := parseWebhookID(c, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := parseWebhookID(c, "deliveryId")
+	if !ok {
+		return
+	}
+	if _, err := s.webhooks.Get(c.Request.Context(), scope, userID, id); err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": localizeWebhookError(err)})
+		return
+	}
+	delivery, err := s.webhooks.Redeliver(c.Request.Context(), id, deliveryID)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"error": localizeWebhookError(err)})
+		return
+	}
+	if scope == webhooks.ScopeAdmin {
+		auditTarget(c, "", "", auditlog.TargetID(id))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": delivery})
+}
+
+// webhookDemoBlocked 演示站禁止配置外部推送地址。
+func (s *Server) webhookDemoBlocked(c *gin.Context) bool {
+	s.mu.RLock()
+	demoMode := s.cfg.DemoMode
+	s.mu.RUnlock()
+	if demoMode {
+		c.JSON(http.StatusForbidden, gin.H{"error": "演示站禁止配置 Webhook"})
+		return true
+	}
+	return false
+}
+
+func parseWebhookID(c *gin.Context, param string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, webhooks.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, webhooks.ErrInvalidURL), errors.Is(err, webhooks.ErrInvalidEvents):
+		return http.StatusBadRequest
+	case errors.Is(err, webhooks.ErrTooMany):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func localizeWebhookError(err error) string {
+	switch {
+	case errors.Is(err, webhooks.ErrNotFound):
+		return "Webhook 不存在"
+	case errors.Is(err, webhooks.ErrInvalidURL):
+		return "推送地址无效，仅支持公网 http/https 地址"
+	case errors.Is(err, webhooks.ErrInvalidEvents):
+		return "请选择有效的订阅事件"
+	case errors.Is(err, webhooks.ErrTooMany):
+		return "Webhook 数量已达上限"
+	default:
+		return err.Error()
+	}
+}
@@ -0,0 +1,309 @@
+// Package auditlog 记录后台管理操作（操作者、动作、目标、来源 IP 与脱敏后的字段变更）。
+package auditlog
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+const (
+	// ConfigRetentionDays 审计日志保留天数，0 表示永久保留
+	ConfigRetentionDays  = "audit.retention_days"
+	DefaultRetentionDays = 180
+	MaxRetentionDays     = 3650
+
+	// maxValueLength 单个字段在 diff 中保留的最大长度
+	maxValueLength = 512
+)
+
+// SettingsReader exposes the admin settings store (implemented by *admin.Service).
+type SettingsReader interface {
+	GetSettings(ctx context.Context) (map[string]string, error)
+}
+
+// Change 是单个字段的变更，新增字段 Before 为空，删除字段 After 为空。
+type Change struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// Entry 描述一次需要写入审计日志的管理操作。
+type Entry struct {
+	ActorID    uint
+	ActorEmail string
+	Action     string
+	TargetType string
+	TargetID   string
+	Method     string
+	Path       string
+	Status     int
+	IP         string
+	UserAgent  string
+	Changes    map[string]Change
+}
+
+// Filter 是列表查询条件，零值字段不参与过滤。
+type Filter struct {
+	ActorID    uint
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+	Limit      int
+	Offset     int
+}
+
+type Service struct {
+	mu          sync.Mutex
+	db          *gorm.DB
+	settings    SettingsReader
+	stopCleanup chan struct{}
+}
+
+func New(db *gorm.DB, settings SettingsReader) *Service {
+	s := &Service{
+		db:          db,
+		settings:    settings,
+		stopCleanup: make(chan struct{}),
+	}
+	go s.cleanupLoop()
+	return s
+}
+
+// SetDB updates the database handle after a runtime database switch.
+func (s *Service) SetDB(db *gorm.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db = db
+}
+
+// SetSettings updates the settings reader after a runtime database switch.
+func (s *Service) SetSettings(settings SettingsReader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = settings
+}
+
+func (s *Service) handle() (*gorm.DB, SettingsReader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db, s.settings
+}
+
+// Record 追加一条审计日志。日志只会被保留期清理，不提供修改接口。
+func (s *Service) Record(ctx context.Context, entry Entry) error {
+	if s == nil {
+		return nil
+	}
+	db, _ := s.handle()
+	if db == nil {
+		return gorm.ErrInvalidDB
+	}
+	record := data.AdminAuditLog{
+		ActorID:    entry.ActorID,
+		ActorEmail: truncate(entry.ActorEmail, 255),
+		Action:     truncate(entry.Action, 64),
+		TargetType: truncate(entry.TargetType, 32),
+		TargetID:   truncate(entry.TargetID, 64),
+		Method:     truncate(entry.Method, 8),
+		Path:       truncate(entry.Path, 255),
+		Status:     entry.Status,
+		IP:         truncate(entry.IP, 64),
+		UserAgent:  truncate(entry.UserAgent, 512),
+	}
+	if len(entry.Changes) > 0 {
+		raw, err := json.Marshal(entry.Changes)
+		if err != nil {
+			return err
+		}
+		record.Changes = datatypes.JSON(raw)
+	}
+	return db.WithContext(ctx).Create(&record).Error
+}
+
+// List 按时间倒序返回符合条件的审计日志。
+func (s *Service) List(ctx context.Context, filter Filter) ([]data.AdminAuditLog, int64, error) {
+	db, _ := s.handle()
+	if db == nil {
+		return nil, 0, gorm.ErrInvalidDB
+	}
+	query := db.WithContext(ctx).Model(&data.AdminAuditLog{})
+	if filter.ActorID > 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if action := strings.TrimSpace(filter.Action); action != "" {
+		// 以 "." 结尾时按前缀匹配，例如 users. 匹配所有用户相关操作
+		if strings.HasSuffix(action, ".") {
+			query = query.Where("action LIKE ? ESCAPE '!'", data.EscapeLike(action)+"%")
+		} else {
+			query = query.Where("action = ?", action)
+		}
+	}
+	if targetType := strings.TrimSpace(filter.TargetType); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID := strings.TrimSpace(filter.TargetID); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var items []data.AdminAuditLog
+	if err := query.Order("created_at desc, id desc").Limit(filter.Limit).Offset(filter.Offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// Prune 删除超过保留期的日志，返回删除条数。
+func (s *Service) Prune(ctx context.Context) (int64, error) {
+	db, settings := s.handle()
+	if db == nil {
+		return 0, nil
+	}
+	days := DefaultRetentionDays
+	if settings != nil {
+		values, err := settings.GetSettings(ctx)
+		if err != nil {
+			return 0, err
+		}
+		days = NormalizeRetentionDays(values[ConfigRetentionDays])
+	}
+	if days == 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+	result := db.WithContext(ctx).Delete(&data.AdminAuditLog{}, "created_at < ?", cutoff)
+	return result.RowsAffected, result.Error
+}
+
+// NormalizeRetentionDays 解析保留天数配置；未配置或非法时返回默认值。
+func NormalizeRetentionDays(raw string) int {
+	days, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return DefaultRetentionDays
+	}
+	return NormalizeRetentionDaysValue(days)
+}
+
+// NormalizeRetentionDaysValue 将保留天数限制在 [0, MaxRetentionDays]，负数视为默认值。
+func NormalizeRetentionDaysValue(days int) int {
+	if days < 0 {
+		return DefaultRetentionDays
+	}
+	return min(days, MaxRetentionDays)
+}
+
+// Flatten 将任意值按 JSON 展开为 "a.b.c" -> 值 的扁平映射，便于逐字段比较。
+func Flatten(value interface{}) map[string]string {
+	out := make(map[string]string)
+	if value == nil {
+		return out
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return out
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return out
+	}
+	flattenInto(out, "", decoded)
+	return out
+}
+
+func flattenInto(out map[string]string, prefix string, value interface{}) {
+	if nested, ok := value.(map[string]interface{}); ok {
+		for key, item := range nested {
+			next := key
+			if prefix != "" {
+				next = prefix + "." + key
+			}
+			flattenInto(out, next, item)
+		}
+		return
+	}
+	if value == nil && prefix == "" {
+		return
+	}
+	if prefix == "" {
+		prefix = "value"
+	}
+	switch typed := value.(type) {
+	case nil:
+		out[prefix] = ""
+	case string:
+		out[prefix] = typed
+	default:
+		raw, _ := json.Marshal(typed)
+		out[prefix] = string(raw)
+	}
+}
+
+// Diff 返回两个扁平映射之间发生变化的字段。
+func Diff(before, after map[string]string) map[string]Change {
+	out := make(map[string]Change)
+	for key, value := range before {
+		if next := after[key]; next != value {
+			out[key] = Change{Before: truncate(value, maxValueLength), After: truncate(after[key], maxValueLength)}
+		}
+	}
+	for key, value := range after {
+		if _, ok := before[key]; !ok && value != "" {
+			out[key] = Change{After: truncate(value, maxValueLength)}
+		}
+	}
+	return out
+}
+
+// TargetID formats a numeric target identifier.
+func TargetID(id uint) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func (s *Service) cleanupLoop() {
+	ticker := time.NewTicker(6 * time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCleanup:
+			return
+		case <-ticker.C:
+			if removed, err := s.Prune(context.Background()); err != nil {
+				log.Printf("[auditlog] prune failed: %v", err)
+			} else if removed > 0 {
+				log.Printf("[auditlog] pruned %d entries", removed)
+			}
+		}
+	}
+}
+
+func truncate(value string, limit int) string {
+	value = strings.TrimSpace(value)
+	if utf8.RuneCountInString(value) <= limit {
+		return value
+	}
+	return string([]rune(value)[:limit])
+}
@@ -0,0 +1,120 @@
+package auditlog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+type staticSettings map[string]string
+
+func (s staticSettings) GetSettings(context.Context) (map[string]string, error) {
+	return s, nil
+}
+
+func newTestService(t *testing.T, settings SettingsReader) (*Service, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&data.AdminAuditLog{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return New(db, settings), db
+}
+
+func TestFlattenAndDiff(t *testing.T) {
+	before := Flatten(map[string]interface{}{
+		"name":    "s3",
+		"configs": map[string]interface{}{"bucket": "a", "secret_key": "old"},
+	})
+	after := Flatten(map[string]interface{}{
+		"name":    "s3",
+		"configs": map[string]interface{}{"bucket": "b", "secret_key": "old", "region": "us"},
+	})
+	changes := Diff(before, after)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %v", changes)
+	}
+	if got := changes["configs.bucket"]; got.Before != "a" || got.After != "b" {
+		t.Fatalf("unexpected bucket change: %+v", got)
+	}
+	if got := changes["configs.region"]; got.Before != "" || got.After != "us" {
+		t.Fatalf("unexpected region change: %+v", got)
+	}
+	if removed := Diff(Flatten(map[string]int{"status": 1}), Flatten(nil)); removed["status"].Before != "1" {
+		t.Fatalf("expected removed field, got %v", removed)
+	}
+}
+
+func TestListFiltersAndPrune(t *testing.T) {
+	s, db := newTestService(t, staticSettings{ConfigRetentionDays: "30"})
+	ctx := context.Background()
+	entries := []Entry{
+		{ActorID: 1000000000000001, Action: "users.status.update", TargetType: "users", TargetID: "1000000000000002"},
+		{ActorID: 1000000000000001, Action: "strategies.update", TargetType: "strategies", TargetID: "3",
+			Changes: map[string]Change{"configs.bucket": {Before: "a", After: "b"}}},
+		{ActorID: 1000000000000003, Action: "users.delete", TargetType: "users", TargetID: "1000000000000004"},
+	}
+	for _, entry := range entries {
+		if err := s.Record(ctx, entry); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+
+	items, total, err := s.List(ctx, Filter{Action: "users.", Limit: 10})
+	if err != nil || total != 2 || len(items) != 2 {
+		t.Fatalf("expected 2 user entries, got %d (%v)", total, err)
+	}
+	if _, total, err = s.List(ctx, Filter{Action: "%.", Limit: 10}); err != nil || total != 0 {
+		t.Fatalf("expected wildcard prefix to match literally, got %d (%v)", total, err)
+	}
+	items, total, err = s.List(ctx, Filter{ActorID: 1000000000000001, TargetType: "strategies", Limit: 10})
+	if err != nil || total != 1 || len(items[0].Changes) == 0 {
+		t.Fatalf("expected strategy entry with changes, got %d (%v)", total, err)
+	}
+
+	old := time.Now().Add(-31 * 24 * time.Hour)
+	if err := db.Model(&data.AdminAuditLog{}).Where("action = ?", "users.delete").Update("created_at", old).Error; err != nil {
+		t.Fatalf("backdate entry: %v", err)
+	}
+	removed, err := s.Prune(ctx)
+	if err != nil || removed != 1 {
+		t.Fatalf("expected 1 pruned entry, got %d (%v)", removed, err)
+	}
+}
+
+func TestTruncateKeepsRunesIntact(t *testing.T) {
+	if got := truncate(" 管理员操作 ", 3); got != "管理员" {
+		t.Fatalf("expected rune-based truncation, got %q", got)
+	}
+}
+
+func TestPruneKeepsForeverWhenRetentionIsZero(t *testing.T) {
+	s, db := newTestService(t, staticSettings{ConfigRetentionDays: "0"})
+	ctx := context.Background()
+	if err := s.Record(ctx, Entry{ActorID: 1000000000000001, Action: "groups.delete"}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if err := db.Model(&data.AdminAuditLog{}).Where("1 = 1").Update("created_at", time.Now().AddDate(-20, 0, 0)).Error; err != nil {
+		t.Fatalf("backdate entry: %v", err)
+	}
+	if removed, err := s.Prune(ctx); err != nil || removed != 0 {
+		t.Fatalf("expected nothing pruned, got %d (%v)", removed, err)
+	}
+}
+
+func TestNormalizeRetentionDays(t *testing.T) {
+	cases := map[string]int{"": DefaultRetentionDays, "abc": DefaultRetentionDays, "-1": DefaultRetentionDays, "0": 0, "90": 90, "99999": MaxRetentionDays}
+	for raw, want := range cases {
+		if got := NormalizeRetentionDays(raw); got != want {
+			t.Fatalf("NormalizeRetentionDays(%q) = %d, want %d", raw, got, want)
+		}
+	}
+}
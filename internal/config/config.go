@@ -1,7 +1,12 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -27,6 +32,16 @@ type Config struct {
 	CORSAllowedOrigins []string `mapstructure:"CORS_ALLOWED_ORIGINS"`
 	TrustedProxies     []string `mapstructure:"TRUSTED_PROXIES"`
 	DemoMode           bool     `mapstructure:"DEMO_MODE"`
+	// 限流计数存储：memory（单实例）、database（多实例共享）；留空时 SQLite 使用 memory，其它数据库使用 database
+	RateLimitStore string `mapstructure:"RATE_LIMIT_STORE"`
+	// Prometheus 指标：METRICS_ENABLED 在主端口提供 /metrics；设置 METRICS_ADDR 时改为只在该地址提供。
+	// METRICS_TOKEN 非空时要求 Authorization: Bearer <token>
+	MetricsEnabled bool   `mapstructure:"METRICS_ENABLED"`
+	MetricsAddr    string `mapstructure:"METRICS_ADDR"`
+	MetricsToken   string `mapstructure:"METRICS_TOKEN"`
+	// SECRET_KEY 是不保存在数据库中的服务端密钥，用于派生 S3 凭据等；留空时自动生成并写入 .env。
+	// 多实例部署时所有实例必须使用相同的值
+	SecretKey string `mapstructure:"SECRET_KEY"`
 	// 演示站配置
 	SiteName         string `mapstructure:"SITE_NAME"`
 	AdminUsername     string `mapstructure:"ADMIN_USERNAME"`
@@ -67,6 +82,11 @@ func Load() (Config, error) {
 	viper.BindEnv("CORS_ALLOWED_ORIGINS")
 	viper.BindEnv("TRUSTED_PROXIES")
 	viper.BindEnv("DEMO_MODE")
+	viper.BindEnv("RATE_LIMIT_STORE")
+	viper.BindEnv("METRICS_ENABLED")
+	viper.BindEnv("METRICS_ADDR")
+	viper.BindEnv("METRICS_TOKEN")
+	viper.BindEnv("SECRET_KEY")
 	// 演示站配置
 	viper.BindEnv("SITE_NAME")
 	viper.BindEnv("ADMIN_USERNAME")
@@ -90,10 +110,37 @@ func Load() (Config, error) {
 	if err := ensurePaths(&cfg); err != nil {
 		return Config{}, err
 	}
+	if err := ensureSecretKey(&cfg); err != nil {
+		return Config{}, err
+	}
 
 	return cfg, nil
 }
 
+// ensureSecretKey 在未配置 SECRET_KEY 时生成一个并写入 .env，保证重启后派生的凭据不变。
+func ensureSecretKey(cfg *Config) error {
+	cfg.SecretKey = strings.TrimSpace(cfg.SecretKey)
+	if cfg.SecretKey != "" {
+		return nil
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("generate secret key: %w", err)
+	}
+	cfg.SecretKey = hex.EncodeToString(buf)
+	if err := saveEnvValues(map[string]string{"SECRET_KEY": cfg.SecretKey}); err != nil {
+		log.Printf("[config] 无法写入 SECRET_KEY 到 .env，重启后派生的凭据将失效: %v", err)
+	}
+	return nil
+}
+
+// DeriveKey 按用途从 SECRET_KEY 派生独立的子密钥，避免不同功能共用同一个密钥。
+func (c Config) DeriveKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(c.SecretKey))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
 func MustLoad() Config {
 	cfg, err := Load()
 	if err != nil {
@@ -117,6 +164,11 @@ func setDefaults() {
 	viper.SetDefault("CORS_ALLOWED_ORIGINS", "")
 	viper.SetDefault("TRUSTED_PROXIES", "")
 	viper.SetDefault("DEMO_MODE", false)
+	viper.SetDefault("RATE_LIMIT_STORE", "")
+	viper.SetDefault("METRICS_ENABLED", false)
+	viper.SetDefault("METRICS_ADDR", "")
+	viper.SetDefault("METRICS_TOKEN", "")
+	viper.SetDefault("SECRET_KEY", "")
 	// 演示站配置默认值
 	viper.SetDefault("SITE_NAME", "SkyImage Demo")
 	viper.SetDefault("ADMIN_USERNAME", "demo_admin")
@@ -159,13 +211,7 @@ func ensurePaths(cfg *Config) error {
 // SaveDatabaseEnv persists database connection settings into the local .env file.
 // Empty values are written as empty strings so switching DB types clears stale fields.
 func SaveDatabaseEnv(cfg Config) error {
-	envPath := ".env"
-	content := ""
-	if existingContent, err := os.ReadFile(envPath); err == nil {
-		content = string(existingContent)
-	}
-
-	updates := map[string]string{
+	return saveEnvValues(map[string]string{
 		"DATABASE_TYPE":     strings.TrimSpace(cfg.DatabaseType),
 		"DATABASE_PATH":     cfg.DatabasePath,
 		"DATABASE_HOST":     cfg.DatabaseHost,
@@ -173,6 +219,15 @@ func SaveDatabaseEnv(cfg Config) error {
 		"DATABASE_NAME":     cfg.DatabaseName,
 		"DATABASE_USER":     cfg.DatabaseUser,
 		"DATABASE_PASSWORD": cfg.DatabasePassword,
+	})
+}
+
+// saveEnvValues 更新或追加 .env 中的键值，保留其它内容。
+func saveEnvValues(updates map[string]string) error {
+	envPath := ".env"
+	content := ""
+	if existingContent, err := os.ReadFile(envPath); err == nil {
+		content = string(existingContent)
 	}
 
 	for key, value := range updates {
@@ -0,0 +1,29 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// AdminAuditLog is one append-only record of an admin mutation.
+// Changes holds a redacted field-level before/after diff when the handler provides one.
+type AdminAuditLog struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	ActorID    uint           `gorm:"index;not null" json:"actorId,string"`
+	ActorEmail string         `gorm:"size:255" json:"actorEmail"`
+	Action     string         `gorm:"size:64;index" json:"action"`
+	TargetType string         `gorm:"size:32;index:idx_admin_audit_target" json:"targetType"`
+	TargetID   string         `gorm:"size:64;index:idx_admin_audit_target" json:"targetId"`
+	Method     string         `gorm:"size:8" json:"method"`
+	Path       string         `gorm:"size:255" json:"path"`
+	Status     int            `json:"status"`
+	IP         string         `gorm:"size:64" json:"ip"`
+	UserAgent  string         `gorm:"size:512" json:"userAgent"`
+	Changes    datatypes.JSON `gorm:"type:json" json:"changes,omitempty"`
+	CreatedAt  time.Time      `gorm:"index" json:"createdAt"`
+}
+
+func (AdminAuditLog) TableName() string {
+	return "admin_audit_logs"
+}
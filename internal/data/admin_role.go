@@ -0,0 +1,198 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 后台权限。超级管理员与未分配角色的管理员拥有全部权限（兼容旧版）；
+// 分配了角色的管理员只拥有角色包含的权限。
+const (
+	AdminPermTickets    = "tickets"
+	AdminPermModeration = "moderation"
+	AdminPermUsers      = "users"
+	AdminPermGroups     = "groups"
+	AdminPermStrategies = "strategies"
+	AdminPermSystem     = "system"
+	AdminPermShop       = "shop"
+	AdminPermRedeem     = "redeem"
+	AdminPermRoles      = "roles"
+)
+
+// AllAdminPermissions 返回全部后台权限。
+func AllAdminPermissions() []string {
+	return []string{
+		AdminPermTickets,
+		AdminPermModeration,
+		AdminPermUsers,
+		AdminPermGroups,
+		AdminPermStrategies,
+		AdminPermSystem,
+		AdminPermShop,
+		AdminPermRedeem,
+		AdminPermRoles,
+	}
+}
+
+// AdminRole is a named set of admin permissions that can be assigned to users.
+type AdminRole struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:64;uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"size:255;default:''" json:"description"`
+	Permissions string    `gorm:"size:512;default:''" json:"-"`
+	BuiltIn     bool      `gorm:"default:false" json:"builtIn"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+func (AdminRole) TableName() string {
+	return "admin_roles"
+}
+
+// PermissionList 返回角色包含的权限。
+func (r AdminRole) PermissionList() []string {
+	out := make([]string, 0)
+	for _, part := range strings.Split(r.Permissions, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// NormalizeAdminPermissions 去重、排序并校验权限名称。
+func NormalizeAdminPermissions(items []string) ([]string, error) {
+	known := make(map[string]struct{}, len(AllAdminPermissions()))
+	for _, perm := range AllAdminPermissions() {
+		known[perm] = struct{}{}
+	}
+	seen := make(map[string]struct{}, len(items))
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		perm := strings.ToLower(strings.TrimSpace(item))
+		if perm == "" {
+			continue
+		}
+		if _, ok := known[perm]; !ok {
+			return nil, fmt.Errorf("未知的权限: %s", item)
+		}
+		if _, dup := seen[perm]; dup {
+			continue
+		}
+		seen[perm] = struct{}{}
+		out = append(out, perm)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// HasAdminPermission 判断用户是否拥有指定后台权限。
+// 分配了角色的用户依赖 Permissions 字段（由 users 服务加载用户时填充）。
+func (u User) HasAdminPermission(perm string) bool {
+	if u.IsSuperAdmin {
+		return true
+	}
+	if !u.IsAdmin {
+		return false
+	}
+	if u.AdminRoleID == nil {
+		return true
+	}
+	for _, item := range u.Permissions {
+		if item == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFullAdmin 判断用户是否拥有不受角色限制的后台权限（超级管理员或未分配角色的管理员）。
+func (u User) HasFullAdmin() bool {
+	return u.IsSuperAdmin || (u.IsAdmin && u.AdminRoleID == nil)
+}
+
+// CanGrantAdminPermissions 判断用户能否授出指定权限：完整管理员不受限制，
+// 分配了角色的管理员只能授出自己已拥有的权限。
+func (u User) CanGrantAdminPermissions(perms []string) bool {
+	if u.HasFullAdmin() {
+		return true
+	}
+	if !u.IsAdmin {
+		return false
+	}
+	for _, perm := range perms {
+		if !u.HasAdminPermission(perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// EffectivePermissions 返回用户实际拥有的后台权限；role 为用户分配的角色（可为 nil）。
+func (u User) EffectivePermissions(role *AdminRole) []string {
+	switch {
+	case u.IsSuperAdmin, u.IsAdmin && u.AdminRoleID == nil:
+		return AllAdminPermissions()
+	case u.IsAdmin && role != nil:
+		return role.PermissionList()
+	default:
+		return nil
+	}
+}
+
+// UserIDsWithAdminPermission 返回拥有指定权限的启用状态的管理员 ID。
+func UserIDsWithAdminPermission(ctx context.Context, db *gorm.DB, perm string) ([]uint, error) {
+	var roles []AdminRole
+	if err := db.WithContext(ctx).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	roleIDs := make([]uint, 0, len(roles))
+	for _, role := range roles {
+		for _, item := range role.PermissionList() {
+			if item == perm {
+				roleIDs = append(roleIDs, role.ID)
+				break
+			}
+		}
+	}
+	query := db.WithContext(ctx).Model(&User{}).Where("status = ?", 1)
+	if len(roleIDs) > 0 {
+		query = query.Where("is_super_admin = ? OR (is_adminer = ? AND (admin_role_id IS NULL OR admin_role_id IN ?))", true, true, roleIDs)
+	} else {
+		query = query.Where("is_super_admin = ? OR (is_adminer = ? AND admin_role_id IS NULL)", true, true)
+	}
+	var ids []uint
+	err := query.Pluck("id", &ids).Error
+	return ids, err
+}
+
+// builtinAdminRoles 是首次启动时创建的默认角色。
+var builtinAdminRoles = []AdminRole{
+	{Name: "moderator", Description: "内容审核：图片管理、审核队列与哈希黑名单", Permissions: AdminPermModeration},
+	{Name: "support", Description: "客服：处理工单", Permissions: AdminPermTickets},
+	{Name: "billing", Description: "财务：商店商品、订单与兑换码", Permissions: AdminPermRedeem + "," + AdminPermShop},
+}
+
+// EnsureBuiltinAdminRoles 创建缺失的默认角色，已存在的角色不会被覆盖。
+// 不在 PrepareSchema 中调用，以免跨数据库迁移时目标库被视为非空。
+func EnsureBuiltinAdminRoles(ctx context.Context, db *gorm.DB) error {
+	for _, role := range builtinAdminRoles {
+		var count int64
+		if err := db.WithContext(ctx).Model(&AdminRole{}).Where("name = ?", role.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		role.BuiltIn = true
+		if err := db.WithContext(ctx).Create(&role).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package data
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// API Token 权限范围。旧版 Token 的 scopes 为空，等同于 ApiTokenScopeAll。
+const (
+	ApiTokenScopeAll = "*"
+
+	ApiTokenScopeFilesRead   = "files:read"
+	ApiTokenScopeFilesUpload = "files:upload"
+	ApiTokenScopeFilesWrite  = "files:write"
+	ApiTokenScopeFilesDelete = "files:delete"
+	ApiTokenScopeAlbumsRead  = "albums:read"
+	ApiTokenScopeAlbumsWrite = "albums:write"
+	ApiTokenScopeAccountRead = "account:read"
+	ApiTokenScopeAccountEdit = "account:write"
+	ApiTokenScopeTokens      = "tokens:manage"
+	ApiTokenScopeAdminRead   = "admin:read"
+	ApiTokenScopeAdminWrite  = "admin:write"
+)
+
+// ApiTokenScopes lists every concrete scope accepted when creating a token.
+var ApiTokenScopes = []string{
+	ApiTokenScopeFilesRead,
+	ApiTokenScopeFilesUpload,
+	ApiTokenScopeFilesWrite,
+	ApiTokenScopeFilesDelete,
+	ApiTokenScopeAlbumsRead,
+	ApiTokenScopeAlbumsWrite,
+	ApiTokenScopeAccountRead,
+	ApiTokenScopeAccountEdit,
+	ApiTokenScopeTokens,
+	ApiTokenScopeAdminRead,
+	ApiTokenScopeAdminWrite,
+}
+
+// NormalizeApiTokenScopes validates scopes and supports "<resource>:*" wildcards.
+// An empty list or one containing "*" means full access.
+func NormalizeApiTokenScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]struct{})
+	out := make([]string, 0, len(scopes))
+	for _, raw := range scopes {
+		scope := strings.ToLower(strings.TrimSpace(raw))
+		if scope == "" {
+			continue
+		}
+		if scope == ApiTokenScopeAll {
+			return []string{ApiTokenScopeAll}, nil
+		}
+		if !isKnownApiTokenScope(scope) {
+			return nil, fmt.Errorf("未知的 Token 权限: %s", raw)
+		}
+		if _, ok := seen[scope]; ok {
+			continue
+		}
+		seen[scope] = struct{}{}
+		out = append(out, scope)
+	}
+	if len(out) == 0 {
+		return []string{ApiTokenScopeAll}, nil
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func isKnownApiTokenScope(scope string) bool {
+	if resource, ok := strings.CutSuffix(scope, ":*"); ok {
+		for _, known := range ApiTokenScopes {
+			if strings.HasPrefix(known, resource+":") {
+				return true
+			}
+		}
+		return false
+	}
+	for _, known := range ApiTokenScopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeApiTokenCIDRs validates CIDR ranges; bare IPs are converted to single-host ranges.
+func NormalizeApiTokenCIDRs(values []string) ([]string, error) {
+	out := make([]string, 0, len(values))
+	seen := make(map[string]struct{})
+	for _, raw := range values {
+		value := strings.TrimSpace(raw)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的 IP 地址: %s", raw)
+			}
+			if ip.To4() != nil {
+				value = ip.String() + "/32"
+			} else {
+				value = ip.String() + "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 CIDR: %s", raw)
+		}
+		normalized := network.String()
+		if _, ok := seen[normalized]; ok {
+			continue
+		}
+		seen[normalized] = struct{}{}
+		out = append(out, normalized)
+	}
+	return out, nil
+}
+
+func splitApiTokenList(raw string) []string {
+	parts := strings.Split(raw, ",")
+	out := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// JoinApiTokenList serialises scopes / CIDRs / strategy IDs for storage.
+func JoinApiTokenList(values []string) string {
+	return strings.Join(values, ",")
+}
+
+// JoinApiTokenStrategyIDs serialises strategy restrictions for storage.
+func JoinApiTokenStrategyIDs(ids []uint) string {
+	parts := make([]string, 0, len(ids))
+	seen := make(map[uint]struct{})
+	for _, id := range ids {
+		if _, ok := seen[id]; ok || id == 0 {
+			continue
+		}
+		seen[id] = struct{}{}
+		parts = append(parts, strconv.FormatUint(uint64(id), 10))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (t ApiToken) ScopeList() []string {
+	scopes := splitApiTokenList(t.Scopes)
+	if len(scopes) == 0 {
+		return []string{ApiTokenScopeAll}
+	}
+	return scopes
+}
+
+// FullAccess reports whether the token is unrestricted by scope.
+func (t ApiToken) FullAccess() bool {
+	for _, scope := range t.ScopeList() {
+		if scope == ApiTokenScopeAll {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token grants scope. An empty scope only matches full-access tokens.
+func (t ApiToken) HasScope(scope string) bool {
+	if t.FullAccess() {
+		return true
+	}
+	scope = strings.ToLower(strings.TrimSpace(scope))
+	if scope == "" {
+		return false
+	}
+	resource, _, _ := strings.Cut(scope, ":")
+	for _, granted := range t.ScopeList() {
+		if granted == scope || granted == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (t ApiToken) StrategyIDList() []uint {
+	parts := splitApiTokenList(t.StrategyIDs)
+	ids := make([]uint, 0, len(parts))
+	for _, part := range parts {
+		if id, err := strconv.ParseUint(part, 10, 64); err == nil && id > 0 {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+func (t ApiToken) CIDRList() []string {
+	return splitApiTokenList(t.AllowedCIDRs)
+}
+
+// AllowsIP reports whether the client IP falls into one of the configured ranges.
+// Tokens without IP restrictions accept any address.
+func (t ApiToken) AllowsIP(clientIP string) bool {
+	cidrs := t.CIDRList()
+	if len(cidrs) == 0 {
+		return true
+	}
+	ip := net.ParseIP(strings.TrimSpace(clientIP))
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package data
+
+import "testing"
+
+func TestApiTokenScopes(t *testing.T) {
+	scopes, err := NormalizeApiTokenScopes([]string{" files:upload", "FILES:read", "albums:*", "files:upload"})
+	if err != nil {
+		t.Fatalf("NormalizeApiTokenScopes failed: %v", err)
+	}
+	token := ApiToken{Scopes: JoinApiTokenList(scopes)}
+	if token.FullAccess() {
+		t.Fatal("expected restricted token")
+	}
+	for _, scope := range []string{ApiTokenScopeFilesUpload, ApiTokenScopeFilesRead, ApiTokenScopeAlbumsRead, ApiTokenScopeAlbumsWrite} {
+		if !token.HasScope(scope) {
+			t.Fatalf("expected scope %s to be granted", scope)
+		}
+	}
+	for _, scope := range []string{ApiTokenScopeFilesDelete, ApiTokenScopeAdminRead, ApiTokenScopeTokens, ""} {
+		if token.HasScope(scope) {
+			t.Fatalf("expected scope %q to be denied", scope)
+		}
+	}
+
+	legacy := ApiToken{}
+	if !legacy.FullAccess() || !legacy.HasScope(ApiTokenScopeAdminWrite) || !legacy.HasScope("") {
+		t.Fatal("expected legacy token without scopes to keep full access")
+	}
+
+	if _, err := NormalizeApiTokenScopes([]string{"files:everything"}); err == nil {
+		t.Fatal("expected unknown scope to be rejected")
+	}
+	if _, err := NormalizeApiTokenScopes([]string{"nope:*"}); err == nil {
+		t.Fatal("expected unknown wildcard to be rejected")
+	}
+}
+
+func TestApiTokenIPRestrictions(t *testing.T) {
+	cidrs, err := NormalizeApiTokenCIDRs([]string{"10.0.0.0/8", "192.168.1.5", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("NormalizeApiTokenCIDRs failed: %v", err)
+	}
+	if cidrs[1] != "192.168.1.5/32" || cidrs[2] != "2001:db8::1/128" {
+		t.Fatalf("unexpected normalized cidrs: %v", cidrs)
+	}
+	token := ApiToken{AllowedCIDRs: JoinApiTokenList(cidrs)}
+	if !token.AllowsIP("10.2.3.4") || !token.AllowsIP("192.168.1.5") || !token.AllowsIP("2001:db8::1") {
+		t.Fatal("expected listed addresses to be allowed")
+	}
+	if token.AllowsIP("192.168.1.6") || token.AllowsIP("not-an-ip") {
+		t.Fatal("expected other addresses to be denied")
+	}
+	if _, err := NormalizeApiTokenCIDRs([]string{"10.0.0.0/33"}); err == nil {
+		t.Fatal("expected invalid cidr to be rejected")
+	}
+
+	restricted := ApiToken{StrategyIDs: JoinApiTokenStrategyIDs([]uint{3, 1, 3, 0})}
+	if ids := restricted.StrategyIDList(); len(ids) != 2 || ids[0] != 3 || ids[1] != 1 {
+		t.Fatalf("unexpected strategy ids: %v", ids)
+	}
+}
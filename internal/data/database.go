@@ -46,9 +46,15 @@ func PrepareSchema(db *gorm.DB) error {
 	if err := migrateTurnstileToCaptcha(db); err != nil {
 		return fmt.Errorf("migrate turnstile to captcha: %w", err)
 	}
+	backfillAudit := db.Migrator().HasTable(&FileAsset{}) && !db.Migrator().HasColumn(&FileAsset{}, "audit_decision")
 	if err := AutoMigrateAll(db); err != nil {
 		return fmt.Errorf("auto migrate: %w", err)
 	}
+	if backfillAudit {
+		if err := backfillFileAuditColumns(db); err != nil {
+			return fmt.Errorf("backfill file audit columns: %w", err)
+		}
+	}
 	if err := MigrateUserIDsToSixteenDigits(db); err != nil {
 		return fmt.Errorf("migrate user ids to 16 digits: %w", err)
 	}
@@ -69,18 +75,34 @@ func AllModels() []interface{} {
 		&OAuthState{},
 		&UserPasskey{},
 		&PasskeyChallenge{},
+		&UserTOTP{},
+		&UserRecoveryCode{},
+		&TwoFactorChallenge{},
+		&VerificationCode{},
+		&LoginFailure{},
+		&LoginHistory{},
+		&AdminRole{},
+		&AdminAuditLog{},
 		&UserNotification{},
 		&FileAsset{},
 		&ConfigEntry{},
 		&AuditProfile{},
+		&ImageHashBlock{},
 		&Strategy{},
 		&GroupStrategy{},
 		&InstallerState{},
 		&SessionEntry{},
+		&RateLimitBucket{},
 		&ApiToken{},
 		&Album{},
 		&RedeemCode{},
 		&RedeemCodeUsage{},
+		&InviteCode{},
+		&InviteCodeUsage{},
+		&Webhook{},
+		&WebhookDelivery{},
+		&S3Object{},
+		&S3MultipartUpload{},
 		&ShopProduct{},
 		&ShopOrder{},
 		&Ticket{},
@@ -93,6 +115,7 @@ func AllModels() []interface{} {
 func MigrateTables() []MigrateTable {
 	return []MigrateTable{
 		{Name: "groups", Model: &Group{}},
+		{Name: "admin_roles", Model: &AdminRole{}},
 		{Name: "strategies", Model: &Strategy{}},
 		{Name: "group_strategy", Model: &GroupStrategy{}},
 		{Name: "users", Model: &User{}},
@@ -100,16 +123,31 @@ func MigrateTables() []MigrateTable {
 		{Name: "oauth_states", Model: &OAuthState{}},
 		{Name: "user_passkeys", Model: &UserPasskey{}},
 		{Name: "passkey_challenges", Model: &PasskeyChallenge{}},
+		{Name: "user_totp", Model: &UserTOTP{}},
+		{Name: "user_recovery_codes", Model: &UserRecoveryCode{}},
+		{Name: "two_factor_challenges", Model: &TwoFactorChallenge{}},
+		{Name: "verification_codes", Model: &VerificationCode{}},
+		{Name: "login_failures", Model: &LoginFailure{}},
+		{Name: "login_histories", Model: &LoginHistory{}},
+		{Name: "admin_audit_logs", Model: &AdminAuditLog{}},
 		{Name: "user_notifications", Model: &UserNotification{}},
 		{Name: "files", Model: &FileAsset{}},
 		{Name: "configs", Model: &ConfigEntry{}},
 		{Name: "audit_profiles", Model: &AuditProfile{}},
+		{Name: "image_hash_blocks", Model: &ImageHashBlock{}},
 		{Name: "installer_states", Model: &InstallerState{}},
 		{Name: "sessions", Model: &SessionEntry{}},
+		{Name: "rate_limit_buckets", Model: &RateLimitBucket{}},
 		{Name: "api_tokens", Model: &ApiToken{}},
 		{Name: "albums", Model: &Album{}},
 		{Name: "redeem_codes", Model: &RedeemCode{}},
 		{Name: "redeem_code_usages", Model: &RedeemCodeUsage{}},
+		{Name: "invite_codes", Model: &InviteCode{}},
+		{Name: "invite_code_usages", Model: &InviteCodeUsage{}},
+		{Name: "webhooks", Model: &Webhook{}},
+		{Name: "webhook_deliveries", Model: &WebhookDelivery{}},
+		{Name: "s3_objects", Model: &S3Object{}},
+		{Name: "s3_multipart_uploads", Model: &S3MultipartUpload{}},
 		{Name: "shop_products", Model: &ShopProduct{}},
 		{Name: "shop_orders", Model: &ShopOrder{}},
 		{Name: "tickets", Model: &Ticket{}},
@@ -277,3 +315,11 @@ func migrateTurnstileToCaptcha(db *gorm.DB) error {
 
 	return nil
 }
+
+// EscapeLike 转义 LIKE 模式中的通配符，查询需写成 `LIKE ? ESCAPE '!'`。
+// 选用 '!' 而非反斜杠，是因为 MySQL 字符串字面量会把反斜杠当作转义符。
+func EscapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
@@ -0,0 +1,90 @@
+package data
+
+import (
+	"encoding/json"
+	"strings"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const fileAuditBackfillBatch = 500
+
+// FileAuditColumns 从 audit_result JSON 中提取审核队列需要在 SQL 中筛选、排序的冗余列。
+// 标签统一小写并以逗号包围（如 ",porn,sexy,"），便于用 LIKE 匹配。
+func FileAuditColumns(result datatypes.JSON) map[string]interface{} {
+	var parsed struct {
+		Provider  string   `json:"provider"`
+		Decision  string   `json:"decision"`
+		Label     string   `json:"label"`
+		Labels    []string `json:"labels"`
+		NSFWScore float64  `json:"nsfwScore"`
+	}
+	if len(result) > 0 {
+		_ = json.Unmarshal(result, &parsed)
+	}
+	seen := make(map[string]struct{}, len(parsed.Labels)+1)
+	labels := make([]string, 0, len(parsed.Labels)+1)
+	for _, label := range append(parsed.Labels, parsed.Label) {
+		label = strings.ToLower(strings.TrimSpace(strings.ReplaceAll(label, ",", " ")))
+		if label == "" {
+			continue
+		}
+		if _, ok := seen[label]; ok {
+			continue
+		}
+		seen[label] = struct{}{}
+		labels = append(labels, label)
+	}
+	joined := ""
+	if len(labels) > 0 {
+		joined = "," + strings.Join(labels, ",") + ","
+		if len(joined) > 512 {
+			joined = joined[:strings.LastIndex(joined[:512], ",")+1]
+		}
+	}
+	return map[string]interface{}{
+		"audit_decision": truncateColumn(strings.ToLower(strings.TrimSpace(parsed.Decision)), 16),
+		"audit_provider": truncateColumn(strings.ToLower(strings.TrimSpace(parsed.Provider)), 32),
+		"audit_score":    parsed.NSFWScore,
+		"audit_labels":   joined,
+	}
+}
+
+func truncateColumn(value string, size int) string {
+	if len(value) <= size {
+		return value
+	}
+	return value[:size]
+}
+
+// backfillFileAuditColumns 为新增审核冗余列之前写入的审核结果补齐这些列。
+func backfillFileAuditColumns(db *gorm.DB) error {
+	type row struct {
+		ID          uint
+		AuditResult datatypes.JSON
+	}
+	var cursor uint
+	for {
+		var rows []row
+		if err := db.Model(&FileAsset{}).
+			Select("id, audit_result").
+			Where("id > ? AND audit_result IS NOT NULL", cursor).
+			Order("id ASC").
+			Limit(fileAuditBackfillBatch).
+			Find(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		for _, item := range rows {
+			cursor = item.ID
+			if err := db.Model(&FileAsset{}).
+				Where("id = ?", item.ID).
+				UpdateColumns(FileAuditColumns(item.AuditResult)).Error; err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package data
+
+import (
+	"testing"
+
+	"gorm.io/datatypes"
+)
+
+func TestFileAuditColumns(t *testing.T) {
+	columns := FileAuditColumns(datatypes.JSON(`{"provider":"Webhook","decision":"Review","label":"Porn","labels":["porn","sexy, hot"],"nsfwScore":0.8}`))
+	if columns["audit_decision"] != "review" || columns["audit_provider"] != "webhook" || columns["audit_score"] != 0.8 {
+		t.Fatalf("unexpected columns: %+v", columns)
+	}
+	if columns["audit_labels"] != ",porn,sexy  hot," {
+		t.Fatalf("unexpected labels column: %q", columns["audit_labels"])
+	}
+
+	empty := FileAuditColumns(nil)
+	if empty["audit_decision"] != "" || empty["audit_labels"] != "" || empty["audit_score"] != 0.0 {
+		t.Fatalf("expected empty columns for missing result, got %+v", empty)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := EscapeLike("100%_a!"); got != "100!%!_a!!" {
+		t.Fatalf("unexpected escaped value: %q", got)
+	}
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImageHashBandCount 是感知哈希按字节拆分的段数。两个 64 位哈希的汉明距离小于该值时，
+// 至少有一段完全相同，上传时可按段走索引取出候选，而不必扫描整张屏蔽表。
+const ImageHashBandCount = 8
+
+// ImageHashBlock 记录被屏蔽图片的感知哈希，上传时与之比较汉明距离。
+type ImageHashBlock struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Hash         string    `gorm:"size:16;not null;uniqueIndex" json:"hash"`
+	Band0        int       `gorm:"index;default:0" json:"-"`
+	Band1        int       `gorm:"index;default:0" json:"-"`
+	Band2        int       `gorm:"index;default:0" json:"-"`
+	Band3        int       `gorm:"index;default:0" json:"-"`
+	Band4        int       `gorm:"index;default:0" json:"-"`
+	Band5        int       `gorm:"index;default:0" json:"-"`
+	Band6        int       `gorm:"index;default:0" json:"-"`
+	Band7        int       `gorm:"index;default:0" json:"-"`
+	Reason       string    `gorm:"size:255" json:"reason"`
+	SourceFileID uint      `gorm:"index;default:0" json:"sourceFileId"`
+	SourceName   string    `gorm:"size:255" json:"sourceName"`
+	CreatedBy    uint      `gorm:"index;default:0" json:"createdBy,string"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+func (ImageHashBlock) TableName() string {
+	return "image_hash_blocks"
+}
+
+// ImageHashBands 把十六进制感知哈希拆成 ImageHashBandCount 个字节段，键为列名；哈希无效时返回 nil。
+func ImageHashBands(hash string) map[string]interface{} {
+	hash = strings.TrimSpace(hash)
+	value, err := strconv.ParseUint(hash, 16, 64)
+	if err != nil || len(hash) != 16 {
+		return nil
+	}
+	bands := make(map[string]interface{}, ImageHashBandCount)
+	for i := 0; i < ImageHashBandCount; i++ {
+		bands["band"+strconv.Itoa(i)] = int(value >> (8 * (ImageHashBandCount - 1 - i)) & 0xff)
+	}
+	return bands
+}
+
+// SetBands 按 Hash 填充分段列。
+func (b *ImageHashBlock) SetBands() {
+	bands := ImageHashBands(b.Hash)
+	if bands == nil {
+		return
+	}
+	fields := []*int{&b.Band0, &b.Band1, &b.Band2, &b.Band3, &b.Band4, &b.Band5, &b.Band6, &b.Band7}
+	for i, field := range fields {
+		*field = bands["band"+strconv.Itoa(i)].(int)
+	}
+}
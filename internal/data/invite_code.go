@@ -0,0 +1,40 @@
+package data
+
+import "time"
+
+// InviteCode 邀请码。邀请注册模式下注册（密码或 OAuth）必须提供有效邀请码；
+// 由管理员创建，或由用户在所属角色组的配额内创建。
+type InviteCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Code      string     `gorm:"size:64;uniqueIndex;not null" json:"code"`
+	InviterID uint       `gorm:"index;not null" json:"inviterId,string"`
+	ByAdmin   bool       `gorm:"not null" json:"byAdmin"`
+	MaxUses   int        `gorm:"not null" json:"maxUses"` // 0 表示不限制
+	UsedCount int        `gorm:"not null" json:"usedCount"`
+	ExpiresAt *time.Time `gorm:"index" json:"expiresAt"`
+	Enabled   bool       `gorm:"not null" json:"enabled"`
+	Note      string     `gorm:"size:255" json:"note"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	Inviter   *User      `gorm:"foreignKey:InviterID" json:"inviter,omitempty"`
+}
+
+func (InviteCode) TableName() string {
+	return "invite_codes"
+}
+
+// InviteCodeUsage 邀请码使用记录，同时记录发放的推荐奖励（字节）。
+type InviteCodeUsage struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	InviteCodeID  uint      `gorm:"index;not null" json:"inviteCodeId"`
+	InviterID     uint      `gorm:"index;not null" json:"inviterId,string"`
+	InviteeID     uint      `gorm:"uniqueIndex;not null" json:"inviteeId,string"`
+	InviterReward float64   `gorm:"default:0" json:"inviterReward"`
+	InviteeReward float64   `gorm:"default:0" json:"inviteeReward"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Invitee       *User     `gorm:"foreignKey:InviteeID" json:"invitee,omitempty"`
+}
+
+func (InviteCodeUsage) TableName() string {
+	return "invite_code_usages"
+}
@@ -0,0 +1,35 @@
+package data
+
+import "time"
+
+// LoginFailure tracks consecutive password login attempts for one key
+// (a normalized email or a client IP), used for progressive delays and
+// temporary lockout. Keys are tracked whether or not the account exists.
+type LoginFailure struct {
+	Key          string     `gorm:"column:failure_key;primaryKey;size:191" json:"key"`
+	FailedCount  int        `gorm:"default:0" json:"failedCount"`
+	LastFailedAt time.Time  `json:"lastFailedAt"`
+	LockedUntil  *time.Time `gorm:"index" json:"lockedUntil,omitempty"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+func (LoginFailure) TableName() string {
+	return "login_failures"
+}
+
+// LoginHistory is one login attempt (successful or failed) for an account.
+type LoginHistory struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index:idx_login_history_user_created;not null" json:"userId,string"`
+	IP        string    `gorm:"size:64" json:"ip"`
+	UserAgent string    `gorm:"size:512" json:"userAgent"`
+	Method    string    `gorm:"size:16" json:"method"`
+	Success   bool      `gorm:"default:false" json:"success"`
+	Reason    string    `gorm:"size:64" json:"reason,omitempty"`
+	NewDevice bool      `gorm:"default:false" json:"newDevice"`
+	CreatedAt time.Time `gorm:"index:idx_login_history_user_created" json:"createdAt"`
+}
+
+func (LoginHistory) TableName() string {
+	return "login_histories"
+}
@@ -35,6 +35,9 @@ type User struct {
 	UsedCapacity   float64        `gorm:"column:use_capacity;default:0" json:"usedCapacity"`
 	Configs        datatypes.JSON `gorm:"type:json" json:"configs"`
 	IsAdmin       bool           `gorm:"column:is_adminer;default:false" json:"isAdmin"`
+	// AdminRoleID 限定管理员的后台权限；为空时管理员拥有全部权限
+	AdminRoleID *uint    `gorm:"index" json:"adminRoleId,omitempty"`
+	Permissions []string `gorm:"-" json:"permissions,omitempty"`
 	Status        uint8          `gorm:"default:1" json:"status"`
 	EmailVerified *time.Time     `gorm:"column:email_verified_at" json:"emailVerifiedAt"`
 	ImageCount    uint64         `gorm:"column:image_num;default:0" json:"imageCount"`
@@ -113,6 +116,7 @@ type OAuthState struct {
 	Mode          string    `gorm:"size:16;not null" json:"mode"`
 	UserID        uint      `gorm:"default:0" json:"userId"`
 	CodeVerifier  string    `gorm:"size:128;default:''" json:"-"`
+	InviteCode    string    `gorm:"size:64;default:''" json:"-"`
 	ExpiresAt     time.Time `gorm:"index;not null" json:"expiresAt"`
 	CreatedAt     time.Time `json:"createdAt"`
 }
@@ -126,6 +130,7 @@ type FileAsset struct {
 	UserID          uint           `gorm:"index" json:"userId"`
 	GroupID         *uint          `gorm:"index" json:"groupId"`
 	StrategyID      uint           `gorm:"index" json:"strategyId"`
+	AlbumID         *uint          `gorm:"index" json:"albumId,omitempty"`
 	Key             string         `gorm:"size:64;uniqueIndex;not null" json:"key"`
 	Path            string         `gorm:"size:512;not null" json:"path"`
 	RelativePath    string         `gorm:"size:512;default:''" json:"relativePath"`
@@ -137,8 +142,11 @@ type FileAsset struct {
 	Extension       string         `gorm:"size:32" json:"extension"`
 	ChecksumMD5     string         `gorm:"size:32" json:"checksumMd5"`
 	ChecksumSHA1    string         `gorm:"size:40" json:"checksumSha1"`
+	PerceptualHash  string         `gorm:"size:16;index" json:"perceptualHash"`
 	Width                     int            `gorm:"default:0" json:"width"`
 	Height                    int            `gorm:"default:0" json:"height"`
+	BlurHash                  string         `gorm:"size:64;default:''" json:"blurHash"`
+	DominantColors            string         `gorm:"size:128;default:''" json:"dominantColors"`
 	Visibility                string         `gorm:"size:16;default:'private'" json:"visibility"`
 	StorageProvider           string         `gorm:"size:32;default:'local'" json:"storageProvider"`
 	ThumbnailPath             string         `gorm:"size:512;default:''" json:"thumbnailPath"`
@@ -150,6 +158,11 @@ type FileAsset struct {
 	AuditResult               datatypes.JSON `gorm:"type:json" json:"auditResult"`
 	AuditCheckedAt            *time.Time     `json:"auditCheckedAt"`
 	AuditReviewedAt           *time.Time     `json:"auditReviewedAt"`
+	AuditReviewedBy           uint           `gorm:"index;default:0" json:"auditReviewedBy,string,omitempty"`
+	AuditDecision             string         `gorm:"size:16;index;default:''" json:"-"`
+	AuditProvider             string         `gorm:"size:32;index;default:''" json:"-"`
+	AuditScore                float64        `gorm:"index;default:0" json:"-"`
+	AuditLabels               string         `gorm:"size:512;default:''" json:"-"`
 	UploadedIP                string         `gorm:"size:64" json:"uploadedIp"`
 	CreatedAt                 time.Time      `json:"createdAt"`
 	UpdatedAt                 time.Time      `json:"updatedAt"`
@@ -212,11 +225,19 @@ func (InstallerState) TableName() string {
 }
 
 type SessionEntry struct {
-	ID        string    `gorm:"primaryKey;size:64" json:"id"`
-	UserID    uint      `gorm:"index;not null" json:"userId"`
-	ExpiresAt time.Time `gorm:"index;not null" json:"expiresAt"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID         string     `gorm:"primaryKey;size:64" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"userId"`
+	IP         string     `gorm:"size:64" json:"ip"`
+	UserAgent  string     `gorm:"size:512" json:"userAgent"`
+	Method     string     `gorm:"size:16" json:"method"`
+	RememberMe bool       `gorm:"not null;default:false" json:"rememberMe"`
+	Lifetime   int64      `gorm:"not null;default:0" json:"-"` // 秒；0 表示使用默认 TTL
+	LastSeenAt *time.Time `json:"lastSeenAt"`
+	// ImpersonatorID 为发起模拟登录的超级管理员；非空时会话有效期固定，不随访问顺延
+	ImpersonatorID *uint     `gorm:"index" json:"impersonatorId,omitempty"`
+	ExpiresAt      time.Time `gorm:"index;not null" json:"expiresAt"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
 }
 
 func (SessionEntry) TableName() string {
@@ -224,14 +245,18 @@ func (SessionEntry) TableName() string {
 }
 
 type ApiToken struct {
-	ID         uint       `gorm:"primaryKey" json:"id"`
-	UserID     uint       `gorm:"index;not null" json:"userId"`
-	Token      string     `gorm:"size:255;uniqueIndex;not null" json:"token"`
-	ExpiresAt  time.Time  `gorm:"index;not null" json:"expiresAt"`
-	LastUsedAt *time.Time `gorm:"index" json:"lastUsedAt,omitempty"`
-	CreatedAt  time.Time  `json:"createdAt"`
-	UpdatedAt  time.Time  `json:"updatedAt"`
-	User       User       `gorm:"foreignKey:UserID" json:"-"`
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"index;not null" json:"userId"`
+	Name         string     `gorm:"size:64;default:''" json:"name"`
+	Token        string     `gorm:"size:255;uniqueIndex;not null" json:"token"`
+	Scopes       string     `gorm:"size:512;default:''" json:"scopes"`
+	StrategyIDs  string     `gorm:"size:255;default:''" json:"strategyIds"`
+	AllowedCIDRs string     `gorm:"column:allowed_cidrs;size:1024;default:''" json:"allowedCidrs"`
+	ExpiresAt    time.Time  `gorm:"index;not null" json:"expiresAt"`
+	LastUsedAt   *time.Time `gorm:"index" json:"lastUsedAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	User         User       `gorm:"foreignKey:UserID" json:"-"`
 }
 
 func (ApiToken) TableName() string {
@@ -0,0 +1,14 @@
+package data
+
+import "time"
+
+// RateLimitBucket is a fixed-window request counter shared by all instances.
+type RateLimitBucket struct {
+	Key     string    `gorm:"column:bucket_key;primaryKey;size:191" json:"key"`
+	Hits    int       `gorm:"not null;default:0" json:"hits"`
+	ResetAt time.Time `gorm:"index;not null" json:"resetAt"`
+}
+
+func (RateLimitBucket) TableName() string {
+	return "rate_limit_buckets"
+}
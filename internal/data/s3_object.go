@@ -0,0 +1,37 @@
+package data
+
+import "time"
+
+// S3Object 记录通过 S3 网关写入的对象键与图片的对应关系。
+// 对象键可能很长，唯一索引建立在其 SHA-256 上。
+type S3Object struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uint      `gorm:"uniqueIndex:idx_s3_objects_key;not null" json:"userId,string"`
+	StrategyID uint      `gorm:"uniqueIndex:idx_s3_objects_key;not null" json:"strategyId"`
+	KeyHash    string    `gorm:"size:64;uniqueIndex:idx_s3_objects_key;not null" json:"-"`
+	ObjectKey  string    `gorm:"size:1024;not null" json:"key"`
+	FileID     uint      `gorm:"uniqueIndex;not null" json:"fileId"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+func (S3Object) TableName() string {
+	return "s3_objects"
+}
+
+// S3MultipartUpload 是进行中的分片上传；分片内容暂存在本机磁盘。
+type S3MultipartUpload struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UploadID    string    `gorm:"size:64;uniqueIndex;not null" json:"uploadId"`
+	UserID      uint      `gorm:"index;not null" json:"userId,string"`
+	TokenID     uint      `gorm:"index;not null" json:"tokenId"`
+	StrategyID  uint      `gorm:"not null" json:"strategyId"`
+	ObjectKey   string    `gorm:"size:1024;not null" json:"key"`
+	ContentType string    `gorm:"size:128" json:"contentType"`
+	Visibility  string    `gorm:"size:16" json:"visibility"`
+	CreatedAt   time.Time `gorm:"index" json:"createdAt"`
+}
+
+func (S3MultipartUpload) TableName() string {
+	return "s3_multipart_uploads"
+}
@@ -0,0 +1,48 @@
+package data
+
+import "time"
+
+// UserTOTP stores a user's TOTP secret. Enabled is false until the user confirms
+// enrollment with a valid code.
+type UserTOTP struct {
+	UserID       uint       `gorm:"primaryKey;autoIncrement:false" json:"userId,string"`
+	Secret       string     `gorm:"size:64;not null" json:"-"`
+	Enabled      bool       `gorm:"default:false" json:"enabled"`
+	LastUsedStep int64      `gorm:"default:0" json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmedAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+func (UserTOTP) TableName() string {
+	return "user_totp"
+}
+
+// UserRecoveryCode is a single-use 2FA recovery code; only the SHA-256 hash is stored.
+type UserRecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"userId,string"`
+	CodeHash  string     `gorm:"size:64;index;not null" json:"-"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+func (UserRecoveryCode) TableName() string {
+	return "user_recovery_codes"
+}
+
+// TwoFactorChallenge is a short-lived pending login waiting for the second factor
+// (multi-instance safe, single-use, similar to PasskeyChallenge).
+type TwoFactorChallenge struct {
+	ID     string `gorm:"primaryKey;size:64" json:"id"`
+	UserID uint   `gorm:"index;not null" json:"userId,string"`
+	// Method 是第一步使用的登录方式（password、oauth、passkey），完成后写入会话
+	Method    string    `gorm:"size:16;default:''" json:"method"`
+	Attempts  int       `gorm:"default:0" json:"attempts"`
+	ExpiresAt time.Time `gorm:"index;not null" json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (TwoFactorChallenge) TableName() string {
+	return "two_factor_challenges"
+}
@@ -0,0 +1,22 @@
+package data
+
+import "time"
+
+// VerificationCode stores a pending email verification code or password-reset
+// request (multi-instance safe, single-use, similar to OAuthState).
+// Only SHA-256 hashes of codes and reset tokens are persisted.
+type VerificationCode struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Purpose    string    `gorm:"size:32;not null;uniqueIndex:idx_verification_purpose_key;index:idx_verification_purpose_email" json:"purpose"`
+	Key        string    `gorm:"column:lookup_key;size:64;not null;uniqueIndex:idx_verification_purpose_key" json:"-"`
+	Email      string    `gorm:"size:255;not null;index:idx_verification_purpose_email" json:"email"`
+	CodeHash   string    `gorm:"size:64;not null" json:"-"`
+	Attempts   int       `gorm:"default:0" json:"attempts"`
+	LastSentAt time.Time `gorm:"not null" json:"lastSentAt"`
+	ExpiresAt  time.Time `gorm:"index;not null" json:"expiresAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func (VerificationCode) TableName() string {
+	return "verification_codes"
+}
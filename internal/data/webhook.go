@@ -0,0 +1,78 @@
+package data
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Webhook 是一个出站事件订阅。scope=user 只接收归属该用户的事件，
+// scope=admin 由管理员创建，接收全站事件。
+type Webhook struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"userId,string"`
+	Scope     string    `gorm:"size:16;index;not null" json:"scope"`
+	Name      string    `gorm:"size:128" json:"name"`
+	URL       string    `gorm:"size:2048;not null" json:"url"`
+	Secret    string    `gorm:"size:128;not null" json:"-"`
+	Events    string    `gorm:"size:512;not null" json:"-"` // 逗号分隔的事件名
+	Enabled   bool      `gorm:"not null" json:"enabled"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	EventList []string  `gorm:"-" json:"events"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// EventNames 返回订阅的事件列表。
+func (w Webhook) EventNames() []string {
+	var out []string
+	for _, part := range strings.Split(w.Events, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// Subscribes 判断是否订阅了指定事件。
+func (w Webhook) Subscribes(event string) bool {
+	for _, name := range w.EventNames() {
+		if name == event {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	WebhookDeliveryPending = "pending"
+	WebhookDeliverySuccess = "success"
+	WebhookDeliveryFailed  = "failed"
+)
+
+// WebhookDelivery 是一次事件投递及其最近一次尝试的结果。
+// Payload 是签名时使用的原始请求体，重新投递时原样发送。
+type WebhookDelivery struct {
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	WebhookID      uint           `gorm:"index;not null" json:"webhookId"`
+	EventID        string         `gorm:"size:64;index;not null" json:"eventId"`
+	Event          string         `gorm:"size:64;index;not null" json:"event"`
+	Payload        datatypes.JSON `gorm:"type:json" json:"payload"`
+	Status         string         `gorm:"size:16;index;not null" json:"status"`
+	Attempts       int            `gorm:"not null" json:"attempts"`
+	NextAttemptAt  *time.Time     `gorm:"index" json:"nextAttemptAt,omitempty"`
+	ResponseStatus int            `gorm:"not null" json:"responseStatus"`
+	ResponseBody   string         `gorm:"size:1024" json:"responseBody"`
+	LastError      string         `gorm:"size:512" json:"lastError"`
+	DeliveredAt    *time.Time     `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time      `gorm:"index" json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
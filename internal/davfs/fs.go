@@ -0,0 +1,549 @@
+// Package davfs 将用户的图片库映射为 WebDAV 目录树：
+//
+//	/albums/<相册>/<图片>
+//	/dates/<年>/<月>/<图片>
+//
+// 图片按原始文件名展示，同一目录下重名时追加 " (ID)"。
+// 写入（PUT）与读取（GET）由 API 层直接处理，这里负责目录浏览、相册增删改与移动。
+package davfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/webdav"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+	"skyimage/internal/files"
+)
+
+const (
+	AlbumsDir = "albums"
+	DatesDir  = "dates"
+
+	// MaxUploadSize 单次 PUT 的大小上限，实际还受角色组限制
+	MaxUploadSize int64 = 512 << 20
+)
+
+// ErrReadOnly 表示目标位置不支持该写操作。
+var ErrReadOnly = os.ErrPermission
+
+type nodeKind int
+
+const (
+	kindRoot nodeKind = iota
+	kindAlbums
+	kindAlbum
+	kindDates
+	kindYear
+	kindMonth
+	kindFile
+)
+
+// Node 是目录树中的一个节点。
+type Node struct {
+	kind    nodeKind
+	name    string
+	album   data.Album
+	year    int
+	month   int
+	file    data.FileAsset
+	modTime time.Time
+}
+
+// IsFile 判断节点是否为图片。
+func (n Node) IsFile() bool { return n.kind == kindFile }
+
+// File 返回图片节点对应的记录。
+func (n Node) File() data.FileAsset { return n.file }
+
+// UploadTarget 判断该目录能否上传图片，以及上传后放入的相册（0 表示不放入相册）。
+func (n Node) UploadTarget() (albumID uint, ok bool) {
+	switch n.kind {
+	case kindAlbum:
+		return n.album.ID, true
+	case kindDates, kindYear, kindMonth:
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+func (n Node) info() *fileInfo {
+	info := &fileInfo{name: n.name, modTime: n.modTime, dir: n.kind != kindFile}
+	if n.kind == kindFile {
+		info.size = n.file.Size
+		info.contentType = n.file.MimeType
+		info.etag = n.file.ChecksumMD5
+	}
+	return info
+}
+
+// Locks 为每个用户维护独立的锁表，避免不同用户的同名路径互相影响。
+type Locks struct {
+	mu      sync.Mutex
+	systems map[uint]webdav.LockSystem
+}
+
+func NewLocks() *Locks {
+	return &Locks{systems: make(map[uint]webdav.LockSystem)}
+}
+
+func (l *Locks) For(userID uint) webdav.LockSystem {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ls, ok := l.systems[userID]
+	if !ok {
+		ls = webdav.NewMemLS()
+		l.systems[userID] = ls
+	}
+	return ls
+}
+
+// FileSystem 实现 webdav.FileSystem，每个请求创建一个实例并缓存目录列表。
+type FileSystem struct {
+	db        *gorm.DB
+	files     *files.Service
+	userID    uint
+	canDelete bool
+	location  *time.Location
+
+	listings map[string][]Node
+}
+
+// New 创建用户的文件系统视图。canDelete 为 false 时禁止删除图片（Token 缺少 files:delete）。
+func New(db *gorm.DB, fileService *files.Service, userID uint, canDelete bool) *FileSystem {
+	return &FileSystem{
+		db:        db,
+		files:     fileService,
+		userID:    userID,
+		canDelete: canDelete,
+		location:  time.Local,
+		listings:  make(map[string][]Node),
+	}
+}
+
+// Resolve 按路径查找节点，不存在时返回 os.ErrNotExist。
+func (fs *FileSystem) Resolve(ctx context.Context, name string) (Node, error) {
+	parts := splitPath(name)
+	node := Node{kind: kindRoot, name: "/", modTime: time.Now()}
+	for i, part := range parts {
+		children, err := fs.children(ctx, "/"+strings.Join(parts[:i], "/"), node)
+		if err != nil {
+			return Node{}, err
+		}
+		found := false
+		for _, child := range children {
+			if child.name == part {
+				node, found = child, true
+				break
+			}
+		}
+		if !found {
+			return Node{}, os.ErrNotExist
+		}
+	}
+	return node, nil
+}
+
+// ResolveParent 返回路径的父目录与最后一段名称。
+func (fs *FileSystem) ResolveParent(ctx context.Context, name string) (Node, string, error) {
+	parts := splitPath(name)
+	if len(parts) == 0 {
+		return Node{}, "", os.ErrInvalid
+	}
+	parent, err := fs.Resolve(ctx, "/"+strings.Join(parts[:len(parts)-1], "/"))
+	if err != nil {
+		return Node{}, "", err
+	}
+	return parent, parts[len(parts)-1], nil
+}
+
+// Invalidate 清除目录缓存，写操作后调用。
+func (fs *FileSystem) Invalidate() {
+	fs.listings = make(map[string][]Node)
+}
+
+func (fs *FileSystem) Mkdir(ctx context.Context, name string, _ os.FileMode) error {
+	if _, err := fs.Resolve(ctx, name); err == nil {
+		return os.ErrExist
+	}
+	parent, base, err := fs.ResolveParent(ctx, name)
+	if err != nil {
+		return err
+	}
+	if parent.kind != kindAlbums {
+		return ErrReadOnly
+	}
+	defer fs.Invalidate()
+	_, err = fs.files.CreateAlbum(ctx, fs.userID, base, "")
+	return err
+}
+
+func (fs *FileSystem) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	writing := flag&(os.O_WRONLY|os.O_RDWR|os.O_TRUNC|os.O_CREATE) != 0
+	node, err := fs.Resolve(ctx, name)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) || flag&os.O_CREATE == 0 {
+			return nil, err
+		}
+		// LOCK 未映射的路径时会先创建空资源；图片只能通过 PUT 上传，这里返回不落盘的占位文件
+		parent, base, perr := fs.ResolveParent(ctx, name)
+		if perr != nil {
+			return nil, perr
+		}
+		if _, ok := parent.UploadTarget(); !ok {
+			return nil, ErrReadOnly
+		}
+		return &placeholderFile{info: &fileInfo{name: base, modTime: time.Now()}}, nil
+	}
+	if node.kind == kindFile {
+		if writing {
+			return nil, ErrReadOnly
+		}
+		return &objectFile{info: node.info()}, nil
+	}
+	if writing {
+		return nil, ErrReadOnly
+	}
+	children, err := fs.children(ctx, cleanPath(name), node)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(children))
+	for _, child := range children {
+		infos = append(infos, child.info())
+	}
+	return &dirFile{info: node.info(), children: infos}, nil
+}
+
+func (fs *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	node, err := fs.Resolve(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer fs.Invalidate()
+	switch node.kind {
+	case kindFile:
+		if !fs.canDelete {
+			return ErrReadOnly
+		}
+		return fs.files.Delete(ctx, fs.userID, node.file.ID)
+	case kindAlbum:
+		// 删除相册目录只删除相册，图片保留在 dates 目录下
+		return fs.files.DeleteAlbum(ctx, fs.userID, node.album.ID)
+	default:
+		return ErrReadOnly
+	}
+}
+
+func (fs *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	node, err := fs.Resolve(ctx, oldName)
+	if err != nil {
+		return err
+	}
+	parent, base, err := fs.ResolveParent(ctx, newName)
+	if err != nil {
+		return err
+	}
+	defer fs.Invalidate()
+	switch node.kind {
+	case kindAlbum:
+		if parent.kind != kindAlbums {
+			return ErrReadOnly
+		}
+		_, err := fs.files.RenameAlbum(ctx, fs.userID, node.album.ID, base)
+		return err
+	case kindFile:
+		var target uint
+		switch parent.kind {
+		case kindAlbum:
+			target = parent.album.ID
+		case kindMonth:
+			// 移到日期目录表示移出相册，只能移到图片所在的月份
+			created := node.file.CreatedAt.In(fs.location)
+			if created.Year() != parent.year || int(created.Month()) != parent.month {
+				return ErrReadOnly
+			}
+		default:
+			return ErrReadOnly
+		}
+		current := uint(0)
+		if node.file.AlbumID != nil {
+			current = *node.file.AlbumID
+		}
+		if target != current {
+			if _, err := fs.files.MoveToAlbum(ctx, fs.userID, node.file.ID, target); err != nil {
+				return err
+			}
+		}
+		if base != node.name {
+			if _, err := fs.files.RenameFile(ctx, fs.userID, node.file.ID, base); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return ErrReadOnly
+	}
+}
+
+func (fs *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	node, err := fs.Resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(), nil
+}
+
+// children 列出目录内容，同一请求内按路径缓存。
+func (fs *FileSystem) children(ctx context.Context, dirPath string, node Node) ([]Node, error) {
+	if cached, ok := fs.listings[dirPath]; ok {
+		return cached, nil
+	}
+	var (
+		out []Node
+		err error
+	)
+	switch node.kind {
+	case kindRoot:
+		now := time.Now()
+		out = []Node{
+			{kind: kindAlbums, name: AlbumsDir, modTime: now},
+			{kind: kindDates, name: DatesDir, modTime: now},
+		}
+	case kindAlbums:
+		out, err = fs.albumNodes(ctx)
+	case kindAlbum:
+		out, err = fs.fileNodes(ctx, fs.fileQuery(ctx).Where("album_id = ?", node.album.ID))
+	case kindDates:
+		out, err = fs.dateNodes(ctx, 0)
+	case kindYear:
+		out, err = fs.dateNodes(ctx, node.year)
+	case kindMonth:
+		start := time.Date(node.year, time.Month(node.month), 1, 0, 0, 0, 0, fs.location)
+		out, err = fs.fileNodes(ctx, fs.fileQuery(ctx).
+			Where("created_at >= ? AND created_at < ?", start, start.AddDate(0, 1, 0)))
+	}
+	if err != nil {
+		return nil, err
+	}
+	fs.listings[dirPath] = out
+	return out, nil
+}
+
+func (fs *FileSystem) fileQuery(ctx context.Context) *gorm.DB {
+	return fs.db.WithContext(ctx).Model(&data.FileAsset{}).Where("user_id = ?", fs.userID)
+}
+
+func (fs *FileSystem) albumNodes(ctx context.Context) ([]Node, error) {
+	albums, err := fs.files.ListAlbums(ctx, fs.userID)
+	if err != nil {
+		return nil, err
+	}
+	names := newNameSet()
+	out := make([]Node, 0, len(albums))
+	for _, album := range albums {
+		name := names.claim(sanitizeName(album.Name, "album"), album.ID, false)
+		out = append(out, Node{kind: kindAlbum, name: name, album: album, modTime: album.UpdatedAt})
+	}
+	return out, nil
+}
+
+func (fs *FileSystem) fileNodes(ctx context.Context, query *gorm.DB) ([]Node, error) {
+	var items []data.FileAsset
+	if err := query.Order("id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	names := newNameSet()
+	out := make([]Node, 0, len(items))
+	for _, item := range items {
+		display := item.OriginalName
+		if strings.TrimSpace(display) == "" {
+			display = item.Name
+		}
+		name := names.claim(sanitizeName(display, item.Key), item.ID, true)
+		out = append(out, Node{kind: kindFile, name: name, file: item, modTime: item.CreatedAt})
+	}
+	return out, nil
+}
+
+// dateNodes 列出有图片的年份（year 为 0）或该年有图片的月份。
+func (fs *FileSystem) dateNodes(ctx context.Context, year int) ([]Node, error) {
+	query := fs.fileQuery(ctx)
+	if year != 0 {
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, fs.location)
+		query = query.Where("created_at >= ? AND created_at < ?", start, start.AddDate(1, 0, 0))
+	}
+	var times []time.Time
+	if err := query.Pluck("created_at", &times).Error; err != nil {
+		return nil, err
+	}
+	latest := make(map[int]time.Time)
+	for _, t := range times {
+		t = t.In(fs.location)
+		key := t.Year()
+		if year != 0 {
+			key = int(t.Month())
+		}
+		if t.After(latest[key]) {
+			latest[key] = t
+		}
+	}
+	keys := make([]int, 0, len(latest))
+	for key := range latest {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	out := make([]Node, 0, len(keys))
+	for _, key := range keys {
+		if year == 0 {
+			out = append(out, Node{kind: kindYear, name: strconv.Itoa(key), year: key, modTime: latest[key]})
+		} else {
+			out = append(out, Node{kind: kindMonth, name: fmt.Sprintf("%02d", key), year: year, month: key, modTime: latest[key]})
+		}
+	}
+	return out, nil
+}
+
+// nameSet 为同一目录内的条目分配唯一名称。
+type nameSet map[string]struct{}
+
+func newNameSet() nameSet { return make(nameSet) }
+
+func (s nameSet) claim(name string, id uint, keepExt bool) string {
+	if _, taken := s[name]; taken {
+		ext := ""
+		if keepExt {
+			ext = path.Ext(name)
+		}
+		name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), id, ext)
+	}
+	s[name] = struct{}{}
+	return name
+}
+
+func sanitizeName(name, fallback string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\':
+			return '_'
+		case r < 0x20 || r == 0x7f:
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." {
+		return fallback
+	}
+	return name
+}
+
+func cleanPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+func splitPath(name string) []string {
+	cleaned := strings.Trim(cleanPath(name), "/")
+	if cleaned == "" {
+		return nil
+	}
+	return strings.Split(cleaned, "/")
+}
+
+type fileInfo struct {
+	name        string
+	size        int64
+	modTime     time.Time
+	dir         bool
+	contentType string
+	etag        string
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+// ContentType 避免 webdav 为猜测类型而读取文件内容。
+func (fi *fileInfo) ContentType(context.Context) (string, error) {
+	if fi.contentType == "" {
+		return "application/octet-stream", nil
+	}
+	return fi.contentType, nil
+}
+
+func (fi *fileInfo) ETag(context.Context) (string, error) {
+	if fi.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + fi.etag + `"`, nil
+}
+
+type dirFile struct {
+	info     *fileInfo
+	children []os.FileInfo
+	pos      int
+}
+
+func (f *dirFile) Close() error                   { return nil }
+func (f *dirFile) Read([]byte) (int, error)       { return 0, os.ErrInvalid }
+func (f *dirFile) Seek(int64, int) (int64, error) { return 0, os.ErrInvalid }
+func (f *dirFile) Write([]byte) (int, error)      { return 0, ErrReadOnly }
+func (f *dirFile) Stat() (os.FileInfo, error)     { return f.info, nil }
+func (f *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if f.pos >= len(f.children) {
+		if count > 0 {
+			return nil, io.EOF
+		}
+		return nil, nil
+	}
+	end := len(f.children)
+	if count > 0 && f.pos+count < end {
+		end = f.pos + count
+	}
+	out := f.children[f.pos:end]
+	f.pos = end
+	return out, nil
+}
+
+// objectFile 只提供元数据，图片内容由 API 层按存储驱动读取或重定向。
+type objectFile struct {
+	info *fileInfo
+}
+
+func (f *objectFile) Close() error                       { return nil }
+func (f *objectFile) Read([]byte) (int, error)           { return 0, os.ErrInvalid }
+func (f *objectFile) Seek(int64, int) (int64, error)     { return 0, os.ErrInvalid }
+func (f *objectFile) Write([]byte) (int, error)          { return 0, ErrReadOnly }
+func (f *objectFile) Readdir(int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (f *objectFile) Stat() (os.FileInfo, error)         { return f.info, nil }
+
+type placeholderFile struct {
+	info *fileInfo
+}
+
+func (f *placeholderFile) Close() error                       { return nil }
+func (f *placeholderFile) Read([]byte) (int, error)           { return 0, io.EOF }
+func (f *placeholderFile) Seek(int64, int) (int64, error)     { return 0, nil }
+func (f *placeholderFile) Write([]byte) (int, error)          { return 0, ErrReadOnly }
+func (f *placeholderFile) Readdir(int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (f *placeholderFile) Stat() (os.FileInfo, error)         { return f.info, nil }
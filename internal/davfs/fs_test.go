@@ -0,0 +1,160 @@
+package davfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"skyimage/internal/config"
+	"skyimage/internal/data"
+	"skyimage/internal/files"
+)
+
+const testUserID uint = 1000000000000001
+
+func setupTestFS(t *testing.T) (*FileSystem, *gorm.DB) {
+	t.Helper()
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&data.User{}, &data.Album{}, &data.FileAsset{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user := data.User{ID: testUserID, Name: "tester", Email: "tester@example.com", PasswordHash: "hashed", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	fs := New(db, files.New(db, config.Config{}), testUserID, false)
+	fs.location = time.UTC
+	return fs, db
+}
+
+func createFile(t *testing.T, db *gorm.DB, key, originalName string, createdAt time.Time) data.FileAsset {
+	t.Helper()
+	file := data.FileAsset{
+		UserID:       testUserID,
+		StrategyID:   1,
+		Key:          key,
+		Path:         "/tmp/" + key,
+		RelativePath: key + ".png",
+		Name:         key + ".png",
+		OriginalName: originalName,
+		Size:         10,
+		MimeType:     "image/png",
+		ChecksumMD5:  "md5-" + key,
+		CreatedAt:    createdAt,
+	}
+	if err := db.Create(&file).Error; err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+	return file
+}
+
+func readdir(t *testing.T, fs *FileSystem, name string) []string {
+	t.Helper()
+	f, err := fs.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	infos, err := f.Readdir(0)
+	if err != nil {
+		t.Fatalf("readdir %s: %v", name, err)
+	}
+	out := make([]string, 0, len(infos))
+	for _, info := range infos {
+		out = append(out, info.Name())
+	}
+	return out
+}
+
+func TestLayout_DatesAndDuplicateNames(t *testing.T) {
+	fs, db := setupTestFS(t)
+	october := time.Date(2026, time.October, 3, 12, 0, 0, 0, time.UTC)
+	first := createFile(t, db, "a", "cat.png", october)
+	second := createFile(t, db, "b", "cat.png", october.Add(time.Hour))
+	createFile(t, db, "c", "", time.Date(2025, time.January, 9, 0, 0, 0, 0, time.UTC))
+
+	if got := readdir(t, fs, "/"); len(got) != 2 || got[0] != AlbumsDir || got[1] != DatesDir {
+		t.Fatalf("unexpected root listing: %v", got)
+	}
+	if got := readdir(t, fs, "/dates"); len(got) != 2 || got[0] != "2025" || got[1] != "2026" {
+		t.Fatalf("unexpected years: %v", got)
+	}
+	if got := readdir(t, fs, "/dates/2025/01"); len(got) != 1 || got[0] != "c.png" {
+		t.Fatalf("file without original name should fall back to stored name: %v", got)
+	}
+	got := readdir(t, fs, "/dates/2026/10")
+	if len(got) != 2 || got[0] != "cat.png" || got[1] != "cat (2).png" {
+		t.Fatalf("duplicate names should be suffixed with the id: %v", got)
+	}
+
+	node, err := fs.Resolve(context.Background(), "/dates/2026/10/cat (2).png")
+	if err != nil || node.File().ID != second.ID || first.ID == second.ID {
+		t.Fatalf("resolve duplicate = %+v, %v", node.File(), err)
+	}
+	info, err := fs.Stat(context.Background(), "/dates/2026/10/cat.png")
+	if err != nil || info.IsDir() || info.Size() != 10 {
+		t.Fatalf("stat file = %+v, %v", info, err)
+	}
+	if _, err := fs.Stat(context.Background(), "/dates/2026/11"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("empty month should not exist, got %v", err)
+	}
+}
+
+func TestAlbums_MkdirMoveAndRename(t *testing.T) {
+	fs, db := setupTestFS(t)
+	ctx := context.Background()
+	created := time.Date(2026, time.October, 3, 12, 0, 0, 0, time.UTC)
+	file := createFile(t, db, "a", "cat.png", created)
+
+	if err := fs.Mkdir(ctx, "/albums/Trips", 0o755); err != nil {
+		t.Fatalf("mkdir album: %v", err)
+	}
+	if err := fs.Mkdir(ctx, "/dates/2027", 0o755); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("mkdir outside albums should be rejected, got %v", err)
+	}
+
+	// 移入相册并改名
+	if err := fs.Rename(ctx, "/dates/2026/10/cat.png", "/albums/Trips/kitty.png"); err != nil {
+		t.Fatalf("move into album: %v", err)
+	}
+	if got := readdir(t, fs, "/albums/Trips"); len(got) != 1 || got[0] != "kitty.png" {
+		t.Fatalf("unexpected album listing: %v", got)
+	}
+	var album data.Album
+	db.First(&album, "name = ?", "Trips")
+	if album.ImageNum != 1 {
+		t.Fatalf("album image count = %d", album.ImageNum)
+	}
+
+	// 移回所在月份表示移出相册，移到其他月份被拒绝
+	if err := fs.Rename(ctx, "/albums/Trips/kitty.png", "/dates/2026/10/kitty.png"); err != nil {
+		t.Fatalf("move out of album: %v", err)
+	}
+	var reloaded data.FileAsset
+	db.First(&reloaded, file.ID)
+	if reloaded.AlbumID != nil || reloaded.OriginalName != "kitty.png" {
+		t.Fatalf("unexpected file after move: album=%v name=%q", reloaded.AlbumID, reloaded.OriginalName)
+	}
+
+	if err := fs.Rename(ctx, "/albums/Trips", "/albums/Holidays"); err != nil {
+		t.Fatalf("rename album: %v", err)
+	}
+	if err := fs.RemoveAll(ctx, "/albums/Holidays"); err != nil {
+		t.Fatalf("remove album: %v", err)
+	}
+	if got := readdir(t, fs, "/albums"); len(got) != 0 {
+		t.Fatalf("album should be removed: %v", got)
+	}
+	// 没有删除权限时不能删除图片
+	if err := fs.RemoveAll(ctx, "/dates/2026/10/kitty.png"); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("delete without permission should be rejected, got %v", err)
+	}
+}
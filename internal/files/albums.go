@@ -0,0 +1,164 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+var (
+	ErrAlbumNotFound    = errors.New("album not found")
+	ErrInvalidAlbumName = errors.New("invalid album name")
+)
+
+const maxAlbumNameLength = 64
+
+// ListAlbums 返回用户的全部相册。
+func (s *Service) ListAlbums(ctx context.Context, userID uint) ([]data.Album, error) {
+	var albums []data.Album
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id ASC").Find(&albums).Error
+	return albums, err
+}
+
+// FindAlbum 读取属于该用户的相册。
+func (s *Service) FindAlbum(ctx context.Context, userID, id uint) (data.Album, error) {
+	var album data.Album
+	err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&album).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return album, ErrAlbumNotFound
+	}
+	return album, err
+}
+
+// CreateAlbum 创建相册。
+func (s *Service) CreateAlbum(ctx context.Context, userID uint, name, intro string) (data.Album, error) {
+	name, err := normalizeAlbumName(name)
+	if err != nil {
+		return data.Album{}, err
+	}
+	album := data.Album{UserID: userID, Name: name, Intro: strings.TrimSpace(intro)}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&album).Error; err != nil {
+			return err
+		}
+		return tx.Model(&data.User{}).Where("id = ?", userID).
+			UpdateColumn("album_num", gorm.Expr("album_num + 1")).Error
+	})
+	return album, err
+}
+
+// RenameAlbum 修改相册名称。
+func (s *Service) RenameAlbum(ctx context.Context, userID, id uint, name string) (data.Album, error) {
+	name, err := normalizeAlbumName(name)
+	if err != nil {
+		return data.Album{}, err
+	}
+	album, err := s.FindAlbum(ctx, userID, id)
+	if err != nil {
+		return album, err
+	}
+	if err := s.db.WithContext(ctx).Model(&data.Album{}).Where("id = ?", id).Update("name", name).Error; err != nil {
+		return album, err
+	}
+	album.Name = name
+	return album, nil
+}
+
+// DeleteAlbum 删除相册，相册中的图片保留并移出相册。
+func (s *Service) DeleteAlbum(ctx context.Context, userID, id uint) error {
+	if _, err := s.FindAlbum(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&data.FileAsset{}).
+			Where("user_id = ? AND album_id = ?", userID, id).
+			UpdateColumn("album_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&data.Album{}, id).Error; err != nil {
+			return err
+		}
+		return tx.Model(&data.User{}).Where("id = ? AND album_num > 0", userID).
+			UpdateColumn("album_num", gorm.Expr("album_num - 1")).Error
+	})
+}
+
+// MoveToAlbum 将图片移入相册，albumID 为 0 时移出相册。
+func (s *Service) MoveToAlbum(ctx context.Context, userID, fileID, albumID uint) (data.FileAsset, error) {
+	var file data.FileAsset
+	if err := s.db.WithContext(ctx).First(&file, "id = ? AND user_id = ?", fileID, userID).Error; err != nil {
+		return file, err
+	}
+	var target *uint
+	if albumID != 0 {
+		if _, err := s.FindAlbum(ctx, userID, albumID); err != nil {
+			return file, err
+		}
+		target = &albumID
+	}
+	if err := s.db.WithContext(ctx).Model(&data.FileAsset{}).
+		Where("id = ?", fileID).
+		UpdateColumn("album_id", target).Error; err != nil {
+		return file, err
+	}
+	previous := file.AlbumID
+	file.AlbumID = target
+	s.refreshAlbumCounts(ctx, previous, target)
+	return file, nil
+}
+
+// RenameFile 修改图片的显示名称（原始文件名），不影响存储路径与外链。
+func (s *Service) RenameFile(ctx context.Context, userID, fileID uint, name string) (data.FileAsset, error) {
+	var file data.FileAsset
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 255 || strings.ContainsAny(name, "/\\") {
+		return file, errors.New("文件名无效")
+	}
+	if err := s.db.WithContext(ctx).First(&file, "id = ? AND user_id = ?", fileID, userID).Error; err != nil {
+		return file, err
+	}
+	if err := s.db.WithContext(ctx).Model(&data.FileAsset{}).
+		Where("id = ?", fileID).
+		UpdateColumn("original_name", name).Error; err != nil {
+		return file, err
+	}
+	file.OriginalName = name
+	return file, nil
+}
+
+// refreshAlbumCounts 重新统计相册图片数，失败不影响主流程。
+func (s *Service) refreshAlbumCounts(ctx context.Context, ids ...*uint) {
+	seen := make(map[uint]struct{}, len(ids))
+	for _, id := range ids {
+		if id == nil || *id == 0 {
+			continue
+		}
+		if _, ok := seen[*id]; ok {
+			continue
+		}
+		seen[*id] = struct{}{}
+		_ = s.db.WithContext(ctx).Model(&data.Album{}).
+			Where("id = ?", *id).
+			UpdateColumn("image_num", s.db.Model(&data.FileAsset{}).Select("COUNT(*)").Where("album_id = ?", *id)).Error
+	}
+}
+
+func albumIDsOf(files []data.FileAsset) []*uint {
+	out := make([]*uint, 0, len(files))
+	for _, file := range files {
+		out = append(out, file.AlbumID)
+	}
+	return out
+}
+
+func normalizeAlbumName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > maxAlbumNameLength || strings.ContainsAny(name, "/\\") {
+		return "", ErrInvalidAlbumName
+	}
+	return name, nil
+}
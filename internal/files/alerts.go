@@ -0,0 +1,62 @@
+package files
+
+import (
+	"fmt"
+	"strings"
+
+	"skyimage/internal/alerts"
+	"skyimage/internal/data"
+)
+
+// SetAlerts 设置管理员提醒服务，未设置时不推送提醒。
+func (s *Service) SetAlerts(service *alerts.Service) {
+	s.alerts = service
+}
+
+// alertAuditBlocked 在自动审核拦截图片时提醒管理员，deleted 表示图片已按策略删除。
+func (s *Service) alertAuditBlocked(file data.FileAsset, result storedAuditResult, deleted bool) {
+	if s.alerts == nil {
+		return
+	}
+	action := "已标记为违规"
+	if deleted {
+		action = "已自动删除"
+	}
+	lines := []string{
+		fmt.Sprintf("图片 %s（用户 %d）被 %s 拦截，%s。", firstNonBlank(file.OriginalName, file.Name), file.UserID, firstNonBlank(result.Provider, "审核服务"), action),
+	}
+	if label := firstNonBlank(result.Label, strings.Join(result.Labels, ", ")); label != "" {
+		lines = append(lines, "标签: "+label)
+	}
+	if message := strings.TrimSpace(result.Message); message != "" {
+		lines = append(lines, "说明: "+message)
+	}
+	s.alerts.Notify(alerts.EventAuditBlocked, alerts.Message{
+		Text: strings.Join(lines, "\n"),
+		URL:  "/dashboard/admin/images",
+	})
+}
+
+// alertStorageError 在写入存储失败时提醒管理员，同一策略的重复错误会被节流。
+func (s *Service) alertStorageError(strategy data.Strategy, driver, op string, err error) {
+	if s.alerts == nil || err == nil {
+		return
+	}
+	if driver = strings.ToLower(strings.TrimSpace(driver)); driver == "" {
+		driver = "local"
+	}
+	s.alerts.Notify(alerts.EventStorageError, alerts.Message{
+		Title: fmt.Sprintf("存储错误：%s（%s）", strategy.Name, driver),
+		Text:  fmt.Sprintf("储存策略 #%d %s失败: %v", strategy.ID, op, err),
+		URL:   "/dashboard/admin/strategies",
+	})
+}
+
+func firstNonBlank(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -20,6 +20,7 @@ import (
 	"gorm.io/gorm"
 
 	"skyimage/internal/data"
+	"skyimage/internal/metrics"
 	"skyimage/internal/notifications"
 )
 
@@ -81,6 +82,7 @@ type storedAuditResult struct {
 	Provider        string          `json:"provider,omitempty"`
 	Decision        string          `json:"decision,omitempty"`
 	Label           string          `json:"label,omitempty"`
+	Labels          []string        `json:"labels,omitempty"`
 	RiskLevel       string          `json:"riskLevel,omitempty"`
 	IsNSFW          bool            `json:"isNsfw"`
 	NSFWScore       float64         `json:"nsfwScore,omitempty"`
@@ -98,11 +100,13 @@ type FileAuditDTO struct {
 	Provider   string     `json:"provider,omitempty"`
 	RiskLevel  string     `json:"riskLevel,omitempty"`
 	Label      string     `json:"label,omitempty"`
+	Labels     []string   `json:"labels,omitempty"`
 	NSFWScore  float64    `json:"nsfwScore,omitempty"`
 	Confidence float64    `json:"confidence,omitempty"`
 	Message    string     `json:"message,omitempty"`
 	CheckedAt  *time.Time `json:"checkedAt,omitempty"`
 	ReviewedAt *time.Time `json:"reviewedAt,omitempty"`
+	ReviewedBy uint       `json:"reviewedBy,string,omitempty"`
 }
 
 type uapiNSFWResponse struct {
@@ -237,7 +241,11 @@ func (s *Service) queueAuditUpload(file data.FileAsset, cfg strategyConfig, file
 		return
 	}
 	payload := append([]byte(nil), dataBytes...)
-	go s.processAuditUpload(context.Background(), file, cfg, fileName, payload)
+	metrics.AuditQueue.Inc()
+	go func() {
+		defer metrics.AuditQueue.Dec()
+		s.processAuditUpload(context.Background(), file, cfg, fileName, payload)
+	}()
 }
 
 func (s *Service) processAuditUpload(ctx context.Context, file data.FileAsset, cfg strategyConfig, fileName string, dataBytes []byte) {
@@ -262,15 +270,22 @@ func (s *Service) processAuditUpload(ctx context.Context, file data.FileAsset, c
 	encoded := encodeAuditResult(result)
 	switch result.Decision {
 	case auditDecisionPass:
+		metrics.AuditResults.Inc(auditDecisionPass)
 		_ = s.persistAuditResult(ctx, file.ID, auditStatusApproved, encoded, &checkedAt)
 	case auditDecisionReview:
+		metrics.AuditResults.Inc(auditDecisionReview)
 		_ = s.persistAuditResult(ctx, file.ID, auditStatusPending, encoded, &checkedAt)
 	case auditDecisionBlock:
+		metrics.AuditResults.Inc(auditDecisionBlock)
 		if normalizeAuditAction(cfg.ImageAuditBlockAction, auditActionDelete) == auditActionDelete {
-			_ = s.deleteAfterAudit(ctx, file, notifications.ReasonAuditBlockDelete, "")
+			if s.deleteAfterAudit(ctx, file, notifications.ReasonAuditBlockDelete, "") == nil {
+				s.alertAuditBlocked(file, result, true)
+			}
 			return
 		}
-		_ = s.persistAuditResult(ctx, file.ID, auditStatusRejected, encoded, &checkedAt)
+		if s.persistAuditResult(ctx, file.ID, auditStatusRejected, encoded, &checkedAt) == nil {
+			s.alertAuditBlocked(file, result, false)
+		}
 	default:
 		s.completeAuditFailure(ctx, file, cfg, checkedAt, profile.Provider, "审核服务返回了无法识别的结果", result.Raw)
 	}
@@ -309,6 +324,7 @@ func (s *Service) completeAuditFailure(
 	message string,
 	raw json.RawMessage,
 ) {
+	metrics.AuditResults.Inc(auditDecisionError)
 	result := storedAuditResult{
 		Provider: provider,
 		Decision: auditDecisionError,
@@ -343,6 +359,8 @@ func (s *Service) callAuditProvider(ctx context.Context, profile data.AuditProfi
 		return s.callUAPIProvider(ctx, settings, fileName, dataBytes)
 	case auditProviderTencentCI:
 		return s.callTencentCIProvider(ctx, profile, publicURL)
+	case auditProviderWebhook:
+		return s.callWebhookProvider(ctx, profile, fileName, dataBytes, publicURL)
 	default:
 		return storedAuditResult{}, fmt.Errorf("不支持的审核服务提供商: %s", provider)
 	}
@@ -684,11 +702,13 @@ func buildFileAuditDTO(file data.FileAsset) *FileAuditDTO {
 		Provider:   result.Provider,
 		RiskLevel:  result.RiskLevel,
 		Label:      result.Label,
+		Labels:     result.Labels,
 		NSFWScore:  result.NSFWScore,
 		Confidence: result.Confidence,
 		Message:    result.Message,
 		CheckedAt:  file.AuditCheckedAt,
 		ReviewedAt: file.AuditReviewedAt,
+		ReviewedBy: file.AuditReviewedBy,
 	}
 }
 
@@ -696,29 +716,55 @@ func (s *Service) UpdateAuditStatusByAdmin(ctx context.Context, id uint, status
 	if strings.ToLower(strings.TrimSpace(status)) != auditStatusApproved {
 		return data.FileAsset{}, fmt.Errorf("仅支持将审核状态更新为 approved")
 	}
+	return s.UpdateAuditStatusByReviewer(ctx, 0, id, status)
+}
+
+// UpdateAuditStatusByReviewer 人工复核单张图片，并记录复核管理员与时间。
+func (s *Service) UpdateAuditStatusByReviewer(ctx context.Context, reviewerID uint, id uint, status string) (data.FileAsset, error) {
+	normalized := strings.ToLower(strings.TrimSpace(status))
+	if normalized != auditStatusApproved && normalized != auditStatusRejected {
+		return data.FileAsset{}, fmt.Errorf("仅支持将审核状态更新为 approved 或 rejected")
+	}
 	var file data.FileAsset
 	if err := s.db.WithContext(ctx).First(&file, "id = ?", id).Error; err != nil {
 		return data.FileAsset{}, err
 	}
+	if err := s.applyManualAuditReview(ctx, s.db, &file, reviewerID, normalized, ""); err != nil {
+		return data.FileAsset{}, err
+	}
+	s.emitAuditCompleted(ctx, file, normalized)
+	if normalized == auditStatusRejected {
+		_ = s.notifyAdminRejected(ctx, file, "")
+	}
+	return file, nil
+}
+
+func (s *Service) applyManualAuditReview(ctx context.Context, tx *gorm.DB, file *data.FileAsset, reviewerID uint, status string, reason string) error {
 	now := time.Now()
 	result := parseStoredAuditResult(file.AuditResult)
 	result.ManualOverride = true
-	result.Decision = auditDecisionPass
-	result.Message = ""
+	result.Message = strings.TrimSpace(reason)
+	if status == auditStatusRejected {
+		result.Decision = auditDecisionBlock
+	} else {
+		result.Decision = auditDecisionPass
+	}
 	encoded := encodeAuditResult(result)
-	if err := s.db.WithContext(ctx).Model(&data.FileAsset{}).
-		Where("id = ?", id).
-		Updates(map[string]interface{}{
-			"audit_status":      auditStatusApproved,
-			"audit_result":      encoded,
-			"audit_reviewed_at": &now,
-		}).Error; err != nil {
-		return data.FileAsset{}, err
+	updates := data.FileAuditColumns(encoded)
+	updates["audit_status"] = status
+	updates["audit_result"] = encoded
+	updates["audit_reviewed_at"] = &now
+	updates["audit_reviewed_by"] = reviewerID
+	if err := tx.WithContext(ctx).Model(&data.FileAsset{}).
+		Where("id = ?", file.ID).
+		Updates(updates).Error; err != nil {
+		return err
 	}
-	file.AuditStatus = auditStatusApproved
+	file.AuditStatus = status
 	file.AuditResult = encoded
 	file.AuditReviewedAt = &now
-	return file, nil
+	file.AuditReviewedBy = reviewerID
+	return nil
 }
 
 func (s *Service) persistAuditResult(ctx context.Context, fileID uint, status string, result datatypes.JSON, checkedAt *time.Time) error {
@@ -735,13 +781,20 @@ func (s *Service) persistAuditResult(ctx context.Context, fileID uint, status st
 	if shouldSkipAuditUpdate(file) {
 		return nil
 	}
-	return s.db.WithContext(ctx).Model(&data.FileAsset{}).
+	updates := data.FileAuditColumns(result)
+	updates["audit_status"] = status
+	updates["audit_result"] = result
+	updates["audit_checked_at"] = checkedAt
+	if err := s.db.WithContext(ctx).Model(&data.FileAsset{}).
 		Where("id = ?", fileID).
-		Updates(map[string]interface{}{
-			"audit_status":     status,
-			"audit_result":     result,
-			"audit_checked_at": checkedAt,
-		}).Error
+		Updates(updates).Error; err != nil {
+		return err
+	}
+	// pending 表示需要人工复核，审核尚未完成
+	if status != auditStatusPending {
+		s.emitAuditCompleted(ctx, file, status)
+	}
+	return nil
 }
 
 func (s *Service) deleteAfterAudit(ctx context.Context, file data.FileAsset, reasonType, auditMessage string) error {
@@ -774,6 +827,7 @@ func (s *Service) deleteAfterAudit(ctx context.Context, file data.FileAsset, rea
 		_ = s.deleteStoredObject(ctx, s.db, current)
 		return err
 	}
+	s.emitAuditCompleted(ctx, current, "deleted")
 	return s.notifyAuditDeleted(ctx, current, reasonType, auditMessage)
 }
 
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
@@ -49,6 +50,7 @@ func setupFilesTestDB(t *testing.T) *gorm.DB {
 		&data.UserNotification{},
 		&data.ConfigEntry{},
 		&data.AuditProfile{},
+		&data.ImageHashBlock{},
 	); err != nil {
 		t.Fatalf("failed to migrate: %v", err)
 	}
@@ -651,3 +653,118 @@ func TestTencentCI_Signing(t *testing.T) {
 		t.Fatalf("expected signed headers in auth, got %q", capturedAuth)
 	}
 }
+
+func TestWebhook_MultipartSignedAndMapped(t *testing.T) {
+	var capturedSignature, capturedTimestamp, capturedFile string
+	var capturedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedSignature = r.Header.Get("X-Audit-Sign")
+		capturedTimestamp = r.Header.Get("X-Skyimage-Timestamp")
+		capturedBody, _ = io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(capturedBody))
+		if err := r.ParseMultipartForm(1 << 20); err == nil {
+			if headers := r.MultipartForm.File["file"]; len(headers) > 0 {
+				capturedFile = headers[0].Filename
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"verdict":"DENY","score":92,"tags":["porn","sexy"],"note":"命中色情"}}`))
+	}))
+	defer server.Close()
+
+	db := setupFilesTestDB(t)
+	svc := New(db, config.Config{})
+	profile := data.AuditProfile{
+		ID:       1,
+		Provider: auditProviderWebhook,
+		Configs: datatypes.JSON([]byte(`{"url":"` + server.URL + `","secret":"s3cret","signature_header":"X-Audit-Sign",` +
+			`"decision_field":"data.verdict","score_field":"data.score","labels_field":"data.tags","message_field":"data.note",` +
+			`"pass_values":"allow","review_values":"suspect","block_values":"deny"}`)),
+	}
+
+	result, err := svc.callAuditProvider(context.Background(), profile, auditProfileConfig{MaxConcurrency: 1}, "test.png", []byte("png"), "")
+	if err != nil {
+		t.Fatalf("callAuditProvider failed: %v", err)
+	}
+	if capturedFile != "test.png" {
+		t.Fatalf("expected multipart file test.png, got %q", capturedFile)
+	}
+	expected := "sha256=" + signWebhookAuditPayload("s3cret", capturedTimestamp, capturedBody)
+	if capturedSignature != expected {
+		t.Fatalf("expected signature %q, got %q", expected, capturedSignature)
+	}
+	if result.Decision != auditDecisionBlock {
+		t.Fatalf("expected block decision, got %q", result.Decision)
+	}
+	if result.NSFWScore != 0.92 {
+		t.Fatalf("expected score 0.92, got %v", result.NSFWScore)
+	}
+	if strings.Join(result.Labels, ",") != "porn,sexy" || result.Label != "porn/sexy" {
+		t.Fatalf("unexpected labels %v / %q", result.Labels, result.Label)
+	}
+	if result.Message != "命中色情" {
+		t.Fatalf("expected mapped message, got %q", result.Message)
+	}
+}
+
+func TestWebhook_URLModeUsesScoreThresholds(t *testing.T) {
+	cases := []struct {
+		score    string
+		expected string
+	}{
+		{score: "0.1", expected: auditDecisionPass},
+		{score: "0.6", expected: auditDecisionReview},
+		{score: "0.95", expected: auditDecisionBlock},
+	}
+	for _, tc := range cases {
+		t.Run(tc.expected, func(t *testing.T) {
+			var payload map[string]string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewDecoder(r.Body).Decode(&payload)
+				_, _ = w.Write([]byte(`{"results":[{"nsfw":` + tc.score + `}]}`))
+			}))
+			defer server.Close()
+
+			db := setupFilesTestDB(t)
+			svc := New(db, config.Config{})
+			profile := data.AuditProfile{
+				ID:       1,
+				Provider: auditProviderWebhook,
+				Configs: datatypes.JSON([]byte(`{"url":"` + server.URL + `","mode":"url","score_field":"results.0.nsfw",` +
+					`"review_threshold":50,"block_threshold":90}`)),
+			}
+
+			result, err := svc.callAuditProvider(context.Background(), profile, auditProfileConfig{MaxConcurrency: 1}, "test.png", nil, "https://cdn.example.com/test.png")
+			if err != nil {
+				t.Fatalf("callAuditProvider failed: %v", err)
+			}
+			if payload["url"] != "https://cdn.example.com/test.png" {
+				t.Fatalf("expected public url in payload, got %v", payload)
+			}
+			if result.Decision != tc.expected {
+				t.Fatalf("expected decision %q, got %q", tc.expected, result.Decision)
+			}
+		})
+	}
+}
+
+func TestWebhook_UnmappedDecisionIsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"decision":"maybe"}`))
+	}))
+	defer server.Close()
+
+	db := setupFilesTestDB(t)
+	svc := New(db, config.Config{})
+	profile := data.AuditProfile{
+		ID:       1,
+		Provider: auditProviderWebhook,
+		Configs:  datatypes.JSON([]byte(`{"url":"` + server.URL + `","decision_field":"decision"}`)),
+	}
+
+	_, err := svc.callAuditProvider(context.Background(), profile, auditProfileConfig{MaxConcurrency: 1}, "test.png", []byte("png"), "")
+	var callErr *auditCallError
+	if !errors.As(err, &callErr) {
+		t.Fatalf("expected auditCallError, got %v", err)
+	}
+}
@@ -0,0 +1,367 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"skyimage/internal/data"
+)
+
+const (
+	auditProviderWebhook = "webhook"
+
+	webhookAuditModeMultipart = "multipart"
+	webhookAuditModeURL       = "url"
+
+	defaultWebhookSignatureHeader = "X-Skyimage-Signature"
+)
+
+type webhookAuditProfileConfig struct {
+	URL             string
+	Mode            string
+	Secret          string
+	SignatureHeader string
+	Timeout         time.Duration
+	DecisionField   string
+	ScoreField      string
+	LabelsField     string
+	MessageField    string
+	PassValues      []string
+	ReviewValues    []string
+	BlockValues     []string
+	// 阈值与 NSFWScore 同为 0-1，由配置中的百分制换算而来
+	ReviewThreshold float64
+	BlockThreshold  float64
+}
+
+func parseWebhookAuditProfileConfig(profile data.AuditProfile) webhookAuditProfileConfig {
+	cfg := webhookAuditProfileConfig{
+		Mode:            webhookAuditModeMultipart,
+		SignatureHeader: defaultWebhookSignatureHeader,
+		Timeout:         30 * time.Second,
+		PassValues:      []string{auditDecisionPass},
+		ReviewValues:    []string{auditDecisionReview},
+		BlockValues:     []string{auditDecisionBlock},
+	}
+	if len(profile.Configs) == 0 {
+		return cfg
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(profile.Configs, &raw); err != nil {
+		return cfg
+	}
+	cfg.URL = strings.TrimSpace(firstString(raw, "url", "endpoint"))
+	if mode := strings.ToLower(strings.TrimSpace(firstString(raw, "mode"))); mode == webhookAuditModeURL {
+		cfg.Mode = webhookAuditModeURL
+	}
+	cfg.Secret = strings.TrimSpace(firstString(raw, "secret"))
+	if header := strings.TrimSpace(firstString(raw, "signature_header", "signatureHeader")); header != "" {
+		cfg.SignatureHeader = header
+	}
+	if seconds := intFromAny(raw["timeout_seconds"]); seconds > 0 {
+		cfg.Timeout = time.Duration(seconds) * time.Second
+	}
+	cfg.DecisionField = strings.TrimSpace(firstString(raw, "decision_field", "decisionField"))
+	cfg.ScoreField = strings.TrimSpace(firstString(raw, "score_field", "scoreField"))
+	cfg.LabelsField = strings.TrimSpace(firstString(raw, "labels_field", "labelsField"))
+	cfg.MessageField = strings.TrimSpace(firstString(raw, "message_field", "messageField"))
+	if values := splitWebhookValues(firstString(raw, "pass_values")); len(values) > 0 {
+		cfg.PassValues = values
+	}
+	if values := splitWebhookValues(firstString(raw, "review_values")); len(values) > 0 {
+		cfg.ReviewValues = values
+	}
+	if values := splitWebhookValues(firstString(raw, "block_values")); len(values) > 0 {
+		cfg.BlockValues = values
+	}
+	cfg.ReviewThreshold = floatFromAny(raw["review_threshold"]) / 100
+	cfg.BlockThreshold = floatFromAny(raw["block_threshold"]) / 100
+	return cfg
+}
+
+func splitWebhookValues(value string) []string {
+	parts := strings.Split(value, ",")
+	items := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if trimmed := strings.ToLower(strings.TrimSpace(part)); trimmed != "" {
+			items = append(items, trimmed)
+		}
+	}
+	return items
+}
+
+// callWebhookProvider 将图片（multipart）或公开链接（JSON）发送到自定义审核服务，
+// 并按配置的字段映射把响应转换为 pass/review/block。
+func (s *Service) callWebhookProvider(ctx context.Context, profile data.AuditProfile, fileName string, dataBytes []byte, publicURL string) (storedAuditResult, error) {
+	cfg := parseWebhookAuditProfileConfig(profile)
+	if cfg.URL == "" {
+		return storedAuditResult{}, &auditCallError{message: "Webhook 审核配置缺少请求地址"}
+	}
+
+	var body bytes.Buffer
+	contentType := "application/json"
+	switch cfg.Mode {
+	case webhookAuditModeURL:
+		if strings.TrimSpace(publicURL) == "" {
+			return storedAuditResult{}, &auditCallError{message: "图片公开链接为空，无法调用 Webhook 审核"}
+		}
+		payload, err := json.Marshal(map[string]string{"url": publicURL, "name": fileName})
+		if err != nil {
+			return storedAuditResult{}, fmt.Errorf("生成审核请求失败")
+		}
+		body.Write(payload)
+	default:
+		writer := multipart.NewWriter(&body)
+		if publicURL != "" {
+			_ = writer.WriteField("url", publicURL)
+		}
+		part, err := writer.CreateFormFile("file", fileName)
+		if err != nil {
+			return storedAuditResult{}, fmt.Errorf("创建审核请求失败")
+		}
+		if _, err := part.Write(dataBytes); err != nil {
+			return storedAuditResult{}, fmt.Errorf("写入审核文件失败")
+		}
+		if err := writer.Close(); err != nil {
+			return storedAuditResult{}, fmt.Errorf("生成审核请求失败")
+		}
+		contentType = writer.FormDataContentType()
+	}
+
+	bodyBytes := body.Bytes()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return storedAuditResult{}, fmt.Errorf("创建审核请求失败")
+	}
+	req.Header.Set("Content-Type", contentType)
+	if cfg.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Skyimage-Timestamp", timestamp)
+		req.Header.Set(cfg.SignatureHeader, "sha256="+signWebhookAuditPayload(cfg.Secret, timestamp, bodyBytes))
+	}
+
+	client := &http.Client{Timeout: cfg.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return storedAuditResult{}, &auditCallError{
+			message:   fmt.Sprintf("调用 Webhook 审核服务失败: %v", err),
+			retryable: true,
+		}
+	}
+	defer resp.Body.Close()
+
+	rawBody, err := ioReadAllLimit(resp.Body, 2*1024*1024)
+	if err != nil {
+		return storedAuditResult{}, fmt.Errorf("读取审核结果失败")
+	}
+	encodedRaw := normalizeAuditRaw(rawBody)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return storedAuditResult{}, &auditCallError{
+			message:    fmt.Sprintf("Webhook 审核服务响应异常: HTTP %d", resp.StatusCode),
+			raw:        encodedRaw,
+			statusCode: resp.StatusCode,
+			retryable:  resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError,
+		}
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(rawBody, &payload); err != nil {
+		return storedAuditResult{}, &auditCallError{message: "Webhook 审核服务返回了无效数据", raw: encodedRaw}
+	}
+	return mapWebhookAuditResponse(cfg, payload, encodedRaw)
+}
+
+// signWebhookAuditPayload 对 "timestamp.body" 计算 HMAC-SHA256，接收方可据此校验来源并拒绝重放。
+func signWebhookAuditPayload(secret, timestamp string, body []byte) string {
+	return hmacSHA256Hex([]byte(secret), timestamp+"."+string(body))
+}
+
+func mapWebhookAuditResponse(cfg webhookAuditProfileConfig, payload interface{}, raw json.RawMessage) (storedAuditResult, error) {
+	result := storedAuditResult{
+		Provider: auditProviderWebhook,
+		Raw:      raw,
+	}
+
+	hasScore := false
+	if cfg.ScoreField != "" {
+		if value, ok := lookupJSONPath(payload, cfg.ScoreField); ok {
+			if score, ok := webhookScore(value); ok {
+				result.NSFWScore = score
+				result.NormalScore = 1 - score
+				result.Confidence = score
+				hasScore = true
+			}
+		}
+	}
+	if cfg.LabelsField != "" {
+		if value, ok := lookupJSONPath(payload, cfg.LabelsField); ok {
+			result.Labels = webhookLabels(value)
+			result.Label = strings.Join(result.Labels, "/")
+		}
+	}
+	if cfg.MessageField != "" {
+		if value, ok := lookupJSONPath(payload, cfg.MessageField); ok {
+			result.Message = strings.TrimSpace(stringFromAny(value))
+		}
+	}
+
+	if cfg.DecisionField != "" {
+		if value, ok := lookupJSONPath(payload, cfg.DecisionField); ok {
+			result.Decision = matchWebhookDecision(cfg, webhookDecisionValue(value))
+		}
+	}
+	if result.Decision == "" && hasScore {
+		switch {
+		case cfg.BlockThreshold > 0 && result.NSFWScore >= cfg.BlockThreshold:
+			result.Decision = auditDecisionBlock
+		case cfg.ReviewThreshold > 0 && result.NSFWScore >= cfg.ReviewThreshold:
+			result.Decision = auditDecisionReview
+		case cfg.BlockThreshold > 0 || cfg.ReviewThreshold > 0:
+			result.Decision = auditDecisionPass
+		}
+	}
+	if result.Decision == "" {
+		return storedAuditResult{}, &auditCallError{message: "Webhook 审核服务返回了无法识别的结果", raw: raw}
+	}
+
+	switch result.Decision {
+	case auditDecisionBlock:
+		result.RiskLevel = "high"
+		result.IsNSFW = true
+	case auditDecisionReview:
+		result.RiskLevel = "medium"
+	default:
+		result.RiskLevel = "low"
+	}
+	return result, nil
+}
+
+func matchWebhookDecision(cfg webhookAuditProfileConfig, value string) string {
+	if value == "" {
+		return ""
+	}
+	for _, candidate := range cfg.BlockValues {
+		if value == candidate {
+			return auditDecisionBlock
+		}
+	}
+	for _, candidate := range cfg.ReviewValues {
+		if value == candidate {
+			return auditDecisionReview
+		}
+	}
+	for _, candidate := range cfg.PassValues {
+		if value == candidate {
+			return auditDecisionPass
+		}
+	}
+	return ""
+}
+
+// webhookDecisionValue 兼容字符串、数字（如 0/1/2）与布尔类型的决策字段。
+func webhookDecisionValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return strings.ToLower(strings.TrimSpace(stringFromAny(value)))
+	}
+}
+
+// lookupJSONPath 按点号路径读取 JSON 字段，数字段表示数组下标，例如 data.results.0.label。
+func lookupJSONPath(payload interface{}, path string) (interface{}, bool) {
+	current := payload
+	for _, segment := range strings.Split(path, ".") {
+		segment = strings.TrimSpace(segment)
+		if segment == "" {
+			continue
+		}
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, current != nil
+}
+
+func webhookScore(value interface{}) (float64, bool) {
+	var score float64
+	switch v := value.(type) {
+	case float64:
+		score = v
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, false
+		}
+		score = parsed
+	default:
+		return 0, false
+	}
+	// 兼容 0-100 的百分制分数
+	if score > 1 {
+		score = score / 100
+	}
+	if score < 0 {
+		score = 0
+	}
+	if score > 1 {
+		score = 1
+	}
+	return score, true
+}
+
+func webhookLabels(value interface{}) []string {
+	var labels []string
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if label := strings.TrimSpace(stringFromAny(item)); label != "" {
+				labels = append(labels, label)
+			}
+		}
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if label := strings.TrimSpace(item); label != "" {
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels
+}
+
+func floatFromAny(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case string:
+		parsed, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return parsed
+	default:
+		return 0
+	}
+}
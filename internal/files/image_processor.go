@@ -9,12 +9,15 @@ import (
 	"image/png"
 	"io"
 	"strings"
+	"time"
 
 	webp "github.com/HugoSmits86/nativewebp"
 	"golang.org/x/image/bmp"
 	"golang.org/x/image/draw"
 	"golang.org/x/image/tiff"
 	webpdecode "golang.org/x/image/webp"
+
+	"skyimage/internal/metrics"
 )
 
 type ImageProcessConfig struct {
@@ -32,6 +35,7 @@ func ProcessImage(data []byte, mimeType string, config ImageProcessConfig) ([]by
 	if !isSupportedImageFormat(mimeType, config.SupportedFormats) {
 		return data, mimeType, nil
 	}
+	defer metrics.ImageProcessing.ObserveSince(time.Now(), "process")
 
 	img, format, err := decodeImage(bytes.NewReader(data), mimeType)
 	if err != nil {
@@ -204,6 +208,7 @@ func GenerateThumbnail(data []byte, mimeType string, config ThumbnailConfig) ([]
 	if !isSupportedImageFormat(mimeType, nil) {
 		return nil, "", 0, 0, fmt.Errorf("unsupported image format for thumbnail: %s", mimeType)
 	}
+	defer metrics.ImageProcessing.ObserveSince(time.Now(), "thumbnail")
 
 	img, _, err := decodeImage(bytes.NewReader(data), mimeType)
 	if err != nil {
@@ -0,0 +1,173 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+const (
+	ModerationActionApprove = "approve"
+	ModerationActionReject  = "reject"
+	ModerationActionDelete  = "delete"
+)
+
+// ModerationQuery 描述审核队列的筛选条件。
+// 决策、分数、服务商与标签取自 files 表上由 audit_result 派生的冗余列，筛选与分页都在数据库中完成。
+type ModerationQuery struct {
+	Status   string
+	Decision string
+	Provider string
+	Label    string
+	MinScore float64
+	MaxScore float64
+	Sort     string
+	Limit    int
+	Offset   int
+}
+
+type ModerationBatchResult struct {
+	Action    string `json:"action"`
+	Processed int64  `json:"processed"`
+	Missing   []uint `json:"missing,omitempty"`
+}
+
+// ListModerationQueue 返回待人工处理的图片，默认包含 pending 与 error 状态。
+func (s *Service) ListModerationQueue(ctx context.Context, query ModerationQuery) ([]data.FileAsset, int, error) {
+	if query.Limit <= 0 {
+		query.Limit = 50
+	}
+	if query.Limit > 100 {
+		query.Limit = 100
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+
+	db := s.db.WithContext(ctx).Model(&data.FileAsset{})
+	switch status := strings.ToLower(strings.TrimSpace(query.Status)); status {
+	case "", "queue":
+		db = db.Where("audit_status IN ?", []string{auditStatusPending, auditStatusError})
+	case "all":
+		db = db.Where("audit_status <> ?", auditStatusNone)
+	case auditStatusPending, auditStatusError, auditStatusRejected, auditStatusApproved:
+		db = db.Where("audit_status = ?", status)
+	default:
+		return nil, 0, &StatusError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("不支持的审核状态: %s", status)}
+	}
+	if decision := strings.ToLower(strings.TrimSpace(query.Decision)); decision != "" {
+		db = db.Where("audit_decision = ?", decision)
+	}
+	if provider := strings.ToLower(strings.TrimSpace(query.Provider)); provider != "" {
+		db = db.Where("audit_provider = ?", provider)
+	}
+	if label := strings.ToLower(strings.TrimSpace(query.Label)); label != "" {
+		db = db.Where("audit_labels LIKE ? ESCAPE '!'", "%"+data.EscapeLike(label)+"%")
+	}
+	if query.MinScore > 0 {
+		db = db.Where("audit_score >= ?", query.MinScore)
+	}
+	if query.MaxScore > 0 {
+		db = db.Where("audit_score <= ?", query.MaxScore)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order := "created_at DESC, id DESC"
+	switch strings.ToLower(strings.TrimSpace(query.Sort)) {
+	case "score", "score_desc":
+		order = "audit_score DESC, created_at DESC, id DESC"
+	case "score_asc":
+		order = "audit_score ASC, created_at DESC, id DESC"
+	case "oldest":
+		order = "created_at ASC, id ASC"
+	}
+	items := make([]data.FileAsset, 0, query.Limit)
+	if err := db.Preload("User").
+		Preload("Strategy").
+		Order(order).
+		Limit(query.Limit).
+		Offset(query.Offset).
+		Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, int(total), nil
+}
+
+// NormalizeModerationAction 校验并规范化审核操作名，不支持的操作返回 400。
+func NormalizeModerationAction(action string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(action))
+	switch normalized {
+	case ModerationActionApprove, ModerationActionReject, ModerationActionDelete:
+		return normalized, nil
+	}
+	return normalized, &StatusError{StatusCode: http.StatusBadRequest, Message: "不支持的审核操作，仅支持 approve、reject 或 delete"}
+}
+
+// ModerateBatch 批量处理审核队列：approve/reject 会记录复核管理员与时间，
+// reject 与 delete 会通过站内通知告知上传者原因。
+func (s *Service) ModerateBatch(ctx context.Context, reviewerID uint, ids []uint, action, reason string) (ModerationBatchResult, error) {
+	normalized, err := NormalizeModerationAction(action)
+	result := ModerationBatchResult{Action: normalized}
+	if err != nil {
+		return result, err
+	}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	var found []data.FileAsset
+	if err := s.db.WithContext(ctx).Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return result, err
+	}
+	existing := make(map[uint]struct{}, len(found))
+	for _, file := range found {
+		existing[file.ID] = struct{}{}
+	}
+	for _, id := range ids {
+		if _, ok := existing[id]; !ok {
+			result.Missing = append(result.Missing, id)
+		}
+	}
+
+	switch normalized {
+	case ModerationActionApprove, ModerationActionReject:
+		status := auditStatusApproved
+		if normalized == ModerationActionReject {
+			status = auditStatusRejected
+		}
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for i := range found {
+				if err := s.applyManualAuditReview(ctx, tx, &found[i], reviewerID, status, reason); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		for _, file := range found {
+			s.emitAuditCompleted(ctx, file, status)
+			if status == auditStatusRejected {
+				_ = s.notifyAdminRejected(ctx, file, reason)
+			}
+		}
+		result.Processed = int64(len(found))
+	default:
+		deleted, err := s.DeleteByAdminBatch(ctx, ids, reason)
+		if err != nil {
+			return result, err
+		}
+		result.Processed = deleted
+	}
+	return result, nil
+}
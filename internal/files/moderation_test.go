@@ -0,0 +1,141 @@
+package files
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"skyimage/internal/config"
+	"skyimage/internal/data"
+	"skyimage/internal/notifications"
+)
+
+func createModerationTestFile(t *testing.T, db *gorm.DB, userID uint, key, status, result string) data.FileAsset {
+	t.Helper()
+	file := data.FileAsset{
+		UserID:          userID,
+		Key:             key,
+		Name:            key + ".png",
+		Path:            "/tmp/" + key + ".png",
+		Size:            5,
+		MimeType:        "image/png",
+		Extension:       "png",
+		StorageProvider: "local",
+		AuditStatus:     status,
+		AuditResult:     datatypes.JSON([]byte(result)),
+	}
+	if err := db.Create(&file).Error; err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	if err := db.Model(&file).UpdateColumns(data.FileAuditColumns(file.AuditResult)).Error; err != nil {
+		t.Fatalf("failed to index audit result: %v", err)
+	}
+	return file
+}
+
+func TestListModerationQueue_FiltersByDecisionScoreAndLabel(t *testing.T) {
+	db := setupFilesTestDB(t)
+	svc := New(db, config.Config{})
+	user := data.User{ID: 1000000000000001, Name: "owner", Email: "owner@example.com", PasswordHash: "hashed", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	createModerationTestFile(t, db, user.ID, "low", auditStatusPending, `{"provider":"webhook","decision":"review","nsfwScore":0.55,"labels":["sexy"]}`)
+	high := createModerationTestFile(t, db, user.ID, "high", auditStatusPending, `{"provider":"webhook","decision":"review","nsfwScore":0.85,"labels":["porn","sexy"]}`)
+	createModerationTestFile(t, db, user.ID, "failed", auditStatusError, `{"provider":"uapis_nsfw","decision":"error","message":"timeout"}`)
+	createModerationTestFile(t, db, user.ID, "approved", auditStatusApproved, `{"provider":"webhook","decision":"pass","nsfwScore":0.01}`)
+
+	items, total, err := svc.ListModerationQueue(context.Background(), ModerationQuery{})
+	if err != nil {
+		t.Fatalf("ListModerationQueue failed: %v", err)
+	}
+	if total != 3 || len(items) != 3 {
+		t.Fatalf("expected pending and error items in default queue, got total=%d len=%d", total, len(items))
+	}
+
+	items, total, err = svc.ListModerationQueue(context.Background(), ModerationQuery{Decision: "review", MinScore: 0.6, Label: "porn"})
+	if err != nil {
+		t.Fatalf("ListModerationQueue failed: %v", err)
+	}
+	if total != 1 || items[0].ID != high.ID {
+		t.Fatalf("expected only high-score porn item, got total=%d items=%v", total, items)
+	}
+
+	items, total, err = svc.ListModerationQueue(context.Background(), ModerationQuery{Label: "100%"})
+	if err != nil {
+		t.Fatalf("ListModerationQueue failed: %v", err)
+	}
+	if total != 0 || len(items) != 0 {
+		t.Fatalf("expected LIKE wildcards in label to be matched literally, got total=%d", total)
+	}
+
+	items, total, err = svc.ListModerationQueue(context.Background(), ModerationQuery{Decision: "review", Limit: 1, Offset: 1, Sort: "score"})
+	if err != nil {
+		t.Fatalf("ListModerationQueue failed: %v", err)
+	}
+	if total != 2 || len(items) != 1 || items[0].ID == high.ID {
+		t.Fatalf("expected second page to hold the lower-score item, got total=%d items=%v", total, items)
+	}
+
+	items, _, err = svc.ListModerationQueue(context.Background(), ModerationQuery{Decision: "review", Sort: "score"})
+	if err != nil {
+		t.Fatalf("ListModerationQueue failed: %v", err)
+	}
+	if len(items) != 2 || items[0].ID != high.ID {
+		t.Fatalf("expected items sorted by score desc, got %v", items)
+	}
+}
+
+func TestModerateBatch_RecordsReviewer(t *testing.T) {
+	db := setupFilesTestDB(t)
+	svc := New(db, config.Config{})
+	user := data.User{ID: 1000000000000001, Name: "owner", Email: "owner@example.com", PasswordHash: "hashed", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	const reviewerID = uint(1000000000000002)
+
+	first := createModerationTestFile(t, db, user.ID, "first", auditStatusPending, `{"provider":"webhook","decision":"review","nsfwScore":0.7}`)
+	second := createModerationTestFile(t, db, user.ID, "second", auditStatusPending, `{"provider":"webhook","decision":"review","nsfwScore":0.9}`)
+
+	result, err := svc.ModerateBatch(context.Background(), reviewerID, []uint{first.ID, second.ID, 999}, ModerationActionReject, "违规内容")
+	if err != nil {
+		t.Fatalf("ModerateBatch failed: %v", err)
+	}
+	if result.Processed != 2 || len(result.Missing) != 1 || result.Missing[0] != 999 {
+		t.Fatalf("unexpected batch result: %+v", result)
+	}
+
+	var stored data.FileAsset
+	if err := db.First(&stored, first.ID).Error; err != nil {
+		t.Fatalf("failed to reload file: %v", err)
+	}
+	if stored.AuditStatus != auditStatusRejected {
+		t.Fatalf("expected rejected status, got %q", stored.AuditStatus)
+	}
+	if stored.AuditReviewedBy != reviewerID || stored.AuditReviewedAt == nil {
+		t.Fatalf("expected reviewer to be recorded, got by=%d at=%v", stored.AuditReviewedBy, stored.AuditReviewedAt)
+	}
+	audit := parseStoredAuditResult(stored.AuditResult)
+	if !audit.ManualOverride || audit.Decision != auditDecisionBlock || audit.Message != "违规内容" {
+		t.Fatalf("unexpected stored audit result: %+v", audit)
+	}
+	if audit.NSFWScore != 0.7 {
+		t.Fatalf("expected provider score to be preserved, got %v", audit.NSFWScore)
+	}
+
+	var notices []data.UserNotification
+	if err := db.Where("user_id = ?", user.ID).Find(&notices).Error; err != nil {
+		t.Fatalf("failed to list notifications: %v", err)
+	}
+	if len(notices) != 2 || notices[0].Type != notifications.TypeImageRejected || notices[0].Message != "违规内容" {
+		t.Fatalf("expected uploader to be notified with the reject reason, got %+v", notices)
+	}
+
+	if _, err := svc.ModerateBatch(context.Background(), reviewerID, []uint{first.ID}, "ban", ""); err == nil {
+		t.Fatal("expected unknown action to be rejected")
+	}
+}
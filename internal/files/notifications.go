@@ -20,3 +20,10 @@ func (s *Service) notifyAdminDeleted(ctx context.Context, file data.FileAsset, r
 	}
 	return s.notifications.CreateImageDeletedByAdmin(ctx, file, strings.TrimSpace(reason))
 }
+
+func (s *Service) notifyAdminRejected(ctx context.Context, file data.FileAsset, reason string) error {
+	if s.notifications == nil {
+		return nil
+	}
+	return s.notifications.CreateImageRejectedByAdmin(ctx, file, strings.TrimSpace(reason))
+}
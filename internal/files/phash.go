@@ -0,0 +1,273 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/image/draw"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+const (
+	ConfigHashBlockDistance = "images.hash_block_distance"
+
+	DefaultHashBlockDistance = 6
+	MaxHashBlockDistance     = 20
+
+	// storedFileReadTimeout 限制回退到公开链接读取原图的耗时，避免补算任务被慢速源站卡住
+	storedFileReadTimeout = 60 * time.Second
+
+	hashBlockScanBatch = 500
+)
+
+// errHashBlockMatched 用于在命中屏蔽记录后提前结束分批扫描。
+var errHashBlockMatched = errors.New("hash block matched")
+
+// ComputePerceptualHash 计算 64 位 dHash：缩放到 9x8 灰度图后比较相邻像素亮度。
+// 轻微裁剪、压缩、调色后的图片汉明距离仍然很小，用于识别重复上传。
+func ComputePerceptualHash(payload []byte, mimeType string) (string, error) {
+	return ComputePerceptualHashFrom(bytes.NewReader(payload), mimeType)
+}
+
+// ComputePerceptualHashFrom 直接从流中解码计算感知哈希，上传时无需把原图整体读入内存。
+func ComputePerceptualHashFrom(r io.Reader, mimeType string) (string, error) {
+	if !isSupportedImageFormat(mimeType, nil) {
+		return "", fmt.Errorf("unsupported image format for perceptual hash: %s", mimeType)
+	}
+	img, _, err := decodeImage(r, mimeType)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	return perceptualHashFromImage(img), nil
+}
+
+func perceptualHashFromImage(img image.Image) string {
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small.GrayAt(x, y).Y < small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return fmt.Sprintf("%016x", hash)
+}
+
+// PerceptualHashDistance 返回两个十六进制哈希之间的汉明距离；任一哈希无效时 ok 为 false。
+func PerceptualHashDistance(a, b string) (int, bool) {
+	left, err := strconv.ParseUint(strings.TrimSpace(a), 16, 64)
+	if err != nil || len(strings.TrimSpace(a)) != 16 {
+		return 0, false
+	}
+	right, err := strconv.ParseUint(strings.TrimSpace(b), 16, 64)
+	if err != nil || len(strings.TrimSpace(b)) != 16 {
+		return 0, false
+	}
+	return bits.OnesCount64(left ^ right), true
+}
+
+func NormalizeHashBlockDistance(raw string) int {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return DefaultHashBlockDistance
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return DefaultHashBlockDistance
+	}
+	return NormalizeHashBlockDistanceValue(value)
+}
+
+func NormalizeHashBlockDistanceValue(value int) int {
+	if value < 0 {
+		return 0
+	}
+	if value > MaxHashBlockDistance {
+		return MaxHashBlockDistance
+	}
+	return value
+}
+
+func (s *Service) hashBlockDistance(ctx context.Context) int {
+	var entry data.ConfigEntry
+	if err := s.db.WithContext(ctx).Where("key = ?", ConfigHashBlockDistance).First(&entry).Error; err != nil {
+		return DefaultHashBlockDistance
+	}
+	return NormalizeHashBlockDistance(entry.Value)
+}
+
+// checkHashBlocklist 在写入存储前拒绝与屏蔽列表相近的图片。
+// 距离阈值小于分段数时只取至少有一个字节段相同的候选；更大的阈值无法用分段排除，按批扫描。
+func (s *Service) checkHashBlocklist(ctx context.Context, hash string) error {
+	bands := data.ImageHashBands(hash)
+	if bands == nil {
+		return nil
+	}
+	maxDistance := s.hashBlockDistance(ctx)
+	blocked := &StatusError{StatusCode: http.StatusForbidden, Message: "该图片已被管理员屏蔽，禁止上传"}
+	query := s.db.WithContext(ctx).Model(&data.ImageHashBlock{}).Select("id", "hash")
+	switch {
+	case maxDistance == 0:
+		var count int64
+		if err := query.Where("hash = ?", hash).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return blocked
+		}
+		return nil
+	case maxDistance < data.ImageHashBandCount:
+		conditions := s.db.Where("band0 = ?", bands["band0"])
+		for i := 1; i < data.ImageHashBandCount; i++ {
+			column := "band" + strconv.Itoa(i)
+			conditions = conditions.Or(column+" = ?", bands[column])
+		}
+		query = query.Where(conditions)
+	}
+	matched := false
+	var batch []data.ImageHashBlock
+	err := query.FindInBatches(&batch, hashBlockScanBatch, func(tx *gorm.DB, _ int) error {
+		for _, block := range batch {
+			if distance, ok := PerceptualHashDistance(hash, block.Hash); ok && distance <= maxDistance {
+				matched = true
+				return errHashBlockMatched
+			}
+		}
+		return nil
+	}).Error
+	if matched {
+		return blocked
+	}
+	return err
+}
+
+func (s *Service) ListHashBlocks(ctx context.Context, limit, offset int) ([]data.ImageHashBlock, int64, error) {
+	var total int64
+	if err := s.db.WithContext(ctx).Model(&data.ImageHashBlock{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var items []data.ImageHashBlock
+	err := s.db.WithContext(ctx).Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error
+	return items, total, err
+}
+
+func (s *Service) DeleteHashBlock(ctx context.Context, id uint) error {
+	result := s.db.WithContext(ctx).Delete(&data.ImageHashBlock{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// BlockFileHashes 将已有图片的感知哈希加入屏蔽列表，通常在驳回或删除违规图片前调用。
+// 旧图片没有哈希时会读取原图补算。
+func (s *Service) BlockFileHashes(ctx context.Context, adminID uint, ids []uint, reason string) ([]data.ImageHashBlock, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var found []data.FileAsset
+	if err := s.db.WithContext(ctx).Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	reason = strings.TrimSpace(reason)
+	if len([]rune(reason)) > 255 {
+		reason = string([]rune(reason)[:255])
+	}
+	blocks := make([]data.ImageHashBlock, 0, len(found))
+	for _, file := range found {
+		hash, err := s.ensurePerceptualHash(ctx, &file)
+		if err != nil {
+			return blocks, fmt.Errorf("图片 %s 无法生成指纹: %w", file.Name, err)
+		}
+		var block data.ImageHashBlock
+		err = s.db.WithContext(ctx).Where("hash = ?", hash).First(&block).Error
+		if err == nil {
+			blocks = append(blocks, block)
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return blocks, err
+		}
+		block = data.ImageHashBlock{
+			Hash:         hash,
+			Reason:       reason,
+			SourceFileID: file.ID,
+			SourceName:   file.OriginalName,
+			CreatedBy:    adminID,
+		}
+		block.SetBands()
+		if err := s.db.WithContext(ctx).Create(&block).Error; err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+func (s *Service) ensurePerceptualHash(ctx context.Context, file *data.FileAsset) (string, error) {
+	if strings.TrimSpace(file.PerceptualHash) != "" {
+		return file.PerceptualHash, nil
+	}
+	payload, err := s.readStoredFile(ctx, *file)
+	if err != nil {
+		return "", err
+	}
+	hash, err := ComputePerceptualHash(payload, file.MimeType)
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.WithContext(ctx).Model(&data.FileAsset{}).
+		Where("id = ?", file.ID).
+		UpdateColumn("perceptual_hash", hash).Error; err != nil {
+		return "", err
+	}
+	file.PerceptualHash = hash
+	return hash, nil
+}
+
+// readStoredFile 读取原图内容，先尝试存储驱动，再回退到公开链接。
+func (s *Service) readStoredFile(ctx context.Context, file data.FileAsset) ([]byte, error) {
+	const maxRead = 64 * 1024 * 1024
+	if obj, err := s.OpenStoredObject(ctx, file.StrategyID, file.Path, file.RelativePath, file.StorageProvider); err == nil {
+		defer obj.Body.Close()
+		return io.ReadAll(io.LimitReader(obj.Body, maxRead))
+	}
+	publicURL, err := s.PublicURL(ctx, file)
+	if err != nil || strings.TrimSpace(publicURL) == "" {
+		return nil, fmt.Errorf("无法读取原图")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, publicURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: storedFileReadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("读取原图失败: HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRead))
+}
@@ -0,0 +1,171 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"skyimage/internal/config"
+	"skyimage/internal/data"
+)
+
+func encodeShadedPNG(t *testing.T, width, height int, shade func(x, y int) uint8) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := shade(x, y)
+			img.Set(x, y, color.RGBA{R: v, G: v / 2, B: 255 - v, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func createLocalUploadUserAndStrategy(t *testing.T, db *gorm.DB, root string) data.User {
+	t.Helper()
+
+	group := data.Group{Name: "默认组"}
+	if err := db.Create(&group).Error; err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	user := data.User{
+		ID:           1000000000000001,
+		Name:         "uploader",
+		Email:        "uploader@example.com",
+		PasswordHash: "hashed",
+		Status:       1,
+		GroupID:      &group.ID,
+		Configs:      datatypes.JSON([]byte(`{}`)),
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	cfgBytes, _ := json.Marshal(map[string]interface{}{
+		"driver":        "local",
+		"root":          root,
+		"url":           "https://cdn.example.com",
+		"path_template": "{year}/{month}/{day}/{uuid}",
+	})
+	strategy := data.Strategy{Name: "本地策略", Configs: datatypes.JSON(cfgBytes)}
+	if err := db.Create(&strategy).Error; err != nil {
+		t.Fatalf("failed to create strategy: %v", err)
+	}
+	if err := db.Create(&data.GroupStrategy{GroupID: group.ID, StrategyID: strategy.ID}).Error; err != nil {
+		t.Fatalf("failed to create group strategy link: %v", err)
+	}
+	return user
+}
+
+func TestComputePerceptualHash_SimilarImagesAreClose(t *testing.T) {
+	gradient := encodeShadedPNG(t, 64, 48, func(x, y int) uint8 { return uint8((x*4 + y*2) % 256) })
+	brighter := encodeShadedPNG(t, 64, 48, func(x, y int) uint8 {
+		v := (x*4+y*2)%256 + 6
+		if v > 255 {
+			v = 255
+		}
+		return uint8(v)
+	})
+	different := encodeShadedPNG(t, 64, 48, func(x, y int) uint8 { return uint8((255 - x*4 + y*5) % 256) })
+
+	base, err := ComputePerceptualHash(gradient, "image/png")
+	if err != nil {
+		t.Fatalf("ComputePerceptualHash failed: %v", err)
+	}
+	similar, _ := ComputePerceptualHash(brighter, "image/png")
+	other, _ := ComputePerceptualHash(different, "image/png")
+
+	if distance, ok := PerceptualHashDistance(base, similar); !ok || distance > 4 {
+		t.Fatalf("expected similar images to be close, got distance=%d ok=%v", distance, ok)
+	}
+	if distance, ok := PerceptualHashDistance(base, other); !ok || distance <= DefaultHashBlockDistance {
+		t.Fatalf("expected different images to be far apart, got distance=%d ok=%v", distance, ok)
+	}
+	if _, ok := PerceptualHashDistance(base, "not-a-hash"); ok {
+		t.Fatal("expected invalid hash to be rejected")
+	}
+}
+
+func TestUpload_RejectsBlockedPerceptualHash(t *testing.T) {
+	db := setupFilesTestDB(t)
+	root := t.TempDir()
+	user := createLocalUploadUserAndStrategy(t, db, root)
+	svc := New(db, config.Config{})
+
+	original := encodeShadedPNG(t, 64, 48, func(x, y int) uint8 { return uint8((x*4 + y*2) % 256) })
+	stored, err := svc.Upload(context.Background(), user, createUploadFileHeader(t, "abuse.png", original), UploadOptions{})
+	if err != nil {
+		t.Fatalf("initial upload failed: %v", err)
+	}
+	if stored.PerceptualHash == "" {
+		t.Fatal("expected perceptual hash to be stored on upload")
+	}
+
+	blocks, err := svc.BlockFileHashes(context.Background(), 1000000000000009, []uint{stored.ID}, "违规内容")
+	if err != nil || len(blocks) != 1 {
+		t.Fatalf("BlockFileHashes failed: %v (%d)", err, len(blocks))
+	}
+	if blocks[0].CreatedBy != 1000000000000009 || blocks[0].SourceFileID != stored.ID {
+		t.Fatalf("unexpected block entry: %+v", blocks[0])
+	}
+
+	tweaked := encodeShadedPNG(t, 64, 48, func(x, y int) uint8 {
+		v := (x*4+y*2)%256 + 4
+		if v > 255 {
+			v = 255
+		}
+		return uint8(v)
+	})
+	_, err = svc.Upload(context.Background(), user, createUploadFileHeader(t, "reupload.png", tweaked), UploadOptions{})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 403 {
+		t.Fatalf("expected near-duplicate upload to be blocked, got %v", err)
+	}
+
+	unrelated := encodeShadedPNG(t, 64, 48, func(x, y int) uint8 { return uint8((255 - x*4 + y*5) % 256) })
+	if _, err := svc.Upload(context.Background(), user, createUploadFileHeader(t, "ok.png", unrelated), UploadOptions{}); err != nil {
+		t.Fatalf("expected unrelated upload to succeed, got %v", err)
+	}
+}
+
+func TestCheckHashBlocklist_UsesBandsAndFallsBackForWideDistances(t *testing.T) {
+	db := setupFilesTestDB(t)
+	svc := New(db, config.Config{})
+	ctx := context.Background()
+
+	// 每个字节各翻转一位：与屏蔽哈希距离为 8，且没有任何字节段相同
+	block := data.ImageHashBlock{Hash: "0000000000000000"}
+	block.SetBands()
+	if err := db.Create(&block).Error; err != nil {
+		t.Fatalf("failed to create block: %v", err)
+	}
+	if block.Band7 != 0 {
+		t.Fatalf("unexpected band value: %+v", block)
+	}
+	spread := "0101010101010101"
+
+	if err := svc.checkHashBlocklist(ctx, "0000000000000003"); err == nil {
+		t.Fatal("expected hash within the default distance to be blocked")
+	}
+	if err := svc.checkHashBlocklist(ctx, spread); err != nil {
+		t.Fatalf("expected distant hash to pass the default distance, got %v", err)
+	}
+
+	if err := db.Create(&data.ConfigEntry{Key: ConfigHashBlockDistance, Value: "10"}).Error; err != nil {
+		t.Fatalf("failed to set distance: %v", err)
+	}
+	if err := svc.checkHashBlocklist(ctx, spread); err == nil {
+		t.Fatal("expected wide distance to scan beyond the matching bands")
+	}
+}
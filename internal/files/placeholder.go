@@ -0,0 +1,379 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/image/draw"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+const (
+	placeholderSampleSize  = 32
+	placeholderPaletteSize = 5
+
+	placeholderBackfillBatch = 50
+)
+
+// ImagePlaceholder 是前端渐进加载使用的占位信息。
+type ImagePlaceholder struct {
+	BlurHash       string
+	DominantColors []string
+}
+
+// ComputeImagePlaceholder 缩放到小尺寸后同时计算 BlurHash 与主色调色板。
+func ComputeImagePlaceholder(payload []byte, mimeType string) (ImagePlaceholder, error) {
+	if !isSupportedImageFormat(mimeType, nil) {
+		return ImagePlaceholder{}, fmt.Errorf("unsupported image format for placeholder: %s", mimeType)
+	}
+	img, _, err := decodeImage(bytes.NewReader(payload), mimeType)
+	if err != nil {
+		return ImagePlaceholder{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() <= 0 || bounds.Dy() <= 0 {
+		return ImagePlaceholder{}, fmt.Errorf("empty image")
+	}
+	width, height := placeholderSampleSize, placeholderSampleSize
+	if bounds.Dx() > bounds.Dy() {
+		height = max(1, placeholderSampleSize*bounds.Dy()/bounds.Dx())
+	} else if bounds.Dy() > bounds.Dx() {
+		width = max(1, placeholderSampleSize*bounds.Dx()/bounds.Dy())
+	}
+	small := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, bounds, draw.Src, nil)
+
+	componentsX, componentsY := 4, 3
+	if height > width {
+		componentsX, componentsY = 3, 4
+	}
+	return ImagePlaceholder{
+		BlurHash:       encodeBlurHash(small, componentsX, componentsY),
+		DominantColors: dominantColors(small, placeholderPaletteSize),
+	}, nil
+}
+
+const blurHashCharacters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// encodeBlurHash 按 https://github.com/woltapp/blurhash 的算法编码。
+func encodeBlurHash(img *image.RGBA, componentsX, componentsY int) string {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	factors := make([][3]float64, 0, componentsX*componentsY)
+	for j := 0; j < componentsY; j++ {
+		for i := 0; i < componentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1.0
+			}
+			var r, g, b float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					offset := img.PixOffset(x, y)
+					r += basis * srgbToLinear(img.Pix[offset])
+					g += basis * srgbToLinear(img.Pix[offset+1])
+					b += basis * srgbToLinear(img.Pix[offset+2])
+				}
+			}
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{r * scale, g * scale, b * scale})
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(encodeBase83((componentsX-1)+(componentsY-1)*9, 1))
+
+	maximumValue := 1.0
+	ac := factors[1:]
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, factor := range ac {
+			for _, v := range factor {
+				actualMax = math.Max(actualMax, math.Abs(v))
+			}
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maximumValue = float64(quantisedMax+1) / 166
+		sb.WriteString(encodeBase83(quantisedMax, 1))
+	} else {
+		sb.WriteString(encodeBase83(0, 1))
+	}
+
+	dc := factors[0]
+	sb.WriteString(encodeBase83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+	for _, factor := range ac {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximumValue, 0.5)*9+9.5))))
+		}
+		sb.WriteString(encodeBase83(quant(factor[0])*19*19+quant(factor[1])*19+quant(factor[2]), 2))
+	}
+	return sb.String()
+}
+
+func encodeBase83(value, length int) string {
+	out := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		out[i-1] = blurHashCharacters[digit]
+	}
+	return string(out)
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(math.Round(v * 12.92 * 255))
+	}
+	return int(math.Round((1.055*math.Pow(v, 1/2.4) - 0.055) * 255))
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
+
+// dominantColors 将像素量化到 4bit/通道后统计出现次数，取占比最高且彼此差异明显的颜色。
+func dominantColors(img *image.RGBA, limit int) []string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			offset := img.PixOffset(x, y)
+			r, g, b, a := int(img.Pix[offset]), int(img.Pix[offset+1]), int(img.Pix[offset+2]), img.Pix[offset+3]
+			if a < 128 {
+				continue
+			}
+			key := (r>>4)<<8 | (g>>4)<<4 | b>>4
+			item, ok := buckets[key]
+			if !ok {
+				item = &bucket{}
+				buckets[key] = item
+			}
+			item.count++
+			item.r += r
+			item.g += g
+			item.b += b
+		}
+	}
+	ordered := make([]*bucket, 0, len(buckets))
+	for _, item := range buckets {
+		ordered = append(ordered, item)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].count != ordered[j].count {
+			return ordered[i].count > ordered[j].count
+		}
+		return ordered[i].r+ordered[i].g+ordered[i].b < ordered[j].r+ordered[j].g+ordered[j].b
+	})
+
+	type rgb struct{ r, g, b int }
+	picked := make([]rgb, 0, limit)
+	for _, item := range ordered {
+		if len(picked) >= limit {
+			break
+		}
+		candidate := rgb{item.r / item.count, item.g / item.count, item.b / item.count}
+		distinct := true
+		for _, existing := range picked {
+			dr, dg, db := candidate.r-existing.r, candidate.g-existing.g, candidate.b-existing.b
+			if dr*dr+dg*dg+db*db < 32*32 {
+				distinct = false
+				break
+			}
+		}
+		if distinct {
+			picked = append(picked, candidate)
+		}
+	}
+	colors := make([]string, 0, len(picked))
+	for _, item := range picked {
+		colors = append(colors, fmt.Sprintf("#%02x%02x%02x", item.r, item.g, item.b))
+	}
+	return colors
+}
+
+// ParseDominantColors 将数据库中以逗号分隔的颜色还原为列表。
+func ParseDominantColors(raw string) []string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	parts := strings.Split(raw, ",")
+	colors := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			colors = append(colors, part)
+		}
+	}
+	return colors
+}
+
+func applyImagePlaceholder(file *data.FileAsset, placeholder ImagePlaceholder) {
+	file.BlurHash = placeholder.BlurHash
+	file.DominantColors = strings.Join(placeholder.DominantColors, ",")
+}
+
+// PlaceholderBackfillStatus 记录历史图片占位信息与感知哈希补算任务的进度。
+type PlaceholderBackfillStatus struct {
+	Running    bool       `json:"running"`
+	Processed  int        `json:"processed"`
+	Updated    int        `json:"updated"`
+	Failed     int        `json:"failed"`
+	Remaining  int64      `json:"remaining"`
+	LastError  string     `json:"lastError,omitempty"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+func (s *Service) placeholderBackfillQuery(ctx context.Context) *gorm.DB {
+	return s.db.WithContext(ctx).
+		Model(&data.FileAsset{}).
+		Where("(blur_hash IS NULL OR blur_hash = '' OR perceptual_hash IS NULL OR perceptual_hash = '') AND mime_type LIKE ?", "image/%")
+}
+
+// PlaceholderBackfillStatus 返回当前（或最近一次）补算任务的状态，并刷新剩余数量。
+func (s *Service) PlaceholderBackfillStatus(ctx context.Context) (PlaceholderBackfillStatus, error) {
+	var remaining int64
+	if err := s.placeholderBackfillQuery(ctx).Count(&remaining).Error; err != nil {
+		return PlaceholderBackfillStatus{}, err
+	}
+	s.backfillMu.Lock()
+	defer s.backfillMu.Unlock()
+	status := s.backfill
+	status.Remaining = remaining
+	return status, nil
+}
+
+// StartPlaceholderBackfill 在后台为缺少 BlurHash 或感知哈希的历史图片补算；已有任务运行时返回 false。
+func (s *Service) StartPlaceholderBackfill() bool {
+	s.backfillMu.Lock()
+	if s.backfill.Running {
+		s.backfillMu.Unlock()
+		return false
+	}
+	now := time.Now()
+	s.backfill = PlaceholderBackfillStatus{Running: true, StartedAt: &now}
+	s.backfillMu.Unlock()
+
+	go func() {
+		err := s.BackfillPlaceholders(context.Background(), func(updated, failed bool, err error) {
+			s.backfillMu.Lock()
+			defer s.backfillMu.Unlock()
+			s.backfill.Processed++
+			if updated {
+				s.backfill.Updated++
+			}
+			if failed {
+				s.backfill.Failed++
+				if err != nil {
+					s.backfill.LastError = err.Error()
+				}
+			}
+		})
+		if err != nil {
+			log.Printf("placeholder backfill: %v", err)
+		}
+		finished := time.Now()
+		s.backfillMu.Lock()
+		s.backfill.Running = false
+		s.backfill.FinishedAt = &finished
+		if err != nil {
+			s.backfill.LastError = err.Error()
+		}
+		s.backfillMu.Unlock()
+	}()
+	return true
+}
+
+// BackfillPlaceholders 按 ID 顺序分批处理缺少占位信息或感知哈希的图片，读取失败的图片会被跳过。
+// progress 在每张图片处理后回调，可为 nil。
+func (s *Service) BackfillPlaceholders(ctx context.Context, progress func(updated, failed bool, err error)) error {
+	var cursor uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var batch []data.FileAsset
+		if err := s.placeholderBackfillQuery(ctx).
+			Where("id > ?", cursor).
+			Order("id ASC").
+			Limit(placeholderBackfillBatch).
+			Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		for _, file := range batch {
+			cursor = file.ID
+			err := s.backfillFilePlaceholder(ctx, file)
+			if progress != nil {
+				progress(err == nil, err != nil, err)
+			}
+		}
+	}
+}
+
+func (s *Service) backfillFilePlaceholder(ctx context.Context, file data.FileAsset) error {
+	payload, err := s.readStoredFile(ctx, file)
+	if err != nil {
+		return fmt.Errorf("file %d: %w", file.ID, err)
+	}
+	// 占位信息与感知哈希分别补算，其中一项失败时仍保存另一项
+	updates := map[string]interface{}{}
+	var computeErr error
+	if strings.TrimSpace(file.BlurHash) == "" {
+		if placeholder, err := ComputeImagePlaceholder(payload, file.MimeType); err != nil {
+			computeErr = err
+		} else {
+			applyImagePlaceholder(&file, placeholder)
+			updates["blur_hash"] = file.BlurHash
+			updates["dominant_colors"] = file.DominantColors
+		}
+	}
+	// 早期上传的图片没有感知哈希，相似图搜索与去重扫描会漏掉它们
+	if strings.TrimSpace(file.PerceptualHash) == "" {
+		if hash, err := ComputePerceptualHash(payload, file.MimeType); err != nil {
+			computeErr = err
+		} else {
+			updates["perceptual_hash"] = hash
+		}
+	}
+	// 顺便补全早期上传缺失的尺寸信息
+	if file.Width == 0 || file.Height == 0 {
+		if w, h, err := ReadImageDimensions(payload, file.MimeType); err == nil {
+			updates["width"] = w
+			updates["height"] = h
+		}
+	}
+	if len(updates) > 0 {
+		if err := s.db.WithContext(ctx).Model(&data.FileAsset{}).Where("id = ?", file.ID).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+	}
+	if computeErr != nil {
+		return fmt.Errorf("file %d: %w", file.ID, computeErr)
+	}
+	return nil
+}
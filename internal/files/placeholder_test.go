@@ -0,0 +1,88 @@
+package files
+
+import (
+	"context"
+	"testing"
+
+	"skyimage/internal/config"
+	"skyimage/internal/data"
+)
+
+func TestComputeImagePlaceholder_SolidColor(t *testing.T) {
+	payload := encodeShadedPNG(t, 40, 20, func(x, y int) uint8 { return 200 })
+	placeholder, err := ComputeImagePlaceholder(payload, "image/png")
+	if err != nil {
+		t.Fatalf("ComputeImagePlaceholder failed: %v", err)
+	}
+	// 4x3 分量：1 位尺寸 + 1 位最大值 + 4 位 DC + 11 个 AC 各 2 位
+	if len(placeholder.BlurHash) != 28 {
+		t.Fatalf("unexpected blurhash length: %q", placeholder.BlurHash)
+	}
+	if placeholder.BlurHash[0] != encodeBase83(3+2*9, 1)[0] {
+		t.Fatalf("expected 4x3 components for landscape image, got %q", placeholder.BlurHash)
+	}
+	if len(placeholder.DominantColors) != 1 || placeholder.DominantColors[0] != "#c86437" {
+		t.Fatalf("unexpected dominant colors: %v", placeholder.DominantColors)
+	}
+	if _, err := ComputeImagePlaceholder([]byte("nope"), "image/png"); err == nil {
+		t.Fatal("expected invalid image to fail")
+	}
+}
+
+func TestUploadAndBackfillPlaceholders(t *testing.T) {
+	db := setupFilesTestDB(t)
+	root := t.TempDir()
+	user := createLocalUploadUserAndStrategy(t, db, root)
+	svc := New(db, config.Config{})
+	ctx := context.Background()
+
+	payload := encodeShadedPNG(t, 64, 48, func(x, y int) uint8 { return uint8((x*4 + y*2) % 256) })
+	stored, err := svc.Upload(ctx, user, createUploadFileHeader(t, "gradient.png", payload), UploadOptions{})
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if stored.BlurHash == "" || stored.DominantColors == "" {
+		t.Fatalf("expected placeholder metadata on upload, got %q / %q", stored.BlurHash, stored.DominantColors)
+	}
+	dto, err := svc.ToDTO(ctx, stored)
+	if err != nil {
+		t.Fatalf("ToDTO failed: %v", err)
+	}
+	if dto.BlurHash != stored.BlurHash || len(dto.DominantColors) == 0 {
+		t.Fatalf("expected placeholder metadata in dto, got %+v", dto)
+	}
+
+	if err := db.Model(&data.FileAsset{}).Where("id = ?", stored.ID).
+		UpdateColumns(map[string]interface{}{"blur_hash": "", "dominant_colors": "", "perceptual_hash": "", "width": 0, "height": 0}).Error; err != nil {
+		t.Fatalf("failed to reset placeholder: %v", err)
+	}
+	status, err := svc.PlaceholderBackfillStatus(ctx)
+	if err != nil || status.Remaining != 1 {
+		t.Fatalf("expected one file pending backfill, got %+v (%v)", status, err)
+	}
+
+	var updated, failed int
+	if err := svc.BackfillPlaceholders(ctx, func(ok, bad bool, _ error) {
+		if ok {
+			updated++
+		}
+		if bad {
+			failed++
+		}
+	}); err != nil {
+		t.Fatalf("BackfillPlaceholders failed: %v", err)
+	}
+	if updated != 1 || failed != 0 {
+		t.Fatalf("unexpected backfill counts: updated=%d failed=%d", updated, failed)
+	}
+	var reloaded data.FileAsset
+	if err := db.First(&reloaded, stored.ID).Error; err != nil {
+		t.Fatalf("failed to reload file: %v", err)
+	}
+	if reloaded.BlurHash != stored.BlurHash || reloaded.Width != 64 || reloaded.Height != 48 {
+		t.Fatalf("unexpected backfilled file: hash=%q size=%dx%d", reloaded.BlurHash, reloaded.Width, reloaded.Height)
+	}
+	if reloaded.PerceptualHash == "" || reloaded.PerceptualHash != stored.PerceptualHash {
+		t.Fatalf("expected perceptual hash to be backfilled, got %q want %q", reloaded.PerceptualHash, stored.PerceptualHash)
+	}
+}
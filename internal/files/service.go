@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"math"
 	"math/rand"
 	"mime/multipart"
 	"net/http"
@@ -24,33 +23,52 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"skyimage/internal/alerts"
 	"skyimage/internal/config"
 	"skyimage/internal/data"
+	"skyimage/internal/metrics"
 	"skyimage/internal/notifications"
+	"skyimage/internal/ratelimit"
 	"skyimage/internal/users"
+	"skyimage/internal/webhooks"
 )
 
 type Service struct {
 	db             *gorm.DB
 	cfg            config.Config
-	limiter        *uploadLimiter
+	limiter        *ratelimit.Limiter
 	notifications  *notifications.Service
+	webhooks       *webhooks.Service
+	alerts         *alerts.Service
 	auditLimiterMu sync.Mutex
 	auditLimiters  map[uint]*auditLimiterEntry
+	backfillMu     sync.Mutex
+	backfill       PlaceholderBackfillStatus
 }
 
 func New(db *gorm.DB, cfg config.Config) *Service {
 	return &Service{
 		db:            db,
 		cfg:           cfg,
-		limiter:       newUploadLimiter(),
+		limiter:       ratelimit.New(ratelimit.NewMemoryStore()),
 		notifications: notifications.New(db),
 	}
 }
 
+// SetLimiter 使用共享的限流器（多实例部署时计数保存在数据库中）。
+func (s *Service) SetLimiter(limiter *ratelimit.Limiter) {
+	if limiter != nil {
+		s.limiter = limiter
+	}
+}
+
 type UploadOptions struct {
 	Visibility string
 	StrategyID uint
+	// AllowedStrategyIDs 限制可使用的储存策略（来自受限的 API Token），为空表示不限制。
+	AllowedStrategyIDs []uint
+	// AlbumID 上传后放入的相册，0 表示不放入相册。
+	AlbumID uint
 }
 
 type FileDTO struct {
@@ -79,6 +97,8 @@ type FileDTO struct {
 	RelativePath       string        `json:"relativePath"`
 	Width              int           `json:"width,omitempty"`
 	Height             int           `json:"height,omitempty"`
+	BlurHash           string        `json:"blurHash,omitempty"`
+	DominantColors     []string      `json:"dominantColors,omitempty"`
 	Audit              *FileAuditDTO `json:"audit,omitempty"`
 }
 
@@ -159,10 +179,17 @@ func isMinIODriver(driver string) bool {
 }
 
 func (s *Service) Upload(ctx context.Context, user data.User, file *multipart.FileHeader, opts UploadOptions) (data.FileAsset, error) {
-	strategy, cfg, err := s.resolveStrategy(ctx, user, opts.StrategyID)
+	strategy, cfg, err := s.resolveStrategy(ctx, user, opts.StrategyID, opts.AllowedStrategyIDs)
 	if err != nil {
 		return data.FileAsset{}, err
 	}
+	var albumID *uint
+	if opts.AlbumID != 0 {
+		if _, err := s.FindAlbum(ctx, user.ID, opts.AlbumID); err != nil {
+			return data.FileAsset{}, err
+		}
+		albumID = &opts.AlbumID
+	}
 
 	// Check file size limit and capacity limit from group config + user capacity bonus
 	var groupCfg map[string]interface{}
@@ -176,13 +203,15 @@ func (s *Service) Upload(ctx context.Context, user data.User, file *multipart.Fi
 		maxMinute := intFromAny(groupCfg["upload_rate_minute"])
 		maxHour := intFromAny(groupCfg["upload_rate_hour"])
 		if (maxMinute > 0 || maxHour > 0) && s.limiter != nil {
-			allowed, retryAfter := s.limiter.Allow(user.ID, maxMinute, maxHour)
-			if !allowed {
-				waitSeconds := int(math.Ceil(retryAfter.Seconds()))
-				if waitSeconds < 1 {
-					waitSeconds = 1
+			result := s.limiter.TakeAll(ctx,
+				ratelimit.Rule{Key: fmt.Sprintf("upload:minute:%d", user.ID), Limit: maxMinute, Window: time.Minute},
+				ratelimit.Rule{Key: fmt.Sprintf("upload:hour:%d", user.ID), Limit: maxHour, Window: time.Hour},
+			)
+			if !result.Allowed {
+				return data.FileAsset{}, &ratelimit.ExceededError{
+					Result:  result,
+					Message: fmt.Sprintf("上传过于频繁，请在 %d 秒后重试", ratelimit.Seconds(result.Reset)),
 				}
-				return data.FileAsset{}, fmt.Errorf("上传过于频繁，请在 %d 秒后重试", waitSeconds)
 			}
 		}
 
@@ -344,6 +373,30 @@ func (s *Service) Upload(ctx context.Context, user data.User, file *multipart.Fi
 		}
 	}
 
+	// 计算感知哈希，并在写入存储前拦截屏蔽列表中的相似图片。
+	// 未经处理的原图直接从上传流解码，仍以流式写入存储
+	var perceptualHash string
+	if isSupportedImageFormat(contentType, nil) {
+		var hash string
+		var hashErr error
+		if len(fullData) > 0 {
+			hash, hashErr = ComputePerceptualHash(fullData, contentType)
+		} else {
+			handleHash, err := file.Open()
+			if err != nil {
+				return data.FileAsset{}, err
+			}
+			hash, hashErr = ComputePerceptualHashFrom(handleHash, contentType)
+			_ = handleHash.Close()
+		}
+		if hashErr == nil {
+			perceptualHash = hash
+			if err := s.checkHashBlocklist(ctx, hash); err != nil {
+				return data.FileAsset{}, err
+			}
+		}
+	}
+
 	var storeResult storeObjectResult
 	if len(fullData) > 0 {
 		// 使用处理后的数据
@@ -353,6 +406,7 @@ func (s *Service) Upload(ctx context.Context, user data.User, file *multipart.Fi
 		storeResult, err = s.storeObject(ctx, cfg, relativePath, head[:headSize], handle)
 	}
 	if err != nil {
+		s.alertStorageError(strategy, cfg.Driver, "写入文件", err)
 		return data.FileAsset{}, err
 	}
 
@@ -360,6 +414,7 @@ func (s *Service) Upload(ctx context.Context, user data.User, file *multipart.Fi
 		UserID:          user.ID,
 		GroupID:         user.GroupID,
 		StrategyID:      strategy.ID,
+		AlbumID:         albumID,
 		Key:             key,
 		Path:            storeResult.Path,
 		RelativePath:    filepath.ToSlash(relativePath),
@@ -370,6 +425,7 @@ func (s *Service) Upload(ctx context.Context, user data.User, file *multipart.Fi
 		Extension:       strings.TrimPrefix(strings.ToLower(filepath.Ext(relativePath)), "."),
 		ChecksumMD5:     hex.EncodeToString(storeResult.MD5),
 		ChecksumSHA1:    hex.EncodeToString(storeResult.SHA1),
+		PerceptualHash:  perceptualHash,
 		Visibility:      users.NormalizeVisibility(opts.Visibility),
 		StorageProvider: cfg.Driver,
 		AuditStatus:     initialAuditStatus(cfg, contentType),
@@ -385,7 +441,7 @@ func (s *Service) Upload(ctx context.Context, user data.User, file *multipart.Fi
 	}
 	fileAsset.PublicURL = publicURL
 
-	// Capture original dimensions when possible (best-effort).
+	// Capture original dimensions and placeholder metadata when possible (best-effort).
 	if isSupportedImageFormat(contentType, nil) {
 		dimData := fullData
 		if len(dimData) == 0 {
@@ -399,6 +455,9 @@ func (s *Service) Upload(ctx context.Context, user data.User, file *multipart.Fi
 				fileAsset.Width = w
 				fileAsset.Height = h
 			}
+			if placeholder, err := ComputeImagePlaceholder(dimData, contentType); err == nil {
+				applyImagePlaceholder(&fileAsset, placeholder)
+			}
 		}
 	}
 
@@ -425,7 +484,17 @@ func (s *Service) Upload(ctx context.Context, user data.User, file *multipart.Fi
 	_ = s.db.WithContext(ctx).Model(&data.User{}).
 		Where("id = ?", user.ID).
 		UpdateColumn("use_capacity", gorm.Expr("use_capacity + ?", fileAsset.Size))
+	s.refreshAlbumCounts(ctx, fileAsset.AlbumID)
 
+	uploadDriver := strings.ToLower(strings.TrimSpace(cfg.Driver))
+	if uploadDriver == "" {
+		uploadDriver = "local"
+	}
+	strategyLabel := strconv.FormatUint(uint64(strategy.ID), 10)
+	metrics.Uploads.Inc(strategyLabel, uploadDriver)
+	metrics.UploadBytes.Add(float64(fileAsset.Size), strategyLabel, uploadDriver)
+
+	s.emitFileEvent(ctx, webhooks.EventFileUploaded, fileAsset)
 	s.queueAuditUpload(fileAsset, cfg, file.Filename, fullData)
 
 	return fileAsset, nil
@@ -479,6 +548,8 @@ func (s *Service) ToDTO(ctx context.Context, file data.FileAsset) (FileDTO, erro
 		RelativePath:       file.RelativePath,
 		Width:              file.Width,
 		Height:             file.Height,
+		BlurHash:           file.BlurHash,
+		DominantColors:     ParseDominantColors(file.DominantColors),
 		Audit:              buildFileAuditDTO(file),
 	}, nil
 }
@@ -501,12 +572,12 @@ func (s *Service) ToDTOForViewer(ctx context.Context, file data.FileAsset, viewe
 }
 
 // CanAccessThumbnail reports whether viewer may load the thumbnail object.
-// Thumbnails are login-only: owner of the file, or any admin.
+// Thumbnails are login-only: owner of the file, or staff with moderation permission.
 func CanAccessThumbnail(file data.FileAsset, viewer *data.User) bool {
 	if viewer == nil || viewer.ID == 0 {
 		return false
 	}
-	if viewer.IsAdmin || viewer.IsSuperAdmin {
+	if viewer.HasAdminPermission(data.AdminPermModeration) {
 		return true
 	}
 	return file.UserID == viewer.ID
@@ -673,6 +744,7 @@ func (s *Service) StoreBytes(ctx context.Context, strategyID uint, relativePath
 	}
 	result, err := s.storeObjectWithData(ctx, cfg, rel, payload)
 	if err != nil {
+		s.alertStorageError(strategy, cfg.Driver, "写入文件", err)
 		return StoredObject{}, err
 	}
 	driver := strings.ToLower(strings.TrimSpace(cfg.Driver))
@@ -1218,8 +1290,8 @@ func (s *Service) ListStrategiesForUser(ctx context.Context, user data.User) ([]
 }
 
 func (s *Service) Delete(ctx context.Context, userID uint, id uint) error {
-	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		var file data.FileAsset
+	var file data.FileAsset
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		if err := tx.First(&file, "id = ? AND user_id = ?", id, userID).Error; err != nil {
 			return err
 		}
@@ -1236,7 +1308,12 @@ func (s *Service) Delete(ctx context.Context, userID uint, id uint) error {
 			return err
 		}
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+	s.refreshAlbumCounts(ctx, file.AlbumID)
+	s.emitFileEvent(ctx, webhooks.EventFileDeleted, file)
+	return nil
 }
 
 func (s *Service) UpdateVisibility(ctx context.Context, userID uint, id uint, visibility string) (data.FileAsset, error) {
@@ -1251,7 +1328,11 @@ func (s *Service) UpdateVisibility(ctx context.Context, userID uint, id uint, vi
 		UpdateColumn("visibility", normalized).Error; err != nil {
 		return file, err
 	}
+	changed := file.Visibility != normalized
 	file.Visibility = normalized
+	if changed {
+		s.emitFileEvent(ctx, webhooks.EventFileVisibilityChanged, file)
+	}
 	return file, nil
 }
 
@@ -1260,10 +1341,14 @@ func (s *Service) UpdateVisibilityBatch(ctx context.Context, userID uint, ids []
 		return 0, nil
 	}
 	normalized := users.NormalizeVisibility(visibility)
+	changed := s.visibilityChangeCandidates(ctx, ids, normalized, userID)
 	result := s.db.WithContext(ctx).
 		Model(&data.FileAsset{}).
 		Where("user_id = ? AND id IN ?", userID, ids).
 		UpdateColumn("visibility", normalized)
+	if result.Error == nil {
+		s.emitVisibilityChanged(ctx, changed, normalized)
+	}
 	return result.RowsAffected, result.Error
 }
 
@@ -1280,6 +1365,8 @@ func (s *Service) DeleteByAdmin(ctx context.Context, id uint, reason string) err
 	}); err != nil {
 		return err
 	}
+	s.refreshAlbumCounts(ctx, deleted.AlbumID)
+	s.emitFileEvent(ctx, webhooks.EventFileDeleted, deleted)
 	return s.notifyAdminDeleted(ctx, deleted, reason)
 }
 
@@ -1317,6 +1404,8 @@ func (s *Service) DeleteBatch(ctx context.Context, userID uint, ids []uint) (int
 	for _, file := range files {
 		_ = s.deleteStoredObject(ctx, s.db, file)
 	}
+	s.refreshAlbumCounts(ctx, albumIDsOf(files)...)
+	s.emitFileEvents(ctx, webhooks.EventFileDeleted, files)
 	return returned, nil
 }
 
@@ -1332,7 +1421,11 @@ func (s *Service) UpdateVisibilityByAdmin(ctx context.Context, id uint, visibili
 		UpdateColumn("visibility", normalized).Error; err != nil {
 		return file, err
 	}
+	changed := file.Visibility != normalized
 	file.Visibility = normalized
+	if changed {
+		s.emitFileEvent(ctx, webhooks.EventFileVisibilityChanged, file)
+	}
 	return file, nil
 }
 
@@ -1341,10 +1434,14 @@ func (s *Service) UpdateVisibilityByAdminBatch(ctx context.Context, ids []uint,
 		return 0, nil
 	}
 	normalized := users.NormalizeVisibility(visibility)
+	changed := s.visibilityChangeCandidates(ctx, ids, normalized, 0)
 	result := s.db.WithContext(ctx).
 		Model(&data.FileAsset{}).
 		Where("id IN ?", ids).
 		UpdateColumn("visibility", normalized)
+	if result.Error == nil {
+		s.emitVisibilityChanged(ctx, changed, normalized)
+	}
 	return result.RowsAffected, result.Error
 }
 
@@ -1372,8 +1469,10 @@ func (s *Service) DeleteByAdminBatch(ctx context.Context, ids []uint, reason str
 	}
 	for _, file := range files {
 		_ = s.deleteStoredObject(ctx, s.db, file)
+		s.emitFileEvent(ctx, webhooks.EventFileDeleted, file)
 		_ = s.notifyAdminDeleted(ctx, file, reason)
 	}
+	s.refreshAlbumCounts(ctx, albumIDsOf(files)...)
 	return returned, nil
 }
 
@@ -1415,7 +1514,7 @@ func removeFile(path string) error {
 	return nil
 }
 
-func (s *Service) resolveStrategy(ctx context.Context, user data.User, requested uint) (data.Strategy, strategyConfig, error) {
+func (s *Service) resolveStrategy(ctx context.Context, user data.User, requested uint, allowed []uint) (data.Strategy, strategyConfig, error) {
 	strategies, err := s.ListStrategiesForUser(ctx, user)
 	if err != nil {
 		return data.Strategy{}, strategyConfig{}, err
@@ -1423,6 +1522,27 @@ func (s *Service) resolveStrategy(ctx context.Context, user data.User, requested
 	if len(strategies) == 0 {
 		return data.Strategy{}, strategyConfig{}, fmt.Errorf("没有可用的储存策略")
 	}
+	if len(allowed) > 0 {
+		permitted := make(map[uint]struct{}, len(allowed))
+		for _, id := range allowed {
+			permitted[id] = struct{}{}
+		}
+		filtered := make([]data.Strategy, 0, len(strategies))
+		for _, item := range strategies {
+			if _, ok := permitted[item.ID]; ok {
+				filtered = append(filtered, item)
+			}
+		}
+		if len(filtered) == 0 {
+			return data.Strategy{}, strategyConfig{}, &StatusError{StatusCode: http.StatusForbidden, Message: "当前 API Token 无权使用任何可用的储存策略"}
+		}
+		if requested > 0 {
+			if _, ok := permitted[requested]; !ok {
+				return data.Strategy{}, strategyConfig{}, &StatusError{StatusCode: http.StatusForbidden, Message: "当前 API Token 无权使用该储存策略"}
+			}
+		}
+		strategies = filtered
+	}
 	var selected data.Strategy
 	if requested > 0 {
 		for _, item := range strategies {
@@ -2119,31 +2239,31 @@ func isAllowedMediaType(contentType string) bool {
 	return false
 }
 
+// mediaTypeExtensions 定义 MIME 类型与扩展名的映射关系，首个扩展名为默认扩展名
+var mediaTypeExtensions = map[string][]string{
+	"image/jpeg":       {"jpg", "jpeg"},
+	"image/png":        {"png"},
+	"image/gif":        {"gif"},
+	"image/webp":       {"webp"},
+	"image/bmp":        {"bmp"},
+	"image/tiff":       {"tiff", "tif"},
+	"image/avif":       {"avif"},
+	"image/x-icon":     {"ico"},
+	"video/mp4":        {"mp4"},
+	"video/webm":       {"webm"},
+	"video/ogg":        {"ogg", "ogv"},
+	"video/quicktime":  {"mov"},
+	"video/x-msvideo":  {"avi"},
+	"video/x-matroska": {"mkv"},
+	"video/mpeg":       {"mpeg", "mpg"},
+}
+
 // validateMimeExtensionMatch 验证 MIME 类型与文件扩展名是否匹配
 func validateMimeExtensionMatch(mimeType string, ext string) bool {
 	ext = strings.ToLower(strings.TrimSpace(ext))
 	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
 
-	// 定义 MIME 类型与扩展名的映射关系
-	validMappings := map[string][]string{
-		"image/jpeg":       {"jpg", "jpeg"},
-		"image/png":        {"png"},
-		"image/gif":        {"gif"},
-		"image/webp":       {"webp"},
-		"image/bmp":        {"bmp"},
-		"image/tiff":       {"tiff", "tif"},
-		"image/avif":       {"avif"},
-		"image/x-icon":     {"ico"},
-		"video/mp4":        {"mp4"},
-		"video/webm":       {"webm"},
-		"video/ogg":        {"ogg", "ogv"},
-		"video/quicktime":  {"mov"},
-		"video/x-msvideo":  {"avi"},
-		"video/x-matroska": {"mkv"},
-		"video/mpeg":       {"mpeg", "mpg"},
-	}
-
-	allowedExts, exists := validMappings[mimeType]
+	allowedExts, exists := mediaTypeExtensions[mimeType]
 	if !exists {
 		return false
 	}
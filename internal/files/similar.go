@@ -0,0 +1,236 @@
+package files
+
+import (
+	"context"
+	"math/bits"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"skyimage/internal/data"
+)
+
+const (
+	DefaultSimilarDistance   = 10
+	DefaultDuplicateDistance = 4
+
+	similarScanLimit   = 20000
+	duplicateScanLimit = 10000
+)
+
+type SimilarMatch struct {
+	File     data.FileAsset
+	Distance int
+}
+
+type DuplicateCluster struct {
+	Files         []SimilarMatch
+	RedundantSize int64
+}
+
+type hashCandidate struct {
+	ID   uint
+	Hash string `gorm:"column:perceptual_hash"`
+}
+
+func normalizeSimilarDistance(value, fallback int) int {
+	if value <= 0 {
+		return fallback
+	}
+	if value > MaxHashBlockDistance {
+		return MaxHashBlockDistance
+	}
+	return value
+}
+
+// FindSimilarByFile 以已有图片为样本查找相似图片；scopeUserID 为 0 时在全站范围内查找。
+func (s *Service) FindSimilarByFile(ctx context.Context, scopeUserID uint, fileID uint, maxDistance, limit int) (data.FileAsset, []SimilarMatch, error) {
+	var source data.FileAsset
+	query := s.db.WithContext(ctx).Where("id = ?", fileID)
+	if scopeUserID != 0 {
+		query = query.Where("user_id = ?", scopeUserID)
+	}
+	if err := query.First(&source).Error; err != nil {
+		return data.FileAsset{}, nil, err
+	}
+	hash, err := s.ensurePerceptualHash(ctx, &source)
+	if err != nil {
+		return source, nil, &StatusError{StatusCode: http.StatusUnprocessableEntity, Message: "该文件无法生成图片指纹"}
+	}
+	matches, err := s.findSimilarByHash(ctx, scopeUserID, hash, source.ID, maxDistance, limit)
+	return source, matches, err
+}
+
+// FindSimilarByImage 以上传的样本图片查找相似图片，样本本身不会被保存。
+func (s *Service) FindSimilarByImage(ctx context.Context, scopeUserID uint, payload []byte, mimeType string, maxDistance, limit int) ([]SimilarMatch, error) {
+	hash, err := ComputePerceptualHash(payload, normalizeContentType(mimeType))
+	if err != nil {
+		return nil, &StatusError{StatusCode: http.StatusBadRequest, Message: "无法识别的样本图片"}
+	}
+	return s.findSimilarByHash(ctx, scopeUserID, hash, 0, maxDistance, limit)
+}
+
+func (s *Service) findSimilarByHash(ctx context.Context, scopeUserID uint, hash string, excludeID uint, maxDistance, limit int) ([]SimilarMatch, error) {
+	maxDistance = normalizeSimilarDistance(maxDistance, DefaultSimilarDistance)
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	candidates, err := s.loadHashCandidates(ctx, scopeUserID, similarScanLimit)
+	if err != nil {
+		return nil, err
+	}
+	distances := make(map[uint]int)
+	ids := make([]uint, 0)
+	for _, candidate := range candidates {
+		if candidate.ID == excludeID {
+			continue
+		}
+		distance, ok := PerceptualHashDistance(hash, candidate.Hash)
+		if !ok || distance > maxDistance {
+			continue
+		}
+		distances[candidate.ID] = distance
+		ids = append(ids, candidate.ID)
+	}
+	if len(ids) == 0 {
+		return []SimilarMatch{}, nil
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		if distances[ids[i]] != distances[ids[j]] {
+			return distances[ids[i]] < distances[ids[j]]
+		}
+		return ids[i] > ids[j]
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	var found []data.FileAsset
+	if err := s.db.WithContext(ctx).Preload("User").Preload("Strategy").Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]data.FileAsset, len(found))
+	for _, file := range found {
+		byID[file.ID] = file
+	}
+	matches := make([]SimilarMatch, 0, len(ids))
+	for _, id := range ids {
+		if file, ok := byID[id]; ok {
+			matches = append(matches, SimilarMatch{File: file, Distance: distances[id]})
+		}
+	}
+	return matches, nil
+}
+
+func (s *Service) loadHashCandidates(ctx context.Context, scopeUserID uint, limit int) ([]hashCandidate, error) {
+	query := s.db.WithContext(ctx).
+		Model(&data.FileAsset{}).
+		Select("id", "perceptual_hash").
+		Where("perceptual_hash IS NOT NULL AND perceptual_hash <> ''").
+		Order("id DESC").
+		Limit(limit)
+	if scopeUserID != 0 {
+		query = query.Where("user_id = ?", scopeUserID)
+	}
+	var candidates []hashCandidate
+	err := query.Scan(&candidates).Error
+	return candidates, err
+}
+
+// FindDuplicateClusters 将用户图库中的近似重复图片分组。按上传顺序扫描，尚未归组的图片
+// 成为新组的代表（保留项），之后与代表距离不超过 maxDistance 的图片归入该组。
+// 与传递闭包式的合并不同，组内每张图片都与代表足够相似，不会经由中间图片串成一长链。
+// RedundantSize 为代表之外副本占用的空间。
+func (s *Service) FindDuplicateClusters(ctx context.Context, userID uint, maxDistance int) ([]DuplicateCluster, error) {
+	maxDistance = normalizeSimilarDistance(maxDistance, DefaultDuplicateDistance)
+	candidates, err := s.loadHashCandidates(ctx, userID, duplicateScanLimit)
+	if err != nil {
+		return nil, err
+	}
+	// loadHashCandidates 按 ID 倒序返回，这里转为上传顺序，让最早的图片成为代表
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].ID < candidates[j].ID })
+
+	// 预先解析哈希，避免在两两比较时重复解析
+	hashes := make([]uint64, len(candidates))
+	valid := make([]bool, len(candidates))
+	for i, candidate := range candidates {
+		if value, err := strconv.ParseUint(candidate.Hash, 16, 64); err == nil {
+			hashes[i] = value
+			valid[i] = true
+		}
+	}
+	assigned := make([]bool, len(candidates))
+	var groups [][]int
+	for i := range candidates {
+		if !valid[i] || assigned[i] {
+			continue
+		}
+		members := []int{i}
+		for j := i + 1; j < len(candidates); j++ {
+			if !valid[j] || assigned[j] || bits.OnesCount64(hashes[i]^hashes[j]) > maxDistance {
+				continue
+			}
+			assigned[j] = true
+			members = append(members, j)
+		}
+		if len(members) > 1 {
+			groups = append(groups, members)
+		}
+	}
+	if len(groups) == 0 {
+		return []DuplicateCluster{}, nil
+	}
+	ids := make([]uint, 0)
+	for _, members := range groups {
+		for _, idx := range members {
+			ids = append(ids, candidates[idx].ID)
+		}
+	}
+
+	var found []data.FileAsset
+	if err := s.db.WithContext(ctx).Preload("Strategy").Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]data.FileAsset, len(found))
+	for _, file := range found {
+		byID[file.ID] = file
+	}
+
+	clusters := make([]DuplicateCluster, 0, len(groups))
+	for _, members := range groups {
+		representative, ok := byID[candidates[members[0]].ID]
+		if !ok {
+			continue
+		}
+		duplicates := make([]data.FileAsset, 0, len(members)-1)
+		for _, idx := range members[1:] {
+			if file, ok := byID[candidates[idx].ID]; ok {
+				duplicates = append(duplicates, file)
+			}
+		}
+		if len(duplicates) == 0 {
+			continue
+		}
+		sort.SliceStable(duplicates, func(i, j int) bool {
+			if duplicates[i].CreatedAt.Equal(duplicates[j].CreatedAt) {
+				return duplicates[i].ID < duplicates[j].ID
+			}
+			return duplicates[i].CreatedAt.Before(duplicates[j].CreatedAt)
+		})
+		cluster := DuplicateCluster{Files: make([]SimilarMatch, 0, len(duplicates)+1)}
+		cluster.Files = append(cluster.Files, SimilarMatch{File: representative})
+		for _, file := range duplicates {
+			distance, _ := PerceptualHashDistance(representative.PerceptualHash, file.PerceptualHash)
+			cluster.Files = append(cluster.Files, SimilarMatch{File: file, Distance: distance})
+			cluster.RedundantSize += file.Size
+		}
+		clusters = append(clusters, cluster)
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if clusters[i].RedundantSize != clusters[j].RedundantSize {
+			return clusters[i].RedundantSize > clusters[j].RedundantSize
+		}
+		return strings.Compare(clusters[i].Files[0].File.Key, clusters[j].Files[0].File.Key) < 0
+	})
+	return clusters, nil
+}
@@ -0,0 +1,141 @@
+package files
+
+import (
+	"context"
+	"testing"
+
+	"skyimage/internal/config"
+	"skyimage/internal/data"
+)
+
+func TestFindSimilar_RanksAndScopesMatches(t *testing.T) {
+	db := setupFilesTestDB(t)
+	root := t.TempDir()
+	user := createLocalUploadUserAndStrategy(t, db, root)
+	svc := New(db, config.Config{})
+	ctx := context.Background()
+
+	shade := func(offset int) func(x, y int) uint8 {
+		return func(x, y int) uint8 {
+			v := (x*4+y*2)%256 + offset
+			if v > 255 {
+				v = 255
+			}
+			return uint8(v)
+		}
+	}
+	original, err := svc.Upload(ctx, user, createUploadFileHeader(t, "original.png", encodeShadedPNG(t, 64, 48, shade(0))), UploadOptions{})
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	copied, err := svc.Upload(ctx, user, createUploadFileHeader(t, "copy.png", encodeShadedPNG(t, 64, 48, shade(5))), UploadOptions{})
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	unrelated := encodeShadedPNG(t, 64, 48, func(x, y int) uint8 { return uint8((255 - x*4 + y*5) % 256) })
+	if _, err := svc.Upload(ctx, user, createUploadFileHeader(t, "other.png", unrelated), UploadOptions{}); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+
+	stranger := data.User{ID: 1000000000000002, Name: "stranger", Email: "stranger@example.com", PasswordHash: "hashed", Status: 1}
+	if err := db.Create(&stranger).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	foreign := createModerationTestFile(t, db, stranger.ID, "foreign", auditStatusNone, `{}`)
+	if err := db.Model(&foreign).UpdateColumn("perceptual_hash", original.PerceptualHash).Error; err != nil {
+		t.Fatalf("failed to set hash: %v", err)
+	}
+
+	_, matches, err := svc.FindSimilarByFile(ctx, user.ID, original.ID, 0, 0)
+	if err != nil {
+		t.Fatalf("FindSimilarByFile failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].File.ID != copied.ID {
+		t.Fatalf("expected only the near copy in user scope, got %+v", matches)
+	}
+
+	_, matches, err = svc.FindSimilarByFile(ctx, 0, original.ID, 0, 0)
+	if err != nil {
+		t.Fatalf("FindSimilarByFile failed: %v", err)
+	}
+	if len(matches) != 2 || matches[0].File.ID != foreign.ID || matches[0].Distance != 0 {
+		t.Fatalf("expected exact foreign match first in global scope, got %+v", matches)
+	}
+
+	if _, _, err := svc.FindSimilarByFile(ctx, stranger.ID, original.ID, 0, 0); err == nil {
+		t.Fatal("expected other users' files to be hidden in user scope")
+	}
+
+	probeMatches, err := svc.FindSimilarByImage(ctx, user.ID, encodeShadedPNG(t, 64, 48, shade(2)), "image/png", 0, 0)
+	if err != nil {
+		t.Fatalf("FindSimilarByImage failed: %v", err)
+	}
+	if len(probeMatches) != 2 {
+		t.Fatalf("expected probe to match both copies, got %+v", probeMatches)
+	}
+	if _, err := svc.FindSimilarByImage(ctx, user.ID, []byte("not an image"), "image/png", 0, 0); err == nil {
+		t.Fatal("expected invalid probe to be rejected")
+	}
+}
+
+func TestFindDuplicateClusters_GroupsNearCopies(t *testing.T) {
+	db := setupFilesTestDB(t)
+	svc := New(db, config.Config{})
+	user := data.User{ID: 1000000000000001, Name: "owner", Email: "owner@example.com", PasswordHash: "hashed", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	withHash := func(key, hash string) data.FileAsset {
+		file := createModerationTestFile(t, db, user.ID, key, auditStatusNone, `{}`)
+		if err := db.Model(&file).UpdateColumn("perceptual_hash", hash).Error; err != nil {
+			t.Fatalf("failed to set hash: %v", err)
+		}
+		return file
+	}
+	keeper := withHash("keeper", "ff00ff00ff00ff00")
+	withHash("near", "ff00ff00ff00ff01")
+	withHash("nearer", "ff00ff00ff00ff03")
+	withHash("alone", "00ff00ff00ff00ff")
+
+	clusters, err := svc.FindDuplicateClusters(context.Background(), user.ID, 0)
+	if err != nil {
+		t.Fatalf("FindDuplicateClusters failed: %v", err)
+	}
+	if len(clusters) != 1 || len(clusters[0].Files) != 3 {
+		t.Fatalf("expected one cluster of three, got %+v", clusters)
+	}
+	if clusters[0].Files[0].File.ID != keeper.ID || clusters[0].RedundantSize != 10 {
+		t.Fatalf("unexpected cluster keeper or redundant size: %+v", clusters[0])
+	}
+}
+
+func TestFindDuplicateClusters_DoesNotChainThroughIntermediates(t *testing.T) {
+	db := setupFilesTestDB(t)
+	svc := New(db, config.Config{})
+	user := data.User{ID: 1000000000000001, Name: "owner", Email: "owner@example.com", PasswordHash: "hashed", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	withHash := func(key, hash string) data.FileAsset {
+		file := createModerationTestFile(t, db, user.ID, key, auditStatusNone, `{}`)
+		if err := db.Model(&file).UpdateColumn("perceptual_hash", hash).Error; err != nil {
+			t.Fatalf("failed to set hash: %v", err)
+		}
+		return file
+	}
+	// first-middle 与 middle-last 的距离都是 3，但 first-last 的距离为 6
+	first := withHash("first", "0000000000000000")
+	middle := withHash("middle", "0000000000000007")
+	withHash("last", "00000000000001c7")
+
+	clusters, err := svc.FindDuplicateClusters(context.Background(), user.ID, 4)
+	if err != nil {
+		t.Fatalf("FindDuplicateClusters failed: %v", err)
+	}
+	if len(clusters) != 1 || len(clusters[0].Files) != 2 {
+		t.Fatalf("expected a single pair without chaining, got %+v", clusters)
+	}
+	if clusters[0].Files[0].File.ID != first.ID || clusters[0].Files[1].File.ID != middle.ID || clusters[0].Files[1].Distance != 3 {
+		t.Fatalf("unexpected cluster members: %+v", clusters[0].Files)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -17,6 +18,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 
 	"skyimage/internal/data"
+	"skyimage/internal/metrics"
 )
 
 func (s *Service) storeS3Object(ctx context.Context, cfg strategyConfig, relativePath string, head []byte, remain io.Reader) (storeObjectResult, error) {
@@ -110,10 +112,12 @@ func (s *Service) fetchS3Object(ctx context.Context, cfg strategyConfig, file da
 	if err != nil {
 		return nil, err
 	}
+	start := time.Now()
 	out, err := client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(cfg.S3Bucket),
 		Key:    aws.String(key),
 	})
+	metrics.ObserveStorage(strings.ToLower(strings.TrimSpace(cfg.Driver)), metrics.StorageGet, start, err)
 	if err != nil {
 		return nil, err
 	}
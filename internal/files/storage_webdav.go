@@ -15,10 +15,12 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
 
 	"skyimage/internal/data"
+	"skyimage/internal/metrics"
 )
 
 type storeObjectResult struct {
@@ -33,7 +35,13 @@ func (s *Service) storeObject(ctx context.Context, cfg strategyConfig, relativeP
 	if driver == "" {
 		driver = "local"
 	}
+	start := time.Now()
+	result, err := s.storeObjectByDriver(ctx, driver, cfg, relativePath, head, remain)
+	metrics.ObserveStorage(driver, metrics.StoragePut, start, err)
+	return result, err
+}
 
+func (s *Service) storeObjectByDriver(ctx context.Context, driver string, cfg strategyConfig, relativePath string, head []byte, remain io.Reader) (storeObjectResult, error) {
 	switch driver {
 	case "webdav":
 		return s.storeWebDAVObject(ctx, cfg, relativePath, head, remain)
@@ -183,7 +191,13 @@ func (s *Service) deleteStoredObjectDirect(ctx context.Context, db *gorm.DB, cfg
 	if driver == "" {
 		driver = "local"
 	}
+	start := time.Now()
+	err := s.deleteObjectByDriver(ctx, driver, cfg, file)
+	metrics.ObserveStorage(driver, metrics.StorageDelete, start, err)
+	return err
+}
 
+func (s *Service) deleteObjectByDriver(ctx context.Context, driver string, cfg strategyConfig, file data.FileAsset) error {
 	switch {
 	case isS3CompatibleDriver(driver):
 		return s.deleteS3Object(ctx, cfg, file)
@@ -0,0 +1,31 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"skyimage/internal/config"
+)
+
+func TestUpload_RespectsAllowedStrategyIDs(t *testing.T) {
+	db := setupFilesTestDB(t)
+	root := t.TempDir()
+	user := createLocalUploadUserAndStrategy(t, db, root)
+	svc := New(db, config.Config{})
+	payload := encodeShadedPNG(t, 16, 16, func(x, y int) uint8 { return uint8(x * 8) })
+
+	_, err := svc.Upload(context.Background(), user, createUploadFileHeader(t, "a.png", payload), UploadOptions{AllowedStrategyIDs: []uint{999}})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 403 {
+		t.Fatalf("expected token strategy restriction to reject upload, got %v", err)
+	}
+
+	stored, err := svc.Upload(context.Background(), user, createUploadFileHeader(t, "b.png", payload), UploadOptions{AllowedStrategyIDs: []uint{1}})
+	if err != nil {
+		t.Fatalf("expected upload with permitted strategy to succeed, got %v", err)
+	}
+	if stored.StrategyID != 1 {
+		t.Fatalf("unexpected strategy: %d", stored.StrategyID)
+	}
+}
@@ -0,0 +1,201 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"skyimage/internal/netguard"
+)
+
+// uploadSourceMemory 超过该大小的内容会写入临时文件，与 gin 解析表单时的默认值一致。
+const uploadSourceMemory = 32 << 20
+
+const (
+	remoteSourceTimeout      = 30 * time.Second
+	remoteSourceMaxRedirects = 3
+)
+
+var (
+	ErrSourceTooLarge = &StatusError{StatusCode: http.StatusRequestEntityTooLarge, Message: "上传内容过大"}
+	ErrInvalidSource  = &StatusError{StatusCode: http.StatusBadRequest, Message: "无效的图片来源"}
+)
+
+// NewFileHeader 将原始请求体包装为 *multipart.FileHeader，供 S3、WebDAV 等
+// 非表单上传复用 Upload 的全部校验与处理流程。调用方负责在使用后执行 cleanup。
+func NewFileHeader(filename, contentType string, content io.Reader) (*multipart.FileHeader, func(), error) {
+	reader, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", multipart.FileContentDisposition("file", filename))
+		if contentType != "" {
+			header.Set("Content-Type", contentType)
+		}
+		part, err := form.CreatePart(header)
+		if err == nil {
+			_, err = io.Copy(part, content)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		_ = writer.CloseWithError(err)
+	}()
+
+	parsed, err := multipart.NewReader(reader, form.Boundary()).ReadForm(uploadSourceMemory)
+	// 读取失败时让写入协程退出
+	_ = reader.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	cleanup := func() { _ = parsed.RemoveAll() }
+	headers := parsed.File["file"]
+	if len(headers) == 0 {
+		cleanup()
+		return nil, func() {}, errors.New("empty upload")
+	}
+	return headers[0], cleanup, nil
+}
+
+// DecodeBase64Source 解析 base64 编码的图片，支持 data URI 前缀。
+func DecodeBase64Source(filename, value string, maxSize int64) (*multipart.FileHeader, func(), error) {
+	value = strings.TrimSpace(value)
+	contentType := ""
+	if strings.HasPrefix(value, "data:") {
+		meta, payload, ok := strings.Cut(value, ",")
+		if !ok || !strings.HasSuffix(meta, ";base64") {
+			return nil, func() {}, ErrInvalidSource
+		}
+		contentType = strings.TrimSuffix(strings.TrimPrefix(meta, "data:"), ";base64")
+		value = payload
+	}
+	value = strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, value)
+	if value == "" {
+		return nil, func() {}, ErrInvalidSource
+	}
+	if int64(base64.StdEncoding.DecodedLen(len(value))) > maxSize+2 {
+		return nil, func() {}, ErrSourceTooLarge
+	}
+	encoding := base64.StdEncoding
+	if strings.ContainsAny(value, "-_") {
+		encoding = base64.URLEncoding
+	}
+	if !strings.HasSuffix(value, "=") && len(value)%4 != 0 {
+		encoding = encoding.WithPadding(base64.NoPadding)
+	}
+	decoded, err := encoding.DecodeString(value)
+	if err != nil || len(decoded) == 0 {
+		return nil, func() {}, ErrInvalidSource
+	}
+	if int64(len(decoded)) > maxSize {
+		return nil, func() {}, ErrSourceTooLarge
+	}
+	return NewFileHeader(withDetectedExtension(filename, decoded), contentType, bytes.NewReader(decoded))
+}
+
+// FetchRemoteSource 下载远程图片作为上传内容，拒绝访问内网地址。
+func FetchRemoteSource(ctx context.Context, rawURL string, maxSize int64) (*multipart.FileHeader, func(), error) {
+	return fetchRemoteSource(ctx, newRemoteSourceClient(false), rawURL, maxSize)
+}
+
+func fetchRemoteSource(ctx context.Context, client *http.Client, rawURL string, maxSize int64) (*multipart.FileHeader, func(), error) {
+	target, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, func() {}, ErrInvalidSource
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, func() {}, ErrInvalidSource
+	}
+	req.Header.Set("User-Agent", "SkyImage/1.0 (+remote upload)")
+	req.Header.Set("Accept", "image/*")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, func() {}, &StatusError{StatusCode: http.StatusBadRequest, Message: "下载远程图片失败"}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, func() {}, &StatusError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("下载远程图片失败（HTTP %d）", resp.StatusCode)}
+	}
+	if resp.ContentLength > maxSize {
+		return nil, func() {}, ErrSourceTooLarge
+	}
+	filename := path.Base(resp.Request.URL.Path)
+	if filename == "." || filename == "/" {
+		filename = "image"
+	}
+	contentType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	body := bufio.NewReader(&cappedReader{r: resp.Body, remaining: maxSize})
+	head, _ := body.Peek(512)
+	header, cleanup, err := NewFileHeader(withDetectedExtension(filename, head), contentType, body)
+	if err != nil {
+		if errors.Is(err, ErrSourceTooLarge) {
+			return nil, func() {}, ErrSourceTooLarge
+		}
+		return nil, func() {}, &StatusError{StatusCode: http.StatusBadRequest, Message: "下载远程图片失败"}
+	}
+	return header, cleanup, nil
+}
+
+// newRemoteSourceClient 在建立连接时校验解析后的地址，重定向也会经过同一校验。
+func newRemoteSourceClient(allowLoopback bool) *http.Client {
+	dialer := netguard.NewDialer(10*time.Second, allowLoopback, netguard.IsInternalIP, errors.New("remote source address is not allowed"))
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   remoteSourceTimeout,
+		Transport: transport,
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			if len(via) > remoteSourceMaxRedirects {
+				return errors.New("too many redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// withDetectedExtension 为没有扩展名的文件名按内容补全扩展名，base64 与部分远程地址没有可用的文件名。
+func withDetectedExtension(filename string, head []byte) string {
+	if path.Ext(filename) != "" || len(head) == 0 {
+		return filename
+	}
+	if exts := mediaTypeExtensions[normalizeContentType(http.DetectContentType(head))]; len(exts) > 0 {
+		return filename + "." + exts[0]
+	}
+	return filename
+}
+
+// cappedReader 读取超过 remaining 字节时返回 ErrSourceTooLarge。
+type cappedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > c.remaining+1 {
+		p = p[:c.remaining+1]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if c.remaining < 0 {
+		return 0, ErrSourceTooLarge
+	}
+	return n, err
+}
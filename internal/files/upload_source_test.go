@@ -0,0 +1,106 @@
+package files
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func readHeader(t *testing.T, header *multipart.FileHeader) string {
+	t.Helper()
+	file, err := header.Open()
+	if err != nil {
+		t.Fatalf("open header: %v", err)
+	}
+	defer file.Close()
+	content, _ := io.ReadAll(file)
+	return string(content)
+}
+
+func TestDecodeBase64Source(t *testing.T) {
+	payload := "\x89PNG\r\n\x1a\n fake image"
+	encoded := base64.StdEncoding.EncodeToString([]byte(payload))
+
+	header, cleanup, err := DecodeBase64Source("cat.png", "data:image/png;base64,"+encoded, 1024)
+	if err != nil {
+		t.Fatalf("decode data uri: %v", err)
+	}
+	defer cleanup()
+	if header.Filename != "cat.png" || header.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("unexpected header: %q %q", header.Filename, header.Header.Get("Content-Type"))
+	}
+	if got := readHeader(t, header); got != payload {
+		t.Fatalf("decoded content = %q", got)
+	}
+
+	// 无填充、带换行的 URL 安全编码
+	raw := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	if _, cleanup, err := DecodeBase64Source("x", raw[:8]+"\n"+raw[8:], 1024); err != nil {
+		t.Fatalf("decode raw url encoding: %v", err)
+	} else {
+		cleanup()
+	}
+	// 没有扩展名时按内容补全，避免被扩展名校验拒绝
+	if header, cleanup, err := DecodeBase64Source("image", encoded, 1024); err != nil || header.Filename != "image.png" {
+		t.Fatalf("expected detected extension, got %v", err)
+	} else {
+		cleanup()
+	}
+	if _, _, err := DecodeBase64Source("x", "not base64!", 1024); !errors.Is(err, ErrInvalidSource) {
+		t.Fatalf("expected invalid source, got %v", err)
+	}
+	if _, _, err := DecodeBase64Source("x", encoded, 4); !errors.Is(err, ErrSourceTooLarge) {
+		t.Fatalf("expected too large, got %v", err)
+	}
+}
+
+func TestFetchRemoteSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/img/cat.png":
+			w.Header().Set("Content-Type", "image/png; charset=binary")
+			_, _ = io.WriteString(w, "remote image")
+		case "/moved":
+			http.Redirect(w, r, "/img/cat.png", http.StatusFound)
+		case "/large":
+			_, _ = io.WriteString(w, strings.Repeat("x", 64))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	client := newRemoteSourceClient(true)
+
+	header, cleanup, err := fetchRemoteSource(ctx, client, server.URL+"/moved", 1024)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	defer cleanup()
+	if header.Filename != "cat.png" || header.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("unexpected header: %q %q", header.Filename, header.Header.Get("Content-Type"))
+	}
+	if got := readHeader(t, header); got != "remote image" {
+		t.Fatalf("fetched content = %q", got)
+	}
+
+	if _, _, err := fetchRemoteSource(ctx, client, server.URL+"/large", 16); !errors.Is(err, ErrSourceTooLarge) {
+		t.Fatalf("expected too large, got %v", err)
+	}
+	if _, _, err := fetchRemoteSource(ctx, client, server.URL+"/missing", 1024); err == nil {
+		t.Fatalf("expected error for 404")
+	}
+	if _, _, err := fetchRemoteSource(ctx, client, "ftp://example.com/a.png", 1024); !errors.Is(err, ErrInvalidSource) {
+		t.Fatalf("expected invalid source for ftp, got %v", err)
+	}
+	// 默认客户端拒绝内网地址
+	if _, _, err := FetchRemoteSource(ctx, server.URL+"/img/cat.png", 1024); err == nil {
+		t.Fatalf("loopback address should be rejected")
+	}
+}
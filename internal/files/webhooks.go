@@ -0,0 +1,103 @@
+package files
+
+import (
+	"context"
+	"time"
+
+	"skyimage/internal/data"
+	"skyimage/internal/webhooks"
+)
+
+// SetWebhooks 设置事件推送服务，未设置时不推送任何事件。
+func (s *Service) SetWebhooks(hooks *webhooks.Service) {
+	s.webhooks = hooks
+}
+
+type fileEventPayload struct {
+	ID           uint      `json:"id"`
+	Key          string    `json:"key"`
+	UserID       uint      `json:"userId,string"`
+	Name         string    `json:"name"`
+	OriginalName string    `json:"originalName"`
+	Size         int64     `json:"size"`
+	MimeType     string    `json:"mimeType"`
+	Visibility   string    `json:"visibility"`
+	AuditStatus  string    `json:"auditStatus,omitempty"`
+	URL          string    `json:"url,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func (s *Service) fileEventPayload(ctx context.Context, file data.FileAsset, withURL bool) fileEventPayload {
+	payload := fileEventPayload{
+		ID:           file.ID,
+		Key:          file.Key,
+		UserID:       file.UserID,
+		Name:         file.Name,
+		OriginalName: file.OriginalName,
+		Size:         file.Size,
+		MimeType:     file.MimeType,
+		Visibility:   file.Visibility,
+		AuditStatus:  file.AuditStatus,
+		CreatedAt:    file.CreatedAt,
+	}
+	if withURL {
+		if url, err := s.PublicURL(ctx, file); err == nil {
+			payload.URL = url
+		}
+	}
+	return payload
+}
+
+func (s *Service) emitFileEvent(ctx context.Context, event string, file data.FileAsset) {
+	if s.webhooks == nil {
+		return
+	}
+	// 已删除的文件不再附带访问地址
+	payload := s.fileEventPayload(ctx, file, event != webhooks.EventFileDeleted)
+	s.webhooks.Emit(ctx, event, file.UserID, payload)
+}
+
+func (s *Service) emitFileEvents(ctx context.Context, event string, files []data.FileAsset) {
+	for _, file := range files {
+		s.emitFileEvent(ctx, event, file)
+	}
+}
+
+// visibilityChangeCandidates 在批量修改可见性之前读取实际会变化的文件，
+// 未配置 Webhook 时不做额外查询。
+func (s *Service) visibilityChangeCandidates(ctx context.Context, ids []uint, visibility string, userID uint) []data.FileAsset {
+	if s.webhooks == nil || len(ids) == 0 {
+		return nil
+	}
+	var files []data.FileAsset
+	query := s.db.WithContext(ctx).Where("id IN ? AND visibility <> ?", ids, visibility)
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.Find(&files).Error; err != nil {
+		return nil
+	}
+	return files
+}
+
+func (s *Service) emitVisibilityChanged(ctx context.Context, files []data.FileAsset, visibility string) {
+	for i := range files {
+		files[i].Visibility = visibility
+	}
+	s.emitFileEvents(ctx, webhooks.EventFileVisibilityChanged, files)
+}
+
+func (s *Service) emitAuditCompleted(ctx context.Context, file data.FileAsset, status string) {
+	if s.webhooks == nil {
+		return
+	}
+	file.AuditStatus = status
+	payload := struct {
+		fileEventPayload
+		Manual bool `json:"manual"`
+	}{
+		fileEventPayload: s.fileEventPayload(ctx, file, status != "deleted"),
+		Manual:           file.AuditReviewedAt != nil,
+	}
+	s.webhooks.Emit(ctx, webhooks.EventAuditCompleted, file.UserID, payload)
+}
@@ -168,6 +168,9 @@ func (s *Service) Run(ctx context.Context, in RunInput) (Status, error) {
 			"features.registration_mode":               "open",
 			"features.allow_registration":              "true",
 			"features.passkeys_enabled":                "true",
+			"features.gallery_feed":                    "true",
+			"features.user_feeds":                      "true",
+			"features.sitemap":                         "true",
 			"oauth.enabled":                            "false",
 			"oauth.auto_link_by_email":                 "false",
 			"oauth.github.enabled":                     "false",
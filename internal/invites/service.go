@@ -0,0 +1,491 @@
+// Package invites 管理邀请码：邀请注册模式下的注册凭证、用户邀请配额与推荐奖励。
+package invites
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+	"skyimage/internal/redeem"
+)
+
+const (
+	// ConfigInviterReward 每成功邀请一人，邀请人获得的额外容量（字节）
+	ConfigInviterReward = "invite.reward_inviter_bytes"
+	// ConfigInviteeReward 使用邀请码注册的新用户获得的额外容量（字节）
+	ConfigInviteeReward = "invite.reward_invitee_bytes"
+	// ConfigUserCodeExpireDays 用户自助创建的邀请码有效天数，0 表示不过期
+	ConfigUserCodeExpireDays = "invite.user_code_expire_days"
+
+	DefaultUserCodeExpireDays = 7
+	MaxUserCodeExpireDays     = 365
+
+	// GroupConfigQuota 角色组配置项：组内每个用户可创建的邀请码数量，缺省为 0（不允许）
+	GroupConfigQuota = "invite_quota"
+)
+
+var (
+	ErrCodeNotFound   = errors.New("invite code not found")
+	ErrInvalidCode    = errors.New("invalid invite code")
+	ErrCodeDisabled   = errors.New("invite code is disabled")
+	ErrCodeExpired    = errors.New("invite code has expired")
+	ErrCodeExhausted  = errors.New("invite code has been fully used")
+	ErrCodeExists     = errors.New("invite code already exists")
+	ErrCodeUsed       = errors.New("invite code has already been used")
+	ErrQuotaExceeded  = errors.New("invite quota exceeded")
+	ErrAlreadyInvited = errors.New("user has already used an invite code")
+	ErrSelfInvite     = errors.New("cannot use your own invite code")
+)
+
+// SettingsReader exposes the admin settings store (implemented by *admin.Service).
+type SettingsReader interface {
+	GetSettings(ctx context.Context) (map[string]string, error)
+}
+
+// Settings 是邀请相关的系统配置。
+type Settings struct {
+	InviterRewardBytes float64 `json:"inviterRewardBytes"`
+	InviteeRewardBytes float64 `json:"inviteeRewardBytes"`
+	UserCodeExpireDays int     `json:"userCodeExpireDays"`
+}
+
+// Values 转换为 configs 表中的键值。
+func (s Settings) Values() map[string]string {
+	return map[string]string{
+		ConfigInviterReward:      strconv.FormatFloat(max(s.InviterRewardBytes, 0), 'f', -1, 64),
+		ConfigInviteeReward:      strconv.FormatFloat(max(s.InviteeRewardBytes, 0), 'f', -1, 64),
+		ConfigUserCodeExpireDays: strconv.Itoa(NormalizeExpireDaysValue(s.UserCodeExpireDays)),
+	}
+}
+
+// Quota 是用户的邀请码配额；Limit 为 0 表示不允许创建。
+type Quota struct {
+	Limit     int `json:"limit"`
+	Used      int `json:"used"`
+	Remaining int `json:"remaining"`
+}
+
+type CreateInput struct {
+	Code      string     `json:"code"`
+	MaxUses   int        `json:"maxUses"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Enabled   *bool      `json:"enabled"`
+	Note      string     `json:"note"`
+}
+
+type UpdateInput struct {
+	MaxUses     *int       `json:"maxUses"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	ClearExpiry bool       `json:"clearExpiry"`
+	Enabled     *bool      `json:"enabled"`
+	Note        *string    `json:"note"`
+}
+
+// Filter 是列表查询条件，零值字段不参与过滤。
+type Filter struct {
+	InviterID uint
+	Limit     int
+	Offset    int
+}
+
+type Service struct {
+	mu       sync.Mutex
+	db       *gorm.DB
+	settings SettingsReader
+}
+
+func New(db *gorm.DB, settings SettingsReader) *Service {
+	return &Service{db: db, settings: settings}
+}
+
+// SetDB updates the database handle after a runtime database switch.
+func (s *Service) SetDB(db *gorm.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db = db
+}
+
+// SetSettings updates the settings reader after a runtime database switch.
+func (s *Service) SetSettings(settings SettingsReader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = settings
+}
+
+func (s *Service) handle() (*gorm.DB, SettingsReader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db, s.settings
+}
+
+// Settings 读取邀请配置，未配置时返回默认值。
+func (s *Service) Settings(ctx context.Context) Settings {
+	out := Settings{UserCodeExpireDays: DefaultUserCodeExpireDays}
+	_, reader := s.handle()
+	if reader == nil {
+		return out
+	}
+	values, err := reader.GetSettings(ctx)
+	if err != nil {
+		return out
+	}
+	out.InviterRewardBytes = parseReward(values[ConfigInviterReward])
+	out.InviteeRewardBytes = parseReward(values[ConfigInviteeReward])
+	out.UserCodeExpireDays = NormalizeExpireDays(values[ConfigUserCodeExpireDays])
+	return out
+}
+
+func (s *Service) List(ctx context.Context, filter Filter) ([]data.InviteCode, int64, error) {
+	db, _ := s.handle()
+	query := db.WithContext(ctx).Model(&data.InviteCode{})
+	if filter.InviterID > 0 {
+		query = query.Where("inviter_id = ?", filter.InviterID)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var items []data.InviteCode
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit).Offset(filter.Offset)
+	}
+	err := query.Preload("Inviter").Order("id DESC").Find(&items).Error
+	return items, total, err
+}
+
+func (s *Service) Get(ctx context.Context, id uint) (data.InviteCode, error) {
+	db, _ := s.handle()
+	var item data.InviteCode
+	err := db.WithContext(ctx).Preload("Inviter").First(&item, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return item, ErrCodeNotFound
+	}
+	return item, err
+}
+
+func (s *Service) ListUsages(ctx context.Context, codeID uint) ([]data.InviteCodeUsage, error) {
+	db, _ := s.handle()
+	var items []data.InviteCodeUsage
+	err := db.WithContext(ctx).
+		Preload("Invitee").
+		Where("invite_code_id = ?", codeID).
+		Order("id DESC").
+		Find(&items).Error
+	return items, err
+}
+
+// Create 由管理员创建邀请码，邀请人记为管理员本人。
+func (s *Service) Create(ctx context.Context, actor data.User, input CreateInput) (data.InviteCode, error) {
+	code := normalizeCode(input.Code)
+	if strings.TrimSpace(input.Code) != "" && code == "" {
+		return data.InviteCode{}, ErrInvalidCode
+	}
+	enabled := true
+	if input.Enabled != nil {
+		enabled = *input.Enabled
+	}
+	item := data.InviteCode{
+		Code:      code,
+		InviterID: actor.ID,
+		ByAdmin:   true,
+		MaxUses:   max(input.MaxUses, 0),
+		ExpiresAt: input.ExpiresAt,
+		Enabled:   enabled,
+		Note:      strings.TrimSpace(input.Note),
+	}
+	return s.create(ctx, item)
+}
+
+// CreateForUser 在用户所属角色组的配额内创建一个单次使用的邀请码。
+func (s *Service) CreateForUser(ctx context.Context, user data.User, note string) (data.InviteCode, error) {
+	quota, err := s.Quota(ctx, user)
+	if err != nil {
+		return data.InviteCode{}, err
+	}
+	if quota.Remaining <= 0 {
+		return data.InviteCode{}, ErrQuotaExceeded
+	}
+	item := data.InviteCode{
+		InviterID: user.ID,
+		MaxUses:   1,
+		Enabled:   true,
+		Note:      strings.TrimSpace(note),
+	}
+	if days := s.Settings(ctx).UserCodeExpireDays; days > 0 {
+		expiresAt := time.Now().Add(time.Duration(days) * 24 * time.Hour)
+		item.ExpiresAt = &expiresAt
+	}
+	return s.create(ctx, item)
+}
+
+func (s *Service) create(ctx context.Context, item data.InviteCode) (data.InviteCode, error) {
+	db, _ := s.handle()
+	if item.Code == "" {
+		generated, err := generateCode()
+		if err != nil {
+			return data.InviteCode{}, err
+		}
+		item.Code = generated
+	}
+	// 计数与开关列不设 default，零值（不限次数、停用）才能原样写入
+	if err := db.WithContext(ctx).Create(&item).Error; err != nil {
+		if isUniqueViolation(err) {
+			return data.InviteCode{}, ErrCodeExists
+		}
+		return data.InviteCode{}, err
+	}
+	return item, nil
+}
+
+// Quota 返回用户的邀请码配额，已创建的邀请码（含已使用）都计入。
+func (s *Service) Quota(ctx context.Context, user data.User) (Quota, error) {
+	db, _ := s.handle()
+	var quota Quota
+	if user.GroupID != nil {
+		var group data.Group
+		if err := db.WithContext(ctx).First(&group, *user.GroupID).Error; err == nil {
+			quota.Limit = GroupQuota(group)
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return Quota{}, err
+		}
+	}
+	var used int64
+	if err := db.WithContext(ctx).Model(&data.InviteCode{}).
+		Where("inviter_id = ? AND by_admin = ?", user.ID, false).
+		Count(&used).Error; err != nil {
+		return Quota{}, err
+	}
+	quota.Used = int(used)
+	quota.Remaining = max(quota.Limit-quota.Used, 0)
+	return quota, nil
+}
+
+func (s *Service) Update(ctx context.Context, id uint, input UpdateInput) (data.InviteCode, error) {
+	item, err := s.Get(ctx, id)
+	if err != nil {
+		return data.InviteCode{}, err
+	}
+	updates := map[string]interface{}{}
+	if input.MaxUses != nil {
+		maxUses := max(*input.MaxUses, 0)
+		if maxUses > 0 && maxUses < item.UsedCount {
+			return data.InviteCode{}, ErrCodeExhausted
+		}
+		updates["max_uses"] = maxUses
+	}
+	if input.ClearExpiry {
+		updates["expires_at"] = nil
+	} else if input.ExpiresAt != nil {
+		updates["expires_at"] = *input.ExpiresAt
+	}
+	if input.Enabled != nil {
+		updates["enabled"] = *input.Enabled
+	}
+	if input.Note != nil {
+		updates["note"] = strings.TrimSpace(*input.Note)
+	}
+	if len(updates) == 0 {
+		return item, nil
+	}
+	db, _ := s.handle()
+	if err := db.WithContext(ctx).Model(&data.InviteCode{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return data.InviteCode{}, err
+	}
+	return s.Get(ctx, id)
+}
+
+// Delete 删除邀请码；已注册用户的邀请关系保留在使用记录中。
+func (s *Service) Delete(ctx context.Context, id uint) error {
+	db, _ := s.handle()
+	res := db.WithContext(ctx).Delete(&data.InviteCode{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrCodeNotFound
+	}
+	return nil
+}
+
+// DeleteOwn 删除用户自己创建且尚未使用的邀请码。
+func (s *Service) DeleteOwn(ctx context.Context, userID, id uint) error {
+	db, _ := s.handle()
+	var item data.InviteCode
+	if err := db.WithContext(ctx).Where("id = ? AND inviter_id = ? AND by_admin = ?", id, userID, false).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCodeNotFound
+		}
+		return err
+	}
+	if item.UsedCount > 0 {
+		return ErrCodeUsed
+	}
+	return db.WithContext(ctx).Delete(&data.InviteCode{}, item.ID).Error
+}
+
+// Check 校验邀请码当前是否可用，不占用次数（用于 OAuth 跳转前的预检）。
+func (s *Service) Check(ctx context.Context, rawCode string) (data.InviteCode, error) {
+	db, _ := s.handle()
+	return findUsable(db.WithContext(ctx), rawCode)
+}
+
+// RedeemInTx 在注册事务内核销邀请码并发放推荐奖励，失败时整个注册回滚。
+func (s *Service) RedeemInTx(ctx context.Context, tx *gorm.DB, rawCode string, inviteeID uint) error {
+	item, err := findUsable(tx, rawCode)
+	if err != nil {
+		return err
+	}
+	if item.InviterID == inviteeID {
+		return ErrSelfInvite
+	}
+	var count int64
+	if err := tx.Model(&data.InviteCodeUsage{}).Where("invitee_id = ?", inviteeID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAlreadyInvited
+	}
+
+	// 原子递增 used_count，并在有上限时再次校验
+	q := tx.Model(&data.InviteCode{}).Where("id = ? AND enabled = ?", item.ID, true)
+	if item.MaxUses > 0 {
+		q = q.Where("used_count < ?", item.MaxUses)
+	}
+	res := q.UpdateColumn("used_count", gorm.Expr("used_count + 1"))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrCodeExhausted
+	}
+
+	settings := s.Settings(ctx)
+	usage := data.InviteCodeUsage{
+		InviteCodeID:  item.ID,
+		InviterID:     item.InviterID,
+		InviteeID:     inviteeID,
+		InviterReward: settings.InviterRewardBytes,
+		InviteeReward: settings.InviteeRewardBytes,
+		CreatedAt:     time.Now(),
+	}
+	if err := tx.Create(&usage).Error; err != nil {
+		return err
+	}
+	if err := redeem.GrantCapacity(tx, item.InviterID, usage.InviterReward); err != nil {
+		return err
+	}
+	return redeem.GrantCapacity(tx, inviteeID, usage.InviteeReward)
+}
+
+func findUsable(db *gorm.DB, rawCode string) (data.InviteCode, error) {
+	code := normalizeCode(rawCode)
+	if code == "" {
+		return data.InviteCode{}, ErrInvalidCode
+	}
+	var item data.InviteCode
+	if err := db.Where("code = ?", code).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return data.InviteCode{}, ErrCodeNotFound
+		}
+		return data.InviteCode{}, err
+	}
+	if !item.Enabled {
+		return data.InviteCode{}, ErrCodeDisabled
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		return data.InviteCode{}, ErrCodeExpired
+	}
+	if item.MaxUses > 0 && item.UsedCount >= item.MaxUses {
+		return data.InviteCode{}, ErrCodeExhausted
+	}
+	return item, nil
+}
+
+// GroupQuota 读取角色组配置中的邀请码配额。
+func GroupQuota(group data.Group) int {
+	if len(group.Configs) == 0 {
+		return 0
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(group.Configs, &cfg); err != nil {
+		return 0
+	}
+	switch val := cfg[GroupConfigQuota].(type) {
+	case float64:
+		return max(int(val), 0)
+	case string:
+		if parsed, err := strconv.Atoi(strings.TrimSpace(val)); err == nil {
+			return max(parsed, 0)
+		}
+	}
+	return 0
+}
+
+// NormalizeExpireDays 解析用户邀请码有效天数；未配置或非法时返回默认值。
+func NormalizeExpireDays(raw string) int {
+	days, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return DefaultUserCodeExpireDays
+	}
+	return NormalizeExpireDaysValue(days)
+}
+
+// NormalizeExpireDaysValue 将有效天数限制在 [0, MaxUserCodeExpireDays]，负数视为默认值。
+func NormalizeExpireDaysValue(days int) int {
+	if days < 0 {
+		return DefaultUserCodeExpireDays
+	}
+	return min(days, MaxUserCodeExpireDays)
+}
+
+func parseReward(raw string) float64 {
+	value, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || value < 0 {
+		return 0
+	}
+	return value
+}
+
+func normalizeCode(code string) string {
+	code = strings.TrimSpace(code)
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, " ", "")
+	return code
+}
+
+func generateCode() (string, error) {
+	// 3 段 × 4 字符，排除易混字符
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	parts := make([]string, 3)
+	for i := range parts {
+		buf := make([]byte, 4)
+		for j := range buf {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+			if err != nil {
+				return "", err
+			}
+			buf[j] = alphabet[n.Int64()]
+		}
+		parts[i] = string(buf)
+	}
+	return "INV-" + strings.Join(parts, "-"), nil
+}
+
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unique") ||
+		strings.Contains(msg, "duplicate") ||
+		strings.Contains(msg, "constraint")
+}
@@ -0,0 +1,146 @@
+package invites
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+type staticSettings map[string]string
+
+func (s staticSettings) GetSettings(context.Context) (map[string]string, error) {
+	return s, nil
+}
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&data.Group{}, &data.User{}, &data.InviteCode{}, &data.InviteCodeUsage{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func createUser(t *testing.T, db *gorm.DB, user data.User) data.User {
+	t.Helper()
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func TestCreateForUser_RespectsGroupQuota(t *testing.T) {
+	db := setupTestDB(t)
+	svc := New(db, staticSettings{ConfigUserCodeExpireDays: "3"})
+	ctx := context.Background()
+
+	group := data.Group{Name: "inviters", Configs: datatypes.JSON([]byte(`{"invite_quota": 1}`))}
+	if err := db.Create(&group).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	user := createUser(t, db, data.User{ID: 1000000000000001, Name: "user", Email: "user@example.com", GroupID: &group.ID})
+	other := createUser(t, db, data.User{ID: 1000000000000002, Name: "other", Email: "other@example.com"})
+
+	item, err := svc.CreateForUser(ctx, user, "friend")
+	if err != nil {
+		t.Fatalf("create invite: %v", err)
+	}
+	if item.MaxUses != 1 || item.ByAdmin || item.ExpiresAt == nil {
+		t.Fatalf("unexpected user invite: %+v", item)
+	}
+	if until := time.Until(*item.ExpiresAt); until < 71*time.Hour || until > 73*time.Hour {
+		t.Fatalf("expected 3 day expiry, got %v", until)
+	}
+	if _, err := svc.CreateForUser(ctx, user, ""); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+	if _, err := svc.CreateForUser(ctx, other, ""); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("users without a group quota must not create invites, got %v", err)
+	}
+
+	quota, err := svc.Quota(ctx, user)
+	if err != nil {
+		t.Fatalf("quota: %v", err)
+	}
+	if quota.Limit != 1 || quota.Used != 1 || quota.Remaining != 0 {
+		t.Fatalf("unexpected quota: %+v", quota)
+	}
+}
+
+func TestRedeemInTx_ConsumesCodeAndGrantsRewards(t *testing.T) {
+	db := setupTestDB(t)
+	svc := New(db, staticSettings{ConfigInviterReward: "1024", ConfigInviteeReward: "512"})
+	ctx := context.Background()
+
+	admin := createUser(t, db, data.User{ID: 1000000000000001, Name: "admin", Email: "admin@example.com", IsAdmin: true})
+	first := createUser(t, db, data.User{ID: 1000000000000002, Name: "first", Email: "first@example.com"})
+	second := createUser(t, db, data.User{ID: 1000000000000003, Name: "second", Email: "second@example.com"})
+
+	item, err := svc.Create(ctx, admin, CreateInput{Code: "welcome 2026", MaxUses: 1})
+	if err != nil {
+		t.Fatalf("create invite: %v", err)
+	}
+	if item.Code != "WELCOME2026" {
+		t.Fatalf("expected normalized code, got %q", item.Code)
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return svc.RedeemInTx(ctx, tx, "welcome2026", first.ID)
+	}); err != nil {
+		t.Fatalf("redeem: %v", err)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return svc.RedeemInTx(ctx, tx, "WELCOME2026", second.ID)
+	})
+	if !errors.Is(err, ErrCodeExhausted) {
+		t.Fatalf("expected exhausted code, got %v", err)
+	}
+
+	var inviter, invitee data.User
+	db.First(&inviter, admin.ID)
+	db.First(&invitee, first.ID)
+	if inviter.CapacityBonus != 1024 || invitee.CapacityBonus != 512 {
+		t.Fatalf("unexpected rewards: inviter=%v invitee=%v", inviter.CapacityBonus, invitee.CapacityBonus)
+	}
+	usages, err := svc.ListUsages(ctx, item.ID)
+	if err != nil || len(usages) != 1 || usages[0].InviteeID != first.ID {
+		t.Fatalf("unexpected usages: %+v err=%v", usages, err)
+	}
+}
+
+func TestCheck_RejectsExpiredAndDisabledCodes(t *testing.T) {
+	db := setupTestDB(t)
+	svc := New(db, nil)
+	ctx := context.Background()
+	admin := createUser(t, db, data.User{ID: 1000000000000001, Name: "admin", Email: "admin@example.com", IsAdmin: true})
+
+	past := time.Now().Add(-time.Hour)
+	if _, err := svc.Create(ctx, admin, CreateInput{Code: "OLD", ExpiresAt: &past}); err != nil {
+		t.Fatalf("create invite: %v", err)
+	}
+	disabled := false
+	if _, err := svc.Create(ctx, admin, CreateInput{Code: "OFF", Enabled: &disabled}); err != nil {
+		t.Fatalf("create invite: %v", err)
+	}
+
+	if _, err := svc.Check(ctx, "old"); !errors.Is(err, ErrCodeExpired) {
+		t.Fatalf("expected expired, got %v", err)
+	}
+	if _, err := svc.Check(ctx, "off"); !errors.Is(err, ErrCodeDisabled) {
+		t.Fatalf("expected disabled, got %v", err)
+	}
+	if _, err := svc.Check(ctx, "missing"); !errors.Is(err, ErrCodeNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
@@ -0,0 +1,372 @@
+// Package loginguard 按邮箱、客户端 IP 与两步验证用户记录登录失败次数（渐进延迟与临时锁定），并保存登录历史。
+package loginguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"skyimage/internal/data"
+)
+
+const (
+	// freeAttempts 次连续失败后开始渐进延迟：1s、2s、4s……最多 maxDelay
+	freeAttempts = 3
+	maxDelay     = time.Minute
+	// lockThreshold 次连续失败后锁定账户 LockDuration
+	lockThreshold = 10
+	LockDuration  = 15 * time.Minute
+	// failureDecay 距上次失败超过该时间后重新计数
+	failureDecay = time.Hour
+	// reserveRetries 条件更新因并发冲突失败时的重试次数
+	reserveRetries = 3
+	// keySize 与 login_failures.failure_key 列宽一致
+	keySize = 191
+
+	historyRetention = 180 * 24 * time.Hour
+	// deviceLookback 判断新设备时参考的历史范围
+	deviceLookback = 90 * 24 * time.Hour
+)
+
+// 失败原因
+const (
+	ReasonBadPassword = "bad_password"
+	ReasonLocked      = "locked"
+)
+
+// LockedError 表示邮箱或 IP 被临时锁定或处于渐进延迟中。
+type LockedError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LockedError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("登录失败次数过多，已临时锁定，请在 %d 分钟后重试", int((e.RetryAfter+time.Minute-1)/time.Minute))
+	}
+	return "登录失败次数过多，请稍后再试"
+}
+
+// Attempt 描述一次登录的来源信息。
+type Attempt struct {
+	IP        string
+	UserAgent string
+	Method    string
+}
+
+type Service struct {
+	mu          sync.Mutex
+	db          *gorm.DB
+	stopCleanup chan struct{}
+}
+
+func New(db *gorm.DB) *Service {
+	s := &Service{
+		db:          db,
+		stopCleanup: make(chan struct{}),
+	}
+	go s.cleanupLoop()
+	return s
+}
+
+// SetDB updates the database handle after a runtime database switch.
+func (s *Service) SetDB(db *gorm.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db = db
+}
+
+func (s *Service) handle() *gorm.DB {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db
+}
+
+// AccountKey 返回按邮箱计数的失败键；无论账户是否存在都使用同一个键，避免泄露账户是否注册。
+func AccountKey(email string) string {
+	return truncate("email:"+strings.ToLower(strings.TrimSpace(email)), keySize)
+}
+
+// IPKey 返回按客户端 IP 计数的失败键。
+func IPKey(ip string) string {
+	ip = strings.TrimSpace(ip)
+	if ip == "" {
+		return ""
+	}
+	return truncate("ip:"+ip, keySize)
+}
+
+// TwoFactorKey 返回按用户计数的两步验证失败键，登录第二步与关闭两步验证、重新生成恢复码共用。
+func TwoFactorKey(userID uint) string {
+	return "2fa:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// Reserve 在校验密码之前为每个键原子地占用一次尝试：处于锁定或渐进延迟中时返回 *LockedError，
+// 否则先把本次尝试计入失败次数，登录成功后再由 Reset 清除。
+// 这样并发请求无法在计数写入前同时通过检查。
+func (s *Service) Reserve(ctx context.Context, keys ...string) error {
+	if s == nil {
+		return nil
+	}
+	db := s.handle()
+	if db == nil {
+		return gorm.ErrInvalidDB
+	}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := s.reserveKey(ctx, db, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) reserveKey(ctx context.Context, db *gorm.DB, key string) error {
+	for i := 0; i < reserveRetries; i++ {
+		now := time.Now()
+		var entry data.LoginFailure
+		err := db.WithContext(ctx).Where("failure_key = ?", key).First(&entry).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			result := db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&data.LoginFailure{Key: key, FailedCount: 1, LastFailedAt: now})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 1 {
+				return nil
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		count := entry.FailedCount
+		switch {
+		case entry.LockedUntil != nil && now.Before(*entry.LockedUntil):
+			return &LockedError{RetryAfter: entry.LockedUntil.Sub(now), Locked: true}
+		case entry.LockedUntil != nil || now.Sub(entry.LastFailedAt) > failureDecay:
+			// 锁定已过期或距上次失败太久，重新计数
+			count = 0
+		default:
+			if wait := entry.LastFailedAt.Add(delayFor(count)).Sub(now); wait > 0 {
+				return &LockedError{RetryAfter: wait}
+			}
+		}
+		count++
+		var lockedUntil *time.Time
+		if count >= lockThreshold {
+			until := now.Add(LockDuration)
+			lockedUntil = &until
+		}
+		// 以读取到的计数和时间作为条件更新，并发请求中只有一个能占用这次尝试
+		result := db.WithContext(ctx).Model(&data.LoginFailure{}).
+			Where("failure_key = ? AND failed_count = ? AND last_failed_at = ?", key, entry.FailedCount, entry.LastFailedAt).
+			Updates(map[string]interface{}{
+				"failed_count":   count,
+				"last_failed_at": now,
+				"locked_until":   lockedUntil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil
+		}
+	}
+	return &LockedError{RetryAfter: time.Second}
+}
+
+// Reset 在密码验证通过后清除这些键的失败计数。
+func (s *Service) Reset(ctx context.Context, keys ...string) error {
+	if s == nil {
+		return nil
+	}
+	db := s.handle()
+	if db == nil {
+		return gorm.ErrInvalidDB
+	}
+	keys = nonEmpty(keys)
+	if len(keys) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Where("failure_key IN ?", keys).Delete(&data.LoginFailure{}).Error
+}
+
+// RecordFailure 为已存在的账户写入一条密码错误的登录历史；失败次数已由 Reserve 计入。
+func (s *Service) RecordFailure(ctx context.Context, userID uint, attempt Attempt) error {
+	if s == nil || userID == 0 {
+		return nil
+	}
+	db := s.handle()
+	if db == nil {
+		return gorm.ErrInvalidDB
+	}
+	return s.appendHistory(ctx, db, data.LoginHistory{
+		UserID:    userID,
+		IP:        truncate(attempt.IP, 64),
+		UserAgent: truncate(attempt.UserAgent, 512),
+		Method:    truncate(attempt.Method, 16),
+		Success:   false,
+		Reason:    ReasonBadPassword,
+	})
+}
+
+// RecordBlocked 记录一次因锁定而被拒绝的登录。
+func (s *Service) RecordBlocked(ctx context.Context, userID uint, attempt Attempt) {
+	if s == nil || userID == 0 {
+		return
+	}
+	db := s.handle()
+	if db == nil {
+		return
+	}
+	_ = s.appendHistory(ctx, db, data.LoginHistory{
+		UserID:    userID,
+		IP:        truncate(attempt.IP, 64),
+		UserAgent: truncate(attempt.UserAgent, 512),
+		Method:    truncate(attempt.Method, 16),
+		Reason:    ReasonLocked,
+	})
+}
+
+// RecordSuccess 写入登录历史；返回是否来自新的 IP 或设备。
+// 首次登录（没有任何成功记录）不视为新设备。
+func (s *Service) RecordSuccess(ctx context.Context, userID uint, attempt Attempt) (bool, error) {
+	if s == nil || userID == 0 {
+		return false, nil
+	}
+	db := s.handle()
+	if db == nil {
+		return false, gorm.ErrInvalidDB
+	}
+	newDevice, err := s.isNewDevice(ctx, db, userID, attempt)
+	if err != nil {
+		return false, err
+	}
+	err = s.appendHistory(ctx, db, data.LoginHistory{
+		UserID:    userID,
+		IP:        truncate(attempt.IP, 64),
+		UserAgent: truncate(attempt.UserAgent, 512),
+		Method:    truncate(attempt.Method, 16),
+		Success:   true,
+		NewDevice: newDevice,
+	})
+	return newDevice, err
+}
+
+// Unlock 清除账户邮箱对应的失败计数与锁定状态。
+func (s *Service) Unlock(ctx context.Context, email string) error {
+	return s.Reset(ctx, AccountKey(email))
+}
+
+// History 按时间倒序返回登录历史。
+func (s *Service) History(ctx context.Context, userID uint, limit, offset int) ([]data.LoginHistory, int64, error) {
+	db := s.handle()
+	if db == nil {
+		return nil, 0, gorm.ErrInvalidDB
+	}
+	query := db.WithContext(ctx).Model(&data.LoginHistory{}).Where("user_id = ?", userID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var items []data.LoginHistory
+	if err := query.Order("created_at desc, id desc").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func (s *Service) isNewDevice(ctx context.Context, db *gorm.DB, userID uint, attempt Attempt) (bool, error) {
+	since := time.Now().Add(-deviceLookback)
+	base := func() *gorm.DB {
+		return db.WithContext(ctx).Model(&data.LoginHistory{}).
+			Where("user_id = ? AND success = ? AND created_at > ?", userID, true, since)
+	}
+	var total int64
+	if err := base().Count(&total).Error; err != nil {
+		return false, err
+	}
+	if total == 0 {
+		return false, nil
+	}
+	var sameIP, sameAgent int64
+	if err := base().Where("ip = ?", truncate(attempt.IP, 64)).Count(&sameIP).Error; err != nil {
+		return false, err
+	}
+	if err := base().Where("user_agent = ?", truncate(attempt.UserAgent, 512)).Count(&sameAgent).Error; err != nil {
+		return false, err
+	}
+	return sameIP == 0 || sameAgent == 0, nil
+}
+
+func (s *Service) appendHistory(ctx context.Context, db *gorm.DB, entry data.LoginHistory) error {
+	return db.WithContext(ctx).Create(&entry).Error
+}
+
+func (s *Service) cleanupLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCleanup:
+			return
+		case <-ticker.C:
+			db := s.handle()
+			if db == nil {
+				continue
+			}
+			ctx := context.Background()
+			if err := db.WithContext(ctx).
+				Delete(&data.LoginHistory{}, "created_at < ?", time.Now().Add(-historyRetention)).Error; err != nil {
+				log.Printf("[loginguard] cleanup history failed: %v", err)
+			}
+			if err := db.WithContext(ctx).
+				Delete(&data.LoginFailure{}, "last_failed_at < ? AND (locked_until IS NULL OR locked_until < ?)", time.Now().Add(-failureDecay), time.Now()).Error; err != nil {
+				log.Printf("[loginguard] cleanup failures failed: %v", err)
+			}
+		}
+	}
+}
+
+// delayFor 返回第 count 次连续失败后下一次尝试前需要等待的时间。
+func delayFor(count int) time.Duration {
+	if count < freeAttempts {
+		return 0
+	}
+	shift := count - freeAttempts
+	if shift > 6 {
+		return maxDelay
+	}
+	return min(time.Second<<shift, maxDelay)
+}
+
+func nonEmpty(keys []string) []string {
+	out := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key != "" {
+			out = append(out, key)
+		}
+	}
+	return out
+}
+
+// truncate 按字符截断，避免把多字节 UTF-8 字符截成半个。
+func truncate(value string, limit int) string {
+	value = strings.TrimSpace(value)
+	if utf8.RuneCountInString(value) <= limit {
+		return value
+	}
+	return string([]rune(value)[:limit])
+}
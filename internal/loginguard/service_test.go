@@ -0,0 +1,178 @@
+package loginguard
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+const testUserID = 1000000000000001
+
+func newTestService(t *testing.T) (*Service, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&data.LoginFailure{}, &data.LoginHistory{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return New(db), db
+}
+
+func TestDelayFor(t *testing.T) {
+	cases := map[int]time.Duration{
+		0: 0, 2: 0, 3: time.Second, 4: 2 * time.Second, 6: 8 * time.Second, 9: time.Minute, 20: time.Minute,
+	}
+	for count, want := range cases {
+		if got := delayFor(count); got != want {
+			t.Fatalf("delayFor(%d) = %v, want %v", count, got, want)
+		}
+	}
+}
+
+func TestProgressiveDelayAndLockout(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	key := AccountKey(" Victim@Example.com ")
+	if key != AccountKey("victim@example.com") {
+		t.Fatalf("expected account keys to be normalized, got %q", key)
+	}
+
+	for i := 0; i < freeAttempts; i++ {
+		if err := svc.Reserve(ctx, key); err != nil {
+			t.Fatalf("expected no delay before %d attempts, got %v", freeAttempts, err)
+		}
+	}
+	var locked *LockedError
+	if err := svc.Reserve(ctx, key); !errors.As(err, &locked) || locked.Locked {
+		t.Fatalf("expected progressive delay, got %v", err)
+	}
+
+	for i := freeAttempts; i < lockThreshold; i++ {
+		backdate(t, svc, key)
+		if err := svc.Reserve(ctx, key); err != nil {
+			t.Fatalf("reserve attempt %d: %v", i+1, err)
+		}
+	}
+	backdate(t, svc, key)
+	if err := svc.Reserve(ctx, key); !errors.As(err, &locked) || !locked.Locked || locked.RetryAfter <= LockDuration-time.Minute {
+		t.Fatalf("expected lockout, got %v", err)
+	}
+
+	if err := svc.Unlock(ctx, "victim@example.com"); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if err := svc.Reserve(ctx, key); err != nil {
+		t.Fatalf("expected unlock to clear lockout, got %v", err)
+	}
+}
+
+func TestReserve_IsAtomicUnderConcurrency(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := context.Background()
+	key := IPKey("198.51.100.1")
+
+	const workers = 20
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int32
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if svc.Reserve(ctx, key) == nil {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var entry data.LoginFailure
+	if err := db.Where("failure_key = ?", key).First(&entry).Error; err != nil {
+		t.Fatalf("load failure entry: %v", err)
+	}
+	if int(allowed.Load()) != entry.FailedCount {
+		t.Fatalf("expected every allowed attempt to be counted, allowed=%d counted=%d", allowed.Load(), entry.FailedCount)
+	}
+	if got := allowed.Load(); got > freeAttempts {
+		t.Fatalf("expected at most %d concurrent attempts before the delay, got %d", freeAttempts, got)
+	}
+}
+
+func TestReset_ClearsOnlyGivenKeys(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	account, ip := AccountKey("a@example.com"), IPKey("203.0.113.9")
+
+	for i := 0; i < freeAttempts; i++ {
+		if err := svc.Reserve(ctx, account, ip); err != nil {
+			t.Fatalf("reserve: %v", err)
+		}
+	}
+	if err := svc.Reset(ctx, account); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if err := svc.Reserve(ctx, account); err != nil {
+		t.Fatalf("expected reset account key to be free, got %v", err)
+	}
+	var locked *LockedError
+	if err := svc.Reserve(ctx, ip); !errors.As(err, &locked) {
+		t.Fatalf("expected IP key to stay delayed, got %v", err)
+	}
+}
+
+// backdate 把上次尝试时间前移，跳过渐进延迟。
+func backdate(t *testing.T, svc *Service, key string) {
+	t.Helper()
+	if err := svc.handle().Model(&data.LoginFailure{}).Where("failure_key = ?", key).
+		Update("last_failed_at", time.Now().Add(-2*maxDelay)).Error; err != nil {
+		t.Fatalf("backdate failure entry: %v", err)
+	}
+}
+
+func TestRecordSuccess_DetectsNewDevice(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	home := Attempt{IP: "203.0.113.10", UserAgent: "Firefox", Method: "password"}
+
+	for i := 0; i < freeAttempts; i++ {
+		_ = svc.RecordFailure(ctx, testUserID, home)
+	}
+	newDevice, err := svc.RecordSuccess(ctx, testUserID, home)
+	if err != nil {
+		t.Fatalf("record success: %v", err)
+	}
+	if newDevice {
+		t.Fatalf("first successful login should not be flagged as new device")
+	}
+	if newDevice, _ := svc.RecordSuccess(ctx, testUserID, home); newDevice {
+		t.Fatalf("known device flagged as new")
+	}
+	if newDevice, _ := svc.RecordSuccess(ctx, testUserID, Attempt{IP: "192.0.2.77", UserAgent: "Firefox"}); !newDevice {
+		t.Fatalf("expected new IP to be flagged")
+	}
+	if newDevice, _ := svc.RecordSuccess(ctx, testUserID, Attempt{IP: "203.0.113.10", UserAgent: "Safari"}); !newDevice {
+		t.Fatalf("expected new user agent to be flagged")
+	}
+
+	items, total, err := svc.History(ctx, testUserID, 2, 0)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if total != int64(freeAttempts+4) || len(items) != 2 {
+		t.Fatalf("unexpected history size: total=%d len=%d", total, len(items))
+	}
+	if items[0].UserAgent != "Safari" || !items[0].NewDevice {
+		t.Fatalf("expected newest entry first, got %+v", items[0])
+	}
+}
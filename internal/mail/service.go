@@ -15,6 +15,7 @@ import (
 
 	"skyimage/internal/admin"
 	"skyimage/internal/data"
+	"skyimage/internal/metrics"
 )
 
 type Service struct {
@@ -153,6 +154,12 @@ func BuildMessage(from, to, subject, body string) ([]byte, string, string, error
 }
 
 func (s *Service) SendMailWithConfig(config *SMTPConfig, to, subject, body string) error {
+	err := s.sendMailWithConfig(config, to, subject, body)
+	metrics.ObserveMail(err)
+	return err
+}
+
+func (s *Service) sendMailWithConfig(config *SMTPConfig, to, subject, body string) error {
 	// BuildMessage applies header/body sanitization (CRLF strip + html.EscapeString).
 	message, from, toClean, err := BuildMessage(config.From, to, subject, body)
 	if err != nil {
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"bufio"
+	"runtime"
+	"time"
+
+	"skyimage/internal/version"
+)
+
+const namespace = "skyimage_"
+
+// 存储操作类型
+const (
+	StoragePut    = "put"
+	StorageGet    = "get"
+	StorageDelete = "delete"
+)
+
+var (
+	HTTPRequests = NewCounterVec(namespace+"http_requests_total",
+		"HTTP requests handled, by route template, method and status code.", "method", "route", "status")
+	HTTPDuration = NewHistogramVec(namespace+"http_request_duration_seconds",
+		"HTTP request latency by route template and method.", nil, "method", "route")
+
+	Uploads = NewCounterVec(namespace+"uploads_total",
+		"Files stored successfully, by storage strategy and driver.", "strategy", "driver")
+	UploadBytes = NewCounterVec(namespace+"upload_bytes_total",
+		"Bytes stored by successful uploads, by storage strategy and driver.", "strategy", "driver")
+
+	StorageDuration = NewHistogramVec(namespace+"storage_operation_duration_seconds",
+		"Storage backend operation latency by driver and operation.", nil, "driver", "operation")
+	StorageErrors = NewCounterVec(namespace+"storage_operation_errors_total",
+		"Failed storage backend operations by driver and operation.", "driver", "operation")
+
+	AuditQueue = NewGaugeVec(namespace+"audit_queue_depth",
+		"Image audits queued or in progress on this instance.")
+	AuditResults = NewCounterVec(namespace+"audit_results_total",
+		"Automatic image audit outcomes (pass, review, block, error).", "decision")
+
+	ImageProcessing = NewHistogramVec(namespace+"image_processing_duration_seconds",
+		"Image processing duration by operation (process, thumbnail).", nil, "operation")
+
+	ActiveSessions = NewGaugeFunc(namespace+"active_sessions",
+		"Unexpired login sessions.")
+
+	MailSent = NewCounterVec(namespace+"mail_sent_total",
+		"Outgoing mail attempts by result (success, failure).", "result")
+
+	PaymentNotifies = NewCounterVec(namespace+"payment_notify_total",
+		"Payment provider notifications by provider and result.", "provider", "result")
+
+	// Default 包含全部内置指标与运行时信息。
+	Default = newDefaultRegistry()
+)
+
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.MustRegister(
+		HTTPRequests,
+		HTTPDuration,
+		Uploads,
+		UploadBytes,
+		StorageDuration,
+		StorageErrors,
+		AuditQueue,
+		AuditResults,
+		ImageProcessing,
+		ActiveSessions,
+		MailSent,
+		PaymentNotifies,
+		runtimeCollector{},
+	)
+	// 无标签的仪表盘先输出 0，避免在第一次审核前缺少序列
+	AuditQueue.Set(0)
+	return r
+}
+
+// ObserveStorage 记录一次存储操作的耗时，err 非空时同时计入错误数。
+func ObserveStorage(driver, operation string, start time.Time, err error) {
+	StorageDuration.ObserveSince(start, driver, operation)
+	if err != nil {
+		StorageErrors.Inc(driver, operation)
+	}
+}
+
+// ObserveMail 记录一次发信结果。
+func ObserveMail(err error) {
+	if err != nil {
+		MailSent.Inc("failure")
+		return
+	}
+	MailSent.Inc("success")
+}
+
+var startTime = time.Now()
+
+// runtimeCollector 输出构建版本、进程启动时间与 goroutine 数。
+type runtimeCollector struct{}
+
+func (runtimeCollector) describe() (string, string, string) {
+	return namespace + "build_info", "Build information; the value is always 1.", "gauge"
+}
+
+func (runtimeCollector) writeSamples(w *bufio.Writer) {
+	writeSample(w, namespace+"build_info", []string{"version", "goversion"}, []string{version.Version, runtime.Version()}, "", "", 1)
+	w.WriteString("# HELP process_start_time_seconds Start time of the process since unix epoch in seconds.\n")
+	w.WriteString("# TYPE process_start_time_seconds gauge\n")
+	writeSample(w, "process_start_time_seconds", nil, nil, "", "", float64(startTime.Unix()))
+	w.WriteString("# HELP go_goroutines Number of goroutines that currently exist.\n")
+	w.WriteString("# TYPE go_goroutines gauge\n")
+	writeSample(w, "go_goroutines", nil, nil, "", "", float64(runtime.NumGoroutine()))
+}
@@ -0,0 +1,381 @@
+// Package metrics 实现 Prometheus 文本格式（0.0.4）所需的最小指标类型：计数器、仪表盘与直方图。
+// 指标只保存在进程内存中，多实例部署时由 Prometheus 分别抓取后聚合。
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ContentType 是文本格式指标的 Content-Type。
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets 是耗时类直方图的默认分桶（秒）。
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Collector 是可以输出到 Registry 的指标。
+type Collector interface {
+	describe() (name, help, kind string)
+	writeSamples(w *bufio.Writer)
+}
+
+// Registry 按注册顺序输出全部指标。
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+	names      map[string]struct{}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+// MustRegister 注册指标，重复的指标名会 panic（属于编程错误）。
+func (r *Registry) MustRegister(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range collectors {
+		name, _, _ := c.describe()
+		if _, ok := r.names[name]; ok {
+			panic("metrics: duplicate metric " + name)
+		}
+		r.names[name] = struct{}{}
+		r.collectors = append(r.collectors, c)
+	}
+}
+
+// WriteTo 以 Prometheus 文本格式输出全部指标。
+func (r *Registry) WriteTo(out io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: out}
+	w := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		name, help, kind := c.describe()
+		w.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+		w.WriteString("# TYPE " + name + " " + kind + "\n")
+		c.writeSamples(w)
+	}
+	err := w.Flush()
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ---------------------------------------------------------------------------
+// Counter / Gauge
+// ---------------------------------------------------------------------------
+
+// atomicFloat 以 uint64 位模式保存 float64，支持无锁累加。
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) add(delta float64) {
+	for {
+		old := f.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if f.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(value float64) {
+	f.bits.Store(math.Float64bits(value))
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// series 按标签值保存同一指标的多条时间序列。
+type series[T any] struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.RWMutex
+	values map[string]*seriesEntry[T]
+	create func() *T
+}
+
+type seriesEntry[T any] struct {
+	labelValues []string
+	value       *T
+}
+
+func newSeries[T any](name, help string, labels []string, create func() *T) series[T] {
+	return series[T]{name: name, help: help, labels: labels, values: make(map[string]*seriesEntry[T]), create: create}
+}
+
+func (s *series[T]) get(labelValues []string) *T {
+	if len(labelValues) != len(s.labels) {
+		panic("metrics: " + s.name + " expects " + strconv.Itoa(len(s.labels)) + " label values")
+	}
+	key := strings.Join(labelValues, "\xff")
+	s.mu.RLock()
+	entry, ok := s.values[key]
+	s.mu.RUnlock()
+	if ok {
+		return entry.value
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok = s.values[key]; !ok {
+		entry = &seriesEntry[T]{labelValues: append([]string(nil), labelValues...), value: s.create()}
+		s.values[key] = entry
+	}
+	return entry.value
+}
+
+// sorted 返回按标签值排序的序列，保证输出稳定。
+func (s *series[T]) sorted() []*seriesEntry[T] {
+	s.mu.RLock()
+	out := make([]*seriesEntry[T], 0, len(s.values))
+	for _, entry := range s.values {
+		out = append(out, entry)
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].labelValues, "\xff") < strings.Join(out[j].labelValues, "\xff")
+	})
+	return out
+}
+
+// CounterVec 是只增不减的计数器。
+type CounterVec struct {
+	series[atomicFloat]
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newSeries(name, help, labels, func() *atomicFloat { return &atomicFloat{} })}
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add 累加计数，负数会被忽略。
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.get(labelValues).add(delta)
+}
+
+func (c *CounterVec) describe() (string, string, string) { return c.name, c.help, "counter" }
+
+func (c *CounterVec) writeSamples(w *bufio.Writer) {
+	for _, entry := range c.sorted() {
+		writeSample(w, c.name, c.labels, entry.labelValues, "", "", entry.value.load())
+	}
+}
+
+// GaugeVec 是可增可减的当前值。
+type GaugeVec struct {
+	series[atomicFloat]
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newSeries(name, help, labels, func() *atomicFloat { return &atomicFloat{} })}
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.get(labelValues).set(value)
+}
+
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.get(labelValues).add(delta)
+}
+
+func (g *GaugeVec) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+func (g *GaugeVec) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+func (g *GaugeVec) describe() (string, string, string) { return g.name, g.help, "gauge" }
+
+func (g *GaugeVec) writeSamples(w *bufio.Writer) {
+	for _, entry := range g.sorted() {
+		writeSample(w, g.name, g.labels, entry.labelValues, "", "", entry.value.load())
+	}
+}
+
+// GaugeFunc 在抓取时调用回调读取当前值，适合数据库中的计数。
+// 回调返回 ok=false 时不输出样本。
+type GaugeFunc struct {
+	name string
+	help string
+	mu   sync.RWMutex
+	fn   func() (float64, bool)
+}
+
+func NewGaugeFunc(name, help string) *GaugeFunc {
+	return &GaugeFunc{name: name, help: help}
+}
+
+// SetFunc 设置取值回调；运行时切换数据库后需要重新设置。
+func (g *GaugeFunc) SetFunc(fn func() (float64, bool)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.fn = fn
+}
+
+func (g *GaugeFunc) describe() (string, string, string) { return g.name, g.help, "gauge" }
+
+func (g *GaugeFunc) writeSamples(w *bufio.Writer) {
+	g.mu.RLock()
+	fn := g.fn
+	g.mu.RUnlock()
+	if fn == nil {
+		return
+	}
+	if value, ok := fn(); ok {
+		writeSample(w, g.name, nil, nil, "", "", value)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Histogram
+// ---------------------------------------------------------------------------
+
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *histogram) observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// HistogramVec 统计观测值的分布，输出累计分桶、总和与次数。
+type HistogramVec struct {
+	series[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec 创建直方图，buckets 为空时使用 DefBuckets。
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	return &HistogramVec{
+		series: newSeries(name, help, labels, func() *histogram {
+			return &histogram{buckets: bounds, counts: make([]uint64, len(bounds))}
+		}),
+		buckets: bounds,
+	}
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.get(labelValues).observe(value)
+}
+
+// ObserveSince 记录从 start 到现在经过的秒数，可直接用于 defer。
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *HistogramVec) describe() (string, string, string) { return h.name, h.help, "histogram" }
+
+func (h *HistogramVec) writeSamples(w *bufio.Writer) {
+	for _, entry := range h.sorted() {
+		hist := entry.value
+		hist.mu.Lock()
+		counts := append([]uint64(nil), hist.counts...)
+		count, sum := hist.count, hist.sum
+		hist.mu.Unlock()
+		for i, bound := range h.buckets {
+			writeSample(w, h.name+"_bucket", h.labels, entry.labelValues, "le", formatFloat(bound), float64(counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, entry.labelValues, "le", "+Inf", float64(count))
+		writeSample(w, h.name+"_sum", h.labels, entry.labelValues, "", "", sum)
+		writeSample(w, h.name+"_count", h.labels, entry.labelValues, "", "", float64(count))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Exposition helpers
+// ---------------------------------------------------------------------------
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label + `="` + escapeLabelValue(values[i]) + `"`)
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraLabel + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
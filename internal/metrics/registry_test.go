@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryWritesPrometheusText(t *testing.T) {
+	requests := NewCounterVec("test_requests_total", "Requests.", "route", "status")
+	queue := NewGaugeVec("test_queue_depth", "Queue depth.")
+	latency := NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.5, 0.1}, "route")
+	sessions := NewGaugeFunc("test_sessions", "Sessions.")
+	registry := NewRegistry()
+	registry.MustRegister(requests, queue, latency, sessions)
+
+	requests.Inc("/b", "200")
+	requests.Add(2, "/a", "500")
+	requests.Add(-5, "/a", "500")
+	requests.Inc("/q\"uote\\", "200")
+	queue.Inc()
+	queue.Inc()
+	queue.Dec()
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.2, "/a")
+	latency.Observe(3, "/a")
+
+	var out strings.Builder
+	if _, err := registry.WriteTo(&out); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	want := `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{route="/a",status="500"} 2
+test_requests_total{route="/b",status="200"} 1
+test_requests_total{route="/q\"uote\\",status="200"} 1
+# HELP test_queue_depth Queue depth.
+# TYPE test_queue_depth gauge
+test_queue_depth 1
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{route="/a",le="0.1"} 1
+test_latency_seconds_bucket{route="/a",le="0.5"} 2
+test_latency_seconds_bucket{route="/a",le="+Inf"} 3
+test_latency_seconds_sum{route="/a"} 3.25
+test_latency_seconds_count{route="/a"} 3
+# HELP test_sessions Sessions.
+# TYPE test_sessions gauge
+`
+	if out.String() != want {
+		t.Fatalf("unexpected exposition:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	sessions.SetFunc(func() (float64, bool) { return 7, true })
+	out.Reset()
+	_, _ = registry.WriteTo(&out)
+	if !strings.HasSuffix(out.String(), "test_sessions 7\n") {
+		t.Fatalf("gauge func should be sampled at scrape time:\n%s", out.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("registering a duplicate metric should panic")
+		}
+	}()
+	registry.MustRegister(NewCounterVec("test_requests_total", "dup"))
+}
@@ -14,21 +14,68 @@ import (
 	"skyimage/internal/users"
 )
 
-const userContextKey = "currentUser"
+const (
+	userContextKey          = "currentUser"
+	apiTokenContextKey      = "currentApiToken"
+	impersonationContextKey = "currentImpersonation"
+)
+
+// Impersonation 描述当前请求所属的模拟登录会话。
+type Impersonation struct {
+	ImpersonatorID uint
+	ExpiresAt      time.Time
+}
+
+// TokenScopePolicy 返回当前请求所需的 API Token 权限。
+// 返回空字符串时仅允许完全权限的 Token；Session 登录不受影响。
+type TokenScopePolicy func(c *gin.Context) string
+
+// Scope 要求固定的权限。
+func Scope(scope string) TokenScopePolicy {
+	return func(*gin.Context) string { return scope }
+}
+
+// ScopeByMethod 对只读请求（GET/HEAD/OPTIONS）要求 read，其余请求要求 write。
+func ScopeByMethod(read, write string) TokenScopePolicy {
+	return func(c *gin.Context) string {
+		if isSafeMethod(c.Request.Method) {
+			return read
+		}
+		return write
+	}
+}
 
-// Auth 强制认证中间件，要求用户必须登录
+// Auth 强制认证中间件，要求用户必须登录。
+// 通过 API Token 访问时仅允许完全权限的 Token，需要细分权限的路由使用 AuthWithScope。
 func Auth(userService *users.Service, sessionManager *session.Manager) gin.HandlerFunc {
+	return AuthWithScope(userService, sessionManager, nil)
+}
+
+// AuthWithScope 与 Auth 相同，但 API Token 只需具备 policy 返回的权限即可访问。
+func AuthWithScope(userService *users.Service, sessionManager *session.Manager, policy TokenScopePolicy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 尝试 Bearer Token 认证
 		authHeader := c.GetHeader("Authorization")
 		if strings.HasPrefix(authHeader, "Bearer ") {
 			token := strings.TrimPrefix(authHeader, "Bearer ")
-			user, ok := authenticateByToken(c, userService, token)
+			user, apiToken, ok := authenticateByToken(c, userService, token)
 			if ok {
+				required := ""
+				if policy != nil {
+					required = policy(c)
+				}
+				if !apiToken.HasScope(required) {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient token scope", "requiredScope": required})
+					return
+				}
 				c.Set(userContextKey, user)
+				c.Set(apiTokenContextKey, apiToken)
 				c.Next()
 				return
 			}
+			if c.IsAborted() {
+				return
+			}
 			// Bearer Token 提供但无效,直接返回 401
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
@@ -41,13 +88,17 @@ func Auth(userService *users.Service, sessionManager *session.Manager) gin.Handl
 			return
 		}
 
-		userID, ok := sessionManager.Resolve(sessionID)
+		resolved, ok := sessionManager.ResolveSession(sessionID)
 		if !ok {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid session"})
 			return
 		}
+		if !validImpersonator(c, userService, sessionManager, sessionID, resolved) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid session"})
+			return
+		}
 
-		user, err := userService.FindByID(c.Request.Context(), userID)
+		user, err := userService.FindByID(c.Request.Context(), resolved.UserID)
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				sessionManager.Delete(sessionID)
@@ -62,6 +113,76 @@ func Auth(userService *users.Service, sessionManager *session.Manager) gin.Handl
 			return
 		}
 		c.Set(userContextKey, user)
+		setImpersonation(c, resolved)
+		refreshSessionCookies(c, sessionID, resolved)
+		c.Next()
+	}
+}
+
+// BasicTokenAuth 以 HTTP Basic 认证的密码作为 API Token（用户名任意），供 WebDAV 等不支持 Bearer 的客户端使用。
+// 认证失败时返回 WWW-Authenticate 质询，便于客户端弹出登录框。
+func BasicTokenAuth(userService *users.Service, realm string, policy TokenScopePolicy) gin.HandlerFunc {
+	challenge := `Basic realm="` + strings.ReplaceAll(realm, `"`, "") + `", charset="UTF-8"`
+	return func(c *gin.Context) {
+		_, password, ok := c.Request.BasicAuth()
+		if !ok || strings.TrimSpace(password) == "" {
+			c.Header("WWW-Authenticate", challenge)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing credentials"})
+			return
+		}
+		user, apiToken, ok := authenticateByToken(c, userService, password)
+		if !ok {
+			if c.IsAborted() {
+				return
+			}
+			c.Header("WWW-Authenticate", challenge)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+		required := ""
+		if policy != nil {
+			required = policy(c)
+		}
+		if !apiToken.HasScope(required) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient token scope", "requiredScope": required})
+			return
+		}
+		c.Set(userContextKey, user)
+		c.Set(apiTokenContextKey, apiToken)
+		c.Next()
+	}
+}
+
+// KeyTokenAuth 从 extract 返回的位置读取 API Token（如 Chevereto 的 key 参数），
+// 缺失、无效或权限不足时调用 deny 以客户端协议的格式返回错误。
+func KeyTokenAuth(userService *users.Service, extract func(*gin.Context) string, policy TokenScopePolicy, deny func(c *gin.Context, status int, message string)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimSpace(extract(c))
+		if token == "" {
+			deny(c, http.StatusUnauthorized, "missing api key")
+			c.Abort()
+			return
+		}
+		user, apiToken, ok := authenticateByToken(c, userService, token)
+		if !ok {
+			if c.IsAborted() {
+				return
+			}
+			deny(c, http.StatusUnauthorized, "invalid api key")
+			c.Abort()
+			return
+		}
+		required := ""
+		if policy != nil {
+			required = policy(c)
+		}
+		if !apiToken.HasScope(required) {
+			deny(c, http.StatusForbidden, "insufficient token scope")
+			c.Abort()
+			return
+		}
+		c.Set(userContextKey, user)
+		c.Set(apiTokenContextKey, apiToken)
 		c.Next()
 	}
 }
@@ -73,9 +194,14 @@ func OptionalAuth(userService *users.Service, sessionManager *session.Manager) g
 		authHeader := c.GetHeader("Authorization")
 		if strings.HasPrefix(authHeader, "Bearer ") {
 			token := strings.TrimPrefix(authHeader, "Bearer ")
-			user, ok := authenticateByToken(c, userService, token)
-			if ok {
+			user, apiToken, ok := authenticateByToken(c, userService, token)
+			if c.IsAborted() {
+				return
+			}
+			// 受限 Token 在可选认证的路由上按匿名访问处理
+			if ok && apiToken.FullAccess() {
 				c.Set(userContextKey, user)
+				c.Set(apiTokenContextKey, apiToken)
 			}
 			// 即使 Token 无效，也继续执行（不强制要求登录）
 			c.Next()
@@ -90,14 +216,14 @@ func OptionalAuth(userService *users.Service, sessionManager *session.Manager) g
 			return
 		}
 
-		userID, ok := sessionManager.Resolve(sessionID)
-		if !ok {
+		resolved, ok := sessionManager.ResolveSession(sessionID)
+		if !ok || !validImpersonator(c, userService, sessionManager, sessionID, resolved) {
 			// session 无效，继续执行（不强制要求登录）
 			c.Next()
 			return
 		}
 
-		user, err := userService.FindByID(c.Request.Context(), userID)
+		user, err := userService.FindByID(c.Request.Context(), resolved.UserID)
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				sessionManager.Delete(sessionID)
@@ -116,14 +242,16 @@ func OptionalAuth(userService *users.Service, sessionManager *session.Manager) g
 
 		// 用户已登录且账户正常，设置用户信息
 		c.Set(userContextKey, user)
+		setImpersonation(c, resolved)
+		refreshSessionCookies(c, sessionID, resolved)
 		c.Next()
 	}
 }
 
-func authenticateByToken(c *gin.Context, userService *users.Service, token string) (data.User, bool) {
+func authenticateByToken(c *gin.Context, userService *users.Service, token string) (data.User, data.ApiToken, bool) {
 	token = strings.TrimSpace(token)
 	if token == "" {
-		return data.User{}, false
+		return data.User{}, data.ApiToken{}, false
 	}
 
 	var apiToken data.ApiToken
@@ -141,10 +269,15 @@ func authenticateByToken(c *gin.Context, userService *users.Service, token strin
 			Where("expires_at > ?", now).
 			Where("token = ?", token).
 			First(&apiToken).Error; err != nil || !data.IsLegacyPlainAPIToken(apiToken.Token) {
-			return data.User{}, false
+			return data.User{}, data.ApiToken{}, false
 		}
 	}
 
+	if !apiToken.AllowsIP(c.ClientIP()) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token not allowed from this address"})
+		return data.User{}, data.ApiToken{}, false
+	}
+
 	updates := map[string]interface{}{"last_used_at": now}
 	if data.IsLegacyPlainAPIToken(apiToken.Token) {
 		updates["token"] = hashed
@@ -156,16 +289,16 @@ func authenticateByToken(c *gin.Context, userService *users.Service, token strin
 
 	user, err := userService.FindByID(c.Request.Context(), apiToken.UserID)
 	if err != nil {
-		return data.User{}, false
+		return data.User{}, data.ApiToken{}, false
 	}
 
 	// Check if user account is disabled
 	if user.Status == 0 {
 		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "account disabled"})
-		return data.User{}, false
+		return data.User{}, data.ApiToken{}, false
 	}
 
-	return user, true
+	return user, apiToken, true
 }
 
 func RequireAdmin() gin.HandlerFunc {
@@ -198,6 +331,135 @@ func RequireSuperAdmin() gin.HandlerFunc {
 	}
 }
 
+// RequirePermission 要求管理员拥有指定的后台权限；未分配角色的管理员拥有全部权限。
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing user"})
+			return
+		}
+		if !user.HasAdminPermission(perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission required", "requiredPermission": perm})
+			return
+		}
+		c.Next()
+	}
+}
+
+// validImpersonator 确认模拟登录的发起者仍是启用状态的超级管理员，否则立即注销该会话。
+func validImpersonator(c *gin.Context, userService *users.Service, sessionManager *session.Manager, sessionID string, resolved session.Resolved) bool {
+	if resolved.ImpersonatorID == 0 {
+		return true
+	}
+	admin, err := userService.FindByID(c.Request.Context(), resolved.ImpersonatorID)
+	if err == nil && admin.IsSuperAdmin && admin.Status == 1 {
+		return true
+	}
+	sessionManager.Delete(sessionID)
+	return false
+}
+
+func setImpersonation(c *gin.Context, resolved session.Resolved) {
+	if resolved.ImpersonatorID == 0 {
+		return
+	}
+	c.Set(impersonationContextKey, Impersonation{ImpersonatorID: resolved.ImpersonatorID, ExpiresAt: resolved.ExpiresAt})
+}
+
+// refreshSessionCookies 在会话有效期顺延后同步延长 Cookie 的 MaxAge，
+// 否则浏览器会按登录时的 MaxAge 丢弃仍然有效的会话。
+func refreshSessionCookies(c *gin.Context, sessionID string, resolved session.Resolved) {
+	if !resolved.Refreshed {
+		return
+	}
+	WriteSessionCookie(c, sessionID, resolved.Lifetime)
+	if token, err := c.Cookie(CSRFCookieName); err == nil && token != "" {
+		WriteCSRFCookie(c, token, resolved.Lifetime)
+	}
+}
+
+// WriteSessionCookie 写入会话 Cookie。
+func WriteSessionCookie(c *gin.Context, sessionID string, lifetime time.Duration) {
+	// Lax (not Strict): OAuth IdP redirects back with a top-level GET navigation.
+	// Strict would omit the session cookie on that callback and break account binding.
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     session.CookieName,
+		Value:    sessionID,
+		Path:     "/",
+		MaxAge:   int(lifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   IsSecureRequest(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// WriteCSRFCookie 写入供前端读取的 CSRF Cookie。
+func WriteCSRFCookie(c *gin.Context, token string, lifetime time.Duration) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(lifetime.Seconds()),
+		HttpOnly: false,
+		Secure:   IsSecureRequest(c),
+		// Lax so CSRF cookie is still present after OAuth top-level return navigation.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// IsSecureRequest 判断请求是否经由 HTTPS（含反向代理转发）到达。
+func IsSecureRequest(c *gin.Context) bool {
+	if c.Request.TLS != nil {
+		return true
+	}
+	return strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+}
+
+// CurrentImpersonation 返回当前请求的模拟登录信息；普通会话与 API Token 时 ok 为 false。
+func CurrentImpersonation(c *gin.Context) (Impersonation, bool) {
+	raw, ok := c.Get(impersonationContextKey)
+	if !ok {
+		return Impersonation{}, false
+	}
+	info, ok := raw.(Impersonation)
+	return info, ok
+}
+
+// BlockImpersonation 禁止模拟登录会话访问敏感操作（密码、Token、支付等）。
+func BlockImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := CurrentImpersonation(c); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "模拟登录期间禁止此操作", "impersonating": true})
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentAPIToken 返回本次请求使用的 API Token；Session 登录时 ok 为 false。
+func CurrentAPIToken(c *gin.Context) (data.ApiToken, bool) {
+	raw, ok := c.Get(apiTokenContextKey)
+	if !ok {
+		return data.ApiToken{}, false
+	}
+	token, ok := raw.(data.ApiToken)
+	return token, ok
+}
+
+// TokenStrategyIDs 返回当前 Token 允许使用的储存策略；nil 表示不限制。
+func TokenStrategyIDs(c *gin.Context) []uint {
+	token, ok := CurrentAPIToken(c)
+	if !ok {
+		return nil
+	}
+	ids := token.StrategyIDList()
+	if len(ids) == 0 {
+		return nil
+	}
+	return ids
+}
+
 func CurrentUser(c *gin.Context) (data.User, bool) {
 	raw, ok := c.Get(userContextKey)
 	if !ok {
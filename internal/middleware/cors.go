@@ -19,7 +19,8 @@ func CORS(allowedOrigins ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		origin := normalizeOrigin(c.GetHeader("Origin"))
 		if origin == "" {
-			if c.Request.Method == http.MethodOptions {
+			// WebDAV 客户端用 OPTIONS 探测服务能力，交给 WebDAV 处理器响应 DAV 头
+			if c.Request.Method == http.MethodOptions && !isWebDAVPath(c.Request.URL.Path) {
 				applyPermissivePreflight(c)
 				c.AbortWithStatus(http.StatusNoContent)
 				return
@@ -83,3 +84,7 @@ func isAllowedOrigin(origin, requestHost string, allowed map[string]struct{}) bo
 	}
 	return strings.EqualFold(parsed.Host, strings.TrimSpace(requestHost))
 }
+
+func isWebDAVPath(p string) bool {
+	return p == "/dav" || strings.HasPrefix(p, "/dav/")
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"skyimage/internal/metrics"
+)
+
+// unmatchedRoute 是未命中路由（前端页面、本地文件、404）的 route 标签，
+// 避免把任意请求路径当作标签值。
+const unmatchedRoute = "unmatched"
+
+// knownMethods 之外的方法在未命中路由时统一记为 OTHER（WebDAV 方法由已注册路由处理）。
+var knownMethods = map[string]struct{}{
+	"GET": {}, "HEAD": {}, "POST": {}, "PUT": {}, "PATCH": {}, "DELETE": {}, "OPTIONS": {},
+}
+
+// Metrics 按路由模板统计请求数与耗时。需注册在 Recovery 之前，才能记录 panic 产生的 500。
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		method := c.Request.Method
+		if route == "" {
+			route = unmatchedRoute
+			if _, ok := knownMethods[method]; !ok {
+				method = "OTHER"
+			}
+		}
+		metrics.HTTPRequests.Inc(method, route, strconv.Itoa(c.Writer.Status()))
+		metrics.HTTPDuration.ObserveSince(start, method, route)
+	}
+}
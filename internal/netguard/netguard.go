@@ -0,0 +1,42 @@
+// Package netguard 校验出站连接的目标地址，防止服务端请求被用来访问内网服务。
+package netguard
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsInternalIP 判断地址是否为回环、私有（含 IPv6 ULA）、链路本地、组播、未指定
+// 或运营商级 NAT（100.64.0.0/10）地址；无法解析的地址视为内网地址。
+func IsInternalIP(ip net.IP) bool {
+	if ip == nil {
+		return true
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+// NewDialer 返回在建立连接前校验解析后地址的 Dialer，blocked 返回 true 的地址会被拒绝并返回 err。
+// allowLoopback 仅供测试连接本机的 httptest 服务。
+func NewDialer(timeout time.Duration, allowLoopback bool, blocked func(net.IP) bool, err error) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, splitErr := net.SplitHostPort(address)
+			if splitErr != nil {
+				return splitErr
+			}
+			ip := net.ParseIP(host)
+			if allowLoopback && ip != nil && ip.IsLoopback() {
+				return nil
+			}
+			if blocked(ip) {
+				return err
+			}
+			return nil
+		},
+	}
+}
@@ -15,13 +15,16 @@ import (
 
 const (
 	TypeImageDeleted  = "image_deleted"
+	TypeImageRejected = "image_rejected"
 	TypeTicketCreated = "ticket_created"
 	TypeTicketReply   = "ticket_reply"
 	TypeTicketStatus  = "ticket_status"
+	TypeNewLogin      = "new_login"
 
 	ReasonAuditBlockDelete = "audit_block_delete"
 	ReasonAuditErrorDelete = "audit_error_delete"
 	ReasonAdminDelete      = "admin_delete"
+	ReasonAdminReject      = "admin_reject"
 
 	ConfigUserRetentionLimit      = "notifications.user_retention_limit"
 	ConfigAdminImageDeleteReason  = "notifications.admin_image_delete_default_reason"
@@ -31,6 +34,7 @@ const (
 	MaxUserRetentionLimit         = 500
 	DefaultAdminImageDeleteReason = "图片已被管理员删除"
 	DefaultSystemAutoDeleteReason = "图片已被系统自动删除"
+	DefaultAdminImageRejectReason = "图片未通过人工审核"
 	defaultNotificationTitle      = "图片已被删除"
 )
 
@@ -152,6 +156,22 @@ func (s *Service) CreateImageDeletedByAdmin(ctx context.Context, file data.FileA
 	return s.create(ctx, file.UserID, defaultNotificationTitle, adminReason, metadata)
 }
 
+// CreateImageRejectedByAdmin 在管理员复核驳回图片时通知上传者，并附上驳回原因。
+func (s *Service) CreateImageRejectedByAdmin(ctx context.Context, file data.FileAsset, reason string) error {
+	adminReason := strings.TrimSpace(reason)
+	if adminReason == "" {
+		adminReason = DefaultAdminImageRejectReason
+	}
+	metadata := ImageDeletedMetadata{
+		FileID:           file.ID,
+		FileKey:          file.Key,
+		FileOriginalName: file.OriginalName,
+		ReasonType:       ReasonAdminReject,
+		AdminReason:      adminReason,
+	}
+	return s.createTyped(ctx, file.UserID, TypeImageRejected, "图片未通过审核", adminReason, metadata)
+}
+
 func (s *Service) List(ctx context.Context, userID uint, status string, limit, offset int) ([]data.UserNotification, error) {
 	if limit <= 0 {
 		limit = 20
@@ -249,14 +269,9 @@ type TicketNoticeMetadata struct {
 	FromStaff bool   `json:"fromStaff,omitempty"`
 }
 
+// listAdminUserIDs 返回有工单权限的管理员，工单通知只发给他们。
 func (s *Service) listAdminUserIDs(ctx context.Context) ([]uint, error) {
-	var ids []uint
-	err := s.db.WithContext(ctx).
-		Model(&data.User{}).
-		Where("is_adminer = ? OR is_super_admin = ?", true, true).
-		Where("status = ?", 1).
-		Pluck("id", &ids).Error
-	return ids, err
+	return data.UserIDsWithAdminPermission(ctx, s.db, data.AdminPermTickets)
 }
 
 func (s *Service) NotifyAdminsTicketCreated(ctx context.Context, ticket data.Ticket) error {
@@ -326,6 +341,19 @@ func (s *Service) NotifyTicketStatus(ctx context.Context, ticket data.Ticket) er
 	return s.createTyped(ctx, ticket.UserID, TypeTicketStatus, title, message, meta)
 }
 
+type LoginNoticeMetadata struct {
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+	Method    string `json:"method"`
+}
+
+// NotifyNewLogin 提醒用户账户在新的 IP 或设备上登录。
+func (s *Service) NotifyNewLogin(ctx context.Context, userID uint, meta LoginNoticeMetadata) error {
+	title := "新设备登录提醒"
+	message := fmt.Sprintf("你的账户刚刚在新的设备或网络上登录（IP: %s）。如果不是你本人操作，请立即修改密码并注销其他会话。", meta.IP)
+	return s.createTyped(ctx, userID, TypeNewLogin, title, message, meta)
+}
+
 func (s *Service) settingsMap(ctx context.Context) (map[string]string, error) {
 	var entries []data.ConfigEntry
 	if err := s.db.WithContext(ctx).Find(&entries).Error; err != nil {
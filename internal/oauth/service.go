@@ -21,6 +21,7 @@ import (
 
 	"skyimage/internal/data"
 	"skyimage/internal/users"
+	"skyimage/internal/webhooks"
 )
 
 var (
@@ -32,6 +33,7 @@ var (
 	ErrBindingExists      = errors.New("oauth account already bound")
 	ErrBindingNotFound    = errors.New("oauth binding not found")
 	ErrAccountDisabled = errors.New("account disabled")
+	ErrInviteRequired  = errors.New("invite code required")
 )
 
 const (
@@ -41,6 +43,7 @@ const (
 	RegModeOpen      = "open"
 	RegModeOAuthOnly = "oauth_only"
 	RegModeClosed    = "closed"
+	RegModeInvite    = "invite"
 )
 
 type SettingsReader interface {
@@ -51,6 +54,8 @@ type Service struct {
 	db       *gorm.DB
 	settings SettingsReader
 	http     *http.Client
+	invites  users.InviteRedeemer
+	webhooks *webhooks.Service
 }
 
 // PendingState is returned after consuming a one-time OAuth state.
@@ -59,6 +64,7 @@ type PendingState struct {
 	Mode         string
 	UserID       uint
 	CodeVerifier string
+	InviteCode   string
 }
 
 type ProviderPublic struct {
@@ -130,10 +136,20 @@ func (s *Service) SetSettings(settings SettingsReader) {
 	s.settings = settings
 }
 
+// SetInvites 设置 OAuth 注册时使用的邀请码核销实现。
+func (s *Service) SetInvites(invites users.InviteRedeemer) {
+	s.invites = invites
+}
+
+// SetWebhooks 设置 OAuth 注册成功后推送 user.registered 事件的服务。
+func (s *Service) SetWebhooks(hooks *webhooks.Service) {
+	s.webhooks = hooks
+}
+
 func NormalizeRegistrationMode(raw string, allowRegistrationFallback bool) string {
 	mode := strings.ToLower(strings.TrimSpace(raw))
 	switch mode {
-	case RegModeOpen, RegModeOAuthOnly, RegModeClosed:
+	case RegModeOpen, RegModeOAuthOnly, RegModeClosed, RegModeInvite:
 		return mode
 	}
 	// Backward compatible with features.allow_registration
@@ -356,6 +372,11 @@ func firstNonEmpty(values ...string) string {
 
 // CreateState persists CSRF state + PKCE verifier (DB-backed for multi-instance).
 func (s *Service) CreateState(ctx context.Context, provider, mode string, userID uint) (state string, codeVerifier string, err error) {
+	return s.CreateStateWithInvite(ctx, provider, mode, userID, "")
+}
+
+// CreateStateWithInvite also carries the invite code through the provider round-trip.
+func (s *Service) CreateStateWithInvite(ctx context.Context, provider, mode string, userID uint, inviteCode string) (state string, codeVerifier string, err error) {
 	mode = strings.ToLower(strings.TrimSpace(mode))
 	if mode != ModeBind {
 		mode = ModeLogin
@@ -375,6 +396,7 @@ func (s *Service) CreateState(ctx context.Context, provider, mode string, userID
 		Mode:         mode,
 		UserID:       userID,
 		CodeVerifier: codeVerifier,
+		InviteCode:   strings.TrimSpace(inviteCode),
 		ExpiresAt:    time.Now().Add(10 * time.Minute),
 	}
 	if err := s.db.WithContext(ctx).Create(&entry).Error; err != nil {
@@ -403,6 +425,7 @@ func (s *Service) ConsumeState(ctx context.Context, state string) (*PendingState
 		Mode:         entry.Mode,
 		UserID:       entry.UserID,
 		CodeVerifier: entry.CodeVerifier,
+		InviteCode:   entry.InviteCode,
 	}, nil
 }
 
@@ -703,7 +726,9 @@ func asFloat(v interface{}) float64 {
 	}
 }
 
-func (s *Service) CompleteLogin(ctx context.Context, identity ExternalIdentity, registeredIP string) (data.User, error) {
+// CompleteLogin signs in an existing binding or registers a new user.
+// inviteCode is required in invite mode and optional (referral only) otherwise.
+func (s *Service) CompleteLogin(ctx context.Context, identity ExternalIdentity, registeredIP, inviteCode string) (data.User, error) {
 	// Existing binding
 	var binding data.UserOAuthBinding
 	err := s.db.WithContext(ctx).
@@ -752,9 +777,13 @@ func (s *Service) CompleteLogin(ctx context.Context, identity ExternalIdentity,
 	if mode == RegModeClosed {
 		return data.User{}, ErrRegistrationClosed
 	}
-	// open and oauth_only both allow OAuth registration
+	// open and oauth_only both allow OAuth registration; invite requires a code
+	inviteCode = strings.TrimSpace(inviteCode)
+	if mode == RegModeInvite && (inviteCode == "" || s.invites == nil) {
+		return data.User{}, ErrInviteRequired
+	}
 
-	return s.createUserFromOAuth(ctx, identity, registeredIP)
+	return s.createUserFromOAuth(ctx, identity, registeredIP, inviteCode)
 }
 
 func (s *Service) BindToUser(ctx context.Context, userID uint, identity ExternalIdentity) error {
@@ -835,7 +864,7 @@ func (s *Service) createBinding(ctx context.Context, userID uint, identity Exter
 	return nil
 }
 
-func (s *Service) createUserFromOAuth(ctx context.Context, identity ExternalIdentity, registeredIP string) (data.User, error) {
+func (s *Service) createUserFromOAuth(ctx context.Context, identity ExternalIdentity, registeredIP, inviteCode string) (data.User, error) {
 	email := strings.ToLower(strings.TrimSpace(identity.Email))
 	if email == "" {
 		email = fmt.Sprintf("%s_%s@oauth.local", identity.Provider, identity.ProviderUserID)
@@ -881,11 +910,18 @@ func (s *Service) createUserFromOAuth(ctx context.Context, identity ExternalIden
 			ProviderName:   identity.Name,
 			AvatarURL:      identity.AvatarURL,
 		}
-		return tx.Create(&binding).Error
+		if err := tx.Create(&binding).Error; err != nil {
+			return err
+		}
+		if inviteCode == "" || s.invites == nil {
+			return nil
+		}
+		return s.invites.RedeemInTx(ctx, tx, inviteCode, user.ID)
 	}); err != nil {
 		return data.User{}, err
 	}
 	_ = s.db.WithContext(ctx).Preload("Group").First(&user, user.ID)
+	s.webhooks.Emit(ctx, webhooks.EventUserRegistered, 0, webhooks.UserRegisteredPayload(user, identity.Provider))
 	return user, nil
 }
 
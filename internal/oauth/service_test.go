@@ -114,7 +114,7 @@ func TestAutoLinkByEmailDefaultOff(t *testing.T) {
 		ProviderUserID: "42",
 		Email:          "same@example.com",
 		Name:           "new",
-	}, "1.2.3.4")
+	}, "1.2.3.4", "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -149,7 +149,7 @@ func TestAutoLinkByEmailWhenEnabled(t *testing.T) {
 		ProviderUserID: "99",
 		Email:          "same@example.com",
 		Name:           "new",
-	}, "1.2.3.4")
+	}, "1.2.3.4", "")
 	if err != nil {
 		t.Fatal(err)
 	}
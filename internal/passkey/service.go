@@ -278,20 +278,29 @@ func (s *Service) BeginLogin(ctx context.Context, requestOrigin, siteName string
 	return assertion, nil
 }
 
+// LoginResult is the outcome of a successful passkey assertion.
+type LoginResult struct {
+	User    data.User
+	Passkey *data.UserPasskey
+	// UserVerified reports whether the authenticator verified the user (PIN or
+	// biometrics), which makes the assertion a multi-factor login on its own.
+	UserVerified bool
+}
+
 // FinishLogin validates the discoverable assertion, resolves the owning user,
 // updates the credential sign count, and returns the user.
-func (s *Service) FinishLogin(ctx context.Context, requestOrigin, siteName string, rawJSON []byte) (data.User, *data.UserPasskey, error) {
+func (s *Service) FinishLogin(ctx context.Context, requestOrigin, siteName string, rawJSON []byte) (LoginResult, error) {
 	parsed, err := protocol.ParseCredentialRequestResponseBytes(rawJSON)
 	if err != nil {
-		return data.User{}, nil, err
+		return LoginResult{}, err
 	}
 	session, err := s.consumeChallenge(ctx, parsed.Response.CollectedClientData.Challenge, ActionLogin, 0)
 	if err != nil {
-		return data.User{}, nil, err
+		return LoginResult{}, err
 	}
 	wa, err := s.newWebAuthn(ctx, requestOrigin, siteName)
 	if err != nil {
-		return data.User{}, nil, err
+		return LoginResult{}, err
 	}
 	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
 		entry, err := s.findByCredentialID(ctx, rawID)
@@ -315,19 +324,19 @@ func (s *Service) FinishLogin(ctx context.Context, requestOrigin, siteName strin
 	}
 	_, cred, err := wa.ValidatePasskeyLogin(handler, *session, parsed)
 	if err != nil {
-		return data.User{}, nil, err
+		return LoginResult{}, err
 	}
 	if cred.Authenticator.CloneWarning {
-		return data.User{}, nil, errors.New("possible cloned authenticator")
+		return LoginResult{}, errors.New("possible cloned authenticator")
 	}
 	entry, err := s.findByCredentialID(ctx, cred.ID)
 	if err != nil {
-		return data.User{}, nil, err
+		return LoginResult{}, err
 	}
 	// Persist the updated credential (sign counter / flags) and last-used time.
 	updated, err := json.Marshal(cred)
 	if err != nil {
-		return data.User{}, nil, err
+		return LoginResult{}, err
 	}
 	now := time.Now()
 	if err := s.db.WithContext(ctx).Model(&data.UserPasskey{}).
@@ -336,14 +345,14 @@ func (s *Service) FinishLogin(ctx context.Context, requestOrigin, siteName strin
 			"credential":   string(updated),
 			"last_used_at": now,
 		}).Error; err != nil {
-		return data.User{}, nil, err
+		return LoginResult{}, err
 	}
 	user, err := s.loadUser(ctx, entry.UserID)
 	if err != nil {
-		return data.User{}, nil, err
+		return LoginResult{}, err
 	}
 	entry.LastUsedAt = &now
-	return user, entry, nil
+	return LoginResult{User: user, Passkey: entry, UserVerified: cred.Flags.UserVerified}, nil
 }
 
 // List returns the passkeys owned by userID.
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+// DBStore 使用 rate_limit_buckets 表计数，多个实例共享同一计数。
+// 所有写入都是带条件的原子 UPDATE/INSERT，不依赖进程内锁。
+type DBStore struct {
+	mu          sync.Mutex
+	db          *gorm.DB
+	stopCleanup chan struct{}
+}
+
+func NewDBStore(db *gorm.DB) *DBStore {
+	s := &DBStore{
+		db:          db,
+		stopCleanup: make(chan struct{}),
+	}
+	go s.cleanupLoop()
+	return s
+}
+
+// SetDB updates the database handle after a runtime database switch.
+func (s *DBStore) SetDB(db *gorm.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db = db
+}
+
+func (s *DBStore) handle() *gorm.DB {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db
+}
+
+func (s *DBStore) Take(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	db := s.handle()
+	if db == nil {
+		return Result{}, gorm.ErrInvalidDB
+	}
+	db = db.WithContext(ctx)
+	// 并发实例竞争同一 key 时可能需要重试
+	for attempt := 0; attempt < 3; attempt++ {
+		now := time.Now()
+		incr := db.Model(&data.RateLimitBucket{}).
+			Where("bucket_key = ? AND reset_at > ? AND hits < ?", key, now, limit).
+			UpdateColumn("hits", gorm.Expr("hits + 1"))
+		if incr.Error != nil {
+			return Result{}, incr.Error
+		}
+		var bucket data.RateLimitBucket
+		err := db.Where("bucket_key = ?", key).First(&bucket).Error
+		if incr.RowsAffected > 0 && err == nil {
+			return Result{Allowed: true, Limit: limit, Remaining: limit - bucket.Hits, Reset: bucket.ResetAt.Sub(now)}, nil
+		}
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			created := db.Create(&data.RateLimitBucket{Key: key, Hits: 1, ResetAt: now.Add(window)})
+			if created.Error == nil {
+				return Result{Allowed: true, Limit: limit, Remaining: limit - 1, Reset: window}, nil
+			}
+			// 其它实例已创建，重新计数
+			continue
+		case err != nil:
+			return Result{}, err
+		}
+		if bucket.ResetAt.After(now) {
+			if bucket.Hits >= limit {
+				return Result{Allowed: false, Limit: limit, Remaining: 0, Reset: bucket.ResetAt.Sub(now)}, nil
+			}
+			continue
+		}
+		// 窗口已过期：只有一个实例能成功重置
+		reset := db.Model(&data.RateLimitBucket{}).
+			Where("bucket_key = ? AND reset_at <= ?", key, now).
+			Updates(map[string]interface{}{"hits": 1, "reset_at": now.Add(window)})
+		if reset.Error != nil {
+			return Result{}, reset.Error
+		}
+		if reset.RowsAffected > 0 {
+			return Result{Allowed: true, Limit: limit, Remaining: limit - 1, Reset: window}, nil
+		}
+	}
+	return Result{}, errors.New("rate limit bucket contention")
+}
+
+func (s *DBStore) Release(ctx context.Context, key string) error {
+	db := s.handle()
+	if db == nil {
+		return gorm.ErrInvalidDB
+	}
+	return db.WithContext(ctx).Model(&data.RateLimitBucket{}).
+		Where("bucket_key = ? AND hits > 0", key).
+		UpdateColumn("hits", gorm.Expr("hits - 1")).Error
+}
+
+func (s *DBStore) cleanupLoop() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCleanup:
+			return
+		case <-ticker.C:
+			db := s.handle()
+			if db == nil {
+				continue
+			}
+			if err := db.WithContext(context.Background()).
+				Delete(&data.RateLimitBucket{}, "reset_at < ?", time.Now()).Error; err != nil {
+				log.Printf("[限流] 清理过期计数失败: %v", err)
+			}
+		}
+	}
+}
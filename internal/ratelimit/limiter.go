@@ -0,0 +1,164 @@
+// Package ratelimit 提供固定窗口限流，计数可保存在进程内存或数据库中（多实例共享）。
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Result 描述一次限流检查的结果。
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset 为当前窗口剩余时间；被拒绝时即需要等待的时间。
+	Reset time.Duration
+}
+
+// RetryAfter 返回被拒绝时需要等待的时间，允许时为 0。
+func (r Result) RetryAfter() time.Duration {
+	if r.Allowed {
+		return 0
+	}
+	return r.Reset
+}
+
+// Store 保存限流计数。
+type Store interface {
+	// Take 在 key 的当前窗口内计数一次；已达到 limit 时不计数并返回 Allowed=false。
+	Take(ctx context.Context, key string, limit int, window time.Duration) (Result, error)
+	// Release 撤销一次计数，用于多窗口检查中后续窗口被拒绝的情况。
+	Release(ctx context.Context, key string) error
+}
+
+// Rule 是一条限流规则。
+type Rule struct {
+	Key    string
+	Limit  int
+	Window time.Duration
+}
+
+// ExceededError 表示超出限流，携带用于响应头的结果。
+type ExceededError struct {
+	Result  Result
+	Message string
+}
+
+func (e *ExceededError) Error() string {
+	return e.Message
+}
+
+// Limiter 是限流入口，存储可在运行时切换。
+type Limiter struct {
+	mu    sync.RWMutex
+	store Store
+}
+
+func New(store Store) *Limiter {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Limiter{store: store}
+}
+
+// SetStore 切换计数存储（例如数据库切换后）。
+func (l *Limiter) SetStore(store Store) {
+	if store == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.store = store
+}
+
+func (l *Limiter) currentStore() Store {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.store
+}
+
+// Take 对 key 计数一次。存储出错时放行，避免限流故障导致服务不可用。
+func (l *Limiter) Take(ctx context.Context, key string, limit int, window time.Duration) Result {
+	if l == nil || limit <= 0 || window <= 0 || key == "" {
+		return Result{Allowed: true}
+	}
+	result, err := l.currentStore().Take(ctx, key, limit, window)
+	if err != nil {
+		log.Printf("[限流] 计数失败 key=%s: %v", key, err)
+		return Result{Allowed: true, Limit: limit, Remaining: limit}
+	}
+	return result
+}
+
+// TakeAll 依次检查多条规则，任一规则被拒绝时撤销已计入的次数。
+// 返回被拒绝的规则结果，或全部通过时剩余次数最少的结果。
+func (l *Limiter) TakeAll(ctx context.Context, rules ...Rule) Result {
+	taken := make([]string, 0, len(rules))
+	var tightest *Result
+	for _, rule := range rules {
+		if rule.Limit <= 0 || rule.Window <= 0 {
+			continue
+		}
+		result := l.Take(ctx, rule.Key, rule.Limit, rule.Window)
+		if !result.Allowed {
+			for _, key := range taken {
+				if err := l.currentStore().Release(ctx, key); err != nil {
+					log.Printf("[限流] 撤销计数失败 key=%s: %v", key, err)
+				}
+			}
+			return result
+		}
+		taken = append(taken, rule.Key)
+		if tightest == nil || result.Remaining < tightest.Remaining {
+			r := result
+			tightest = &r
+		}
+	}
+	if tightest == nil {
+		return Result{Allowed: true}
+	}
+	return *tightest
+}
+
+// Allow 是 Take 的简化形式，返回是否允许以及需要等待的时间。
+func (l *Limiter) Allow(key string, limit int, window time.Duration) (bool, time.Duration) {
+	result := l.Take(context.Background(), key, limit, window)
+	return result.Allowed, result.RetryAfter()
+}
+
+// AllowInterval allows at most one action per key inside interval (cooldown).
+func (l *Limiter) AllowInterval(key string, interval time.Duration) (bool, time.Duration) {
+	return l.Allow(key, 1, interval)
+}
+
+// SetHeaders 写入 RateLimit-Limit / RateLimit-Remaining / RateLimit-Reset，被拒绝时同时写入 Retry-After。
+// 同一响应多次调用时保留剩余次数最少的结果。
+func SetHeaders(header http.Header, result Result) {
+	if result.Limit <= 0 {
+		return
+	}
+	if existing := header.Get("RateLimit-Remaining"); existing != "" && result.Allowed {
+		if remaining, err := strconv.Atoi(existing); err == nil && remaining < result.Remaining {
+			return
+		}
+	}
+	header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(max(result.Remaining, 0)))
+	header.Set("RateLimit-Reset", strconv.Itoa(Seconds(result.Reset)))
+	if !result.Allowed {
+		header.Set("Retry-After", strconv.Itoa(Seconds(result.Reset)))
+	}
+}
+
+// Seconds 将等待时间向上取整为秒，至少为 1。
+func Seconds(d time.Duration) int {
+	secs := int((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+func newTestDBStore(t *testing.T) (*DBStore, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&data.RateLimitBucket{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return NewDBStore(db), db
+}
+
+func exerciseStore(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		result, err := store.Take(ctx, "k", 3, time.Minute)
+		if err != nil || !result.Allowed {
+			t.Fatalf("hit %d: expected allowed, got %+v (%v)", i+1, result, err)
+		}
+		if result.Remaining != 2-i {
+			t.Fatalf("hit %d: expected remaining %d, got %d", i+1, 2-i, result.Remaining)
+		}
+	}
+	result, err := store.Take(ctx, "k", 3, time.Minute)
+	if err != nil || result.Allowed {
+		t.Fatalf("expected 4th hit to be rejected, got %+v (%v)", result, err)
+	}
+	if result.Reset <= 0 || result.Reset > time.Minute {
+		t.Fatalf("unexpected reset: %v", result.Reset)
+	}
+	if err := store.Release(ctx, "k"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if result, _ := store.Take(ctx, "k", 3, time.Minute); !result.Allowed {
+		t.Fatalf("expected released hit to be available again")
+	}
+	if result, _ := store.Take(ctx, "other", 3, time.Minute); !result.Allowed || result.Remaining != 2 {
+		t.Fatalf("keys should be independent, got %+v", result)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	exerciseStore(t, NewMemoryStore())
+}
+
+func TestDBStore(t *testing.T) {
+	store, _ := newTestDBStore(t)
+	exerciseStore(t, store)
+}
+
+func TestDBStore_SharedAcrossInstancesAndWindowReset(t *testing.T) {
+	first, db := newTestDBStore(t)
+	second := NewDBStore(db)
+	ctx := context.Background()
+	if r, _ := first.Take(ctx, "shared", 2, time.Minute); !r.Allowed {
+		t.Fatalf("expected first hit allowed")
+	}
+	if r, _ := second.Take(ctx, "shared", 2, time.Minute); !r.Allowed || r.Remaining != 0 {
+		t.Fatalf("expected second instance to see shared count, got %+v", r)
+	}
+	if r, _ := first.Take(ctx, "shared", 2, time.Minute); r.Allowed {
+		t.Fatalf("expected limit to apply across instances")
+	}
+	if err := db.Model(&data.RateLimitBucket{}).Where("bucket_key = ?", "shared").
+		Update("reset_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("expire bucket: %v", err)
+	}
+	if r, _ := second.Take(ctx, "shared", 2, time.Minute); !r.Allowed || r.Remaining != 1 {
+		t.Fatalf("expected new window after expiry, got %+v", r)
+	}
+}
+
+func TestTakeAll_RollsBackEarlierRules(t *testing.T) {
+	limiter := New(NewMemoryStore())
+	ctx := context.Background()
+	rules := []Rule{
+		{Key: "minute", Limit: 10, Window: time.Minute},
+		{Key: "hour", Limit: 1, Window: time.Hour},
+	}
+	if r := limiter.TakeAll(ctx, rules...); !r.Allowed || r.Remaining != 0 || r.Limit != 1 {
+		t.Fatalf("expected tightest rule in result, got %+v", r)
+	}
+	if r := limiter.TakeAll(ctx, rules...); r.Allowed || r.Limit != 1 {
+		t.Fatalf("expected hour rule to reject, got %+v", r)
+	}
+	if r := limiter.Take(ctx, "minute", 10, time.Minute); r.Remaining != 8 {
+		t.Fatalf("expected rejected attempt to be released from minute rule, remaining=%d", r.Remaining)
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	header := http.Header{}
+	SetHeaders(header, Result{Allowed: true, Limit: 10, Remaining: 2, Reset: 30 * time.Second})
+	SetHeaders(header, Result{Allowed: true, Limit: 20, Remaining: 15, Reset: 50 * time.Second})
+	if header.Get("RateLimit-Limit") != "10" || header.Get("RateLimit-Remaining") != "2" || header.Get("RateLimit-Reset") != "30" {
+		t.Fatalf("expected tightest limit to win, got %v", header)
+	}
+	if header.Get("Retry-After") != "" {
+		t.Fatalf("Retry-After should only be set when rejected")
+	}
+	SetHeaders(header, Result{Allowed: false, Limit: 20, Remaining: 0, Reset: 1500 * time.Millisecond})
+	if header.Get("Retry-After") != "2" || header.Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("unexpected rejected headers: %v", header)
+	}
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore 在进程内存中计数，仅适用于单实例部署。
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastPrune time.Time
+}
+
+type memoryBucket struct {
+	hits    int
+	resetAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*memoryBucket)}
+}
+
+func (m *MemoryStore) Take(_ context.Context, key string, limit int, window time.Duration) (Result, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastPrune) >= time.Minute {
+		for k, bucket := range m.buckets {
+			if !now.Before(bucket.resetAt) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastPrune = now
+	}
+
+	bucket, ok := m.buckets[key]
+	if !ok || !now.Before(bucket.resetAt) {
+		bucket = &memoryBucket{resetAt: now.Add(window)}
+		m.buckets[key] = bucket
+	}
+	if bucket.hits >= limit {
+		return Result{Allowed: false, Limit: limit, Remaining: 0, Reset: bucket.resetAt.Sub(now)}, nil
+	}
+	bucket.hits++
+	return Result{Allowed: true, Limit: limit, Remaining: limit - bucket.hits, Reset: bucket.resetAt.Sub(now)}, nil
+}
+
+func (m *MemoryStore) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if bucket, ok := m.buckets[key]; ok && bucket.hits > 0 {
+		bucket.hits--
+	}
+	return nil
+}
@@ -370,12 +370,8 @@ func (s *Service) Redeem(ctx context.Context, user data.User, rawCode string) (R
 				Update("group_id", item.GroupID).Error; err != nil {
 				return err
 			}
-		} else {
-			if err := tx.Model(&data.User{}).
-				Where("id = ?", user.ID).
-				UpdateColumn("capacity_bonus", gorm.Expr("capacity_bonus + ?", item.CapacityDelta)).Error; err != nil {
-				return err
-			}
+		} else if err := GrantCapacity(tx, user.ID, item.CapacityDelta); err != nil {
+			return err
 		}
 
 		if err := tx.Preload("Group").First(&item, item.ID).Error; err != nil {
@@ -396,6 +392,16 @@ func (s *Service) Redeem(ctx context.Context, user data.User, rawCode string) (R
 	return result, err
 }
 
+// GrantCapacity 在用户的额外容量上增减 delta 字节（可为负），兑换码与邀请奖励共用。
+func GrantCapacity(tx *gorm.DB, userID uint, delta float64) error {
+	if delta == 0 {
+		return nil
+	}
+	return tx.Model(&data.User{}).
+		Where("id = ?", userID).
+		UpdateColumn("capacity_bonus", gorm.Expr("capacity_bonus + ?", delta)).Error
+}
+
 func normalizeCode(code string) string {
 	code = strings.TrimSpace(code)
 	code = strings.ToUpper(code)
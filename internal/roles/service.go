@@ -0,0 +1,230 @@
+// Package roles 管理后台角色以及角色到用户的分配。
+package roles
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+var (
+	ErrNotFound       = errors.New("角色不存在")
+	ErrNameRequired   = errors.New("角色名称不能为空")
+	ErrNameTaken      = errors.New("角色名称已存在")
+	ErrBuiltIn        = errors.New("内置角色不能删除")
+	ErrRoleInUse      = errors.New("仍有用户使用该角色，请先调整这些用户的角色")
+	ErrSelfAssign     = errors.New("不能修改自己的角色")
+	ErrSuperAdminRole = errors.New("不能修改超级管理员的角色")
+	ErrOwnRole        = errors.New("不能修改自己所属的角色")
+	ErrEscalation     = errors.New("不能授予超出自身范围的权限")
+)
+
+// Input 是创建或更新角色的参数。
+type Input struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// RoleDTO 是角色的对外表示。
+type RoleDTO struct {
+	data.AdminRole
+	Permissions []string `json:"permissions"`
+	UserCount   int64    `json:"userCount"`
+}
+
+type Service struct {
+	mu sync.Mutex
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *Service {
+	s := &Service{db: db}
+	s.ensureBuiltins()
+	return s
+}
+
+// SetDB updates the database handle after a runtime database switch.
+func (s *Service) SetDB(db *gorm.DB) {
+	s.mu.Lock()
+	s.db = db
+	s.mu.Unlock()
+	s.ensureBuiltins()
+}
+
+func (s *Service) handle() *gorm.DB {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db
+}
+
+func (s *Service) ensureBuiltins() {
+	db := s.handle()
+	if db == nil || !db.Migrator().HasTable(&data.AdminRole{}) {
+		return
+	}
+	if err := data.EnsureBuiltinAdminRoles(context.Background(), db); err != nil {
+		log.Printf("[roles] 创建内置角色失败: %v", err)
+	}
+}
+
+func (s *Service) List(ctx context.Context) ([]RoleDTO, error) {
+	db := s.handle()
+	var items []data.AdminRole
+	if err := db.WithContext(ctx).Order("id asc").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	type countRow struct {
+		AdminRoleID uint
+		Total       int64
+	}
+	var counts []countRow
+	if err := db.WithContext(ctx).Model(&data.User{}).
+		Select("admin_role_id, COUNT(*) AS total").
+		Where("admin_role_id IS NOT NULL").
+		Group("admin_role_id").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	byRole := make(map[uint]int64, len(counts))
+	for _, row := range counts {
+		byRole[row.AdminRoleID] = row.Total
+	}
+	out := make([]RoleDTO, 0, len(items))
+	for _, item := range items {
+		out = append(out, RoleDTO{AdminRole: item, Permissions: item.PermissionList(), UserCount: byRole[item.ID]})
+	}
+	return out, nil
+}
+
+func (s *Service) Get(ctx context.Context, id uint) (data.AdminRole, error) {
+	var role data.AdminRole
+	if err := s.handle().WithContext(ctx).First(&role, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return role, ErrNotFound
+		}
+		return role, err
+	}
+	return role, nil
+}
+
+// Create 创建角色；分配了角色的管理员只能创建权限不超出自身的角色。
+func (s *Service) Create(ctx context.Context, actor data.User, input Input) (data.AdminRole, error) {
+	role, err := s.apply(ctx, actor, data.AdminRole{}, input)
+	if err != nil {
+		return data.AdminRole{}, err
+	}
+	if err := s.handle().WithContext(ctx).Create(&role).Error; err != nil {
+		return data.AdminRole{}, err
+	}
+	return role, nil
+}
+
+// Update 更新角色；分配了角色的管理员不能修改自己所属的角色，
+// 也不能修改或授出超出自身权限的角色。
+func (s *Service) Update(ctx context.Context, actor data.User, id uint, input Input) (data.AdminRole, error) {
+	role, err := s.Get(ctx, id)
+	if err != nil {
+		return role, err
+	}
+	if !actor.HasFullAdmin() {
+		if actor.AdminRoleID != nil && *actor.AdminRoleID == id {
+			return data.AdminRole{}, ErrOwnRole
+		}
+		if !actor.CanGrantAdminPermissions(role.PermissionList()) {
+			return data.AdminRole{}, ErrEscalation
+		}
+	}
+	role, err = s.apply(ctx, actor, role, input)
+	if err != nil {
+		return data.AdminRole{}, err
+	}
+	if err := s.handle().WithContext(ctx).Save(&role).Error; err != nil {
+		return data.AdminRole{}, err
+	}
+	return role, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id uint) error {
+	role, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if role.BuiltIn {
+		return ErrBuiltIn
+	}
+	db := s.handle()
+	var count int64
+	if err := db.WithContext(ctx).Model(&data.User{}).Where("admin_role_id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+	return db.WithContext(ctx).Delete(&data.AdminRole{}, id).Error
+}
+
+// Assign 为用户分配角色并将其设为管理员；roleID 为 nil 时取消角色并撤销管理员身份。
+// 授予完整管理员权限请使用 users.Service.ToggleAdmin。分配了角色的管理员
+// 只能分配权限不超出自身的角色，也不能调整完整管理员。
+func (s *Service) Assign(ctx context.Context, actor data.User, userID uint, roleID *uint) error {
+	if actor.ID == userID {
+		return ErrSelfAssign
+	}
+	db := s.handle()
+	var target data.User
+	if err := db.WithContext(ctx).First(&target, userID).Error; err != nil {
+		return err
+	}
+	if target.IsSuperAdmin {
+		return ErrSuperAdminRole
+	}
+	if !actor.HasFullAdmin() && target.HasFullAdmin() {
+		return ErrEscalation
+	}
+	updates := map[string]interface{}{"admin_role_id": nil, "is_adminer": false}
+	if roleID != nil {
+		role, err := s.Get(ctx, *roleID)
+		if err != nil {
+			return err
+		}
+		if !actor.CanGrantAdminPermissions(role.PermissionList()) {
+			return ErrEscalation
+		}
+		updates = map[string]interface{}{"admin_role_id": *roleID, "is_adminer": true}
+	}
+	return db.WithContext(ctx).Model(&data.User{}).Where("id = ?", userID).Updates(updates).Error
+}
+
+func (s *Service) apply(ctx context.Context, actor data.User, role data.AdminRole, input Input) (data.AdminRole, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return role, ErrNameRequired
+	}
+	perms, err := data.NormalizeAdminPermissions(input.Permissions)
+	if err != nil {
+		return role, err
+	}
+	if !actor.CanGrantAdminPermissions(perms) {
+		return role, ErrEscalation
+	}
+	var count int64
+	if err := s.handle().WithContext(ctx).Model(&data.AdminRole{}).
+		Where("name = ? AND id <> ?", name, role.ID).
+		Count(&count).Error; err != nil {
+		return role, err
+	}
+	if count > 0 {
+		return role, ErrNameTaken
+	}
+	role.Name = name
+	role.Description = strings.TrimSpace(input.Description)
+	role.Permissions = strings.Join(perms, ",")
+	return role, nil
+}
@@ -0,0 +1,175 @@
+package roles
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+const (
+	actorID  = 1000000000000001
+	targetID = 1000000000000002
+)
+
+func newTestService(t *testing.T) (*Service, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&data.AdminRole{}, &data.User{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	for _, user := range []data.User{
+		{ID: actorID, Name: "actor", Email: "actor@example.com", IsAdmin: true, Status: 1},
+		{ID: targetID, Name: "target", Email: "target@example.com", Status: 1},
+	} {
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	return New(db), db
+}
+
+func findRole(t *testing.T, s *Service, name string) RoleDTO {
+	t.Helper()
+	items, err := s.List(context.Background())
+	if err != nil {
+		t.Fatalf("list roles: %v", err)
+	}
+	for _, item := range items {
+		if item.Name == name {
+			return item
+		}
+	}
+	t.Fatalf("role %q not found", name)
+	return RoleDTO{}
+}
+
+func TestBuiltinRolesSeeded(t *testing.T) {
+	s, _ := newTestService(t)
+	moderator := findRole(t, s, "moderator")
+	if !moderator.BuiltIn || len(moderator.Permissions) != 1 || moderator.Permissions[0] != data.AdminPermModeration {
+		t.Fatalf("unexpected moderator role: %+v", moderator)
+	}
+	if err := s.Delete(context.Background(), moderator.ID); !errors.Is(err, ErrBuiltIn) {
+		t.Fatalf("expected ErrBuiltIn, got %v", err)
+	}
+	// 重复初始化不应产生重复角色
+	s.ensureBuiltins()
+	if items, _ := s.List(context.Background()); len(items) != 3 {
+		t.Fatalf("expected 3 builtin roles, got %d", len(items))
+	}
+}
+
+func TestCreateRoleValidatesPermissions(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+	actor := data.User{ID: actorID, IsAdmin: true}
+	if _, err := s.Create(ctx, actor, Input{Name: "bad", Permissions: []string{"nope"}}); err == nil {
+		t.Fatal("expected unknown permission to be rejected")
+	}
+	if _, err := s.Create(ctx, actor, Input{Name: "support"}); !errors.Is(err, ErrNameTaken) {
+		t.Fatalf("expected ErrNameTaken, got %v", err)
+	}
+	role, err := s.Create(ctx, actor, Input{Name: "ops", Permissions: []string{data.AdminPermUsers, data.AdminPermGroups, data.AdminPermUsers}})
+	if err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+	if got := role.PermissionList(); len(got) != 2 {
+		t.Fatalf("expected deduplicated permissions, got %v", got)
+	}
+}
+
+func TestAssignRoleGrantsScopedPermissions(t *testing.T) {
+	s, db := newTestService(t)
+	ctx := context.Background()
+	actor := data.User{ID: actorID, IsAdmin: true}
+	support := findRole(t, s, "support")
+
+	if err := s.Assign(ctx, actor, actorID, &support.ID); !errors.Is(err, ErrSelfAssign) {
+		t.Fatalf("expected ErrSelfAssign, got %v", err)
+	}
+	if err := s.Assign(ctx, actor, targetID, &support.ID); err != nil {
+		t.Fatalf("assign role: %v", err)
+	}
+	var target data.User
+	if err := db.First(&target, targetID).Error; err != nil {
+		t.Fatalf("load target: %v", err)
+	}
+	if !target.IsAdmin || target.AdminRoleID == nil || *target.AdminRoleID != support.ID {
+		t.Fatalf("role not assigned: %+v", target)
+	}
+	target.Permissions = target.EffectivePermissions(&support.AdminRole)
+	if !target.HasAdminPermission(data.AdminPermTickets) || target.HasAdminPermission(data.AdminPermSystem) {
+		t.Fatalf("unexpected permissions: %v", target.Permissions)
+	}
+
+	ids, err := data.UserIDsWithAdminPermission(ctx, db, data.AdminPermTickets)
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("expected actor and support staff to receive tickets, got %v (%v)", ids, err)
+	}
+	ids, err = data.UserIDsWithAdminPermission(ctx, db, data.AdminPermSystem)
+	if err != nil || len(ids) != 1 || ids[0] != actorID {
+		t.Fatalf("expected only full admin for system, got %v (%v)", ids, err)
+	}
+
+	if err := s.Delete(ctx, support.ID); err == nil {
+		t.Fatal("expected builtin role deletion to fail")
+	}
+	if err := s.Assign(ctx, actor, targetID, nil); err != nil {
+		t.Fatalf("revoke role: %v", err)
+	}
+	if err := db.First(&target, targetID).Error; err != nil {
+		t.Fatalf("load target: %v", err)
+	}
+	if target.IsAdmin || target.AdminRoleID != nil {
+		t.Fatalf("role not revoked: %+v", target)
+	}
+}
+
+func TestScopedAdminCannotEscalateThroughRoles(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+	support := findRole(t, s, "support")
+	moderator := findRole(t, s, "moderator")
+	custom, err := s.Create(ctx, data.User{ID: actorID, IsAdmin: true}, Input{
+		Name:        "delegate",
+		Permissions: []string{data.AdminPermRoles, data.AdminPermUsers, data.AdminPermTickets},
+	})
+	if err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+	scoped := data.User{ID: actorID, IsAdmin: true, AdminRoleID: &custom.ID, Permissions: custom.PermissionList()}
+
+	// 不能修改自己所属的角色，哪怕只是补充权限
+	all := Input{Name: "delegate", Permissions: data.AllAdminPermissions()}
+	if _, err := s.Update(ctx, scoped, custom.ID, all); !errors.Is(err, ErrOwnRole) {
+		t.Fatalf("expected ErrOwnRole, got %v", err)
+	}
+	// 不能创建或把其他角色扩展到超出自身的权限
+	if _, err := s.Create(ctx, scoped, Input{Name: "wide", Permissions: []string{data.AdminPermSystem}}); !errors.Is(err, ErrEscalation) {
+		t.Fatalf("expected ErrEscalation on create, got %v", err)
+	}
+	if _, err := s.Update(ctx, scoped, support.ID, Input{Name: "support", Permissions: []string{data.AdminPermSystem}}); !errors.Is(err, ErrEscalation) {
+		t.Fatalf("expected ErrEscalation on update, got %v", err)
+	}
+	if _, err := s.Update(ctx, scoped, moderator.ID, Input{Name: "moderator", Permissions: []string{data.AdminPermTickets}}); !errors.Is(err, ErrEscalation) {
+		t.Fatalf("expected ErrEscalation when editing a role outside own permissions, got %v", err)
+	}
+	if err := s.Assign(ctx, scoped, targetID, &moderator.ID); !errors.Is(err, ErrEscalation) {
+		t.Fatalf("expected ErrEscalation on assign, got %v", err)
+	}
+	// 权限子集内的操作仍然允许
+	if _, err := s.Update(ctx, scoped, support.ID, Input{Name: "support", Permissions: []string{data.AdminPermTickets}}); err != nil {
+		t.Fatalf("update within own permissions: %v", err)
+	}
+	if err := s.Assign(ctx, scoped, targetID, &support.ID); err != nil {
+		t.Fatalf("assign within own permissions: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package s3gateway
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+// Error 是以 S3 XML 错误格式返回给客户端的错误。
+type Error struct {
+	Code    string
+	Message string
+	Status  int
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Is 按错误码比较，WithMessage 生成的副本与原错误视为同一种错误。
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithMessage 返回替换了描述信息的副本。
+func (e *Error) WithMessage(message string) *Error {
+	copied := *e
+	copied.Message = message
+	return &copied
+}
+
+var (
+	ErrAccessDenied                      = &Error{"AccessDenied", "Access Denied", http.StatusForbidden}
+	ErrInvalidAccessKeyID                = &Error{"InvalidAccessKeyId", "The AWS access key Id you provided does not exist in our records.", http.StatusForbidden}
+	ErrSignatureDoesNotMatch             = &Error{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.", http.StatusForbidden}
+	ErrRequestTimeTooSkewed              = &Error{"RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.", http.StatusForbidden}
+	ErrAuthorizationHeaderMalformed      = &Error{"AuthorizationHeaderMalformed", "The authorization header is malformed.", http.StatusBadRequest}
+	ErrAuthorizationQueryParametersError = &Error{"AuthorizationQueryParametersError", "Error parsing the X-Amz-Credential parameter.", http.StatusBadRequest}
+	ErrMissingSecurityHeader             = &Error{"MissingSecurityHeader", "Your request is missing a required header.", http.StatusBadRequest}
+	ErrContentSHA256Mismatch             = &Error{"XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.", http.StatusBadRequest}
+	ErrIncompleteBody                    = &Error{"IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header.", http.StatusBadRequest}
+	ErrEntityTooLarge                    = &Error{"EntityTooLarge", "Your proposed upload exceeds the maximum allowed object size.", http.StatusBadRequest}
+	ErrEntityTooSmall                    = &Error{"EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.", http.StatusBadRequest}
+	ErrBadDigest                         = &Error{"BadDigest", "The Content-MD5 you specified did not match what we received.", http.StatusBadRequest}
+	ErrInvalidRequest                    = &Error{"InvalidRequest", "Invalid Request", http.StatusBadRequest}
+	ErrSlowDown                          = &Error{"SlowDown", "Please reduce your request rate.", http.StatusServiceUnavailable}
+	ErrInvalidArgument                   = &Error{"InvalidArgument", "Invalid Argument", http.StatusBadRequest}
+	ErrInvalidBucketName                 = &Error{"InvalidBucketName", "The specified bucket is not valid.", http.StatusBadRequest}
+	ErrNoSuchBucket                      = &Error{"NoSuchBucket", "The specified bucket does not exist.", http.StatusNotFound}
+	ErrBucketAlreadyOwnedByYou           = &Error{"BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.", http.StatusConflict}
+	ErrNoSuchKey                         = &Error{"NoSuchKey", "The specified key does not exist.", http.StatusNotFound}
+	ErrNoSuchUpload                      = &Error{"NoSuchUpload", "The specified multipart upload does not exist.", http.StatusNotFound}
+	ErrInvalidPart                       = &Error{"InvalidPart", "One or more of the specified parts could not be found.", http.StatusBadRequest}
+	ErrInvalidPartOrder                  = &Error{"InvalidPartOrder", "The list of parts was not in ascending order.", http.StatusBadRequest}
+	ErrMalformedXML                      = &Error{"MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.", http.StatusBadRequest}
+	ErrMethodNotAllowed                  = &Error{"MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed}
+	ErrNotImplemented                    = &Error{"NotImplemented", "A header you provided implies functionality that is not implemented.", http.StatusNotImplemented}
+	ErrInternal                          = &Error{"InternalError", "We encountered an internal error. Please try again.", http.StatusInternalServerError}
+	ErrServiceUnavailable                = &Error{"ServiceUnavailable", "The S3 gateway is disabled.", http.StatusServiceUnavailable}
+)
+
+// ErrorResponse 是 S3 错误响应体。
+type ErrorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource,omitempty"`
+	RequestID string   `xml:"RequestId"`
+}
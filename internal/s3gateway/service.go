@@ -0,0 +1,548 @@
+// Package s3gateway 提供 S3 兼容接口的子集（对象读写、列举与分片上传），
+// 便于 rclone、PicGo S3 插件等工具直接上传到 SkyImage。
+//
+// 存储桶对应用户可用的储存策略（strategy-<id>），凭据由 API Token 派生：
+// Access Key ID 由 Token ID 生成，Secret 由服务端密钥（SECRET_KEY，不保存在数据库中）与 Token 的哈希
+// 共同派生：只读取到 api_tokens 表无法算出可用的凭据，删除或重新生成 Token 即失效。
+// 所有写入都经过 files.Service.Upload，容量、审核与图片处理规则保持一致。
+package s3gateway
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"skyimage/internal/data"
+)
+
+const (
+	ConfigEnabled = "s3.enabled"
+
+	AccessKeyPrefix = "SKY"
+	BucketPrefix    = "strategy-"
+
+	// MaxObjectSize 单个对象（含分片合并后）的大小上限，实际还受角色组限制
+	MaxObjectSize int64 = 512 << 20
+	// MaxKeyLength 与 S3 一致
+	MaxKeyLength = 1024
+	MaxParts     = 10000
+	MaxListKeys  = 1000
+
+	multipartTTL = 24 * time.Hour
+)
+
+type SettingsReader interface {
+	GetSettings(ctx context.Context) (map[string]string, error)
+}
+
+// Settings 是 S3 网关的后台配置。
+type Settings struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Values 转换为 configs 表中的键值。
+func (s Settings) Values() map[string]string {
+	return map[string]string{ConfigEnabled: strconv.FormatBool(s.Enabled)}
+}
+
+// ObjectInfo 是列举结果中的一个对象。
+type ObjectInfo struct {
+	Key          string
+	FileID       uint
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// ListInput 是 ListObjects 的查询条件，After 为上一页最后一个键。
+type ListInput struct {
+	Prefix    string
+	Delimiter string
+	After     string
+	MaxKeys   int
+}
+
+type ListResult struct {
+	Objects        []ObjectInfo
+	CommonPrefixes []string
+	Truncated      bool
+	// NextAfter 为下一页的起始位置（最后返回的键或公共前缀）
+	NextAfter string
+}
+
+// CompletedPart 是 CompleteMultipartUpload 请求中的一个分片。
+type CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type Service struct {
+	mu          sync.Mutex
+	db          *gorm.DB
+	settings    SettingsReader
+	secretKey   []byte
+	stagingDir  string
+	stopCleanup chan struct{}
+}
+
+// New 创建网关服务，secretKey 用于派生 Secret Access Key。
+// 分片内容暂存在本机临时目录，多实例部署时需让同一上传会话落在同一实例。
+func New(db *gorm.DB, settings SettingsReader, secretKey []byte) *Service {
+	s := &Service{
+		db:          db,
+		settings:    settings,
+		secretKey:   secretKey,
+		stagingDir:  filepath.Join(os.TempDir(), "skyimage-s3"),
+		stopCleanup: make(chan struct{}),
+	}
+	go s.cleanupLoop()
+	return s
+}
+
+func (s *Service) SetDB(db *gorm.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db = db
+}
+
+func (s *Service) SetSettings(settings SettingsReader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = settings
+}
+
+func (s *Service) handle() (*gorm.DB, SettingsReader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db, s.settings
+}
+
+// Settings 读取网关配置，默认关闭。
+func (s *Service) Settings(ctx context.Context) Settings {
+	_, reader := s.handle()
+	if reader == nil {
+		return Settings{}
+	}
+	values, err := reader.GetSettings(ctx)
+	if err != nil {
+		return Settings{}
+	}
+	return Settings{Enabled: strings.EqualFold(strings.TrimSpace(values[ConfigEnabled]), "true")}
+}
+
+// AccessKeyID 返回 Token 对应的 Access Key ID（20 个字符）。
+func AccessKeyID(tokenID uint) string {
+	return fmt.Sprintf("%s%017d", AccessKeyPrefix, tokenID)
+}
+
+// ParseAccessKeyID 从 Access Key ID 解析 Token ID。
+func ParseAccessKeyID(accessKeyID string) (uint, bool) {
+	raw, ok := strings.CutPrefix(accessKeyID, AccessKeyPrefix)
+	if !ok || len(raw) != 17 {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// SecretAccessKey 由服务端密钥与数据库中保存的 Token（哈希值）派生 Secret Access Key。
+func (s *Service) SecretAccessKey(storedToken string) string {
+	return deriveSecret(s.secretKey, storedToken)
+}
+
+func deriveSecret(secretKey []byte, storedToken string) string {
+	hashed := strings.TrimSpace(storedToken)
+	if data.IsLegacyPlainAPIToken(hashed) {
+		// 旧版明文 Token 在首次使用时会迁移为哈希，提前按哈希计算保持结果不变
+		hashed = data.HashAPIToken(hashed)
+	}
+	mac := hmac.New(sha256.New, secretKey)
+	mac.Write([]byte(hashed))
+	return hex.EncodeToString(mac.Sum(nil))[:40]
+}
+
+// LookupToken 按 Access Key ID 读取未过期的 API Token。
+func (s *Service) LookupToken(ctx context.Context, accessKeyID string) (data.ApiToken, error) {
+	id, ok := ParseAccessKeyID(accessKeyID)
+	if !ok {
+		return data.ApiToken{}, ErrInvalidAccessKeyID
+	}
+	db, _ := s.handle()
+	var token data.ApiToken
+	if err := db.WithContext(ctx).Where("id = ? AND expires_at > ?", id, time.Now()).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return data.ApiToken{}, ErrInvalidAccessKeyID
+		}
+		return data.ApiToken{}, err
+	}
+	return token, nil
+}
+
+// BucketName 返回储存策略对应的存储桶名。
+func BucketName(strategyID uint) string {
+	return BucketPrefix + strconv.FormatUint(uint64(strategyID), 10)
+}
+
+// ParseBucket 从存储桶名解析储存策略 ID。
+func ParseBucket(name string) (uint, bool) {
+	raw, ok := strings.CutPrefix(name, BucketPrefix)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// ValidKey 校验对象键：非空、不超过 1024 字节且不含控制字符。
+func ValidKey(key string) bool {
+	if key == "" || len(key) > MaxKeyLength {
+		return false
+	}
+	for _, r := range key {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func keyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// FindObject 按对象键查找图片：先查网关写入的键，再按未映射图片的相对路径查找。
+func (s *Service) FindObject(ctx context.Context, userID, strategyID uint, key string) (data.FileAsset, error) {
+	db, _ := s.handle()
+	var file data.FileAsset
+	var mapping data.S3Object
+	err := db.WithContext(ctx).
+		Where("user_id = ? AND strategy_id = ? AND key_hash = ?", userID, strategyID, keyHash(key)).
+		First(&mapping).Error
+	switch {
+	case err == nil:
+		if err := db.WithContext(ctx).Where("id = ? AND user_id = ?", mapping.FileID, userID).First(&file).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return file, ErrNoSuchKey
+			}
+			return file, err
+		}
+		return file, nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return file, err
+	}
+	err = db.WithContext(ctx).
+		Where("user_id = ? AND strategy_id = ? AND relative_path = ?", userID, strategyID, key).
+		Where("id NOT IN (?)", db.Model(&data.S3Object{}).Select("file_id").Where("user_id = ?", userID)).
+		First(&file).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return file, ErrNoSuchKey
+	}
+	return file, err
+}
+
+// BindObject 将对象键指向新上传的图片，返回该键之前指向的图片 ID（没有则为 0）。
+func (s *Service) BindObject(ctx context.Context, userID, strategyID uint, key string, fileID uint) (uint, error) {
+	db, _ := s.handle()
+	previous := uint(0)
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing data.S3Object
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND strategy_id = ? AND key_hash = ?", userID, strategyID, keyHash(key)).
+			First(&existing).Error
+		if err == nil {
+			previous = existing.FileID
+			return tx.Model(&data.S3Object{}).Where("id = ?", existing.ID).Update("file_id", fileID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		// 覆盖未映射的同路径图片
+		var unmapped data.FileAsset
+		if err := tx.Select("id").
+			Where("user_id = ? AND strategy_id = ? AND relative_path = ? AND id <> ?", userID, strategyID, key, fileID).
+			Where("id NOT IN (?)", tx.Model(&data.S3Object{}).Select("file_id").Where("user_id = ?", userID)).
+			First(&unmapped).Error; err == nil {
+			previous = unmapped.ID
+		}
+		return tx.Create(&data.S3Object{
+			UserID:     userID,
+			StrategyID: strategyID,
+			KeyHash:    keyHash(key),
+			ObjectKey:  key,
+			FileID:     fileID,
+		}).Error
+	})
+	return previous, err
+}
+
+// UnbindFile 删除图片对应的对象键映射。
+func (s *Service) UnbindFile(ctx context.Context, fileID uint) error {
+	db, _ := s.handle()
+	return db.WithContext(ctx).Where("file_id = ?", fileID).Delete(&data.S3Object{}).Error
+}
+
+// ListObjects 按字典序列举存储桶中的对象，支持前缀、分隔符与分页。
+func (s *Service) ListObjects(ctx context.Context, userID, strategyID uint, input ListInput) (ListResult, error) {
+	db, _ := s.handle()
+	maxKeys := input.MaxKeys
+	if maxKeys <= 0 || maxKeys > MaxListKeys {
+		maxKeys = MaxListKeys
+	}
+	var rows []struct {
+		ID           uint
+		Name         string
+		RelativePath string
+		Size         int64
+		ChecksumMD5  string
+		CreatedAt    time.Time
+	}
+	if err := db.WithContext(ctx).Model(&data.FileAsset{}).
+		Select("id, name, relative_path, size, checksum_md5, created_at").
+		Where("user_id = ? AND strategy_id = ?", userID, strategyID).
+		Scan(&rows).Error; err != nil {
+		return ListResult{}, err
+	}
+	var mappings []data.S3Object
+	if err := db.WithContext(ctx).
+		Where("user_id = ? AND strategy_id = ?", userID, strategyID).
+		Find(&mappings).Error; err != nil {
+		return ListResult{}, err
+	}
+	keys := make(map[uint]string, len(mappings))
+	for _, mapping := range mappings {
+		keys[mapping.FileID] = mapping.ObjectKey
+	}
+
+	objects := make([]ObjectInfo, 0, len(rows))
+	seen := make(map[string]struct{}, len(rows))
+	for _, row := range rows {
+		key, mapped := keys[row.ID]
+		if !mapped {
+			key = strings.TrimPrefix(row.RelativePath, "/")
+			if key == "" {
+				key = row.Name
+			}
+		}
+		if !strings.HasPrefix(key, input.Prefix) || key <= input.After {
+			continue
+		}
+		if _, dup := seen[key]; dup && !mapped {
+			continue
+		}
+		seen[key] = struct{}{}
+		objects = append(objects, ObjectInfo{Key: key, FileID: row.ID, Size: row.Size, ETag: row.ChecksumMD5, LastModified: row.CreatedAt})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	var result ListResult
+	prefixes := make(map[string]struct{})
+	for _, object := range objects {
+		if len(result.Objects)+len(result.CommonPrefixes) >= maxKeys {
+			result.Truncated = true
+			break
+		}
+		if input.Delimiter != "" {
+			rest := strings.TrimPrefix(object.Key, input.Prefix)
+			if idx := strings.Index(rest, input.Delimiter); idx >= 0 {
+				prefix := input.Prefix + rest[:idx+len(input.Delimiter)]
+				if _, ok := prefixes[prefix]; ok {
+					continue
+				}
+				// 上一页已返回的公共前缀（After 位于其下）不重复返回
+				if input.After != "" && strings.HasPrefix(input.After, prefix) {
+					continue
+				}
+				prefixes[prefix] = struct{}{}
+				result.CommonPrefixes = append(result.CommonPrefixes, prefix)
+				result.NextAfter = prefix
+				continue
+			}
+		}
+		result.Objects = append(result.Objects, object)
+		result.NextAfter = object.Key
+	}
+	if !result.Truncated {
+		result.NextAfter = ""
+	}
+	return result, nil
+}
+
+// CreateMultipart 创建分片上传会话。
+func (s *Service) CreateMultipart(ctx context.Context, upload data.S3MultipartUpload) (data.S3MultipartUpload, error) {
+	id, err := randomHex(24)
+	if err != nil {
+		return upload, err
+	}
+	upload.UploadID = id
+	db, _ := s.handle()
+	if err := db.WithContext(ctx).Create(&upload).Error; err != nil {
+		return upload, err
+	}
+	return upload, nil
+}
+
+// GetMultipart 读取属于该用户且对象键一致的分片上传会话。
+func (s *Service) GetMultipart(ctx context.Context, uploadID string, userID, strategyID uint, key string) (data.S3MultipartUpload, error) {
+	db, _ := s.handle()
+	var upload data.S3MultipartUpload
+	err := db.WithContext(ctx).
+		Where("upload_id = ? AND user_id = ? AND strategy_id = ?", uploadID, userID, strategyID).
+		First(&upload).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && upload.ObjectKey != key) {
+		return upload, ErrNoSuchUpload
+	}
+	return upload, err
+}
+
+// CreatePart 创建（或覆盖）分片文件，调用方写入后需关闭。
+func (s *Service) CreatePart(upload data.S3MultipartUpload, partNumber int) (*os.File, error) {
+	if partNumber < 1 || partNumber > MaxParts {
+		return nil, ErrInvalidArgument.WithMessage("Part number must be an integer between 1 and 10000")
+	}
+	dir := s.uploadDir(upload.UploadID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return os.Create(filepath.Join(dir, partFileName(partNumber)))
+}
+
+// OpenParts 校验分片列表（升序、存在且 ETag 一致）并按顺序拼接，返回合并后的读取器与总大小。
+func (s *Service) OpenParts(upload data.S3MultipartUpload, parts []CompletedPart) (io.ReadCloser, int64, error) {
+	if len(parts) == 0 {
+		return nil, 0, ErrMalformedXML.WithMessage("You must specify at least one part")
+	}
+	dir := s.uploadDir(upload.UploadID)
+	readers := make([]io.Reader, 0, len(parts))
+	handles := make([]*os.File, 0, len(parts))
+	closeAll := func() {
+		for _, handle := range handles {
+			_ = handle.Close()
+		}
+	}
+	var total int64
+	last := 0
+	for _, part := range parts {
+		if part.PartNumber <= last {
+			closeAll()
+			return nil, 0, ErrInvalidPartOrder
+		}
+		last = part.PartNumber
+		handle, err := os.Open(filepath.Join(dir, partFileName(part.PartNumber)))
+		if err != nil {
+			closeAll()
+			return nil, 0, ErrInvalidPart
+		}
+		handles = append(handles, handle)
+		sum := md5.New()
+		size, err := io.Copy(sum, handle)
+		if err != nil {
+			closeAll()
+			return nil, 0, err
+		}
+		if strings.Trim(part.ETag, "\" ") != hex.EncodeToString(sum.Sum(nil)) {
+			closeAll()
+			return nil, 0, ErrInvalidPart
+		}
+		if _, err := handle.Seek(0, io.SeekStart); err != nil {
+			closeAll()
+			return nil, 0, err
+		}
+		total += size
+		readers = append(readers, handle)
+	}
+	if total > MaxObjectSize {
+		closeAll()
+		return nil, 0, ErrEntityTooLarge
+	}
+	return &multiReadCloser{Reader: io.MultiReader(readers...), close: closeAll}, total, nil
+}
+
+// AbortMultipart 删除分片上传会话与暂存的分片。
+func (s *Service) AbortMultipart(ctx context.Context, upload data.S3MultipartUpload) error {
+	db, _ := s.handle()
+	if err := db.WithContext(ctx).Where("id = ?", upload.ID).Delete(&data.S3MultipartUpload{}).Error; err != nil {
+		return err
+	}
+	return os.RemoveAll(s.uploadDir(upload.UploadID))
+}
+
+func (s *Service) uploadDir(uploadID string) string {
+	// uploadID 由服务端生成（十六进制），仍做一次清理防止路径穿越
+	return filepath.Join(s.stagingDir, filepath.Base(filepath.Clean("/"+uploadID)))
+}
+
+func (s *Service) cleanupLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.cleanupExpired(context.Background())
+		case <-s.stopCleanup:
+			return
+		}
+	}
+}
+
+// cleanupExpired 清理超过 24 小时未完成的分片上传。
+func (s *Service) cleanupExpired(ctx context.Context) {
+	db, _ := s.handle()
+	if db == nil {
+		return
+	}
+	var expired []data.S3MultipartUpload
+	if err := db.WithContext(ctx).Where("created_at < ?", time.Now().Add(-multipartTTL)).Find(&expired).Error; err != nil {
+		return
+	}
+	for _, upload := range expired {
+		if err := s.AbortMultipart(ctx, upload); err != nil {
+			log.Printf("[s3] cleanup multipart upload %s failed: %v", upload.UploadID, err)
+		}
+	}
+}
+
+type multiReadCloser struct {
+	io.Reader
+	close func()
+}
+
+func (m *multiReadCloser) Close() error {
+	m.close()
+	return nil
+}
+
+func partFileName(partNumber int) string {
+	return fmt.Sprintf("%05d.part", partNumber)
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
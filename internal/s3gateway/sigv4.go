@@ -0,0 +1,398 @@
+package s3gateway
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat = "20060102T150405Z"
+	shortDate     = "20060102"
+	service       = "s3"
+	terminator    = "aws4_request"
+
+	UnsignedPayload        = "UNSIGNED-PAYLOAD"
+	StreamingPayload       = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	StreamingPayloadTrail  = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	StreamingUnsignedTrail = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// maxClockSkew 与 AWS 一致，请求时间与服务器相差超过 15 分钟即拒绝
+	maxClockSkew = 15 * time.Minute
+	// maxPresignExpiry 预签名 URL 最长 7 天
+	maxPresignExpiry = 7 * 24 * time.Hour
+	maxChunkHeader   = 4096
+)
+
+// SecretLookup 根据 Access Key ID 返回对应的 Secret Access Key。
+type SecretLookup func(accessKeyID string) (string, error)
+
+// Signature 是一次已通过校验的 SigV4 请求，后续用于校验请求体。
+type Signature struct {
+	AccessKeyID string
+	PayloadHash string
+	amzDate     string
+	scope       string
+	signature   string
+	signingKey  []byte
+}
+
+// Verify 校验请求头（Authorization）或查询参数（预签名 URL）中的 SigV4 签名。
+// 只校验签名本身；请求体的哈希在 CopyBody 读取时校验。
+func Verify(r *http.Request, now time.Time, lookup SecretLookup) (*Signature, error) {
+	if r.URL.Query().Get("X-Amz-Algorithm") != "" {
+		return verifyPresigned(r, now, lookup)
+	}
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return nil, ErrAccessDenied.WithMessage("Anonymous access is not allowed")
+	}
+	algorithm, fields, ok := strings.Cut(auth, " ")
+	if !ok || algorithm != signAlgorithm {
+		return nil, ErrAuthorizationHeaderMalformed.WithMessage("Only AWS4-HMAC-SHA256 signatures are supported")
+	}
+	params := make(map[string]string, 3)
+	for _, field := range strings.Split(fields, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return nil, ErrAuthorizationHeaderMalformed
+		}
+		params[key] = value
+	}
+	credential, signedHeaders, signature := params["Credential"], params["SignedHeaders"], params["Signature"]
+	if credential == "" || signedHeaders == "" || signature == "" {
+		return nil, ErrAuthorizationHeaderMalformed
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if amzDate == "" {
+		amzDate = r.Header.Get("Date")
+	}
+	requestTime, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil {
+		return nil, ErrAccessDenied.WithMessage("Missing or invalid X-Amz-Date header")
+	}
+	if diff := now.Sub(requestTime); diff > maxClockSkew || diff < -maxClockSkew {
+		return nil, ErrRequestTimeTooSkewed
+	}
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		return nil, ErrMissingSecurityHeader.WithMessage("Missing required header x-amz-content-sha256")
+	}
+	sig := &Signature{PayloadHash: payloadHash, amzDate: amzDate, signature: signature}
+	if err := sig.deriveKey(credential, requestTime, lookup); err != nil {
+		return nil, err
+	}
+	headers := strings.Split(signedHeaders, ";")
+	if !containsString(headers, "host") {
+		return nil, ErrAuthorizationHeaderMalformed.WithMessage("The host header must be signed")
+	}
+	canonical := canonicalRequest(r, r.URL.Query(), headers, payloadHash)
+	if !hmac.Equal([]byte(sig.sign(canonical)), []byte(signature)) {
+		return nil, ErrSignatureDoesNotMatch
+	}
+	return sig, nil
+}
+
+func verifyPresigned(r *http.Request, now time.Time, lookup SecretLookup) (*Signature, error) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != signAlgorithm {
+		return nil, ErrAuthorizationQueryParametersError.WithMessage("Only AWS4-HMAC-SHA256 signatures are supported")
+	}
+	credential := query.Get("X-Amz-Credential")
+	amzDate := query.Get("X-Amz-Date")
+	signedHeaders := query.Get("X-Amz-SignedHeaders")
+	signature := query.Get("X-Amz-Signature")
+	if credential == "" || amzDate == "" || signedHeaders == "" || signature == "" {
+		return nil, ErrAuthorizationQueryParametersError
+	}
+	requestTime, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil {
+		return nil, ErrAuthorizationQueryParametersError.WithMessage("Invalid X-Amz-Date")
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires <= 0 || time.Duration(expires)*time.Second > maxPresignExpiry {
+		return nil, ErrAuthorizationQueryParametersError.WithMessage("X-Amz-Expires must be between 1 second and 7 days")
+	}
+	if now.Before(requestTime.Add(-maxClockSkew)) {
+		return nil, ErrRequestTimeTooSkewed
+	}
+	if now.After(requestTime.Add(time.Duration(expires) * time.Second)) {
+		return nil, ErrAccessDenied.WithMessage("Request has expired")
+	}
+	payloadHash := UnsignedPayload
+	if value := query.Get("X-Amz-Content-Sha256"); value != "" {
+		payloadHash = value
+	}
+	sig := &Signature{PayloadHash: payloadHash, amzDate: amzDate, signature: signature}
+	if err := sig.deriveKey(credential, requestTime, lookup); err != nil {
+		return nil, err
+	}
+	query.Del("X-Amz-Signature")
+	canonical := canonicalRequest(r, query, strings.Split(signedHeaders, ";"), payloadHash)
+	if !hmac.Equal([]byte(sig.sign(canonical)), []byte(signature)) {
+		return nil, ErrSignatureDoesNotMatch
+	}
+	return sig, nil
+}
+
+// deriveKey 解析 Credential（AKID/日期/区域/s3/aws4_request）并计算签名密钥。
+// 区域按客户端签名时使用的值接受，兼容 us-east-1、auto 等常见配置。
+func (s *Signature) deriveKey(credential string, requestTime time.Time, lookup SecretLookup) error {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[3] != service || parts[4] != terminator {
+		return ErrAuthorizationHeaderMalformed.WithMessage("Malformed credential scope")
+	}
+	if parts[1] != requestTime.UTC().Format(shortDate) {
+		return ErrAuthorizationHeaderMalformed.WithMessage("Credential date does not match X-Amz-Date")
+	}
+	secret, err := lookup(parts[0])
+	if err != nil {
+		return err
+	}
+	s.AccessKeyID = parts[0]
+	s.scope = strings.Join(parts[1:], "/")
+	key := hmacSHA256([]byte("AWS4"+secret), parts[1])
+	key = hmacSHA256(key, parts[2])
+	key = hmacSHA256(key, service)
+	s.signingKey = hmacSHA256(key, terminator)
+	return nil
+}
+
+func (s *Signature) sign(canonical string) string {
+	stringToSign := signAlgorithm + "\n" + s.amzDate + "\n" + s.scope + "\n" + sha256Hex([]byte(canonical))
+	return hex.EncodeToString(hmacSHA256(s.signingKey, stringToSign))
+}
+
+func (s *Signature) chunkSignature(previous string, chunk []byte) string {
+	stringToSign := signAlgorithm + "-PAYLOAD\n" + s.amzDate + "\n" + s.scope + "\n" +
+		previous + "\n" + emptySHA256 + "\n" + sha256Hex(chunk)
+	return hex.EncodeToString(hmacSHA256(s.signingKey, stringToSign))
+}
+
+// CopyBody 将请求体写入 dst，并按 x-amz-content-sha256 校验：
+// 普通请求比对整体哈希，aws-chunked 请求逐块校验签名。返回写入字节数与 MD5。
+func (s *Signature) CopyBody(dst io.Writer, r *http.Request, limit int64) (int64, string, error) {
+	md5sum := md5.New()
+	out := io.MultiWriter(dst, md5sum)
+	var (
+		written int64
+		err     error
+	)
+	switch s.PayloadHash {
+	case StreamingPayload, StreamingPayloadTrail:
+		written, err = s.copyChunked(out, r.Body, limit, true)
+	case StreamingUnsignedTrail:
+		written, err = s.copyChunked(out, r.Body, limit, false)
+	case UnsignedPayload:
+		written, err = copyLimited(out, r.Body, limit)
+	default:
+		sum := sha256.New()
+		written, err = copyLimited(io.MultiWriter(out, sum), r.Body, limit)
+		if err == nil && hex.EncodeToString(sum.Sum(nil)) != strings.ToLower(s.PayloadHash) {
+			err = ErrContentSHA256Mismatch
+		}
+	}
+	if err != nil {
+		return written, "", err
+	}
+	if decoded := r.Header.Get("X-Amz-Decoded-Content-Length"); decoded != "" {
+		if expected, perr := strconv.ParseInt(decoded, 10, 64); perr == nil && expected != written {
+			return written, "", ErrIncompleteBody
+		}
+	}
+	return written, hex.EncodeToString(md5sum.Sum(nil)), nil
+}
+
+// copyChunked 解码 aws-chunked 编码：每块为 "<hex 大小>[;chunk-signature=<签名>]\r\n<数据>\r\n"，
+// 以大小为 0 的块结束，之后可能跟随尾部校验和（忽略其内容）。
+func (s *Signature) copyChunked(dst io.Writer, body io.Reader, limit int64, signed bool) (int64, error) {
+	reader := bufio.NewReader(body)
+	previous := s.signature
+	var written int64
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			return written, ErrIncompleteBody
+		}
+		sizeField, ext, _ := strings.Cut(line, ";")
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeField), 16, 64)
+		if err != nil || size < 0 {
+			return written, ErrIncompleteBody
+		}
+		if written+size > limit {
+			return written, ErrEntityTooLarge
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return written, ErrIncompleteBody
+		}
+		if signed {
+			claimed := strings.TrimPrefix(strings.TrimSpace(ext), "chunk-signature=")
+			expected := s.chunkSignature(previous, chunk)
+			if !hmac.Equal([]byte(claimed), []byte(expected)) {
+				return written, ErrSignatureDoesNotMatch
+			}
+			previous = expected
+		}
+		if size == 0 {
+			// 余下为可选的尾部字段，内容不参与签名校验
+			_, _ = io.Copy(io.Discard, io.LimitReader(reader, maxChunkHeader))
+			return written, nil
+		}
+		if _, err := dst.Write(chunk); err != nil {
+			return written, err
+		}
+		written += size
+		if line, err := readLine(reader); err != nil || line != "" {
+			return written, ErrIncompleteBody
+		}
+	}
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	var buf bytes.Buffer
+	for buf.Len() <= maxChunkHeader {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == '\n' {
+			return strings.TrimSuffix(buf.String(), "\r"), nil
+		}
+		buf.WriteByte(b)
+	}
+	return "", errors.New("chunk header too long")
+}
+
+func copyLimited(dst io.Writer, src io.Reader, limit int64) (int64, error) {
+	n, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if err != nil {
+		return n, err
+	}
+	if n > limit {
+		return n, ErrEntityTooLarge
+	}
+	return n, nil
+}
+
+func canonicalRequest(r *http.Request, query url.Values, signedHeaders []string, payloadHash string) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte('\n')
+	b.WriteString(EncodePath(r.URL.Path))
+	b.WriteByte('\n')
+	b.WriteString(canonicalQuery(query))
+	b.WriteByte('\n')
+	for _, name := range signedHeaders {
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(canonicalHeaderValue(r, name))
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	b.WriteString(strings.Join(signedHeaders, ";"))
+	b.WriteByte('\n')
+	b.WriteString(payloadHash)
+	return b.String()
+}
+
+func canonicalHeaderValue(r *http.Request, name string) string {
+	var values []string
+	switch name {
+	case "host":
+		values = []string{r.Host}
+	case "content-length":
+		if r.ContentLength >= 0 {
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		}
+		if raw := r.Header.Values("Content-Length"); len(raw) > 0 {
+			values = raw
+		}
+	default:
+		values = r.Header.Values(name)
+		if len(values) == 0 && name == "transfer-encoding" {
+			values = r.TransferEncoding
+		}
+	}
+	for i, value := range values {
+		values[i] = strings.Join(strings.Fields(value), " ")
+	}
+	return strings.Join(values, ",")
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// EncodePath 按 SigV4 规则编码路径：除非保留字符与 "/" 外全部百分号编码。
+func EncodePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return uriEncode(path, false)
+}
+
+func uriEncode(value string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+func containsString(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -3,8 +3,12 @@ package session
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"gorm.io/gorm"
 
@@ -13,6 +17,67 @@ import (
 
 const CookieName = "skyimage_session"
 
+// RememberTTL 是勾选“记住我”时的会话有效期。
+const RememberTTL = 30 * 24 * time.Hour
+
+// ImpersonationTTL 是模拟登录会话的固定有效期。
+const ImpersonationTTL = 30 * time.Minute
+
+// touchInterval 限制 last_seen_at / expires_at 的写入频率，避免每个请求都写库。
+const touchInterval = time.Minute
+
+const (
+	MethodPassword = "password"
+	MethodPasskey  = "passkey"
+	MethodOAuth    = "oauth"
+	MethodRegister = "register"
+	// MethodImpersonate 表示超级管理员发起的模拟登录会话
+	MethodImpersonate = "impersonate"
+)
+
+// WithTwoFactor 返回经过两步验证后完成的登录方式，如 "password+2fa"。
+func WithTwoFactor(method string) string {
+	return method + "+2fa"
+}
+
+// ErrNotFound 表示会话不存在或不属于当前用户。
+var ErrNotFound = errors.New("会话不存在")
+
+// Metadata 记录会话的来源设备信息。
+type Metadata struct {
+	IP         string
+	UserAgent  string
+	Method     string
+	RememberMe bool
+}
+
+// Info 是对外展示的会话信息，ID 为会话令牌的摘要，不会泄露 Cookie 值。
+type Info struct {
+	ID         string `json:"id"`
+	IP         string `json:"ip"`
+	UserAgent  string `json:"userAgent"`
+	Method     string `json:"method"`
+	RememberMe bool   `json:"rememberMe"`
+	Current    bool   `json:"current"`
+	// Impersonated 表示该会话由管理员模拟登录创建
+	Impersonated bool       `json:"impersonated"`
+	LastSeenAt   *time.Time `json:"lastSeenAt"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// Resolved 是 ResolveSession 返回的会话信息。
+type Resolved struct {
+	UserID uint
+	// ImpersonatorID 非 0 表示当前为模拟登录会话
+	ImpersonatorID uint
+	ExpiresAt      time.Time
+	// Lifetime 是会话的有效期长度，用于重新写入 Cookie
+	Lifetime time.Duration
+	// Refreshed 表示本次请求顺延了有效期，调用方应以 Lifetime 重新写入 Cookie 的 MaxAge
+	Refreshed bool
+}
+
 type Manager struct {
 	db  *gorm.DB
 	ttl time.Duration
@@ -33,6 +98,11 @@ func (m *Manager) SetDB(db *gorm.DB) {
 }
 
 func (m *Manager) Create(userID uint) (string, error) {
+	return m.CreateWithMetadata(userID, Metadata{})
+}
+
+// CreateWithMetadata 创建会话并记录登录设备信息。
+func (m *Manager) CreateWithMetadata(userID uint, meta Metadata) (string, error) {
 	if m.db == nil {
 		return "", gorm.ErrInvalidDB
 	}
@@ -43,10 +113,17 @@ func (m *Manager) Create(userID uint) (string, error) {
 	id := hex.EncodeToString(token)
 
 	now := time.Now().UTC()
+	lifetime := m.LifetimeFor(meta.RememberMe)
 	record := data.SessionEntry{
-		ID:        id,
-		UserID:    userID,
-		ExpiresAt: now.Add(m.ttl),
+		ID:         id,
+		UserID:     userID,
+		IP:         truncate(strings.TrimSpace(meta.IP), 64),
+		UserAgent:  truncate(strings.TrimSpace(meta.UserAgent), 512),
+		Method:     truncate(strings.TrimSpace(meta.Method), 16),
+		RememberMe: meta.RememberMe,
+		Lifetime:   int64(lifetime / time.Second),
+		LastSeenAt: &now,
+		ExpiresAt:  now.Add(lifetime),
 	}
 	if err := m.db.WithContext(context.Background()).Create(&record).Error; err != nil {
 		return "", err
@@ -54,33 +131,90 @@ func (m *Manager) Create(userID uint) (string, error) {
 	return id, nil
 }
 
+// CreateImpersonation 为 userID 创建由 impersonatorID 发起的模拟登录会话，有效期固定为 ImpersonationTTL。
+func (m *Manager) CreateImpersonation(impersonatorID, userID uint, meta Metadata) (string, time.Time, error) {
+	if m.db == nil {
+		return "", time.Time{}, gorm.ErrInvalidDB
+	}
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", time.Time{}, err
+	}
+	id := hex.EncodeToString(token)
+	now := time.Now().UTC()
+	record := data.SessionEntry{
+		ID:             id,
+		UserID:         userID,
+		IP:             truncate(strings.TrimSpace(meta.IP), 64),
+		UserAgent:      truncate(strings.TrimSpace(meta.UserAgent), 512),
+		Method:         MethodImpersonate,
+		Lifetime:       int64(ImpersonationTTL / time.Second),
+		LastSeenAt:     &now,
+		ImpersonatorID: &impersonatorID,
+		ExpiresAt:      now.Add(ImpersonationTTL),
+	}
+	if err := m.db.WithContext(context.Background()).Create(&record).Error; err != nil {
+		return "", time.Time{}, err
+	}
+	return id, record.ExpiresAt, nil
+}
+
+// EndImpersonations 注销 userID 上的所有模拟登录会话。
+func (m *Manager) EndImpersonations(ctx context.Context, userID uint) (int64, error) {
+	if m.db == nil {
+		return 0, gorm.ErrInvalidDB
+	}
+	result := m.db.WithContext(ctx).
+		Where("user_id = ? AND impersonator_id IS NOT NULL", userID).
+		Delete(&data.SessionEntry{})
+	return result.RowsAffected, result.Error
+}
+
 func (m *Manager) Resolve(sessionID string) (uint, bool) {
+	resolved, ok := m.ResolveSession(sessionID)
+	return resolved.UserID, ok
+}
+
+// ResolveSession 校验会话并顺延有效期；模拟登录会话的有效期不顺延。
+func (m *Manager) ResolveSession(sessionID string) (Resolved, bool) {
 	if m.db == nil || sessionID == "" {
-		return 0, false
+		return Resolved{}, false
 	}
 	now := time.Now().UTC()
 	var entry data.SessionEntry
 	if err := m.db.WithContext(context.Background()).
 		Where("id = ?", sessionID).
 		First(&entry).Error; err != nil {
-		return 0, false
+		return Resolved{}, false
 	}
 	if now.After(entry.ExpiresAt) {
 		_ = m.db.WithContext(context.Background()).
 			Where("id = ?", sessionID).
 			Delete(&data.SessionEntry{}).Error
-		return 0, false
+		return Resolved{}, false
+	}
+	resolved := Resolved{UserID: entry.UserID, ExpiresAt: entry.ExpiresAt, Lifetime: m.lifetimeOf(entry)}
+	if entry.ImpersonatorID != nil {
+		resolved.ImpersonatorID = *entry.ImpersonatorID
 	}
 
-	// Sliding session window on every valid request.
-	nextExpiry := now.Add(m.ttl)
+	// Sliding session window; throttled so busy clients don't write on every request.
+	if entry.LastSeenAt != nil && now.Sub(*entry.LastSeenAt) < touchInterval {
+		return resolved, true
+	}
+	updates := map[string]interface{}{"last_seen_at": now}
+	if entry.ImpersonatorID == nil {
+		resolved.ExpiresAt = now.Add(resolved.Lifetime)
+		updates["expires_at"] = resolved.ExpiresAt
+	}
 	if err := m.db.WithContext(context.Background()).
 		Model(&data.SessionEntry{}).
 		Where("id = ?", sessionID).
-		Update("expires_at", nextExpiry).Error; err != nil {
-		return 0, false
+		Updates(updates).Error; err != nil {
+		return Resolved{}, false
 	}
-	return entry.UserID, true
+	resolved.Refreshed = entry.ImpersonatorID == nil
+	return resolved, true
 }
 
 func (m *Manager) Delete(sessionID string) {
@@ -92,6 +226,117 @@ func (m *Manager) Delete(sessionID string) {
 		Delete(&data.SessionEntry{}).Error
 }
 
+// CountActive 返回全站未过期的会话数。
+func (m *Manager) CountActive(ctx context.Context) (int64, error) {
+	if m.db == nil {
+		return 0, nil
+	}
+	var count int64
+	err := m.db.WithContext(ctx).
+		Model(&data.SessionEntry{}).
+		Where("expires_at > ?", time.Now().UTC()).
+		Count(&count).Error
+	return count, err
+}
+
+// List 返回用户所有未过期的会话，currentID 对应的会话会被标记为当前会话。
+func (m *Manager) List(ctx context.Context, userID uint, currentID string) ([]Info, error) {
+	if m.db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var entries []data.SessionEntry
+	if err := m.db.WithContext(ctx).
+		Where("user_id = ? AND expires_at > ?", userID, time.Now().UTC()).
+		Order("created_at desc").
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	items := make([]Info, 0, len(entries))
+	for _, entry := range entries {
+		items = append(items, Info{
+			ID:           PublicID(entry.ID),
+			IP:           entry.IP,
+			UserAgent:    entry.UserAgent,
+			Method:       entry.Method,
+			RememberMe:   entry.RememberMe,
+			Current:      currentID != "" && entry.ID == currentID,
+			Impersonated: entry.ImpersonatorID != nil,
+			LastSeenAt:   entry.LastSeenAt,
+			ExpiresAt:    entry.ExpiresAt,
+			CreatedAt:    entry.CreatedAt,
+		})
+	}
+	return items, nil
+}
+
+// Revoke 按 List 返回的公开 ID 注销用户的某个会话。
+func (m *Manager) Revoke(ctx context.Context, userID uint, publicID string) error {
+	if m.db == nil {
+		return gorm.ErrInvalidDB
+	}
+	publicID = strings.ToLower(strings.TrimSpace(publicID))
+	if publicID == "" {
+		return ErrNotFound
+	}
+	var ids []string
+	if err := m.db.WithContext(ctx).
+		Model(&data.SessionEntry{}).
+		Where("user_id = ?", userID).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if PublicID(id) == publicID {
+			return m.db.WithContext(ctx).
+				Where("id = ? AND user_id = ?", id, userID).
+				Delete(&data.SessionEntry{}).Error
+		}
+	}
+	return ErrNotFound
+}
+
+// RevokeAll 注销用户的全部会话；exceptID 非空时保留该会话（通常为当前会话）。
+func (m *Manager) RevokeAll(ctx context.Context, userID uint, exceptID string) (int64, error) {
+	if m.db == nil {
+		return 0, gorm.ErrInvalidDB
+	}
+	query := m.db.WithContext(ctx).Where("user_id = ?", userID)
+	if exceptID != "" {
+		query = query.Where("id <> ?", exceptID)
+	}
+	result := query.Delete(&data.SessionEntry{})
+	return result.RowsAffected, result.Error
+}
+
 func (m *Manager) TTL() time.Duration {
 	return m.ttl
 }
+
+// LifetimeFor 返回新会话的有效期。
+func (m *Manager) LifetimeFor(rememberMe bool) time.Duration {
+	if rememberMe && RememberTTL > m.ttl {
+		return RememberTTL
+	}
+	return m.ttl
+}
+
+func (m *Manager) lifetimeOf(entry data.SessionEntry) time.Duration {
+	if entry.Lifetime > 0 {
+		return time.Duration(entry.Lifetime) * time.Second
+	}
+	return m.ttl
+}
+
+// PublicID 返回会话令牌的摘要，用于在接口中标识会话。
+func PublicID(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:])[:32]
+}
+
+// truncate 按字符截断，避免把多字节 UTF-8 字符截成半个。
+func truncate(value string, limit int) string {
+	if utf8.RuneCountInString(value) <= limit {
+		return value
+	}
+	return string([]rune(value)[:limit])
+}
@@ -0,0 +1,194 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+func newTestManager(t *testing.T) (*Manager, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&data.SessionEntry{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return NewManager(db, time.Hour), db
+}
+
+func TestCreateWithMetadata_RememberMeExtendsLifetime(t *testing.T) {
+	m, db := newTestManager(t)
+	id, err := m.CreateWithMetadata(1000000000000001, Metadata{IP: "203.0.113.5", UserAgent: "test-agent", Method: MethodPassword, RememberMe: true})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	var entry data.SessionEntry
+	if err := db.First(&entry, "id = ?", id).Error; err != nil {
+		t.Fatalf("load session: %v", err)
+	}
+	if entry.IP != "203.0.113.5" || entry.UserAgent != "test-agent" || entry.Method != MethodPassword {
+		t.Fatalf("unexpected metadata: %+v", entry)
+	}
+	if entry.Lifetime != int64(RememberTTL/time.Second) {
+		t.Fatalf("expected remember-me lifetime, got %d", entry.Lifetime)
+	}
+	if time.Until(entry.ExpiresAt) < 29*24*time.Hour {
+		t.Fatalf("expected long expiry, got %v", entry.ExpiresAt)
+	}
+}
+
+func TestResolve_SlidesExpiryAndTracksLastSeen(t *testing.T) {
+	m, db := newTestManager(t)
+	id, err := m.Create(1000000000000001)
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	stale := time.Now().UTC().Add(-10 * time.Minute)
+	if err := db.Model(&data.SessionEntry{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_seen_at": stale,
+		"expires_at":   time.Now().UTC().Add(5 * time.Minute),
+	}).Error; err != nil {
+		t.Fatalf("age session: %v", err)
+	}
+	resolved, ok := m.ResolveSession(id)
+	if !ok || resolved.UserID != 1000000000000001 {
+		t.Fatalf("expected session to resolve, got %d %v", resolved.UserID, ok)
+	}
+	if !resolved.Refreshed || resolved.Lifetime != time.Hour {
+		t.Fatalf("expected sliding expiry to ask for a cookie refresh, got %+v", resolved)
+	}
+	if again, _ := m.ResolveSession(id); again.Refreshed {
+		t.Fatalf("throttled resolves must not refresh the cookie again")
+	}
+	var entry data.SessionEntry
+	if err := db.First(&entry, "id = ?", id).Error; err != nil {
+		t.Fatalf("load session: %v", err)
+	}
+	if entry.LastSeenAt == nil || entry.LastSeenAt.Before(stale.Add(time.Minute)) {
+		t.Fatalf("expected last_seen_at to advance, got %v", entry.LastSeenAt)
+	}
+	if time.Until(entry.ExpiresAt) < 50*time.Minute {
+		t.Fatalf("expected expiry to slide to ttl, got %v", entry.ExpiresAt)
+	}
+}
+
+func TestRevokeAndRevokeAll(t *testing.T) {
+	m, _ := newTestManager(t)
+	ctx := context.Background()
+	const userID = 1000000000000001
+	current, _ := m.Create(userID)
+	other, _ := m.Create(userID)
+	third, _ := m.Create(userID)
+	foreign, _ := m.Create(1000000000000002)
+
+	items, err := m.List(ctx, userID, current)
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("expected 3 sessions, got %d", len(items))
+	}
+	currentCount := 0
+	for _, item := range items {
+		if item.ID == current {
+			t.Fatalf("session token leaked in list")
+		}
+		if item.Current {
+			currentCount++
+		}
+	}
+	if currentCount != 1 {
+		t.Fatalf("expected exactly one current session, got %d", currentCount)
+	}
+
+	if err := m.Revoke(ctx, userID, PublicID(foreign)); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound for foreign session, got %v", err)
+	}
+	if err := m.Revoke(ctx, userID, PublicID(other)); err != nil {
+		t.Fatalf("revoke session: %v", err)
+	}
+	if _, ok := m.Resolve(other); ok {
+		t.Fatalf("revoked session should not resolve")
+	}
+
+	revoked, err := m.RevokeAll(ctx, userID, current)
+	if err != nil || revoked != 1 {
+		t.Fatalf("expected 1 revoked session, got %d (%v)", revoked, err)
+	}
+	if _, ok := m.Resolve(third); ok {
+		t.Fatalf("third session should be revoked")
+	}
+	if _, ok := m.Resolve(current); !ok {
+		t.Fatalf("current session should survive")
+	}
+	if _, ok := m.Resolve(foreign); !ok {
+		t.Fatalf("other users' sessions should be untouched")
+	}
+}
+
+func TestCreateImpersonation_FixedExpiryAndEnd(t *testing.T) {
+	m, db := newTestManager(t)
+	own, err := m.Create(1000000000000002)
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	id, expiresAt, err := m.CreateImpersonation(1000000000000001, 1000000000000002, Metadata{IP: "203.0.113.5"})
+	if err != nil {
+		t.Fatalf("create impersonation: %v", err)
+	}
+	if time.Until(expiresAt) > ImpersonationTTL {
+		t.Fatalf("unexpected expiry %v", expiresAt)
+	}
+
+	if err := db.Model(&data.SessionEntry{}).Where("id = ?", id).
+		Update("last_seen_at", time.Now().UTC().Add(-10*time.Minute)).Error; err != nil {
+		t.Fatalf("age session: %v", err)
+	}
+	resolved, ok := m.ResolveSession(id)
+	if !ok || resolved.UserID != 1000000000000002 || resolved.ImpersonatorID != 1000000000000001 {
+		t.Fatalf("unexpected resolve result: %+v ok=%v", resolved, ok)
+	}
+	var entry data.SessionEntry
+	if err := db.First(&entry, "id = ?", id).Error; err != nil {
+		t.Fatalf("load session: %v", err)
+	}
+	if !entry.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("impersonation expiry must not slide: %v -> %v", expiresAt, entry.ExpiresAt)
+	}
+
+	revoked, err := m.EndImpersonations(context.Background(), 1000000000000002)
+	if err != nil || revoked != 1 {
+		t.Fatalf("end impersonations: revoked=%d err=%v", revoked, err)
+	}
+	if _, ok := m.Resolve(id); ok {
+		t.Fatalf("impersonation session should be gone")
+	}
+	if _, ok := m.Resolve(own); !ok {
+		t.Fatalf("user's own session must survive")
+	}
+}
+
+func TestCreateWithMetadata_TruncatesUserAgentByRune(t *testing.T) {
+	m, db := newTestManager(t)
+	agent := strings.Repeat("浏", 600)
+	id, err := m.CreateWithMetadata(1000000000000001, Metadata{UserAgent: agent})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	var entry data.SessionEntry
+	if err := db.First(&entry, "id = ?", id).Error; err != nil {
+		t.Fatalf("load session: %v", err)
+	}
+	if !utf8.ValidString(entry.UserAgent) || utf8.RuneCountInString(entry.UserAgent) != 512 {
+		t.Fatalf("expected 512 whole characters, got %d runes (valid=%v)", utf8.RuneCountInString(entry.UserAgent), utf8.ValidString(entry.UserAgent))
+	}
+}
@@ -14,8 +14,10 @@ import (
 	"gorm.io/gorm/clause"
 
 	"skyimage/internal/admin"
+	"skyimage/internal/alerts"
 	"skyimage/internal/data"
 	"skyimage/internal/payment"
+	"skyimage/internal/webhooks"
 )
 
 var (
@@ -31,8 +33,10 @@ var (
 )
 
 type Service struct {
-	db    *gorm.DB
-	admin *admin.Service
+	db       *gorm.DB
+	admin    *admin.Service
+	webhooks *webhooks.Service
+	alerts   *alerts.Service
 }
 
 func New(db *gorm.DB, adminService *admin.Service) *Service {
@@ -47,6 +51,14 @@ func (s *Service) SetAdmin(a *admin.Service) {
 	s.admin = a
 }
 
+func (s *Service) SetWebhooks(hooks *webhooks.Service) {
+	s.webhooks = hooks
+}
+
+func (s *Service) SetAlerts(service *alerts.Service) {
+	s.alerts = service
+}
+
 type ProductInput struct {
 	Name         string `json:"name"`
 	Description  string `json:"description"`
@@ -377,7 +389,8 @@ func (s *Service) FulfillFromNotify(ctx context.Context, providerName string, re
 }
 
 func (s *Service) fulfillOrder(ctx context.Context, order data.ShopOrder, tradeNo, notifyRaw string) error {
-	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	var paid *data.ShopOrder
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		var locked data.ShopOrder
 		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
 			Where("id = ?", order.ID).First(&locked).Error; err != nil {
@@ -443,8 +456,40 @@ func (s *Service) fulfillOrder(ctx context.Context, order data.ShopOrder, tradeN
 		if res.RowsAffected == 0 {
 			return nil
 		}
+		locked.Status = data.OrderStatusPaid
+		locked.ProviderTradeNo = tradeNo
+		locked.PaidAt = &paidAt
+		locked.FulfilledAt = &paidAt
+		locked.MembershipExpiresAt = &expires
+		paid = &locked
 		return nil
 	})
+	if err == nil && paid != nil && s.alerts != nil {
+		s.alerts.Notify(alerts.EventOrderPaid, alerts.Message{
+			Text: fmt.Sprintf("订单 %s：用户 %d 购买「%s」，实付 %.2f %s（%s）",
+				paid.OrderNo, paid.UserID, paid.ProductName, float64(paid.PriceCents)/100, paid.Currency, paid.Provider),
+			URL: "/dashboard/admin/shop",
+		})
+	}
+	if err == nil && paid != nil && s.webhooks != nil {
+		// 只在本次调用真正完成支付时推送，重复的支付回调不会重复触发
+		s.webhooks.Emit(ctx, webhooks.EventOrderPaid, paid.UserID, map[string]interface{}{
+			"id":                  paid.ID,
+			"orderNo":             paid.OrderNo,
+			"userId":              fmt.Sprint(paid.UserID),
+			"productId":           paid.ProductID,
+			"productName":         paid.ProductName,
+			"priceCents":          paid.PriceCents,
+			"currency":            paid.Currency,
+			"durationDays":        paid.DurationDays,
+			"groupId":             paid.GroupID,
+			"provider":            paid.Provider,
+			"providerTradeNo":     paid.ProviderTradeNo,
+			"paidAt":              paid.PaidAt,
+			"membershipExpiresAt": paid.MembershipExpiresAt,
+		})
+	}
+	return err
 }
 
 // computeMembershipAfterPurchase returns new expiry, unit price, and whether to capture previous group.
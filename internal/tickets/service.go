@@ -5,16 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"skyimage/internal/alerts"
 	"skyimage/internal/data"
 	"skyimage/internal/files"
 	"skyimage/internal/notifications"
 	"skyimage/internal/users"
+	"skyimage/internal/webhooks"
 )
 
 const (
@@ -58,6 +61,8 @@ type Service struct {
 	db            *gorm.DB
 	files         *files.Service
 	notifications *notifications.Service
+	webhooks      *webhooks.Service
+	alerts        *alerts.Service
 	mail          MailSender
 }
 
@@ -81,6 +86,14 @@ func (s *Service) SetMail(mail MailSender) {
 	s.mail = mail
 }
 
+func (s *Service) SetWebhooks(hooks *webhooks.Service) {
+	s.webhooks = hooks
+}
+
+func (s *Service) SetAlerts(service *alerts.Service) {
+	s.alerts = service
+}
+
 type ListFilter struct {
 	UserID   uint
 	Status   string
@@ -250,26 +263,29 @@ func (s *Service) Create(ctx context.Context, input CreateInput) (TicketDetail,
 		Priority:    priority,
 		LastReplyAt: &now,
 	}
+	var first data.TicketMessage
 	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(&ticket).Error; err != nil {
 			return err
 		}
-		msg := data.TicketMessage{
+		first = data.TicketMessage{
 			TicketID: ticket.ID,
 			UserID:   input.UserID,
 			Body:     body,
 			IsStaff:  input.IsStaff,
 		}
-		return tx.Create(&msg).Error
+		return tx.Create(&first).Error
 	})
 	if err != nil {
 		return TicketDetail{}, err
 	}
+	s.emitTicketEvent(ctx, webhooks.EventTicketCreated, ticket, first)
 	if s.notifications != nil && !input.IsStaff {
 		_ = s.notifications.NotifyAdminsTicketCreated(ctx, ticket)
 	}
 	if !input.IsStaff {
 		s.emailAdminsTicketCreated(ctx, ticket)
+		s.alertTicket(alerts.EventTicketCreated, ticket, first.Body)
 	}
 	return s.Get(ctx, ticket.ID)
 }
@@ -315,6 +331,11 @@ func (s *Service) Reply(ctx context.Context, input ReplyInput) (data.TicketMessa
 	if err != nil {
 		return data.TicketMessage{}, err
 	}
+	if input.IsStaff && ticket.Status == data.TicketStatusOpen {
+		ticket.Status = data.TicketStatusPending
+	}
+	ticket.LastReplyAt = &now
+	s.emitTicketEvent(ctx, webhooks.EventTicketReplied, ticket, msg)
 	if s.notifications != nil {
 		if input.IsStaff {
 			_ = s.notifications.NotifyTicketReply(ctx, ticket, true)
@@ -326,6 +347,7 @@ func (s *Service) Reply(ctx context.Context, input ReplyInput) (data.TicketMessa
 		s.emailUserTicketReply(ctx, ticket, input.UserID, body)
 	} else {
 		s.emailAdminsTicketReply(ctx, ticket, input.UserID, body)
+		s.alertTicket(alerts.EventTicketReplied, ticket, body)
 	}
 	_ = s.db.WithContext(ctx).Preload("User").First(&msg, msg.ID)
 	return msg, nil
@@ -501,13 +523,13 @@ func (s *Service) FindAttachmentByRelativePath(ctx context.Context, rel string)
 	return att, err
 }
 
-// CanAccessAttachment: only the uploader or an admin may open the file.
+// CanAccessAttachment: only the uploader or staff with ticket permission may open the file.
 // Ticket owners cannot download another user's attachments.
 func (s *Service) CanAccessAttachment(att data.TicketAttachment, viewer *data.User) bool {
 	if viewer == nil || viewer.ID == 0 {
 		return false
 	}
-	if viewer.IsAdmin || viewer.IsSuperAdmin {
+	if viewer.HasAdminPermission(data.AdminPermTickets) {
 		return true
 	}
 	return att.UserID == viewer.ID
@@ -518,7 +540,7 @@ func FilterAttachmentsForViewer(items []data.TicketAttachment, viewer *data.User
 	if viewer == nil || viewer.ID == 0 {
 		return nil
 	}
-	if viewer.IsAdmin || viewer.IsSuperAdmin {
+	if viewer.HasAdminPermission(data.AdminPermTickets) {
 		return items
 	}
 	out := make([]data.TicketAttachment, 0, len(items))
@@ -537,6 +559,42 @@ func (s *Service) AttachmentPublicURL(ctx context.Context, att data.TicketAttach
 	return s.files.ConsolePublicURL(ctx, att.RelativePath)
 }
 
+// emitTicketEvent 推送工单事件；事件归属工单发起人，管理员订阅同样会收到。
+func (s *Service) emitTicketEvent(ctx context.Context, event string, ticket data.Ticket, msg data.TicketMessage) {
+	if s.webhooks == nil {
+		return
+	}
+	s.webhooks.Emit(ctx, event, ticket.UserID, map[string]interface{}{
+		"ticket": map[string]interface{}{
+			"id":        ticket.ID,
+			"ticketNo":  ticket.TicketNo,
+			"userId":    fmt.Sprint(ticket.UserID),
+			"subject":   ticket.Subject,
+			"status":    ticket.Status,
+			"priority":  ticket.Priority,
+			"createdAt": ticket.CreatedAt,
+		},
+		"message": map[string]interface{}{
+			"id":        msg.ID,
+			"userId":    fmt.Sprint(msg.UserID),
+			"body":      msg.Body,
+			"isStaff":   msg.IsStaff,
+			"createdAt": msg.CreatedAt,
+		},
+	})
+}
+
+// alertTicket 把用户发起或回复的工单推送到管理员提醒渠道。
+func (s *Service) alertTicket(event string, ticket data.Ticket, body string) {
+	if s.alerts == nil {
+		return
+	}
+	s.alerts.Notify(event, alerts.Message{
+		Text: fmt.Sprintf("%s %s（优先级 %s）\n%s", ticket.TicketNo, ticket.Subject, ticket.Priority, TruncateForEmail(body, 500)),
+		URL:  "/dashboard/admin/tickets/" + strconv.FormatUint(uint64(ticket.ID), 10),
+	})
+}
+
 func generateTicketNo(now time.Time) string {
 	return fmt.Sprintf("T-%s-%s", now.Format("20060102"), strings.ToUpper(uuid.NewString()[:6]))
 }
@@ -620,10 +678,13 @@ func (s *Service) selectedAdminIDs(ctx context.Context) []uint {
 }
 
 func (s *Service) listNotifyAdminUsers(ctx context.Context) ([]data.User, error) {
+	staffIDs, err := data.UserIDsWithAdminPermission(ctx, s.db, data.AdminPermTickets)
+	if err != nil || len(staffIDs) == 0 {
+		return nil, err
+	}
 	q := s.db.WithContext(ctx).
 		Model(&data.User{}).
-		Where("is_adminer = ? OR is_super_admin = ?", true, true).
-		Where("status = ?", 1)
+		Where("id IN ?", staffIDs)
 	if s.emailNotifyMode(ctx) == NotifyModeSelected {
 		ids := s.selectedAdminIDs(ctx)
 		if len(ids) == 0 {
@@ -632,7 +693,7 @@ func (s *Service) listNotifyAdminUsers(ctx context.Context) ([]data.User, error)
 		q = q.Where("id IN ?", ids)
 	}
 	var users []data.User
-	err := q.Find(&users).Error
+	err = q.Find(&users).Error
 	return users, err
 }
 
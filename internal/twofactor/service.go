@@ -0,0 +1,410 @@
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+const (
+	// ConfigKeyRequireAdmin forces admin and super-admin accounts to enroll TOTP.
+	ConfigKeyRequireAdmin = "security.require_admin_2fa"
+
+	challengeTTL         = 5 * time.Minute
+	maxChallengeAttempts = 5
+	recoveryCodeCount    = 10
+	defaultIssuer        = "SkyImage"
+)
+
+var (
+	ErrNotEnabled       = errors.New("两步验证未启用")
+	ErrAlreadyEnabled   = errors.New("两步验证已启用")
+	ErrNoPendingSetup   = errors.New("请先生成两步验证密钥")
+	ErrInvalidCode      = errors.New("验证码错误或已过期")
+	ErrInvalidChallenge = errors.New("登录验证已失效，请重新登录")
+)
+
+// SettingsReader exposes the admin settings store (implemented by *admin.Service).
+type SettingsReader interface {
+	GetSettings(ctx context.Context) (map[string]string, error)
+}
+
+// Service implements TOTP enrollment, recovery codes and the second login step.
+type Service struct {
+	db       *gorm.DB
+	settings SettingsReader
+
+	mu          sync.Mutex
+	stopCleanup chan struct{}
+}
+
+// Status is the public 2FA state of an account.
+type Status struct {
+	Enabled                bool       `json:"enabled"`
+	Pending                bool       `json:"pending"`
+	Required               bool       `json:"required"`
+	RecoveryCodesRemaining int64      `json:"recoveryCodesRemaining"`
+	ConfirmedAt            *time.Time `json:"confirmedAt,omitempty"`
+}
+
+// Enrollment is returned when a user starts TOTP setup.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+func New(db *gorm.DB, settings SettingsReader) *Service {
+	s := &Service{
+		db:          db,
+		settings:    settings,
+		stopCleanup: make(chan struct{}),
+	}
+	go s.cleanupLoop()
+	return s
+}
+
+// SetDB updates the database handle after a runtime database switch.
+func (s *Service) SetDB(db *gorm.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db = db
+}
+
+// SetSettings updates the settings reader after a runtime database switch.
+func (s *Service) SetSettings(settings SettingsReader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = settings
+}
+
+func (s *Service) handle() (*gorm.DB, SettingsReader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db, s.settings
+}
+
+// Required reports whether the admin policy forces this account to use 2FA.
+func (s *Service) Required(ctx context.Context, user data.User) bool {
+	if !user.IsAdmin && !user.IsSuperAdmin {
+		return false
+	}
+	_, settings := s.handle()
+	if settings == nil {
+		return false
+	}
+	values, err := settings.GetSettings(ctx)
+	if err != nil {
+		return false
+	}
+	return values[ConfigKeyRequireAdmin] == "true"
+}
+
+// Enabled reports whether the user has confirmed TOTP enrollment.
+func (s *Service) Enabled(ctx context.Context, userID uint) bool {
+	db, _ := s.handle()
+	var count int64
+	if err := db.WithContext(ctx).Model(&data.UserTOTP{}).
+		Where("user_id = ? AND enabled = ?", userID, true).
+		Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+func (s *Service) Status(ctx context.Context, user data.User) (Status, error) {
+	db, _ := s.handle()
+	status := Status{Required: s.Required(ctx, user)}
+	var entry data.UserTOTP
+	err := db.WithContext(ctx).Where("user_id = ?", user.ID).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+	status.Enabled = entry.Enabled
+	status.Pending = !entry.Enabled
+	status.ConfirmedAt = entry.ConfirmedAt
+	if entry.Enabled {
+		if err := db.WithContext(ctx).Model(&data.UserRecoveryCode{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Count(&status.RecoveryCodesRemaining).Error; err != nil {
+			return status, err
+		}
+	}
+	return status, nil
+}
+
+// BeginEnrollment creates (or replaces) a pending secret. It is not active until confirmed.
+func (s *Service) BeginEnrollment(ctx context.Context, user data.User, issuer string) (Enrollment, error) {
+	db, _ := s.handle()
+	if s.Enabled(ctx, user.ID) {
+		return Enrollment{}, ErrAlreadyEnabled
+	}
+	secret, err := generateSecret()
+	if err != nil {
+		return Enrollment{}, err
+	}
+	entry := data.UserTOTP{UserID: user.ID, Secret: secret}
+	if err := db.WithContext(ctx).Where("user_id = ?", user.ID).Delete(&data.UserTOTP{}).Error; err != nil {
+		return Enrollment{}, err
+	}
+	if err := db.WithContext(ctx).Create(&entry).Error; err != nil {
+		return Enrollment{}, err
+	}
+	issuer = strings.TrimSpace(issuer)
+	if issuer == "" {
+		issuer = defaultIssuer
+	}
+	return Enrollment{Secret: secret, URI: ProvisioningURI(issuer, user.Email, secret)}, nil
+}
+
+// ConfirmEnrollment activates TOTP after the first valid code and returns fresh recovery codes.
+func (s *Service) ConfirmEnrollment(ctx context.Context, userID uint, code string) ([]string, error) {
+	db, _ := s.handle()
+	var entry data.UserTOTP
+	if err := db.WithContext(ctx).Where("user_id = ?", userID).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoPendingSetup
+		}
+		return nil, err
+	}
+	if entry.Enabled {
+		return nil, ErrAlreadyEnabled
+	}
+	step := matchTOTP(entry.Secret, code, time.Now())
+	if step < 0 {
+		return nil, ErrInvalidCode
+	}
+	var codes []string
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&data.UserTOTP{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+			"enabled":        true,
+			"confirmed_at":   now,
+			"last_used_step": step,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// Verify checks a TOTP code or an unused recovery code. Recovery codes are consumed on success.
+func (s *Service) Verify(ctx context.Context, userID uint, code string) error {
+	db, _ := s.handle()
+	var entry data.UserTOTP
+	if err := db.WithContext(ctx).Where("user_id = ? AND enabled = ?", userID, true).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotEnabled
+		}
+		return err
+	}
+	normalized := strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if step := matchTOTP(entry.Secret, normalized, time.Now()); step >= 0 {
+		// 同一时间窗口的验证码只能使用一次，防止重放
+		result := db.WithContext(ctx).Model(&data.UserTOTP{}).
+			Where("user_id = ? AND last_used_step < ?", userID, step).
+			Update("last_used_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+	return s.consumeRecoveryCode(ctx, userID, normalized)
+}
+
+func (s *Service) consumeRecoveryCode(ctx context.Context, userID uint, code string) error {
+	db, _ := s.handle()
+	code = strings.ToLower(strings.ReplaceAll(code, "-", ""))
+	if code == "" {
+		return ErrInvalidCode
+	}
+	result := db.WithContext(ctx).Model(&data.UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after verifying the current code.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	db, _ := s.handle()
+	var codes []string
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// Disable turns off 2FA after verifying a TOTP or recovery code.
+func (s *Service) Disable(ctx context.Context, userID uint, code string) error {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+	return s.Reset(ctx, userID)
+}
+
+// Reset removes all 2FA data for a user without verification (admin recovery).
+func (s *Service) Reset(ctx context.Context, userID uint) error {
+	db, _ := s.handle()
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&data.UserTOTP{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&data.UserRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&data.TwoFactorChallenge{}).Error
+	})
+}
+
+// CreateChallenge records a login whose first factor (password, OAuth or an
+// unverified passkey) succeeded but still needs the second factor.
+func (s *Service) CreateChallenge(ctx context.Context, userID uint, method string) (string, error) {
+	db, _ := s.handle()
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	entry := data.TwoFactorChallenge{
+		ID:        hex.EncodeToString(buf),
+		UserID:    userID,
+		Method:    method,
+		ExpiresAt: time.Now().Add(challengeTTL),
+	}
+	if err := db.WithContext(ctx).Create(&entry).Error; err != nil {
+		return "", err
+	}
+	return entry.ID, nil
+}
+
+// ChallengeUserID returns the user of a pending, unexpired login challenge
+// without consuming an attempt, so callers can apply per-user limits first.
+func (s *Service) ChallengeUserID(ctx context.Context, challengeID string) (uint, error) {
+	db, _ := s.handle()
+	var entry data.TwoFactorChallenge
+	err := db.WithContext(ctx).
+		Where("id = ? AND expires_at > ? AND attempts < ?", strings.TrimSpace(challengeID), time.Now(), maxChallengeAttempts).
+		First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrInvalidChallenge
+	}
+	if err != nil {
+		return 0, err
+	}
+	return entry.UserID, nil
+}
+
+// CompleteChallenge verifies the code for a pending login and returns the challenge.
+// The challenge is single-use and is discarded after too many failed attempts. Each
+// attempt is reserved with a conditional update before the code is checked, so
+// parallel guesses cannot exceed the limit.
+func (s *Service) CompleteChallenge(ctx context.Context, challengeID, code string) (data.TwoFactorChallenge, error) {
+	db, _ := s.handle()
+	challengeID = strings.TrimSpace(challengeID)
+	reserved := db.WithContext(ctx).Model(&data.TwoFactorChallenge{}).
+		Where("id = ? AND expires_at > ? AND attempts < ?", challengeID, time.Now(), maxChallengeAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if reserved.Error != nil {
+		return data.TwoFactorChallenge{}, reserved.Error
+	}
+	if reserved.RowsAffected == 0 {
+		_ = db.WithContext(ctx).Delete(&data.TwoFactorChallenge{}, "id = ? AND attempts >= ?", challengeID, maxChallengeAttempts).Error
+		return data.TwoFactorChallenge{}, ErrInvalidChallenge
+	}
+	var entry data.TwoFactorChallenge
+	if err := db.WithContext(ctx).Where("id = ?", challengeID).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return data.TwoFactorChallenge{}, ErrInvalidChallenge
+		}
+		return data.TwoFactorChallenge{}, err
+	}
+	if err := s.Verify(ctx, entry.UserID, code); err != nil {
+		if errors.Is(err, ErrInvalidCode) && entry.Attempts >= maxChallengeAttempts {
+			_ = db.WithContext(ctx).Delete(&data.TwoFactorChallenge{}, "id = ?", entry.ID).Error
+			return data.TwoFactorChallenge{}, ErrInvalidChallenge
+		}
+		return data.TwoFactorChallenge{}, err
+	}
+	result := db.WithContext(ctx).Delete(&data.TwoFactorChallenge{}, "id = ?", entry.ID)
+	if result.Error != nil {
+		return data.TwoFactorChallenge{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return data.TwoFactorChallenge{}, ErrInvalidChallenge
+	}
+	return entry, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&data.UserRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]data.UserRecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := hex.EncodeToString(buf)
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		rows = append(rows, data.UserRecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(raw)})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Service) cleanupLoop() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCleanup:
+			return
+		case <-ticker.C:
+			db, _ := s.handle()
+			if db == nil {
+				continue
+			}
+			if err := db.WithContext(context.Background()).
+				Delete(&data.TwoFactorChallenge{}, "expires_at < ?", time.Now()).Error; err != nil {
+				log.Printf("[2fa] cleanup failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package twofactor
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+var dbSeq int64
+
+type stubSettings struct {
+	values map[string]string
+}
+
+func (s *stubSettings) GetSettings(ctx context.Context) (map[string]string, error) {
+	if s.values == nil {
+		return map[string]string{}, nil
+	}
+	return s.values, nil
+}
+
+func newTestService(t *testing.T, settings *stubSettings) (*Service, data.User) {
+	t.Helper()
+
+	n := atomic.AddInt64(&dbSeq, 1)
+	db, err := gorm.Open(sqlite.Open("file:2fa-test-"+t.Name()+"-"+strconv.FormatInt(n, 10)+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&data.User{}, &data.UserTOTP{}, &data.UserRecoveryCode{}, &data.TwoFactorChallenge{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	user := data.User{ID: 1000000000000001, Name: "2FA User", Email: "2fa@example.com", PasswordHash: "x", Status: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return New(db, settings), user
+}
+
+func currentCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := totpCode(secret, time.Now().Unix()/totpPeriod+offset)
+	if err != nil {
+		t.Fatalf("totpCode failed: %v", err)
+	}
+	return code
+}
+
+func TestTOTPCode_RFC6238Vector(t *testing.T) {
+	// RFC 6238 附录 B 的 SHA1 测试向量（密钥 "12345678901234567890"），取后 6 位。
+	secret := base32NoPadding.EncodeToString([]byte("12345678901234567890"))
+	code, err := totpCode(secret, 59/totpPeriod)
+	if err != nil || code != "287082" {
+		t.Fatalf("expected 287082, got %q (%v)", code, err)
+	}
+	if step := matchTOTP(secret, "287082", time.Unix(59, 0)); step != 1 {
+		t.Fatalf("expected step 1, got %d", step)
+	}
+}
+
+func TestEnrollmentVerifyAndRecoveryCodes(t *testing.T) {
+	svc, user := newTestService(t, nil)
+	ctx := context.Background()
+
+	enrollment, err := svc.BeginEnrollment(ctx, user, "SkyImage")
+	if err != nil {
+		t.Fatalf("BeginEnrollment failed: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/SkyImage:2fa@example.com?") || !strings.Contains(enrollment.URI, "secret="+enrollment.Secret) {
+		t.Fatalf("unexpected provisioning uri: %s", enrollment.URI)
+	}
+	if svc.Enabled(ctx, user.ID) {
+		t.Fatal("expected 2fa to stay disabled until confirmed")
+	}
+	if _, err := svc.ConfirmEnrollment(ctx, user.ID, "000000"); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("expected invalid code, got %v", err)
+	}
+
+	codes, err := svc.ConfirmEnrollment(ctx, user.ID, currentCode(t, enrollment.Secret, -1))
+	if err != nil {
+		t.Fatalf("ConfirmEnrollment failed: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || !svc.Enabled(ctx, user.ID) {
+		t.Fatalf("expected enabled 2fa with %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	}
+
+	// 已使用过的时间窗口不能重放
+	if err := svc.Verify(ctx, user.ID, currentCode(t, enrollment.Secret, -1)); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("expected replayed code to fail, got %v", err)
+	}
+	if err := svc.Verify(ctx, user.ID, currentCode(t, enrollment.Secret, 0)); err != nil {
+		t.Fatalf("expected current code to verify, got %v", err)
+	}
+
+	if err := svc.Verify(ctx, user.ID, strings.ToUpper(codes[0])); err != nil {
+		t.Fatalf("expected recovery code to verify, got %v", err)
+	}
+	if err := svc.Verify(ctx, user.ID, codes[0]); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("expected recovery code to be single-use, got %v", err)
+	}
+	status, err := svc.Status(ctx, user)
+	if err != nil || status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Fatalf("unexpected status: %+v (%v)", status, err)
+	}
+
+	if err := svc.Reset(ctx, user.ID); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if svc.Enabled(ctx, user.ID) {
+		t.Fatal("expected reset to disable 2fa")
+	}
+}
+
+func TestLoginChallenge(t *testing.T) {
+	svc, user := newTestService(t, nil)
+	ctx := context.Background()
+	enrollment, _ := svc.BeginEnrollment(ctx, user, "")
+	codes, err := svc.ConfirmEnrollment(ctx, user.ID, currentCode(t, enrollment.Secret, 0))
+	if err != nil {
+		t.Fatalf("ConfirmEnrollment failed: %v", err)
+	}
+
+	challenge, err := svc.CreateChallenge(ctx, user.ID, "oauth")
+	if err != nil {
+		t.Fatalf("CreateChallenge failed: %v", err)
+	}
+	if _, err := svc.CompleteChallenge(ctx, challenge, "123456x"); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("expected invalid code, got %v", err)
+	}
+	completed, err := svc.CompleteChallenge(ctx, challenge, codes[1])
+	if err != nil || completed.UserID != user.ID || completed.Method != "oauth" {
+		t.Fatalf("expected challenge to complete, got %+v (%v)", completed, err)
+	}
+	if _, err := svc.CompleteChallenge(ctx, challenge, codes[2]); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("expected challenge to be single-use, got %v", err)
+	}
+
+	limited, _ := svc.CreateChallenge(ctx, user.ID, "password")
+	for i := 0; i < maxChallengeAttempts; i++ {
+		_, err = svc.CompleteChallenge(ctx, limited, "000000")
+	}
+	if !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("expected challenge to be dropped after too many attempts, got %v", err)
+	}
+}
+
+func TestLoginChallengeLimitsParallelGuesses(t *testing.T) {
+	svc, user := newTestService(t, nil)
+	ctx := context.Background()
+	enrollment, _ := svc.BeginEnrollment(ctx, user, "")
+	if _, err := svc.ConfirmEnrollment(ctx, user.ID, currentCode(t, enrollment.Secret, 0)); err != nil {
+		t.Fatalf("ConfirmEnrollment failed: %v", err)
+	}
+	challenge, _ := svc.CreateChallenge(ctx, user.ID, "password")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	checked := 0
+	for i := 0; i < maxChallengeAttempts*4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := svc.CompleteChallenge(ctx, challenge, "000000"); errors.Is(err, ErrInvalidCode) {
+				mu.Lock()
+				checked++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if checked >= maxChallengeAttempts {
+		t.Fatalf("expected at most %d codes to be checked, got %d", maxChallengeAttempts-1, checked)
+	}
+}
+
+func TestRequiredForAdmins(t *testing.T) {
+	settings := &stubSettings{values: map[string]string{ConfigKeyRequireAdmin: "true"}}
+	svc, user := newTestService(t, settings)
+	if svc.Required(context.Background(), user) {
+		t.Fatal("expected regular users to be exempt")
+	}
+	user.IsAdmin = true
+	if !svc.Required(context.Background(), user) {
+		t.Fatal("expected admins to be required to use 2fa")
+	}
+	settings.values[ConfigKeyRequireAdmin] = "false"
+	if svc.Required(context.Background(), user) {
+		t.Fatal("expected policy to be switchable")
+	}
+}
@@ -20,10 +20,28 @@ import (
 	"gorm.io/gorm/clause"
 
 	"skyimage/internal/data"
+	"skyimage/internal/webhooks"
 )
 
 type Service struct {
-	db *gorm.DB
+	db       *gorm.DB
+	invites  InviteRedeemer
+	webhooks *webhooks.Service
+}
+
+// InviteRedeemer 在注册事务内核销邀请码（由 invites.Service 实现）。
+type InviteRedeemer interface {
+	RedeemInTx(ctx context.Context, tx *gorm.DB, code string, inviteeID uint) error
+}
+
+// SetInvites 设置注册时使用的邀请码核销实现。
+func (s *Service) SetInvites(invites InviteRedeemer) {
+	s.invites = invites
+}
+
+// SetWebhooks 设置注册成功后推送 user.registered 事件的服务。
+func (s *Service) SetWebhooks(hooks *webhooks.Service) {
+	s.webhooks = hooks
 }
 
 func (s *Service) DB() *gorm.DB {
@@ -32,9 +50,12 @@ func (s *Service) DB() *gorm.DB {
 
 var (
 	ErrSuperAdminImmutable = errors.New("cannot modify super admin")
+	ErrFullAdminRequired   = errors.New("only unrestricted admins can grant admin access")
+	ErrFullAdminTarget     = errors.New("only unrestricted admins can modify unrestricted admins")
 	ErrInvalidEmail        = errors.New("invalid email format")
 	ErrWeakPassword        = errors.New("password must be at least 8 characters and contain uppercase, lowercase, and numbers")
 	ErrUserAlreadyExists   = errors.New("user already exists")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
 )
 
 // 邮箱验证正则表达式
@@ -50,6 +71,7 @@ type RegisterInput struct {
 	Name         string `json:"name"`
 	Email        string `json:"email"`
 	Password     string `json:"password"`
+	InviteCode   string `json:"inviteCode"`
 	RegisteredIP string `json:"-"` // 不从JSON读取，由服务器设置
 }
 
@@ -161,7 +183,25 @@ func (s *Service) Register(ctx context.Context, in RegisterInput) (data.User, er
 	if group, err := s.defaultGroup(ctx); err == nil && group != nil {
 		user.GroupID = &group.ID
 	}
-	if err := CreateUserWithGeneratedID(s.db.WithContext(ctx), &user); err != nil {
+	inviteCode := strings.TrimSpace(in.InviteCode)
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := CreateUserWithGeneratedID(tx, &user); err != nil {
+			return err
+		}
+		if inviteCode == "" || s.invites == nil {
+			return nil
+		}
+		// 邀请码错误直接返回，不按唯一约束冲突处理
+		if err := s.invites.RedeemInTx(ctx, tx, inviteCode, user.ID); err != nil {
+			return &inviteError{err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		var inviteErr *inviteError
+		if errors.As(err, &inviteErr) {
+			return data.User{}, inviteErr.err
+		}
 		if errors.Is(err, ErrGenerateUserID) {
 			return data.User{}, err
 		}
@@ -171,13 +211,22 @@ func (s *Service) Register(ctx context.Context, in RegisterInput) (data.User, er
 		return data.User{}, err
 	}
 	_ = s.hydrateUser(ctx, &user)
+	s.webhooks.Emit(ctx, webhooks.EventUserRegistered, 0, webhooks.UserRegisteredPayload(user, "password"))
 	return user, nil
 }
 
+type inviteError struct {
+	err error
+}
+
+func (e *inviteError) Error() string { return e.err.Error() }
+
+func (e *inviteError) Unwrap() error { return e.err }
+
 func (s *Service) Login(ctx context.Context, in LoginInput) (data.User, error) {
 	// 验证邮箱格式
 	if err := validateEmail(in.Email); err != nil {
-		return data.User{}, errors.New("invalid credentials")
+		return data.User{}, ErrInvalidCredentials
 	}
 
 	// 标准化邮箱（转小写）
@@ -188,15 +237,15 @@ func (s *Service) Login(ctx context.Context, in LoginInput) (data.User, error) {
 	if err := s.db.WithContext(ctx).Preload("Group").Where("LOWER(email) = ?", in.Email).First(&user).Error; err != nil {
 		// 统一返回"邮箱/密码不正确"，不暴露用户是否存在
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return data.User{}, errors.New("invalid credentials")
+			return data.User{}, ErrInvalidCredentials
 		}
 		return data.User{}, err
 	}
 	if strings.TrimSpace(user.PasswordHash) == "" {
-		return data.User{}, errors.New("invalid credentials")
+		return data.User{}, ErrInvalidCredentials
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(in.Password)); err != nil {
-		return data.User{}, errors.New("invalid credentials")
+		return data.User{}, ErrInvalidCredentials
 	}
 	if user.Status == 0 {
 		return data.User{}, errors.New("account disabled")
@@ -286,11 +335,23 @@ func (s *Service) UpdateStatus(ctx context.Context, actor data.User, userID uint
 	if target.IsSuperAdmin {
 		return ErrSuperAdminImmutable
 	}
+	if err := GuardFullAdminTarget(actor, target); err != nil {
+		return err
+	}
 	return s.db.WithContext(ctx).Model(&data.User{}).
 		Where("id = ?", userID).
 		Update("status", status).Error
 }
 
+// GuardFullAdminTarget 禁止分配了角色的管理员修改不受角色限制的管理员，
+// 否则仅有用户管理权限的管理员即可禁用、删除或接管完整管理员。
+func GuardFullAdminTarget(actor, target data.User) error {
+	if !actor.HasFullAdmin() && target.HasFullAdmin() {
+		return ErrFullAdminTarget
+	}
+	return nil
+}
+
 func (s *Service) ToggleAdmin(ctx context.Context, actor data.User, userID uint, isAdmin bool) error {
 	if !actor.IsAdmin {
 		return errors.New("admin required")
@@ -298,6 +359,10 @@ func (s *Service) ToggleAdmin(ctx context.Context, actor data.User, userID uint,
 	if actor.ID == userID {
 		return errors.New("cannot change your own role")
 	}
+	// 该接口授予的是完整管理员权限，分配了角色的管理员无权调用
+	if !actor.HasFullAdmin() {
+		return ErrFullAdminRequired
+	}
 	target, err := s.FindByID(ctx, userID)
 	if err != nil {
 		return err
@@ -305,9 +370,10 @@ func (s *Service) ToggleAdmin(ctx context.Context, actor data.User, userID uint,
 	if target.IsSuperAdmin {
 		return ErrSuperAdminImmutable
 	}
+	// 通过该接口授予或撤销的都是完整管理员权限，清除已分配的角色
 	return s.db.WithContext(ctx).Model(&data.User{}).
 		Where("id = ?", userID).
-		Update("is_adminer", isAdmin).Error
+		Updates(map[string]interface{}{"is_adminer": isAdmin, "admin_role_id": nil}).Error
 }
 
 func (s *Service) CreateUser(ctx context.Context, actor data.User, input CreateUserInput) (data.User, error) {
@@ -332,6 +398,9 @@ func (s *Service) CreateUser(ctx context.Context, actor data.User, input CreateU
 	if role != "admin" && role != "user" {
 		return data.User{}, errors.New("role must be admin or user")
 	}
+	if role == "admin" && !actor.HasFullAdmin() {
+		return data.User{}, ErrFullAdminRequired
+	}
 	hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return data.User{}, err
@@ -369,6 +438,9 @@ func (s *Service) DeleteUser(ctx context.Context, actor data.User, userID uint)
 		if user.IsSuperAdmin {
 			return ErrSuperAdminImmutable
 		}
+		if err := GuardFullAdminTarget(actor, user); err != nil {
+			return err
+		}
 		var assets []data.FileAsset
 		if err := tx.Where("user_id = ?", user.ID).Find(&assets).Error; err != nil {
 			return err
@@ -542,6 +614,9 @@ func (s *Service) AssignGroup(ctx context.Context, actor data.User, userID uint,
 	if err != nil {
 		return data.User{}, err
 	}
+	if err := GuardFullAdminTarget(actor, target); err != nil {
+		return data.User{}, err
+	}
 	var group *data.Group
 	if groupID != nil {
 		var g data.Group
@@ -621,6 +696,19 @@ func (s *Service) hydrateUser(ctx context.Context, user *data.User) error {
 		total = 0
 	}
 	user.Capacity = total
+
+	var role *data.AdminRole
+	if user.IsAdmin && user.AdminRoleID != nil {
+		var loaded data.AdminRole
+		if err := s.db.WithContext(ctx).First(&loaded, *user.AdminRoleID).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		} else {
+			role = &loaded
+		}
+	}
+	user.Permissions = user.EffectivePermissions(role)
 	return nil
 }
 
@@ -675,13 +763,16 @@ func (s *Service) AdjustCapacityBonus(ctx context.Context, actor data.User, user
 	if !actor.IsAdmin {
 		return data.User{}, errors.New("admin required")
 	}
-	if deltaBytes == 0 {
-		return s.FindByID(ctx, userID)
-	}
 	target, err := s.FindByID(ctx, userID)
 	if err != nil {
 		return data.User{}, err
 	}
+	if err := GuardFullAdminTarget(actor, target); err != nil {
+		return data.User{}, err
+	}
+	if deltaBytes == 0 {
+		return target, nil
+	}
 	if err := s.db.WithContext(ctx).Model(&data.User{}).
 		Where("id = ?", userID).
 		UpdateColumn("capacity_bonus", gorm.Expr("capacity_bonus + ?", deltaBytes)).Error; err != nil {
@@ -695,7 +786,11 @@ func (s *Service) SetCapacityBonus(ctx context.Context, actor data.User, userID
 	if !actor.IsAdmin {
 		return data.User{}, errors.New("admin required")
 	}
-	if _, err := s.FindByID(ctx, userID); err != nil {
+	target, err := s.FindByID(ctx, userID)
+	if err != nil {
+		return data.User{}, err
+	}
+	if err := GuardFullAdminTarget(actor, target); err != nil {
 		return data.User{}, err
 	}
 	if err := s.db.WithContext(ctx).Model(&data.User{}).
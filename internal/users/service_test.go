@@ -146,3 +146,88 @@ func TestRegister_ReturnsUserAlreadyExistsOnDuplicateEmail(t *testing.T) {
 		t.Fatalf("expected ErrUserAlreadyExists, got %v", err)
 	}
 }
+
+func TestScopedAdminCannotGrantFullAdmin(t *testing.T) {
+	db := setupTestDB(t)
+	service := New(db)
+	ctx := context.Background()
+
+	roleID := uint(7)
+	scoped := data.User{ID: 1, IsAdmin: true, AdminRoleID: &roleID, Permissions: []string{data.AdminPermUsers, data.AdminPermRoles}}
+	target := data.User{Name: "target", Email: "target@example.com", PasswordHash: "x", Status: 1, Configs: datatypes.JSON([]byte(`{}`))}
+	if err := CreateUserWithGeneratedID(db, &target); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	if err := service.ToggleAdmin(ctx, scoped, target.ID, true); !errors.Is(err, ErrFullAdminRequired) {
+		t.Fatalf("expected ErrFullAdminRequired from ToggleAdmin, got %v", err)
+	}
+	input := CreateUserInput{Name: "new", Email: "new@example.com", Password: "Password123", Role: "admin"}
+	if _, err := service.CreateUser(ctx, scoped, input); !errors.Is(err, ErrFullAdminRequired) {
+		t.Fatalf("expected ErrFullAdminRequired from CreateUser, got %v", err)
+	}
+	input.Role = "user"
+	if _, err := service.CreateUser(ctx, scoped, input); err != nil {
+		t.Fatalf("scoped admin should still create regular users: %v", err)
+	}
+
+	full := data.User{ID: 2, IsAdmin: true}
+	if err := service.ToggleAdmin(ctx, full, target.ID, true); err != nil {
+		t.Fatalf("full admin toggle: %v", err)
+	}
+}
+
+func TestScopedAdminCannotModifyFullAdmin(t *testing.T) {
+	db := setupTestDB(t)
+	service := New(db)
+	ctx := context.Background()
+
+	roleID := uint(7)
+	scoped := data.User{ID: 1, IsAdmin: true, AdminRoleID: &roleID, Permissions: []string{data.AdminPermUsers}}
+	fullAdmin := data.User{Name: "admin", Email: "admin@example.com", PasswordHash: "x", Status: 1, IsAdmin: true, Configs: datatypes.JSON([]byte(`{}`))}
+	if err := CreateUserWithGeneratedID(db, &fullAdmin); err != nil {
+		t.Fatalf("failed to create admin: %v", err)
+	}
+	regular := data.User{Name: "user", Email: "user@example.com", PasswordHash: "x", Status: 1, Configs: datatypes.JSON([]byte(`{}`))}
+	if err := CreateUserWithGeneratedID(db, &regular); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	t.Run("UpdateStatus", func(t *testing.T) {
+		if err := service.UpdateStatus(ctx, scoped, fullAdmin.ID, 0); !errors.Is(err, ErrFullAdminTarget) {
+			t.Fatalf("expected ErrFullAdminTarget, got %v", err)
+		}
+		if err := service.UpdateStatus(ctx, scoped, regular.ID, 1); err != nil {
+			t.Fatalf("scoped admin should still manage regular users: %v", err)
+		}
+	})
+	t.Run("DeleteUser", func(t *testing.T) {
+		if err := service.DeleteUser(ctx, scoped, fullAdmin.ID); !errors.Is(err, ErrFullAdminTarget) {
+			t.Fatalf("expected ErrFullAdminTarget, got %v", err)
+		}
+	})
+	t.Run("AssignGroup", func(t *testing.T) {
+		if _, err := service.AssignGroup(ctx, scoped, fullAdmin.ID, nil); !errors.Is(err, ErrFullAdminTarget) {
+			t.Fatalf("expected ErrFullAdminTarget, got %v", err)
+		}
+		if _, err := service.AssignGroup(ctx, scoped, regular.ID, nil); err != nil {
+			t.Fatalf("scoped admin should still re-group regular users: %v", err)
+		}
+	})
+	t.Run("AdjustCapacityBonus", func(t *testing.T) {
+		if _, err := service.AdjustCapacityBonus(ctx, scoped, fullAdmin.ID, 1024); !errors.Is(err, ErrFullAdminTarget) {
+			t.Fatalf("expected ErrFullAdminTarget, got %v", err)
+		}
+		if _, err := service.SetCapacityBonus(ctx, scoped, fullAdmin.ID, 1024); !errors.Is(err, ErrFullAdminTarget) {
+			t.Fatalf("expected ErrFullAdminTarget from SetCapacityBonus, got %v", err)
+		}
+	})
+
+	var stored data.User
+	if err := db.First(&stored, fullAdmin.ID).Error; err != nil {
+		t.Fatalf("full admin must not be deleted: %v", err)
+	}
+	if stored.Status != 1 || stored.CapacityBonus != 0 {
+		t.Fatalf("full admin must be left untouched, got status=%d bonus=%v", stored.Status, stored.CapacityBonus)
+	}
+}
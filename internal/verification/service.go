@@ -2,34 +2,76 @@ package verification
 
 import (
 	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
 	"math/big"
+	"strings"
 	"sync"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"skyimage/internal/data"
+)
+
+const (
+	purposeRegister      = "register"
+	purposePasswordReset = "password_reset"
+
+	codeTTL          = 5 * time.Minute
+	passwordResetTTL = 15 * time.Minute
+	// ResendInterval 同一邮箱两次发送之间的最短间隔
+	ResendInterval = time.Minute
+	maxAttempts    = 5
 )
 
+// ThrottleError 表示同一邮箱请求过于频繁，RetryAfter 为需要等待的时间。
+type ThrottleError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	return "该邮箱请求过于频繁，请稍后再试"
+}
+
+// Service 将验证码与密码重置请求保存在数据库中，多实例部署和重启后依然有效。
 type Service struct {
-	codes          sync.Map // key: email, value: *CodeEntry
-	passwordResets sync.Map // key: token, value: *PasswordResetEntry
+	mu          sync.Mutex
+	db          *gorm.DB
+	secretKey   []byte
+	stopCleanup chan struct{}
 }
 
-type CodeEntry struct {
-	Code      string
-	ExpiresAt time.Time
-	Attempts  int
+// New 创建验证码服务，secretKey 用于对邮箱、重置令牌与验证码做 HMAC，
+// 避免数据库泄露后直接穷举 6 位验证码。
+func New(db *gorm.DB, secretKey []byte) *Service {
+	s := &Service{
+		db:          db,
+		secretKey:   secretKey,
+		stopCleanup: make(chan struct{}),
+	}
+	go s.cleanupLoop()
+	return s
 }
 
-type PasswordResetEntry struct {
-	Email     string
-	Code      string
-	Token     string
-	ExpiresAt time.Time
-	Attempts  int
+// SetDB updates the database handle after a runtime database switch.
+func (s *Service) SetDB(db *gorm.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db = db
 }
 
-func New() *Service {
-	return &Service{}
+func (s *Service) handle() *gorm.DB {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db
 }
 
 // GenerateCode 生成6位数字验证码
@@ -42,125 +84,213 @@ func (s *Service) GenerateCode() string {
 	return code
 }
 
-// StoreCode 存储验证码，有效期5分钟
-func (s *Service) StoreCode(email, code string) {
-	s.codes.Store(email, &CodeEntry{
-		Code:      code,
-		ExpiresAt: time.Now().Add(5 * time.Minute),
-		Attempts:  0,
+// StoreCode 存储注册验证码，有效期5分钟；同一邮箱在 ResendInterval 内重复请求返回 *ThrottleError。
+func (s *Service) StoreCode(ctx context.Context, email, code string) error {
+	db := s.handle()
+	if db == nil {
+		return gorm.ErrInvalidDB
+	}
+	email = normalizeEmail(email)
+	now := time.Now()
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing data.VerificationCode
+		err := tx.Where("purpose = ? AND lookup_key = ?", purposeRegister, s.hashValue(email)).First(&existing).Error
+		switch {
+		case err == nil:
+			if wait := existing.LastSentAt.Add(ResendInterval).Sub(now); wait > 0 && now.Before(existing.ExpiresAt) {
+				return &ThrottleError{RetryAfter: wait}
+			}
+			if err := tx.Delete(&data.VerificationCode{}, existing.ID).Error; err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+		entry := data.VerificationCode{
+			Purpose:    purposeRegister,
+			Key:        s.hashValue(email),
+			Email:      email,
+			CodeHash:   s.hashValue(code),
+			LastSentAt: now,
+			ExpiresAt:  now.Add(codeTTL),
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// 另一个实例同时写入了同一邮箱的验证码
+			return &ThrottleError{RetryAfter: ResendInterval}
+		}
+		return nil
 	})
 }
 
 // VerifyCode 验证验证码
-func (s *Service) VerifyCode(email, code string) (bool, error) {
-	value, ok := s.codes.Load(email)
-	if !ok {
+func (s *Service) VerifyCode(ctx context.Context, email, code string) (bool, error) {
+	db := s.handle()
+	if db == nil {
+		return false, gorm.ErrInvalidDB
+	}
+	email = normalizeEmail(email)
+	var entry data.VerificationCode
+	if err := db.WithContext(ctx).
+		Where("purpose = ? AND lookup_key = ?", purposeRegister, s.hashValue(email)).
+		First(&entry).Error; err != nil {
 		return false, fmt.Errorf("验证码不存在或已过期")
 	}
-
-	entry := value.(*CodeEntry)
-
 	// 检查是否过期
 	if time.Now().After(entry.ExpiresAt) {
-		s.codes.Delete(email)
+		s.remove(ctx, db, entry.ID)
 		return false, fmt.Errorf("验证码已过期")
 	}
-
-	// 检查尝试次数
-	if entry.Attempts >= 5 {
-		s.codes.Delete(email)
-		return false, fmt.Errorf("验证码尝试次数过多")
+	if err := s.consumeAttempt(ctx, db, entry); err != nil {
+		return false, err
 	}
-
-	entry.Attempts++
-
 	// 验证码错误
-	if entry.Code != code {
+	if !s.matchHash(entry.CodeHash, code) {
 		return false, fmt.Errorf("验证码错误")
 	}
-
-	// 验证成功，删除验证码
-	s.codes.Delete(email)
+	// 验证成功，删除验证码（并发请求只有一个能删除成功）
+	if !s.remove(ctx, db, entry.ID) {
+		return false, fmt.Errorf("验证码不存在或已过期")
+	}
 	return true, nil
 }
 
-// StorePasswordReset stores one password-reset token and code pair.
-func (s *Service) StorePasswordReset(email, token, code string) {
-	s.passwordResets.Store(token, &PasswordResetEntry{
-		Email:     email,
-		Code:      code,
-		Token:     token,
-		ExpiresAt: time.Now().Add(15 * time.Minute),
-		Attempts:  0,
+// StorePasswordReset stores one password-reset token and code pair and drops older
+// requests for the same email. Returns *ThrottleError when resent too quickly.
+func (s *Service) StorePasswordReset(ctx context.Context, email, token, code string) error {
+	db := s.handle()
+	if db == nil {
+		return gorm.ErrInvalidDB
+	}
+	email = normalizeEmail(email)
+	now := time.Now()
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var latest data.VerificationCode
+		err := tx.Where("purpose = ? AND email = ? AND expires_at > ?", purposePasswordReset, email, now).
+			Order("last_sent_at desc").
+			First(&latest).Error
+		if err == nil {
+			if wait := latest.LastSentAt.Add(ResendInterval).Sub(now); wait > 0 {
+				return &ThrottleError{RetryAfter: wait}
+			}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := tx.Where("purpose = ? AND email = ?", purposePasswordReset, email).
+			Delete(&data.VerificationCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&data.VerificationCode{
+			Purpose:    purposePasswordReset,
+			Key:        s.hashValue(token),
+			Email:      email,
+			CodeHash:   s.hashValue(code),
+			LastSentAt: now,
+			ExpiresAt:  now.Add(passwordResetTTL),
+		}).Error
 	})
 }
 
 // IsPasswordResetTokenValid checks whether the token exists and is not expired.
-func (s *Service) IsPasswordResetTokenValid(token string) bool {
-	value, ok := s.passwordResets.Load(token)
-	if !ok {
+func (s *Service) IsPasswordResetTokenValid(ctx context.Context, token string) bool {
+	db := s.handle()
+	if db == nil || strings.TrimSpace(token) == "" {
 		return false
 	}
-	entry := value.(*PasswordResetEntry)
-	if time.Now().After(entry.ExpiresAt) {
-		s.passwordResets.Delete(token)
+	var count int64
+	if err := db.WithContext(ctx).Model(&data.VerificationCode{}).
+		Where("purpose = ? AND lookup_key = ? AND expires_at > ? AND attempts < ?", purposePasswordReset, s.hashValue(token), time.Now(), maxAttempts).
+		Count(&count).Error; err != nil {
 		return false
 	}
-	return true
+	return count > 0
 }
 
 // VerifyPasswordReset validates token/code, consumes it on success, and returns bound email.
-func (s *Service) VerifyPasswordReset(token, code string) (string, error) {
-	value, ok := s.passwordResets.Load(token)
-	if !ok {
+func (s *Service) VerifyPasswordReset(ctx context.Context, token, code string) (string, error) {
+	db := s.handle()
+	if db == nil {
+		return "", gorm.ErrInvalidDB
+	}
+	var entry data.VerificationCode
+	if err := db.WithContext(ctx).
+		Where("purpose = ? AND lookup_key = ?", purposePasswordReset, s.hashValue(token)).
+		First(&entry).Error; err != nil {
 		return "", fmt.Errorf("重置链接无效或已过期")
 	}
-	entry := value.(*PasswordResetEntry)
 	if time.Now().After(entry.ExpiresAt) {
-		s.passwordResets.Delete(token)
+		s.remove(ctx, db, entry.ID)
 		return "", fmt.Errorf("重置链接已过期")
 	}
-	if entry.Attempts >= 5 {
-		s.passwordResets.Delete(token)
-		return "", fmt.Errorf("验证码尝试次数过多")
-	}
-	if entry.Token != token {
-		s.passwordResets.Delete(token)
-		return "", fmt.Errorf("重置请求不匹配")
+	if err := s.consumeAttempt(ctx, db, entry); err != nil {
+		return "", err
 	}
-	entry.Attempts++
-	if entry.Code != code {
+	if !s.matchHash(entry.CodeHash, code) {
 		return "", fmt.Errorf("验证码错误")
 	}
-	s.passwordResets.Delete(token)
+	if !s.remove(ctx, db, entry.ID) {
+		return "", fmt.Errorf("重置链接无效或已过期")
+	}
 	return entry.Email, nil
 }
 
-// CleanExpired 清理过期的验证码（定期调用）
-func (s *Service) CleanExpired(ctx context.Context) {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
+// CleanExpired 删除已过期的验证码与重置请求。
+func (s *Service) CleanExpired(ctx context.Context) error {
+	db := s.handle()
+	if db == nil {
+		return nil
+	}
+	return db.WithContext(ctx).Delete(&data.VerificationCode{}, "expires_at < ?", time.Now()).Error
+}
+
+// consumeAttempt 原子地增加尝试次数，超过上限时删除记录。
+func (s *Service) consumeAttempt(ctx context.Context, db *gorm.DB, entry data.VerificationCode) error {
+	result := db.WithContext(ctx).Model(&data.VerificationCode{}).
+		Where("id = ? AND attempts < ?", entry.ID, maxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		s.remove(ctx, db, entry.ID)
+		return fmt.Errorf("验证码尝试次数过多")
+	}
+	return nil
+}
 
+func (s *Service) remove(ctx context.Context, db *gorm.DB, id uint) bool {
+	result := db.WithContext(ctx).Delete(&data.VerificationCode{}, id)
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+func (s *Service) cleanupLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
 	for {
 		select {
-		case <-ctx.Done():
+		case <-s.stopCleanup:
 			return
 		case <-ticker.C:
-			now := time.Now()
-			s.codes.Range(func(key, value interface{}) bool {
-				entry := value.(*CodeEntry)
-				if now.After(entry.ExpiresAt) {
-					s.codes.Delete(key)
-				}
-				return true
-			})
-			s.passwordResets.Range(func(key, value interface{}) bool {
-				entry := value.(*PasswordResetEntry)
-				if now.After(entry.ExpiresAt) {
-					s.passwordResets.Delete(key)
-				}
-				return true
-			})
+			if err := s.CleanExpired(context.Background()); err != nil {
+				log.Printf("[verification] cleanup failed: %v", err)
+			}
 		}
 	}
 }
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func (s *Service) hashValue(value string) string {
+	mac := hmac.New(sha256.New, s.secretKey)
+	mac.Write([]byte(strings.TrimSpace(value)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Service) matchHash(expected, code string) bool {
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(s.hashValue(code))) == 1
+}
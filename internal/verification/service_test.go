@@ -0,0 +1,167 @@
+package verification
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+func newTestService(t *testing.T) (*Service, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&data.VerificationCode{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return New(db, []byte("test-secret")), db
+}
+
+func TestStoreCode_SharedAcrossInstances(t *testing.T) {
+	first, db := newTestService(t)
+	ctx := context.Background()
+	if err := first.StoreCode(ctx, "User@Example.com", "123456"); err != nil {
+		t.Fatalf("store code: %v", err)
+	}
+	// 另一个实例使用同一数据库校验
+	second := New(db, []byte("test-secret"))
+	if ok, err := second.VerifyCode(ctx, "user@example.com", "000000"); ok || err == nil {
+		t.Fatalf("expected wrong code to fail")
+	}
+	if ok, err := second.VerifyCode(ctx, "user@example.com", "123456"); !ok || err != nil {
+		t.Fatalf("expected code to verify, got %v %v", ok, err)
+	}
+	if ok, _ := first.VerifyCode(ctx, "user@example.com", "123456"); ok {
+		t.Fatalf("code should be single-use")
+	}
+}
+
+func TestStoreCode_ThrottlesResend(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := context.Background()
+	if err := svc.StoreCode(ctx, "a@example.com", "111111"); err != nil {
+		t.Fatalf("store code: %v", err)
+	}
+	err := svc.StoreCode(ctx, "a@example.com", "222222")
+	var throttled *ThrottleError
+	if !errors.As(err, &throttled) || throttled.RetryAfter <= 0 {
+		t.Fatalf("expected throttle error, got %v", err)
+	}
+	// 超过重发间隔后允许重新发送，旧验证码失效
+	if err := db.Model(&data.VerificationCode{}).Where("email = ?", "a@example.com").
+		Update("last_sent_at", time.Now().Add(-2*ResendInterval)).Error; err != nil {
+		t.Fatalf("age entry: %v", err)
+	}
+	if err := svc.StoreCode(ctx, "a@example.com", "333333"); err != nil {
+		t.Fatalf("resend after interval: %v", err)
+	}
+	if ok, _ := svc.VerifyCode(ctx, "a@example.com", "111111"); ok {
+		t.Fatalf("old code should be replaced")
+	}
+}
+
+func TestVerifyCode_LimitsAttempts(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	if err := svc.StoreCode(ctx, "b@example.com", "123456"); err != nil {
+		t.Fatalf("store code: %v", err)
+	}
+	for i := 0; i < maxAttempts; i++ {
+		if ok, _ := svc.VerifyCode(ctx, "b@example.com", "000000"); ok {
+			t.Fatalf("wrong code accepted")
+		}
+	}
+	if ok, _ := svc.VerifyCode(ctx, "b@example.com", "123456"); ok {
+		t.Fatalf("expected code to be locked after too many attempts")
+	}
+}
+
+func TestPasswordReset_Lifecycle(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := context.Background()
+	if err := svc.StorePasswordReset(ctx, "c@example.com", "token-1", "654321"); err != nil {
+		t.Fatalf("store reset: %v", err)
+	}
+	var stored data.VerificationCode
+	if err := db.First(&stored).Error; err != nil {
+		t.Fatalf("load reset: %v", err)
+	}
+	if stored.Key == "token-1" || stored.CodeHash == "654321" {
+		t.Fatalf("token and code must be stored hashed")
+	}
+	if !svc.IsPasswordResetTokenValid(ctx, "token-1") {
+		t.Fatalf("expected token to be valid")
+	}
+	email, err := svc.VerifyPasswordReset(ctx, "token-1", "654321")
+	if err != nil || email != "c@example.com" {
+		t.Fatalf("expected reset to verify, got %q %v", email, err)
+	}
+	if svc.IsPasswordResetTokenValid(ctx, "token-1") {
+		t.Fatalf("token should be consumed")
+	}
+
+	if err := db.Model(&data.VerificationCode{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("expire entries: %v", err)
+	}
+	if err := svc.StorePasswordReset(ctx, "c@example.com", "token-2", "111111"); err != nil {
+		t.Fatalf("store second reset: %v", err)
+	}
+	if err := db.Model(&data.VerificationCode{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("expire entries: %v", err)
+	}
+	if err := svc.CleanExpired(ctx); err != nil {
+		t.Fatalf("clean expired: %v", err)
+	}
+	var count int64
+	db.Model(&data.VerificationCode{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected expired entries to be removed, got %d", count)
+	}
+}
+
+func TestStoreCode_HashesWithSecretKey(t *testing.T) {
+	svc, db := newTestService(t)
+	ctx := context.Background()
+	if err := svc.StoreCode(ctx, "d@example.com", "123456"); err != nil {
+		t.Fatalf("store code: %v", err)
+	}
+	var stored data.VerificationCode
+	if err := db.First(&stored).Error; err != nil {
+		t.Fatalf("load code: %v", err)
+	}
+	plain := sha256.Sum256([]byte("123456"))
+	if stored.CodeHash == hex.EncodeToString(plain[:]) {
+		t.Fatalf("code must not be stored as an unkeyed sha256")
+	}
+	other := New(db, []byte("other-secret"))
+	if ok, _ := other.VerifyCode(ctx, "d@example.com", "123456"); ok {
+		t.Fatalf("a different secret key must not verify the code")
+	}
+	if ok, err := svc.VerifyCode(ctx, "d@example.com", "123456"); !ok || err != nil {
+		t.Fatalf("expected code to verify with the original key, got %v %v", ok, err)
+	}
+}
+
+func TestStoreCode_ReturnsDatabaseErrors(t *testing.T) {
+	svc, db := newTestService(t)
+	failure := errors.New("disk full")
+	if err := db.Callback().Create().Before("gorm:create").Register("test:fail_create", func(tx *gorm.DB) {
+		_ = tx.AddError(failure)
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	err := svc.StoreCode(context.Background(), "e@example.com", "123456")
+	var throttled *ThrottleError
+	if errors.As(err, &throttled) || !errors.Is(err, failure) {
+		t.Fatalf("expected the database error to be returned, got %v", err)
+	}
+}
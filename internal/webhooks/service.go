@@ -0,0 +1,693 @@
+// Package webhooks 将站内事件以 HMAC 签名的 HTTP 请求推送到用户或管理员配置的地址，
+// 每次投递都会持久化，失败后按指数退避重试，并支持手动重新投递。
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+	"skyimage/internal/netguard"
+)
+
+const (
+	EventFileUploaded          = "file.uploaded"
+	EventFileDeleted           = "file.deleted"
+	EventFileVisibilityChanged = "file.visibility_changed"
+	EventAuditCompleted        = "audit.completed"
+	EventUserRegistered        = "user.registered"
+	EventOrderPaid             = "order.paid"
+	EventTicketCreated         = "ticket.created"
+	EventTicketReplied         = "ticket.replied"
+
+	ScopeUser  = "user"
+	ScopeAdmin = "admin"
+
+	HeaderEvent     = "X-Skyimage-Event"
+	HeaderDelivery  = "X-Skyimage-Delivery"
+	HeaderTimestamp = "X-Skyimage-Timestamp"
+	HeaderSignature = "X-Skyimage-Signature"
+
+	// MaxAttempts 自动投递的最大尝试次数，之后标记为 failed
+	MaxAttempts = 8
+	// MaxWebhooksPerUser 每个用户（或管理员范围）最多可创建的 Webhook 数
+	MaxWebhooksPerUser = 20
+
+	baseRetryDelay   = 30 * time.Second
+	maxRetryDelay    = 6 * time.Hour
+	requestTimeout   = 10 * time.Second
+	claimLease       = 2 * time.Minute
+	pollInterval     = 15 * time.Second
+	deliveryBatch    = 20
+	deliveryRetained = 30 * 24 * time.Hour
+	maxResponseBody  = 1024
+)
+
+var (
+	ErrNotFound      = errors.New("webhook not found")
+	ErrInvalidURL    = errors.New("invalid webhook url")
+	ErrInvalidEvents = errors.New("invalid webhook events")
+	ErrTooMany       = errors.New("too many webhooks")
+)
+
+// AllEvents 返回管理员可订阅的全部事件。
+func AllEvents() []string {
+	return []string{
+		EventFileUploaded,
+		EventFileDeleted,
+		EventFileVisibilityChanged,
+		EventAuditCompleted,
+		EventUserRegistered,
+		EventOrderPaid,
+		EventTicketCreated,
+		EventTicketReplied,
+	}
+}
+
+// UserEvents 返回普通用户可订阅的事件（不含全站注册事件）。
+func UserEvents() []string {
+	out := make([]string, 0, len(AllEvents()))
+	for _, event := range AllEvents() {
+		if event != EventUserRegistered {
+			out = append(out, event)
+		}
+	}
+	return out
+}
+
+// Input 是创建/更新 Webhook 的参数，更新时零值字段保持不变。
+type Input struct {
+	Name         string   `json:"name"`
+	URL          string   `json:"url"`
+	Events       []string `json:"events"`
+	Enabled      *bool    `json:"enabled"`
+	RotateSecret bool     `json:"rotateSecret"`
+}
+
+// envelope 是推送的请求体。
+type envelope struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+type Service struct {
+	mu          sync.Mutex
+	db          *gorm.DB
+	client      *http.Client
+	userClient  *http.Client
+	wake        chan struct{}
+	stopCleanup chan struct{}
+	lastPrune   time.Time
+}
+
+func New(db *gorm.DB) *Service {
+	s := &Service{
+		db:          db,
+		client:      newClient(false, false),
+		userClient:  newClient(false, true),
+		wake:        make(chan struct{}, 1),
+		stopCleanup: make(chan struct{}),
+	}
+	go s.deliveryLoop()
+	return s
+}
+
+// SetDB updates the database handle after a runtime database switch.
+func (s *Service) SetDB(db *gorm.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db = db
+}
+
+func (s *Service) handle() *gorm.DB {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db
+}
+
+// Emit 为订阅了 event 的 Webhook 创建投递记录：ownerID 的用户级订阅与全部管理员订阅。
+// 只写入数据库并唤醒投递协程，不会阻塞调用方等待对端响应。
+func (s *Service) Emit(ctx context.Context, event string, ownerID uint, payload interface{}) {
+	if s == nil {
+		return
+	}
+	db := s.handle()
+	if db == nil {
+		return
+	}
+	var hooks []data.Webhook
+	query := db.WithContext(ctx).Where("enabled = ?", true)
+	if ownerID > 0 && event != EventUserRegistered {
+		query = query.Where("scope = ? OR (scope = ? AND user_id = ?)", ScopeAdmin, ScopeUser, ownerID)
+	} else {
+		query = query.Where("scope = ?", ScopeAdmin)
+	}
+	if err := query.Find(&hooks).Error; err != nil {
+		log.Printf("[webhook] load subscriptions failed: %v", err)
+		return
+	}
+	var body []byte
+	eventID := ""
+	created := 0
+	for _, hook := range hooks {
+		if !hook.Subscribes(event) {
+			continue
+		}
+		if body == nil {
+			id, err := randomHex(16)
+			if err != nil {
+				log.Printf("[webhook] generate event id failed: %v", err)
+				return
+			}
+			eventID = "evt_" + id
+			body, err = json.Marshal(envelope{ID: eventID, Event: event, CreatedAt: time.Now().UTC(), Data: payload})
+			if err != nil {
+				log.Printf("[webhook] encode %s payload failed: %v", event, err)
+				return
+			}
+		}
+		now := time.Now()
+		delivery := data.WebhookDelivery{
+			WebhookID:     hook.ID,
+			EventID:       eventID,
+			Event:         event,
+			Payload:       body,
+			Status:        data.WebhookDeliveryPending,
+			NextAttemptAt: &now,
+		}
+		if err := db.WithContext(ctx).Create(&delivery).Error; err != nil {
+			log.Printf("[webhook] queue %s for webhook %d failed: %v", event, hook.ID, err)
+			continue
+		}
+		created++
+	}
+	if created > 0 {
+		s.kick()
+	}
+}
+
+// UserRegisteredPayload 构造 user.registered 事件数据，method 为 password 或 OAuth 提供方。
+func UserRegisteredPayload(user data.User, method string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           strconv.FormatUint(uint64(user.ID), 10),
+		"name":         user.Name,
+		"email":        user.Email,
+		"groupId":      user.GroupID,
+		"method":       method,
+		"registeredIp": user.RegisteredIP,
+		"createdAt":    user.CreatedAt,
+	}
+}
+
+// List 返回指定范围的 Webhook；scope=user 时只返回 userID 自己的。
+func (s *Service) List(ctx context.Context, scope string, userID uint) ([]data.Webhook, error) {
+	var items []data.Webhook
+	query := s.handle().WithContext(ctx).Where("scope = ?", scope)
+	if scope == ScopeUser {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.Order("id DESC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].EventList = items[i].EventNames()
+	}
+	return items, nil
+}
+
+// Get 按范围读取 Webhook，用户只能读取自己的订阅。
+func (s *Service) Get(ctx context.Context, scope string, userID, id uint) (data.Webhook, error) {
+	var item data.Webhook
+	query := s.handle().WithContext(ctx).Where("id = ? AND scope = ?", id, scope)
+	if scope == ScopeUser {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return item, ErrNotFound
+		}
+		return item, err
+	}
+	item.EventList = item.EventNames()
+	return item, nil
+}
+
+// Create 创建 Webhook 并返回签名密钥（密钥只在创建与轮换时返回一次）。
+func (s *Service) Create(ctx context.Context, scope string, userID uint, input Input) (data.Webhook, string, error) {
+	endpoint, err := normalizeScopedURL(scope, input.URL)
+	if err != nil {
+		return data.Webhook{}, "", err
+	}
+	events, err := normalizeEvents(scope, input.Events)
+	if err != nil {
+		return data.Webhook{}, "", err
+	}
+	db := s.handle()
+	var count int64
+	countQuery := db.WithContext(ctx).Model(&data.Webhook{}).Where("scope = ?", scope)
+	if scope == ScopeUser {
+		countQuery = countQuery.Where("user_id = ?", userID)
+	}
+	if err := countQuery.Count(&count).Error; err != nil {
+		return data.Webhook{}, "", err
+	}
+	if count >= MaxWebhooksPerUser {
+		return data.Webhook{}, "", ErrTooMany
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return data.Webhook{}, "", err
+	}
+	enabled := true
+	if input.Enabled != nil {
+		enabled = *input.Enabled
+	}
+	item := data.Webhook{
+		UserID:  userID,
+		Scope:   scope,
+		Name:    truncate(input.Name, 128),
+		URL:     endpoint,
+		Secret:  secret,
+		Events:  strings.Join(events, ","),
+		Enabled: enabled,
+	}
+	if err := db.WithContext(ctx).Create(&item).Error; err != nil {
+		return data.Webhook{}, "", err
+	}
+	item.EventList = events
+	return item, secret, nil
+}
+
+// Update 修改 Webhook；RotateSecret 为 true 时生成新密钥并返回。
+func (s *Service) Update(ctx context.Context, scope string, userID, id uint, input Input) (data.Webhook, string, error) {
+	item, err := s.Get(ctx, scope, userID, id)
+	if err != nil {
+		return data.Webhook{}, "", err
+	}
+	updates := map[string]interface{}{}
+	if strings.TrimSpace(input.URL) != "" {
+		endpoint, err := normalizeScopedURL(scope, input.URL)
+		if err != nil {
+			return data.Webhook{}, "", err
+		}
+		updates["url"] = endpoint
+	}
+	if input.Events != nil {
+		events, err := normalizeEvents(scope, input.Events)
+		if err != nil {
+			return data.Webhook{}, "", err
+		}
+		updates["events"] = strings.Join(events, ",")
+	}
+	if strings.TrimSpace(input.Name) != "" {
+		updates["name"] = truncate(input.Name, 128)
+	}
+	if input.Enabled != nil {
+		updates["enabled"] = *input.Enabled
+	}
+	secret := ""
+	if input.RotateSecret {
+		if secret, err = newSecret(); err != nil {
+			return data.Webhook{}, "", err
+		}
+		updates["secret"] = secret
+	}
+	if len(updates) > 0 {
+		if err := s.handle().WithContext(ctx).Model(&data.Webhook{}).Where("id = ?", item.ID).Updates(updates).Error; err != nil {
+			return data.Webhook{}, "", err
+		}
+	}
+	item, err = s.Get(ctx, scope, userID, id)
+	return item, secret, err
+}
+
+// Delete 删除 Webhook 及其投递记录。
+func (s *Service) Delete(ctx context.Context, scope string, userID, id uint) error {
+	item, err := s.Get(ctx, scope, userID, id)
+	if err != nil {
+		return err
+	}
+	return s.handle().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", item.ID).Delete(&data.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&data.Webhook{}, item.ID).Error
+	})
+}
+
+// ListDeliveries 按时间倒序返回某个 Webhook 的投递记录。
+func (s *Service) ListDeliveries(ctx context.Context, webhookID uint, limit, offset int) ([]data.WebhookDelivery, int64, error) {
+	query := s.handle().WithContext(ctx).Model(&data.WebhookDelivery{}).Where("webhook_id = ?", webhookID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var items []data.WebhookDelivery
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error
+	return items, total, err
+}
+
+// Redeliver 以原始请求体创建一条新的投递记录并立即排队发送。
+func (s *Service) Redeliver(ctx context.Context, webhookID, deliveryID uint) (data.WebhookDelivery, error) {
+	db := s.handle()
+	var original data.WebhookDelivery
+	if err := db.WithContext(ctx).Where("id = ? AND webhook_id = ?", deliveryID, webhookID).First(&original).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return data.WebhookDelivery{}, ErrNotFound
+		}
+		return data.WebhookDelivery{}, err
+	}
+	now := time.Now()
+	delivery := data.WebhookDelivery{
+		WebhookID:     original.WebhookID,
+		EventID:       original.EventID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        data.WebhookDeliveryPending,
+		NextAttemptAt: &now,
+	}
+	if err := db.WithContext(ctx).Create(&delivery).Error; err != nil {
+		return data.WebhookDelivery{}, err
+	}
+	s.kick()
+	return delivery, nil
+}
+
+func (s *Service) kick() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Service) deliveryLoop() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCleanup:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		s.processDue(context.Background())
+		if time.Since(s.lastPrune) > 6*time.Hour {
+			s.lastPrune = time.Now()
+			s.prune(context.Background())
+		}
+	}
+}
+
+// processDue 逐条认领并投递到期的记录。租约在发送前才获取，避免批量认领后
+// 排队发送的记录租约过期、被其他实例重复发送。
+func (s *Service) processDue(ctx context.Context) {
+	db := s.handle()
+	if db == nil {
+		return
+	}
+	for {
+		delivery, ok := s.claimNext(ctx, db)
+		if !ok {
+			return
+		}
+		s.attempt(ctx, db, delivery)
+	}
+}
+
+// claimNext 认领一条到期的记录，将 next_attempt_at 推迟 claimLease 作为租约。
+func (s *Service) claimNext(ctx context.Context, db *gorm.DB) (data.WebhookDelivery, bool) {
+	now := time.Now()
+	var due []data.WebhookDelivery
+	if err := db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", data.WebhookDeliveryPending, now).
+		Order("next_attempt_at ASC, id ASC").
+		Limit(deliveryBatch).
+		Find(&due).Error; err != nil {
+		log.Printf("[webhook] load due deliveries failed: %v", err)
+		return data.WebhookDelivery{}, false
+	}
+	for _, delivery := range due {
+		res := db.WithContext(ctx).Model(&data.WebhookDelivery{}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", delivery.ID, data.WebhookDeliveryPending, now).
+			Update("next_attempt_at", now.Add(claimLease))
+		if res.Error == nil && res.RowsAffected == 1 {
+			return delivery, true
+		}
+	}
+	return data.WebhookDelivery{}, false
+}
+
+func (s *Service) attempt(ctx context.Context, db *gorm.DB, delivery data.WebhookDelivery) {
+	var hook data.Webhook
+	if err := db.WithContext(ctx).First(&hook, delivery.WebhookID).Error; err != nil {
+		_ = db.WithContext(ctx).Model(&data.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+			"status":          data.WebhookDeliveryFailed,
+			"next_attempt_at": nil,
+			"last_error":      "webhook not found",
+		}).Error
+		return
+	}
+	status, body, err := s.send(ctx, hook, delivery)
+	if hook.Scope == ScopeUser {
+		// 用户级推送不回显响应内容，避免被用来读取目标服务的数据
+		body = ""
+	}
+	attempts := delivery.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts":        attempts,
+		"response_status": status,
+		"response_body":   truncate(body, maxResponseBody),
+		"last_error":      "",
+	}
+	if err == nil && status >= 200 && status < 300 {
+		now := time.Now()
+		updates["status"] = data.WebhookDeliverySuccess
+		updates["delivered_at"] = &now
+		updates["next_attempt_at"] = nil
+	} else {
+		if err != nil {
+			updates["last_error"] = truncate(err.Error(), 512)
+		} else {
+			updates["last_error"] = "unexpected status " + strconv.Itoa(status)
+		}
+		if attempts >= MaxAttempts {
+			updates["status"] = data.WebhookDeliveryFailed
+			updates["next_attempt_at"] = nil
+		} else {
+			updates["next_attempt_at"] = time.Now().Add(RetryDelay(attempts))
+		}
+	}
+	if err := db.WithContext(ctx).Model(&data.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		log.Printf("[webhook] update delivery %d failed: %v", delivery.ID, err)
+	}
+}
+
+func (s *Service) send(ctx context.Context, hook data.Webhook, delivery data.WebhookDelivery) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SkyImage-Webhook/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.EventID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, delivery.Payload))
+	client := s.client
+	if hook.Scope == ScopeUser {
+		client = s.userClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	return resp.StatusCode, string(raw), nil
+}
+
+func (s *Service) prune(ctx context.Context) {
+	db := s.handle()
+	if db == nil {
+		return
+	}
+	cutoff := time.Now().Add(-deliveryRetained)
+	res := db.WithContext(ctx).
+		Where("status <> ? AND created_at < ?", data.WebhookDeliveryPending, cutoff).
+		Delete(&data.WebhookDelivery{})
+	if res.Error != nil {
+		log.Printf("[webhook] prune deliveries failed: %v", res.Error)
+	} else if res.RowsAffected > 0 {
+		log.Printf("[webhook] pruned %d deliveries", res.RowsAffected)
+	}
+}
+
+// Sign 计算签名：sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))。
+// 接收方应校验时间戳在允许范围内，以防重放。
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// RetryDelay 返回第 attempts 次失败后的等待时间（30s 起按 2 倍递增，最长 6 小时）。
+func RetryDelay(attempts int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
+
+// NormalizeURL 校验推送地址：仅允许 http/https，拒绝 localhost 等明显的内网目标。
+// 实际连接时还会按解析出的 IP 再次校验（见 newClient）。
+func NormalizeURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return "", ErrInvalidURL
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") || host == "metadata.google.internal" {
+		return "", ErrInvalidURL
+	}
+	if ip := net.ParseIP(host); ip != nil && isBlockedIP(ip) {
+		return "", ErrInvalidURL
+	}
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+func normalizeEvents(scope string, events []string) ([]string, error) {
+	allowed := AllEvents()
+	if scope == ScopeUser {
+		allowed = UserEvents()
+	}
+	seen := make(map[string]struct{}, len(events))
+	out := make([]string, 0, len(events))
+	for _, event := range events {
+		event = strings.ToLower(strings.TrimSpace(event))
+		if event == "" {
+			continue
+		}
+		if !contains(allowed, event) {
+			return nil, ErrInvalidEvents
+		}
+		if _, ok := seen[event]; ok {
+			continue
+		}
+		seen[event] = struct{}{}
+		out = append(out, event)
+	}
+	if len(out) == 0 {
+		return nil, ErrInvalidEvents
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// normalizeScopedURL 在 NormalizeURL 的基础上拒绝用户级 Webhook 直接填写内网 IP。
+func normalizeScopedURL(scope, raw string) (string, error) {
+	endpoint, err := NormalizeURL(raw)
+	if err != nil || scope != ScopeUser {
+		return endpoint, err
+	}
+	u, _ := url.Parse(endpoint)
+	if ip := net.ParseIP(u.Hostname()); ip != nil && netguard.IsInternalIP(ip) {
+		return "", ErrInvalidURL
+	}
+	return endpoint, nil
+}
+
+// newClient 返回不跟随重定向、且拒绝连接回环/链路本地地址的 HTTP 客户端。
+// 管理员 Webhook 允许私有网段，便于推送到内网 CMS；blockPrivate 为 true 时
+// （用户级 Webhook）还会拒绝私有、ULA 与运营商级 NAT 网段。
+func newClient(allowLoopback, blockPrivate bool) *http.Client {
+	blocked := isBlockedIP
+	if blockPrivate {
+		blocked = func(ip net.IP) bool { return isBlockedIP(ip) || netguard.IsInternalIP(ip) }
+	}
+	dialer := netguard.NewDialer(5*time.Second, allowLoopback, blocked, errors.New("webhook target address is not allowed"))
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   requestTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isBlockedIP(ip net.IP) bool {
+	if ip == nil {
+		return true
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	// 100.100.100.200 (Alibaba Cloud metadata)
+	return ip.Equal(net.IPv4(100, 100, 100, 200))
+}
+
+func newSecret() (string, error) {
+	value, err := randomHex(24)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + value, nil
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func contains(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func truncate(value string, limit int) string {
+	value = strings.TrimSpace(value)
+	if len(value) <= limit {
+		return value
+	}
+	return value[:limit]
+}
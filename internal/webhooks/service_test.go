@@ -0,0 +1,265 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"skyimage/internal/data"
+)
+
+func setupTestService(t *testing.T) (*Service, *gorm.DB) {
+	t.Helper()
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&data.Webhook{}, &data.WebhookDelivery{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// 不启动后台投递协程，由测试直接调用 processDue
+	svc := &Service{
+		db:          db,
+		client:      newClient(true, false),
+		userClient:  newClient(true, true),
+		wake:        make(chan struct{}, 1),
+		stopCleanup: make(chan struct{}),
+	}
+	return svc, db
+}
+
+func createHook(t *testing.T, db *gorm.DB, hook data.Webhook) data.Webhook {
+	t.Helper()
+	hook.Enabled = true
+	if err := db.Create(&hook).Error; err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	return hook
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func TestEmit_DeliversSignedPayloadToMatchingSubscriptions(t *testing.T) {
+	svc, db := setupTestService(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var received []receivedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, receivedRequest{header: r.Header.Clone(), body: body})
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	owner := createHook(t, db, data.Webhook{UserID: 1000000000000001, Scope: ScopeUser, URL: server.URL, Secret: "owner-secret", Events: EventFileUploaded})
+	createHook(t, db, data.Webhook{UserID: 1000000000000002, Scope: ScopeUser, URL: server.URL, Secret: "other-secret", Events: EventFileUploaded})
+	createHook(t, db, data.Webhook{UserID: 1000000000000001, Scope: ScopeUser, URL: server.URL, Secret: "owner-secret", Events: EventFileDeleted})
+
+	svc.Emit(ctx, EventFileUploaded, 1000000000000001, map[string]interface{}{"id": 7})
+	svc.processDue(ctx)
+
+	if len(received) != 1 {
+		t.Fatalf("expected exactly one delivery, got %d", len(received))
+	}
+	req := received[0]
+	timestamp := req.header.Get(HeaderTimestamp)
+	if got, want := req.header.Get(HeaderSignature), Sign("owner-secret", timestamp, req.body); got != want {
+		t.Fatalf("signature mismatch: got %q want %q", got, want)
+	}
+	if req.header.Get(HeaderEvent) != EventFileUploaded {
+		t.Fatalf("unexpected event header %q", req.header.Get(HeaderEvent))
+	}
+	var body envelope
+	if err := json.Unmarshal(req.body, &body); err != nil || body.Event != EventFileUploaded || body.ID != req.header.Get(HeaderDelivery) {
+		t.Fatalf("unexpected body %s err=%v", req.body, err)
+	}
+
+	deliveries, total, err := svc.ListDeliveries(ctx, owner.ID, 10, 0)
+	if err != nil || total != 1 {
+		t.Fatalf("list deliveries: total=%d err=%v", total, err)
+	}
+	if d := deliveries[0]; d.Status != data.WebhookDeliverySuccess || d.Attempts != 1 || d.ResponseStatus != http.StatusNoContent || d.NextAttemptAt != nil {
+		t.Fatalf("unexpected delivery: %+v", d)
+	}
+}
+
+func TestProcessDue_RetriesWithBackoffAndRedeliver(t *testing.T) {
+	svc, db := setupTestService(t)
+	ctx := context.Background()
+
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	hook := createHook(t, db, data.Webhook{Scope: ScopeAdmin, URL: server.URL, Secret: "s", Events: EventOrderPaid})
+	svc.Emit(ctx, EventOrderPaid, 1000000000000001, map[string]interface{}{"orderNo": "A1"})
+	svc.processDue(ctx)
+
+	var delivery data.WebhookDelivery
+	if err := db.First(&delivery).Error; err != nil {
+		t.Fatalf("load delivery: %v", err)
+	}
+	if delivery.Status != data.WebhookDeliveryPending || delivery.Attempts != 1 || delivery.NextAttemptAt == nil {
+		t.Fatalf("expected pending retry, got %+v", delivery)
+	}
+	if wait := time.Until(*delivery.NextAttemptAt); wait < 25*time.Second || wait > 35*time.Second {
+		t.Fatalf("expected ~30s backoff, got %v", wait)
+	}
+	if RetryDelay(2) != time.Minute || RetryDelay(30) != maxRetryDelay {
+		t.Fatalf("unexpected backoff curve: %v %v", RetryDelay(2), RetryDelay(30))
+	}
+
+	// 最后一次尝试失败后标记为 failed
+	past := time.Now().Add(-time.Second)
+	db.Model(&data.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{"attempts": MaxAttempts - 1, "next_attempt_at": past})
+	svc.processDue(ctx)
+	var failed data.WebhookDelivery
+	db.First(&failed, delivery.ID)
+	if failed.Status != data.WebhookDeliveryFailed || failed.Attempts != MaxAttempts || failed.NextAttemptAt != nil {
+		t.Fatalf("expected failed delivery, got %+v", failed)
+	}
+
+	status = http.StatusOK
+	redelivery, err := svc.Redeliver(ctx, hook.ID, delivery.ID)
+	if err != nil {
+		t.Fatalf("redeliver: %v", err)
+	}
+	if redelivery.ID == delivery.ID || redelivery.EventID != delivery.EventID {
+		t.Fatalf("redelivery should be a new attempt of the same event: %+v", redelivery)
+	}
+	svc.processDue(ctx)
+	var delivered data.WebhookDelivery
+	db.First(&delivered, redelivery.ID)
+	if delivered.Status != data.WebhookDeliverySuccess || delivered.DeliveredAt == nil {
+		t.Fatalf("expected redelivery success, got %+v", delivered)
+	}
+	if _, err := svc.Redeliver(ctx, hook.ID+1, delivery.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found for foreign webhook, got %v", err)
+	}
+}
+
+func TestCreate_ValidatesURLAndEvents(t *testing.T) {
+	svc, _ := setupTestService(t)
+	ctx := context.Background()
+
+	for _, raw := range []string{"ftp://example.com/hook", "http://localhost:8080/hook", "http://127.0.0.1/hook", "http://169.254.169.254/latest"} {
+		if _, _, err := svc.Create(ctx, ScopeUser, 1000000000000001, Input{URL: raw, Events: []string{EventFileUploaded}}); !errors.Is(err, ErrInvalidURL) {
+			t.Fatalf("expected invalid url for %s, got %v", raw, err)
+		}
+	}
+	// 用户级 Webhook 不能指向私有、ULA 或运营商级 NAT 地址，管理员仍可推送到内网
+	for _, raw := range []string{"http://10.0.0.5/hook", "http://192.168.1.1/hook", "http://[fd00::1]/hook", "http://100.64.0.1/hook"} {
+		if _, _, err := svc.Create(ctx, ScopeUser, 1000000000000001, Input{URL: raw, Events: []string{EventFileUploaded}}); !errors.Is(err, ErrInvalidURL) {
+			t.Fatalf("expected invalid url for user webhook %s, got %v", raw, err)
+		}
+	}
+	if _, _, err := svc.Create(ctx, ScopeAdmin, 0, Input{URL: "http://10.0.0.5/hook", Events: []string{EventFileUploaded}}); err != nil {
+		t.Fatalf("admin webhooks may target private networks: %v", err)
+	}
+	if _, _, err := svc.Create(ctx, ScopeUser, 1000000000000001, Input{URL: "https://example.com/hook", Events: []string{EventUserRegistered}}); !errors.Is(err, ErrInvalidEvents) {
+		t.Fatalf("users must not subscribe to user.registered, got %v", err)
+	}
+
+	item, secret, err := svc.Create(ctx, ScopeUser, 1000000000000001, Input{URL: "https://example.com/hook", Events: []string{"FILE.UPLOADED", EventFileDeleted, EventFileUploaded}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if secret == "" || item.Secret != secret || len(item.EventList) != 2 {
+		t.Fatalf("unexpected webhook: %+v secret=%q", item, secret)
+	}
+	if _, err := svc.Get(ctx, ScopeUser, 1000000000000002, item.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("other users must not see the webhook, got %v", err)
+	}
+	_, rotated, err := svc.Update(ctx, ScopeUser, 1000000000000001, item.ID, Input{RotateSecret: true})
+	if err != nil || rotated == "" || rotated == secret {
+		t.Fatalf("rotate secret: %q err=%v", rotated, err)
+	}
+}
+
+func TestProcessDue_UserScopeHidesResponseAndBlocksPrivateDial(t *testing.T) {
+	svc, db := setupTestService(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("internal secret"))
+	}))
+	defer server.Close()
+
+	user := createHook(t, db, data.Webhook{UserID: 1000000000000001, Scope: ScopeUser, URL: server.URL, Secret: "u", Events: EventFileUploaded})
+	admin := createHook(t, db, data.Webhook{Scope: ScopeAdmin, URL: server.URL, Secret: "a", Events: EventFileUploaded})
+	svc.Emit(ctx, EventFileUploaded, 1000000000000001, map[string]interface{}{"id": 1})
+	svc.processDue(ctx)
+
+	var userDelivery, adminDelivery data.WebhookDelivery
+	db.Where("webhook_id = ?", user.ID).First(&userDelivery)
+	db.Where("webhook_id = ?", admin.ID).First(&adminDelivery)
+	if userDelivery.Status != data.WebhookDeliverySuccess || userDelivery.ResponseBody != "" {
+		t.Fatalf("user delivery must not store the response body: %+v", userDelivery)
+	}
+	if adminDelivery.ResponseBody != "internal secret" {
+		t.Fatalf("admin delivery should keep the response body, got %q", adminDelivery.ResponseBody)
+	}
+
+	// 绕过创建时的校验（如 DNS 解析到内网），连接时仍会被拒绝
+	blocked := newClient(false, true)
+	if _, err := blocked.Get("http://10.255.255.1:9/"); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("expected private address to be rejected at dial time, got %v", err)
+	}
+}
+
+func TestProcessDue_LeaseStartsWhenDeliveryIsSent(t *testing.T) {
+	svc, db := setupTestService(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var shortest time.Duration = claimLease
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var delivery data.WebhookDelivery
+		db.Where("event_id = ? AND status = ?", r.Header.Get(HeaderDelivery), data.WebhookDeliveryPending).First(&delivery)
+		mu.Lock()
+		if delivery.NextAttemptAt != nil {
+			if remaining := time.Until(*delivery.NextAttemptAt); remaining < shortest {
+				shortest = remaining
+			}
+		}
+		mu.Unlock()
+		// 模拟慢速对端：批量认领时后面的记录会在发送前耗掉一部分租约
+		time.Sleep(1200 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	createHook(t, db, data.Webhook{Scope: ScopeAdmin, URL: server.URL, Secret: "s", Events: EventOrderPaid})
+	for i := 0; i < 2; i++ {
+		svc.Emit(ctx, EventOrderPaid, 0, map[string]interface{}{"i": i})
+	}
+	svc.processDue(ctx)
+
+	var delivered int64
+	db.Model(&data.WebhookDelivery{}).Where("status = ?", data.WebhookDeliverySuccess).Count(&delivered)
+	if delivered != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", delivered)
+	}
+	if shortest < claimLease-time.Second {
+		t.Fatalf("lease should be taken right before sending, only %v left", shortest)
+	}
+}